@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/auth"
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FiberAdminHandler handles admin-only requests using Fiber
+type FiberAdminHandler struct {
+	inviteRepo         *models.InviteCodeRepository
+	serviceAccountRepo *models.ServiceAccountRepository
+	planRepo           *models.PlanRepository
+	transferRepo       *models.OwnershipTransferRepository
+}
+
+// NewFiberAdminHandler creates a new FiberAdminHandler
+func NewFiberAdminHandler(database *db.DB) *FiberAdminHandler {
+	return &FiberAdminHandler{
+		inviteRepo:         models.NewInviteCodeRepository(database),
+		serviceAccountRepo: models.NewServiceAccountRepository(database),
+		planRepo:           models.NewPlanRepository(database),
+		transferRepo:       models.NewOwnershipTransferRepository(database),
+	}
+}
+
+// CreateInviteCode generates a new invite code
+func (h *FiberAdminHandler) CreateInviteCode(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var request struct {
+		MaxUses   *int       `json:"max_uses"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			logger.Error("Failed to parse request body: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request format",
+			})
+		}
+	}
+
+	// Validate fields
+	if request.MaxUses != nil && *request.MaxUses < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "max_uses must be at least 1",
+		})
+	}
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_at must be in the future",
+		})
+	}
+
+	invite := &models.InviteCode{
+		CreatedBy: &userID,
+		MaxUses:   request.MaxUses,
+		ExpiresAt: request.ExpiresAt,
+	}
+
+	if err := h.inviteRepo.Create(invite); err != nil {
+		logger.Error("Failed to create invite code: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invite code",
+		})
+	}
+
+	logger.Info("Invite code %d created by user ID: %d", invite.ID, userID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":     "Invite code created successfully",
+		"invite_code": invite,
+	})
+}
+
+// GetInviteCodes lists all invite codes with their usage
+func (h *FiberAdminHandler) GetInviteCodes(c *fiber.Ctx) error {
+	invites, err := h.inviteRepo.GetAll()
+	if err != nil {
+		logger.Error("Failed to get invite codes: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve invite codes",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"invite_codes": invites,
+	})
+}
+
+// RevokeInviteCode disables an invite code
+func (h *FiberAdminHandler) RevokeInviteCode(c *fiber.Ctx) error {
+	inviteID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invite code ID",
+		})
+	}
+
+	if err := h.inviteRepo.Revoke(inviteID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invite code not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Invite code revoked successfully",
+	})
+}
+
+// CreateServiceAccount creates a service account owned by the current admin.
+// The client secret is only returned in this response.
+func (h *FiberAdminHandler) CreateServiceAccount(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var request struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	// Validate fields
+	if request.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name is required",
+		})
+	}
+	if len(request.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one scope is required",
+		})
+	}
+	for _, scope := range request.Scopes {
+		if !auth.IsKnownScope(scope) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Unknown scope %s", scope),
+			})
+		}
+	}
+
+	account := &models.ServiceAccount{
+		Name:    request.Name,
+		OwnerID: userID,
+		Scopes:  request.Scopes,
+	}
+
+	secret, err := h.serviceAccountRepo.Create(account)
+	if err != nil {
+		logger.Error("Failed to create service account: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create service account",
+		})
+	}
+
+	logger.Info("Service account %d created by user ID: %d", account.ID, userID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":         "Service account created successfully",
+		"service_account": account,
+		"client_secret":   secret,
+	})
+}
+
+// GetServiceAccounts lists all service accounts
+func (h *FiberAdminHandler) GetServiceAccounts(c *fiber.Ctx) error {
+	accounts, err := h.serviceAccountRepo.GetAll()
+	if err != nil {
+		logger.Error("Failed to get service accounts: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve service accounts",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"service_accounts": accounts,
+	})
+}
+
+// RotateServiceAccountSecret replaces the client secret of a service account
+func (h *FiberAdminHandler) RotateServiceAccountSecret(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid service account ID",
+		})
+	}
+
+	secret, err := h.serviceAccountRepo.RotateSecret(accountID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Service account not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "Client secret rotated successfully",
+		"client_secret": secret,
+	})
+}
+
+// DisableServiceAccount prevents a service account from obtaining new tokens
+func (h *FiberAdminHandler) DisableServiceAccount(c *fiber.Ctx) error {
+	accountID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid service account ID",
+		})
+	}
+
+	if err := h.serviceAccountRepo.Disable(accountID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Service account not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Service account disabled successfully",
+	})
+}
+
+// SetOrganizationPlan assigns a plan to an organization
+func (h *FiberAdminHandler) SetOrganizationPlan(c *fiber.Ctx) error {
+	organizationID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid organization ID",
+		})
+	}
+
+	plan, err := h.requestedPlan(c)
+	if plan == nil {
+		return err
+	}
+
+	if err := h.planRepo.AssignToOrganization(organizationID, plan.Code); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Organization not found",
+		})
+	}
+
+	logger.Info("Organization ID %d moved to plan %s", organizationID, plan.Code)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Plan assigned successfully",
+		"plan":    plan,
+	})
+}
+
+// SetUserPlan assigns a plan to the personal workspace of a user
+func (h *FiberAdminHandler) SetUserPlan(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	plan, err := h.requestedPlan(c)
+	if plan == nil {
+		return err
+	}
+
+	if err := h.planRepo.AssignToUser(userID, plan.Code); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	logger.Info("User ID %d moved to plan %s", userID, plan.Code)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Plan assigned successfully",
+		"plan":    plan,
+	})
+}
+
+// TransferOwnership reassigns the tasks, service accounts and organizations
+// owned by a user to another one, typically before the first one is
+// deleted. With "dry_run" nothing changes and the response counts what
+// would be transferred.
+func (h *FiberAdminHandler) TransferOwnership(c *fiber.Ctx) error {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	fromUserID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var request struct {
+		ToUserID int  `json:"to_user_id"`
+		DryRun   bool `json:"dry_run"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	transfer, err := h.transferRepo.Transfer(fromUserID, request.ToUserID, adminID, request.DryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTransferSameUser), errors.Is(err, models.ErrTransferTargetInactive):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		case errors.Is(err, models.ErrTransferUserNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		logger.Error("Failed to transfer ownership from user ID %d to user ID %d: %v", fromUserID, request.ToUserID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to transfer ownership",
+		})
+	}
+
+	if request.DryRun {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"dry_run":  true,
+			"transfer": transfer,
+		})
+	}
+
+	logger.Info("Ownership of user ID %d transferred to user ID %d by user ID %d: %d tasks, %d service accounts, %d organizations",
+		fromUserID, request.ToUserID, adminID, transfer.Tasks, transfer.ServiceAccounts, transfer.Organizations)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Ownership transferred successfully",
+		"dry_run":  false,
+		"transfer": transfer,
+	})
+}
+
+// GetOwnershipTransfers lists the audit trail of the ownership transfers
+func (h *FiberAdminHandler) GetOwnershipTransfers(c *fiber.Ctx) error {
+	transfers, err := h.transferRepo.GetAll()
+	if err != nil {
+		logger.Error("Failed to get ownership transfers: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve ownership transfers",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"transfers": transfers,
+	})
+}
+
+// requestedPlan loads the plan named in the request body. When it returns
+// nil the error response has already been written.
+func (h *FiberAdminHandler) requestedPlan(c *fiber.Ctx) (*models.Plan, error) {
+	var request struct {
+		Plan string `json:"plan"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	plan, err := h.planRepo.GetByCode(request.Plan)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown plan",
+		})
+	}
+
+	return plan, nil
+}
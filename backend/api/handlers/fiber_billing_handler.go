@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/billing"
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FiberBillingHandler handles checkout, the customer portal and the billing
+// provider webhooks using Fiber
+type FiberBillingHandler struct {
+	provider         billing.Provider
+	config           *billing.Config
+	subscriptionRepo *models.SubscriptionRepository
+	orgRepo          *models.OrganizationRepository
+	userRepo         *models.UserRepository
+	planRepo         *models.PlanRepository
+	couponRepo       *models.CouponRepository
+}
+
+// NewFiberBillingHandler creates a new FiberBillingHandler. provider may be
+// nil when billing is disabled, the endpoints then answer 503.
+func NewFiberBillingHandler(database *db.DB, provider billing.Provider, config *billing.Config) *FiberBillingHandler {
+	return &FiberBillingHandler{
+		provider:         provider,
+		config:           config,
+		subscriptionRepo: models.NewSubscriptionRepository(database),
+		orgRepo:          models.NewOrganizationRepository(database),
+		userRepo:         models.NewUserRepository(database),
+		planRepo:         models.NewPlanRepository(database),
+		couponRepo:       models.NewCouponRepository(database),
+	}
+}
+
+// CreateCheckout starts a hosted checkout to subscribe an organization to a
+// plan, owners only. An optional coupon discounts the subscription, it is
+// redeemed once the checkout is completed.
+func (h *FiberBillingHandler) CreateCheckout(c *fiber.Ctx) error {
+	if h.provider == nil {
+		return billingDisabled(c)
+	}
+
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if org.Role != models.RoleOwner {
+		return forbiddenRole(c)
+	}
+
+	var request struct {
+		Plan   string `json:"plan"`
+		Coupon string `json:"coupon"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	priceID, ok := h.config.PriceFor(request.Plan)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "This plan cannot be purchased",
+		})
+	}
+
+	params := &billing.CheckoutParams{
+		PriceID:        priceID,
+		SuccessURL:     h.config.SuccessURL,
+		CancelURL:      h.config.CancelURL,
+		OrganizationID: strconv.Itoa(org.ID),
+		Plan:           request.Plan,
+	}
+
+	if request.Coupon != "" {
+		coupon, err := h.couponRepo.GetByCode(request.Coupon)
+		if err == nil {
+			err = coupon.Redeemable(request.Plan, time.Now())
+		}
+		if err == nil {
+			err = h.checkNotRedeemed(coupon, org.ID)
+		}
+		if err != nil {
+			return couponError(c, err)
+		}
+
+		params.CouponCode = coupon.Code
+		if params.CouponID, err = h.providerCouponID(coupon); err != nil {
+			logger.Error("Failed to create provider coupon %s: %v", coupon.Code, err)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error": "Failed to create checkout session",
+			})
+		}
+	}
+
+	params.CustomerID, err = h.customerID(c, org)
+	if err != nil {
+		logger.Error("Failed to get billing customer: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to create checkout session",
+		})
+	}
+
+	session, err := h.provider.CreateCheckoutSession(params)
+	if err != nil {
+		logger.Error("Failed to create checkout session: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to create checkout session",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"checkout": session,
+	})
+}
+
+// CreatePortal returns a link to the customer portal where owners manage
+// payment methods and cancel their subscription
+func (h *FiberBillingHandler) CreatePortal(c *fiber.Ctx) error {
+	if h.provider == nil {
+		return billingDisabled(c)
+	}
+
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if org.Role != models.RoleOwner {
+		return forbiddenRole(c)
+	}
+
+	customerID, err := h.subscriptionRepo.GetCustomerID(org.ID)
+	if err != nil {
+		logger.Error("Failed to get billing customer: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create portal session",
+		})
+	}
+	if customerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "This organization has no billing account yet",
+		})
+	}
+
+	url, err := h.provider.CreatePortalSession(customerID, h.config.PortalReturnURL)
+	if err != nil {
+		logger.Error("Failed to create portal session: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to create portal session",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"url": url,
+	})
+}
+
+// RedeemCoupon applies a coupon to the current plan of an organization,
+// owners only. The discount is applied to the provider subscription when
+// there is one, and to the invoices of the organization.
+func (h *FiberBillingHandler) RedeemCoupon(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if org.Role != models.RoleOwner {
+		return forbiddenRole(c)
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	plan, err := h.planRepo.GetByCode(org.Plan)
+	if err != nil {
+		logger.Error("Failed to get plan %s: %v", org.Plan, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to redeem coupon",
+		})
+	}
+	if plan.PriceCents == 0 || org.SubscriptionStatus == models.SubscriptionCanceled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Coupons only apply to paid subscriptions",
+		})
+	}
+
+	coupon, err := h.couponRepo.GetByCode(request.Code)
+	if err == nil {
+		err = coupon.Redeemable(plan.Code, time.Now())
+	}
+	if err != nil {
+		return couponError(c, err)
+	}
+
+	// The provider coupon is created before the redemption locks the coupon
+	var apply func(*models.Coupon) error
+	if sub, _ := h.subscriptionRepo.GetByOrganization(org.ID); h.provider != nil && sub != nil &&
+		billing.LifecycleStatus(sub.Status) != models.SubscriptionCanceled {
+		providerCouponID, err := h.providerCouponID(coupon)
+		if err != nil {
+			logger.Error("Failed to create provider coupon %s: %v", coupon.Code, err)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error": "Failed to redeem coupon",
+			})
+		}
+		apply = func(*models.Coupon) error {
+			return h.provider.ApplyCoupon(sub.ProviderSubscriptionID, providerCouponID)
+		}
+	}
+
+	userID, _ := currentUserID(c)
+	redemption := &models.CouponRedemption{
+		OrganizationID: &org.ID,
+		RedeemedBy:     &userID,
+		Plan:           plan.Code,
+		Source:         models.RedemptionSubscription,
+	}
+
+	coupon, err = h.couponRepo.Redeem(request.Code, redemption, apply)
+	if err != nil {
+		return couponError(c, err)
+	}
+
+	logger.Info("Coupon %s redeemed by organization ID %d", coupon.Code, org.ID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Coupon redeemed successfully",
+		"coupon":     coupon,
+		"redemption": redemption,
+	})
+}
+
+// GetSubscription returns the plan, lifecycle status, subscription and
+// current discount of an organization
+func (h *FiberBillingHandler) GetSubscription(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	// Organizations that never subscribed have no subscription
+	sub, _ := h.subscriptionRepo.GetByOrganization(org.ID)
+
+	var discount fiber.Map
+	coupon, redemption, err := h.couponRepo.GetActiveForOrganization(org.ID)
+	if err != nil {
+		logger.Error("Failed to get discount of organization ID %d: %v", org.ID, err)
+	} else if coupon != nil {
+		discount = fiber.Map{"coupon": coupon, "redemption": redemption}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"plan":          org.Plan,
+		"status":        org.SubscriptionStatus,
+		"trial_ends_at": org.TrialEndsAt,
+		"subscription":  sub,
+		"discount":      discount,
+	})
+}
+
+// Webhook receives the events of the billing provider. The signature is
+// verified, events are processed once and the subscription state is fetched
+// from the provider so that events delivered out of order cannot roll it back.
+func (h *FiberBillingHandler) Webhook(c *fiber.Ctx) error {
+	if h.provider == nil {
+		return billingDisabled(c)
+	}
+
+	event, err := h.provider.ParseWebhook(c.Body(), c.Get(h.config.SignatureHeader))
+	if err != nil {
+		logger.Error("Rejected billing webhook: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid webhook",
+		})
+	}
+
+	var sub *models.Subscription
+	status := ""
+
+	subscriptionID := event.SubscriptionID
+	if event.Subscription != nil {
+		subscriptionID = event.Subscription.ID
+	}
+
+	if subscriptionID != "" {
+		current, err := h.provider.GetSubscription(subscriptionID)
+		if err != nil {
+			logger.Error("Failed to fetch subscription %s: %v", subscriptionID, err)
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error": "Failed to fetch subscription",
+			})
+		}
+
+		sub, err = h.subscriptionFromProvider(current)
+		if err != nil {
+			logger.Error("Cannot apply subscription %s: %v", subscriptionID, err)
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		status = billing.LifecycleStatus(current.Status)
+	}
+
+	applied, err := h.subscriptionRepo.ApplyEvent(event.ID, event.Type, sub, status)
+	if err != nil {
+		logger.Error("Failed to apply billing event %s: %v", event.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process webhook",
+		})
+	}
+
+	if applied && sub != nil {
+		logger.Info("Subscription %s of organization ID %d is %s on plan %s",
+			sub.ProviderSubscriptionID, sub.OrganizationID, sub.Status, sub.Plan)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"received":  true,
+		"duplicate": !applied,
+	})
+}
+
+// customerID returns the billing customer of an organization, creating it on
+// first checkout
+func (h *FiberBillingHandler) customerID(c *fiber.Ctx, org *models.Organization) (string, error) {
+	customerID, err := h.subscriptionRepo.GetCustomerID(org.ID)
+	if err != nil || customerID != "" {
+		return customerID, err
+	}
+
+	userID, _ := currentUserID(c)
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return "", err
+	}
+
+	customerID, err = h.provider.CreateCustomer(user.Email, org.Name, map[string]string{
+		billing.MetadataOrganizationID: strconv.Itoa(org.ID),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := h.subscriptionRepo.SetCustomerID(org.ID, customerID); err != nil {
+		return "", err
+	}
+
+	return customerID, nil
+}
+
+// subscriptionFromProvider maps a provider subscription to its organization and plan
+func (h *FiberBillingHandler) subscriptionFromProvider(current *billing.Subscription) (*models.Subscription, error) {
+	organizationID, err := strconv.Atoi(current.Metadata[billing.MetadataOrganizationID])
+	if err != nil {
+		organizationID, err = h.subscriptionRepo.GetOrganizationByCustomer(current.CustomerID)
+		if err != nil {
+			return nil, fmt.Errorf("unknown billing customer %s", current.CustomerID)
+		}
+	}
+
+	plan, ok := h.config.PlanFor(current.PriceID)
+	if !ok {
+		plan = current.Metadata[billing.MetadataPlan]
+	}
+	if _, err := h.planRepo.GetByCode(plan); err != nil {
+		return nil, fmt.Errorf("unknown plan for price %s", current.PriceID)
+	}
+
+	sub := &models.Subscription{
+		OrganizationID:         organizationID,
+		ProviderSubscriptionID: current.ID,
+		ProviderCustomerID:     current.CustomerID,
+		Plan:                   plan,
+		Status:                 current.Status,
+		CancelAtPeriodEnd:      current.CancelAtPeriodEnd,
+		CouponCode:             current.Metadata[billing.MetadataCoupon],
+	}
+	if !current.CurrentPeriodEnd.IsZero() {
+		periodEnd := current.CurrentPeriodEnd
+		sub.CurrentPeriodEnd = &periodEnd
+	}
+
+	return sub, nil
+}
+
+// checkNotRedeemed fails with ErrCouponAlreadyRedeemed when an
+// organization already redeemed a coupon
+func (h *FiberBillingHandler) checkNotRedeemed(coupon *models.Coupon, organizationID int) error {
+	redeemed, err := h.couponRepo.HasRedeemed(coupon.ID, organizationID)
+	if err != nil {
+		return err
+	}
+	if redeemed {
+		return models.ErrCouponAlreadyRedeemed
+	}
+	return nil
+}
+
+// providerCouponID returns the provider coupon mirroring a coupon, creating
+// it on first use
+func (h *FiberBillingHandler) providerCouponID(coupon *models.Coupon) (string, error) {
+	if coupon.ProviderCouponID != "" {
+		return coupon.ProviderCouponID, nil
+	}
+
+	params := &billing.CouponParams{
+		Name:     coupon.Code,
+		Currency: h.config.Currency,
+		Duration: coupon.Duration,
+	}
+	if coupon.PercentOff != nil {
+		params.PercentOff = *coupon.PercentOff
+	}
+	if coupon.AmountOffCents != nil {
+		params.AmountOffCents = *coupon.AmountOffCents
+	}
+	if coupon.DurationMonths != nil {
+		params.DurationMonths = *coupon.DurationMonths
+	}
+
+	id, err := h.provider.CreateCoupon(params)
+	if err != nil {
+		return "", err
+	}
+
+	if err := h.couponRepo.SetProviderCouponID(coupon.ID, id); err != nil {
+		return "", err
+	}
+
+	coupon.ProviderCouponID = id
+	return id, nil
+}
+
+// couponError is the response sent when a coupon cannot be redeemed
+func couponError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, models.ErrCouponNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Coupon not found",
+		})
+	case errors.Is(err, models.ErrCouponExpired), errors.Is(err, models.ErrCouponExhausted),
+		errors.Is(err, models.ErrCouponPlanNotEligible), errors.Is(err, models.ErrCouponAlreadyRedeemed):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	logger.Error("Failed to redeem coupon: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to redeem coupon",
+	})
+}
+
+// billingDisabled is the response sent when no billing provider is configured
+func billingDisabled(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error": "Billing is not configured",
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// FiberCouponHandler handles the administration of coupons and the
+// reporting of their redemptions using Fiber
+type FiberCouponHandler struct {
+	couponRepo *models.CouponRepository
+	planRepo   *models.PlanRepository
+}
+
+// NewFiberCouponHandler creates a new FiberCouponHandler
+func NewFiberCouponHandler(database *db.DB) *FiberCouponHandler {
+	return &FiberCouponHandler{
+		couponRepo: models.NewCouponRepository(database),
+		planRepo:   models.NewPlanRepository(database),
+	}
+}
+
+// CreateCoupon defines a new coupon
+func (h *FiberCouponHandler) CreateCoupon(c *fiber.Ctx) error {
+	coupon := &models.Coupon{}
+	if err := c.BodyParser(coupon); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := coupon.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	for _, code := range coupon.PlanCodes {
+		plan, err := h.planRepo.GetByCode(code)
+		if err != nil || plan.PriceCents == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown or free plan " + code,
+			})
+		}
+	}
+
+	if err := h.couponRepo.Create(coupon); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A coupon with this code already exists",
+			})
+		}
+		logger.Error("Failed to create coupon: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create coupon",
+		})
+	}
+
+	logger.Info("Coupon %s created", coupon.Code)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Coupon created successfully",
+		"coupon":  coupon,
+	})
+}
+
+// GetCoupons lists the coupons with their redemption counts
+func (h *FiberCouponHandler) GetCoupons(c *fiber.Ctx) error {
+	coupons, err := h.couponRepo.GetAll()
+	if err != nil {
+		logger.Error("Failed to get coupons: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve coupons",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"coupons": coupons,
+	})
+}
+
+// GetCoupon reports on a coupon: its redemptions, how many still apply and
+// the discount granted on invoices
+func (h *FiberCouponHandler) GetCoupon(c *fiber.Ctx) error {
+	coupon, err := h.couponRepo.GetByCode(c.Params("code"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Coupon not found",
+		})
+	}
+
+	redemptions, report, err := h.couponRepo.GetRedemptions(coupon)
+	if err != nil {
+		logger.Error("Failed to get redemptions of coupon %s: %v", coupon.Code, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve coupon",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"coupon":      coupon,
+		"report":      report,
+		"redemptions": redemptions,
+	})
+}
+
+// ArchiveCoupon stops the redemption of a coupon, running discounts are kept
+func (h *FiberCouponHandler) ArchiveCoupon(c *fiber.Ctx) error {
+	if err := h.couponRepo.Archive(c.Params("code")); err != nil {
+		if errors.Is(err, models.ErrCouponNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Coupon not found",
+			})
+		}
+		logger.Error("Failed to archive coupon: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to archive coupon",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Coupon archived successfully",
+	})
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/flags"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// FiberFeatureFlagHandler manages feature flags and evaluates them for the
+// current user using Fiber
+type FiberFeatureFlagHandler struct {
+	flagRepo *models.FeatureFlagRepository
+	flags    *flags.Service
+}
+
+// NewFiberFeatureFlagHandler creates a new FiberFeatureFlagHandler. Changes
+// made through the admin endpoints invalidate the cache of service.
+func NewFiberFeatureFlagHandler(database *db.DB, service *flags.Service) *FiberFeatureFlagHandler {
+	return &FiberFeatureFlagHandler{
+		flagRepo: models.NewFeatureFlagRepository(database),
+		flags:    service,
+	}
+}
+
+// GetFlags returns the variant of every flag served to the current user and
+// organization, for clients that adapt their interface
+func (h *FiberFeatureFlagHandler) GetFlags(c *fiber.Ctx) error {
+	ctx := h.flags.ContextFrom(c)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"flags": h.flags.EvaluateAll(ctx),
+	})
+}
+
+// GetFeatureFlags lists every flag definition
+func (h *FiberFeatureFlagHandler) GetFeatureFlags(c *fiber.Ctx) error {
+	all, err := h.flagRepo.GetAll()
+	if err != nil {
+		logger.Error("Failed to get feature flags: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve feature flags",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"feature_flags": all,
+	})
+}
+
+// GetFeatureFlag returns a flag definition
+func (h *FiberFeatureFlagHandler) GetFeatureFlag(c *fiber.Ctx) error {
+	flag, err := h.flagRepo.GetByKey(c.Params("key"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Feature flag not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"feature_flag": flag,
+	})
+}
+
+// CreateFeatureFlag creates a flag
+func (h *FiberFeatureFlagHandler) CreateFeatureFlag(c *fiber.Ctx) error {
+	flag, err := parseFeatureFlag(c)
+	if flag == nil {
+		return err
+	}
+
+	if err := h.flagRepo.Create(flag); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "A feature flag with this key already exists",
+			})
+		}
+		logger.Error("Failed to create feature flag: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create feature flag",
+		})
+	}
+
+	h.flags.Invalidate()
+	logger.Info("Feature flag %s created", flag.Key)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"feature_flag": flag,
+	})
+}
+
+// UpdateFeatureFlag replaces the definition of a flag
+func (h *FiberFeatureFlagHandler) UpdateFeatureFlag(c *fiber.Ctx) error {
+	flag, err := parseFeatureFlag(c)
+	if flag == nil {
+		return err
+	}
+
+	if err := h.flagRepo.Update(flag); err != nil {
+		logger.Error("Failed to update feature flag %s: %v", flag.Key, err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Feature flag not found",
+		})
+	}
+
+	h.flags.Invalidate()
+	logger.Info("Feature flag %s updated", flag.Key)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"feature_flag": flag,
+	})
+}
+
+// DeleteFeatureFlag deletes a flag, it then evaluates as disabled
+func (h *FiberFeatureFlagHandler) DeleteFeatureFlag(c *fiber.Ctx) error {
+	key := c.Params("key")
+
+	if err := h.flagRepo.Delete(key); err != nil {
+		logger.Error("Failed to delete feature flag %s: %v", key, err)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Feature flag not found",
+		})
+	}
+
+	h.flags.Invalidate()
+	logger.Info("Feature flag %s deleted", key)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Feature flag deleted successfully",
+	})
+}
+
+// parseFeatureFlag reads and validates a flag definition from the request
+// body. The key of the URL, when present, wins over the body. It returns a
+// nil flag after writing the error response.
+func parseFeatureFlag(c *fiber.Ctx) (*models.FeatureFlag, error) {
+	flag := &models.FeatureFlag{}
+	if err := c.BodyParser(flag); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if key := c.Params("key"); key != "" {
+		flag.Key = key
+	}
+
+	if err := flag.Validate(); err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return flag, nil
+}
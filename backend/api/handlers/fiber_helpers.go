@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/LouisVannobel/SaaS-Template/backend/workflow"
+	"github.com/gofiber/fiber/v2"
+)
+
+// currentUserID returns the user ID set by the JWTProtected middleware
+func currentUserID(c *fiber.Ctx) (int, bool) {
+	switch v := c.Locals("userID").(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	case uint:
+		return int(v), true
+	default:
+		logger.Error("Invalid userID type: %T", v)
+		return 0, false
+	}
+}
+
+// unauthorized is the response sent when the user ID is missing from the context
+func unauthorized(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "Unauthorized: Invalid user ID",
+	})
+}
+
+// currentOrganizationID returns the organization ID set by the
+// OrganizationContext middleware
+func currentOrganizationID(c *fiber.Ctx) (int, bool) {
+	organizationID, ok := c.Locals("organizationID").(int)
+	if !ok {
+		logger.Error("Missing organization in context")
+	}
+	return organizationID, ok
+}
+
+// currentOrganizationRole returns the role of the user in the active
+// organization, set by the OrganizationContext middleware
+func currentOrganizationRole(c *fiber.Ctx) string {
+	role, _ := c.Locals("organizationRole").(string)
+	return role
+}
+
+// noOrganization is the response sent when the organization is missing from the context
+func noOrganization(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "Forbidden: No active organization",
+	})
+}
+
+// entitlementError is the response sent when a plan check fails. Exceeded
+// quotas are answered with 402 since upgrading lifts them, missing features
+// with 403. Other errors are logged and answered with failure.
+func entitlementError(c *fiber.Ctx, err error, failure string) error {
+	var entitlementErr *models.EntitlementError
+	if !errors.As(err, &entitlementErr) {
+		logger.Error("%s: %v", failure, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": failure,
+		})
+	}
+
+	if entitlementErr.Feature != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Your plan does not include this feature: " + entitlementErr.Feature,
+			"plan":    entitlementErr.Plan,
+			"feature": entitlementErr.Feature,
+		})
+	}
+
+	return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+		"error":       "Plan limit reached: " + entitlementErr.Error(),
+		"plan":        entitlementErr.Plan,
+		"entitlement": entitlementErr.Entitlement,
+		"limit":       entitlementErr.Limit,
+	})
+}
+
+// taskWriteError is the response sent when a task cannot be saved. Statuses
+// the workflow of the organization rejects are answered with 400 and the
+// statuses allowed instead, exceeded plan quotas like entitlementError,
+// other errors are logged and answered with failure.
+func taskWriteError(c *fiber.Ctx, err error, failure string) error {
+	var workflowErr *workflow.Error
+	if errors.As(err, &workflowErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":            "Invalid status: " + workflowErr.Message,
+			"allowed_statuses": workflowErr.Allowed,
+		})
+	}
+
+	var entitlementErr *models.EntitlementError
+	if errors.As(err, &entitlementErr) {
+		return entitlementError(c, err, failure)
+	}
+
+	logger.Error("%s: %v", failure, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": failure,
+	})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/mailer"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FiberInvitationHandler handles organization invitations using Fiber
+type FiberInvitationHandler struct {
+	invitationRepo *models.InvitationRepository
+	orgRepo        *models.OrganizationRepository
+	userRepo       *models.UserRepository
+	planRepo       *models.PlanRepository
+	mailer         mailer.Mailer
+	acceptURL      string
+}
+
+// NewFiberInvitationHandler creates a new FiberInvitationHandler
+func NewFiberInvitationHandler(database *db.DB, m mailer.Mailer) *FiberInvitationHandler {
+	// Page of the web app where invited users accept an invitation
+	acceptURL := os.Getenv("INVITATION_ACCEPT_URL")
+	if acceptURL == "" {
+		acceptURL = "http://localhost:5173/invitations/accept"
+	}
+
+	return &FiberInvitationHandler{
+		invitationRepo: models.NewInvitationRepository(database),
+		orgRepo:        models.NewOrganizationRepository(database),
+		userRepo:       models.NewUserRepository(database),
+		planRepo:       models.NewPlanRepository(database),
+		mailer:         m,
+		acceptURL:      acceptURL,
+	}
+}
+
+// CreateInvitation invites an email address to an organization and emails
+// the invitation link, admins and owners only
+func (h *FiberInvitationHandler) CreateInvitation(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	if org.Personal {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Personal workspaces cannot have invitations",
+		})
+	}
+
+	if err := h.planRepo.CheckFeature(org.ID, models.FeatureInvitations); err != nil {
+		return entitlementError(c, err, "Failed to create invitation")
+	}
+
+	var request struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	request.Email = strings.TrimSpace(request.Email)
+	if !strings.Contains(request.Email, "@") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A valid email is required",
+		})
+	}
+
+	if request.Role == "" {
+		request.Role = models.RoleMember
+	}
+	if ok, err := checkAssignableRole(c, org, request.Role); !ok {
+		return err
+	}
+
+	if user, _ := h.userRepo.GetByEmail(request.Email); user != nil {
+		if _, err := h.orgRepo.GetMembership(org.ID, user.ID); err == nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "User is already a member",
+			})
+		}
+	}
+
+	pending, err := h.invitationRepo.HasPending(org.ID, request.Email)
+	if err != nil {
+		logger.Error("Failed to check pending invitations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invitation",
+		})
+	}
+	if pending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "An invitation is already pending for this email",
+		})
+	}
+
+	userID, _ := currentUserID(c)
+	invitation := &models.Invitation{
+		OrganizationID:   org.ID,
+		OrganizationName: org.Name,
+		Email:            request.Email,
+		Role:             request.Role,
+		InvitedBy:        &userID,
+	}
+
+	// Pending invitations reserve a seat
+	token, err := h.invitationRepo.Create(invitation)
+	if err != nil {
+		return entitlementError(c, err, "Failed to create invitation")
+	}
+
+	if err := h.mailer.Send(h.invitationMessage(invitation, token)); err != nil {
+		logger.Error("Failed to send invitation email: %v", err)
+		if err := h.invitationRepo.Revoke(org.ID, invitation.ID); err != nil {
+			logger.Error("Failed to revoke unsent invitation: %v", err)
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to send invitation email",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":    "Invitation sent successfully",
+		"invitation": invitation,
+	})
+}
+
+// GetInvitations lists the invitations of an organization, admins and owners only
+func (h *FiberInvitationHandler) GetInvitations(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	invitations, err := h.invitationRepo.GetAllByOrganization(org.ID)
+	if err != nil {
+		logger.Error("Failed to get invitations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve invitations",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"invitations": invitations,
+	})
+}
+
+// RevokeInvitation cancels a pending invitation, admins and owners only
+func (h *FiberInvitationHandler) RevokeInvitation(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	invitationID, err := c.ParamsInt("invitationId")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invitation ID",
+		})
+	}
+
+	if err := h.invitationRepo.Revoke(org.ID, invitationID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invitation not found or no longer pending",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Invitation revoked successfully",
+	})
+}
+
+// GetInvitation shows an invitation from its token so that the web app can
+// tell the visitor which organization invited them
+func (h *FiberInvitationHandler) GetInvitation(c *fiber.Ctx) error {
+	invitation, err := h.invitationRepo.GetByToken(c.Params("token"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invitation not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"invitation": fiber.Map{
+			"organization_name": invitation.OrganizationName,
+			"email":             invitation.Email,
+			"role":              invitation.Role,
+			"status":            invitation.Status,
+			"expires_at":        invitation.ExpiresAt,
+		},
+	})
+}
+
+// AcceptInvitation adds the current user to the organization of an invitation
+func (h *FiberInvitationHandler) AcceptInvitation(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var request struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		logger.Error("Failed to get user: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to accept invitation",
+		})
+	}
+
+	invitation, err := h.invitationRepo.Accept(request.Token, user)
+	if err != nil {
+		return invitationError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Invitation accepted successfully",
+		"invitation": invitation,
+	})
+}
+
+// invitationMessage builds the email sent to an invited address
+func (h *FiberInvitationHandler) invitationMessage(invitation *models.Invitation, token string) *mailer.Message {
+	link := h.acceptURL + "?token=" + url.QueryEscape(token)
+
+	return &mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", invitation.OrganizationName),
+		Body: fmt.Sprintf(
+			"You have been invited to join %s as %s.\n\n"+
+				"Accept the invitation by opening this link:\n%s\n\n"+
+				"The invitation expires on %s. If you were not expecting it, you can ignore this email.\n",
+			invitation.OrganizationName, invitation.Role, link,
+			invitation.ExpiresAt.UTC().Format("January 2, 2006 15:04 MST"),
+		),
+	}
+}
+
+// invitationError is the response sent when an invitation cannot be accepted
+func invitationError(c *fiber.Ctx, err error) error {
+	var readOnlyErr *models.ReadOnlyError
+	if errors.As(err, &readOnlyErr) {
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":               "Organization is read-only until its overdue payment is settled",
+			"code":                "read_only",
+			"subscription_status": readOnlyErr.Status,
+		})
+	}
+
+	switch err {
+	case models.ErrInvitationInvalid:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired invitation",
+		})
+	case models.ErrInvitationEmailMismatch:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "This invitation was sent to another email address",
+		})
+	default:
+		return entitlementError(c, err, "Failed to accept invitation")
+	}
+}
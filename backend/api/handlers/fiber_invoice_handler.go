@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/invoicing"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FiberInvoiceHandler serves the invoices and billing details of
+// organizations using Fiber
+type FiberInvoiceHandler struct {
+	invoiceRepo *models.InvoiceRepository
+	orgRepo     *models.OrganizationRepository
+	storage     invoicing.Storage
+}
+
+// NewFiberInvoiceHandler creates a new FiberInvoiceHandler reading the
+// documents from storage
+func NewFiberInvoiceHandler(database *db.DB, storage invoicing.Storage) *FiberInvoiceHandler {
+	return &FiberInvoiceHandler{
+		invoiceRepo: models.NewInvoiceRepository(database),
+		orgRepo:     models.NewOrganizationRepository(database),
+		storage:     storage,
+	}
+}
+
+// GetInvoices lists the invoices of the active organization, most recent
+// first, for its owners and admins
+func (h *FiberInvoiceHandler) GetInvoices(c *fiber.Ctx) error {
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	if !models.RoleAtLeast(currentOrganizationRole(c), models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	invoices, err := h.invoiceRepo.GetForOrganization(organizationID)
+	if err != nil {
+		logger.Error("Failed to get invoices: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve invoices",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"invoices": invoices,
+	})
+}
+
+// DownloadInvoice sends an invoice of the active organization as a PDF, or
+// as HTML with ?format=html. Invoices whose documents are not stored yet
+// are rendered on the fly.
+func (h *FiberInvoiceHandler) DownloadInvoice(c *fiber.Ctx) error {
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	if !models.RoleAtLeast(currentOrganizationRole(c), models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invoice ID",
+		})
+	}
+
+	invoice, err := h.invoiceRepo.GetByID(id, organizationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invoice not found",
+		})
+	}
+
+	var content []byte
+	var contentType, extension string
+
+	switch c.Query("format", "pdf") {
+	case "pdf":
+		contentType, extension = "application/pdf", ".pdf"
+		if invoice.PDFKey != "" {
+			content, err = h.storage.Get(invoice.PDFKey)
+		} else {
+			content = invoicing.RenderPDF(invoice)
+		}
+	case "html":
+		contentType, extension = fiber.MIMETextHTMLCharsetUTF8, ".html"
+		if invoice.HTMLKey != "" {
+			content, err = h.storage.Get(invoice.HTMLKey)
+		} else {
+			content, err = invoicing.RenderHTML(invoice)
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be pdf or html",
+		})
+	}
+
+	if err != nil {
+		logger.Error("Failed to read invoice %s: %v", invoice.Number, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve invoice",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+invoice.Number+extension+`"`)
+	return c.Status(fiber.StatusOK).Send(content)
+}
+
+// GetBillingDetails returns the details printed on the invoices of an
+// organization
+func (h *FiberInvoiceHandler) GetBillingDetails(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	details, err := h.invoiceRepo.GetBillingDetails(org.ID)
+	if err != nil {
+		logger.Error("Failed to get billing details: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve billing details",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"billing_details": details,
+	})
+}
+
+// UpdateBillingDetails replaces the details printed on the next invoices of
+// an organization, owners only. Invoices already issued keep their details.
+func (h *FiberInvoiceHandler) UpdateBillingDetails(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if org.Role != models.RoleOwner {
+		return forbiddenRole(c)
+	}
+
+	details := &models.BillingDetails{}
+	if err := c.BodyParser(details); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := details.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.invoiceRepo.UpdateBillingDetails(org.ID, details); err != nil {
+		logger.Error("Failed to update billing details: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update billing details",
+		})
+	}
+
+	return h.GetBillingDetails(c)
+}
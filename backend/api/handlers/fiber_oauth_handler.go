@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/auth"
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// OAuth grant types supported by the token endpoint
+const (
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// FiberOAuthHandler implements the OAuth 2.0 device authorization grant
+// (RFC 8628), the client credentials grant used by service accounts and the
+// token endpoint
+type FiberOAuthHandler struct {
+	userRepo           *models.UserRepository
+	deviceRepo         *models.DeviceAuthorizationRepository
+	refreshRepo        *models.RefreshTokenRepository
+	serviceAccountRepo *models.ServiceAccountRepository
+	verificationURI    string
+}
+
+// NewFiberOAuthHandler creates a new FiberOAuthHandler
+func NewFiberOAuthHandler(database *db.DB) *FiberOAuthHandler {
+	// Page of the web app where users enter the code shown by the CLI
+	verificationURI := os.Getenv("DEVICE_VERIFICATION_URL")
+	if verificationURI == "" {
+		verificationURI = "http://localhost:5173/device"
+	}
+
+	return &FiberOAuthHandler{
+		userRepo:           models.NewUserRepository(database),
+		deviceRepo:         models.NewDeviceAuthorizationRepository(database),
+		refreshRepo:        models.NewRefreshTokenRepository(database),
+		serviceAccountRepo: models.NewServiceAccountRepository(database),
+		verificationURI:    verificationURI,
+	}
+}
+
+// DeviceCode starts a device authorization and returns the codes to display
+func (h *FiberOAuthHandler) DeviceCode(c *fiber.Ctx) error {
+	var request struct {
+		ClientID string `json:"client_id" form:"client_id"`
+	}
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request format")
+		}
+	}
+
+	if request.ClientID == "" {
+		request.ClientID = "cli"
+	}
+
+	authorization, deviceCode, err := h.deviceRepo.Create(request.ClientID)
+	if err != nil {
+		logger.Error("Failed to create device authorization: %v", err)
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to create device authorization")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"device_code":               deviceCode,
+		"user_code":                 authorization.UserCode,
+		"verification_uri":          h.verificationURI,
+		"verification_uri_complete": h.verificationURI + "?user_code=" + authorization.UserCode,
+		"expires_in":                int(models.DeviceCodeTTL.Seconds()),
+		"interval":                  authorization.PollInterval,
+	})
+}
+
+// GetDeviceAuthorization lets the logged-in user check which client a code
+// belongs to before approving it
+func (h *FiberOAuthHandler) GetDeviceAuthorization(c *fiber.Ctx) error {
+	authorization, err := h.deviceRepo.GetPendingByUserCode(c.Query("user_code"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invalid or expired code",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"device_authorization": fiber.Map{
+			"user_code":  authorization.UserCode,
+			"client_id":  authorization.ClientID,
+			"expires_at": authorization.ExpiresAt,
+		},
+	})
+}
+
+// ApproveDevice approves or denies a device authorization for the logged-in user
+func (h *FiberOAuthHandler) ApproveDevice(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var request struct {
+		UserCode string `json:"user_code"`
+		Approve  bool   `json:"approve"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if request.UserCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "User code is required",
+		})
+	}
+
+	if err := h.deviceRepo.Decide(request.UserCode, userID, request.Approve); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invalid or expired code",
+		})
+	}
+
+	message := "Device denied"
+	if request.Approve {
+		message = "Device approved"
+		logger.Info("Device authorization approved by user ID: %d", userID)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": message,
+	})
+}
+
+// Token is the OAuth token endpoint, it exchanges a device code or a
+// refresh token for an access/refresh token pair, and client credentials
+// for a scoped service account token
+func (h *FiberOAuthHandler) Token(c *fiber.Ctx) error {
+	var request struct {
+		GrantType    string `json:"grant_type" form:"grant_type"`
+		DeviceCode   string `json:"device_code" form:"device_code"`
+		RefreshToken string `json:"refresh_token" form:"refresh_token"`
+		ClientID     string `json:"client_id" form:"client_id"`
+		ClientSecret string `json:"client_secret" form:"client_secret"`
+		Scope        string `json:"scope" form:"scope"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_request", "Invalid request format")
+	}
+
+	if request.GrantType == GrantTypeClientCredentials {
+		// Credentials may also be sent with HTTP Basic authentication
+		if clientID, clientSecret, ok := basicAuth(c); ok {
+			request.ClientID, request.ClientSecret = clientID, clientSecret
+		}
+		return h.clientCredentials(c, request.ClientID, request.ClientSecret, request.Scope)
+	}
+
+	var userID int
+	var err error
+
+	switch request.GrantType {
+	case GrantTypeDeviceCode:
+		if request.DeviceCode == "" {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_request", "device_code is required")
+		}
+		userID, err = h.deviceRepo.Poll(request.DeviceCode)
+	case GrantTypeRefreshToken:
+		if request.RefreshToken == "" {
+			return oauthError(c, fiber.StatusBadRequest, "invalid_request", "refresh_token is required")
+		}
+		userID, err = h.refreshRepo.Consume(request.RefreshToken)
+		if err != nil {
+			err = models.ErrInvalidGrant
+		}
+	default:
+		return oauthError(c, fiber.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrAuthorizationPending):
+			return oauthError(c, fiber.StatusBadRequest, err.Error(), "The user has not approved the device yet")
+		case errors.Is(err, models.ErrSlowDown):
+			return oauthError(c, fiber.StatusBadRequest, err.Error(), "Polling too fast")
+		case errors.Is(err, models.ErrAccessDenied):
+			return oauthError(c, fiber.StatusBadRequest, err.Error(), "The user denied the device")
+		case errors.Is(err, models.ErrExpiredToken):
+			return oauthError(c, fiber.StatusBadRequest, err.Error(), "The device code has expired")
+		case errors.Is(err, models.ErrInvalidGrant):
+			return oauthError(c, fiber.StatusBadRequest, err.Error(), "Invalid grant")
+		}
+		logger.Error("Failed to process token request: %v", err)
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to process token request")
+	}
+
+	// Deactivated accounts cannot obtain new tokens
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil || !user.Active {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Account is deactivated")
+	}
+
+	return h.issueTokens(c, userID)
+}
+
+// clientCredentials issues a scoped access token to a service account.
+// No refresh token is issued, the client authenticates again instead.
+func (h *FiberOAuthHandler) clientCredentials(c *fiber.Ctx, clientID, clientSecret, scope string) error {
+	if clientID == "" || clientSecret == "" {
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	account, err := h.serviceAccountRepo.Authenticate(clientID, clientSecret)
+	if err != nil {
+		logger.Error("Client credentials rejected for %s: %v", clientID, err)
+		return oauthError(c, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	}
+
+	// The owner must still be an active admin
+	owner, err := h.userRepo.GetByID(account.OwnerID)
+	if err != nil || !owner.Active || !owner.IsAdmin {
+		return oauthError(c, fiber.StatusBadRequest, "invalid_grant", "Service account owner is no longer allowed to delegate access")
+	}
+
+	// Requested scopes must be a subset of the granted ones, all granted
+	// scopes are used when none are requested
+	scopes := account.Scopes
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		for _, s := range requested {
+			if !containsString(account.Scopes, s) {
+				return oauthError(c, fiber.StatusBadRequest, "invalid_scope", fmt.Sprintf("Scope %s is not granted to this client", s))
+			}
+		}
+		scopes = requested
+	}
+
+	accessToken, err := auth.GenerateServiceAccountToken(account.OwnerID, account.ID, account.SecretGeneration, scopes)
+	if err != nil {
+		logger.Error("Failed to generate token: %v", err)
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to generate authentication token")
+	}
+
+	logger.Info("Service account %d issued a token with scopes %v", account.ID, scopes)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(auth.ServiceAccountTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// issueTokens responds with a new access token and refresh token
+func (h *FiberOAuthHandler) issueTokens(c *fiber.Ctx, userID int) error {
+	accessToken, err := auth.GenerateToken(userID)
+	if err != nil {
+		logger.Error("Failed to generate token: %v", err)
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to generate authentication token")
+	}
+
+	refreshToken, err := h.refreshRepo.Issue(userID)
+	if err != nil {
+		logger.Error("Failed to issue refresh token: %v", err)
+		return oauthError(c, fiber.StatusInternalServerError, "server_error", "Failed to generate authentication token")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(auth.TokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+	})
+}
+
+// oauthError writes an RFC 6749 error response
+func oauthError(c *fiber.Ctx, status int, code, description string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(fiber.Map{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// basicAuth extracts client credentials from an HTTP Basic Authorization header
+func basicAuth(c *fiber.Ctx) (string, string, bool) {
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(authorization, "Basic ") {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+
+	clientID, clientSecret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	// RFC 6749 section 2.3.1 requires form-urlencoding of both parts
+	if unescaped, err := url.QueryUnescape(clientID); err == nil {
+		clientID = unescaped
+	}
+	if unescaped, err := url.QueryUnescape(clientSecret); err == nil {
+		clientSecret = unescaped
+	}
+
+	return clientID, clientSecret, true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FiberOrganizationHandler handles organization and membership requests using Fiber
+type FiberOrganizationHandler struct {
+	orgRepo  *models.OrganizationRepository
+	userRepo *models.UserRepository
+}
+
+// NewFiberOrganizationHandler creates a new FiberOrganizationHandler
+func NewFiberOrganizationHandler(database *db.DB) *FiberOrganizationHandler {
+	return &FiberOrganizationHandler{
+		orgRepo:  models.NewOrganizationRepository(database),
+		userRepo: models.NewUserRepository(database),
+	}
+}
+
+// CreateOrganization creates an organization owned by the current user
+func (h *FiberOrganizationHandler) CreateOrganization(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	var request struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if request.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name is required",
+		})
+	}
+
+	org := &models.Organization{Name: request.Name}
+	if err := h.orgRepo.Create(org, userID); err != nil {
+		logger.Error("Failed to create organization: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create organization",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":      "Organization created successfully",
+		"organization": org,
+	})
+}
+
+// GetOrganizations lists the organizations of the current user with their role
+func (h *FiberOrganizationHandler) GetOrganizations(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	orgs, err := h.orgRepo.GetAllForUser(userID)
+	if err != nil {
+		logger.Error("Failed to get organizations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve organizations",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"organizations": orgs,
+	})
+}
+
+// GetOrganization retrieves an organization the current user belongs to
+func (h *FiberOrganizationHandler) GetOrganization(c *fiber.Ctx) error {
+	org, err := h.memberOrganization(c)
+	if org == nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"organization": org,
+	})
+}
+
+// UpdateOrganization renames an organization, admins and owners only
+func (h *FiberOrganizationHandler) UpdateOrganization(c *fiber.Ctx) error {
+	org, err := h.memberOrganization(c)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	var request struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if request.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name is required",
+		})
+	}
+
+	org.Name = request.Name
+	if err := h.orgRepo.Update(org); err != nil {
+		logger.Error("Failed to update organization: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update organization",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":      "Organization updated successfully",
+		"organization": org,
+	})
+}
+
+// DeleteOrganization deletes an organization and its tasks, owners only.
+// Personal workspaces cannot be deleted.
+func (h *FiberOrganizationHandler) DeleteOrganization(c *fiber.Ctx) error {
+	org, err := h.memberOrganization(c)
+	if org == nil {
+		return err
+	}
+
+	if org.Role != models.RoleOwner {
+		return forbiddenRole(c)
+	}
+
+	if org.Personal {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Personal workspaces cannot be deleted",
+		})
+	}
+
+	if err := h.orgRepo.Delete(org.ID); err != nil {
+		logger.Error("Failed to delete organization: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete organization",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Organization deleted successfully",
+	})
+}
+
+// GetMembers lists the members of an organization
+func (h *FiberOrganizationHandler) GetMembers(c *fiber.Ctx) error {
+	org, err := h.memberOrganization(c)
+	if org == nil {
+		return err
+	}
+
+	members, err := h.orgRepo.GetMembers(org.ID)
+	if err != nil {
+		logger.Error("Failed to get members: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve members",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"members": members,
+	})
+}
+
+// AddMember adds an existing user to an organization, admins and owners only
+func (h *FiberOrganizationHandler) AddMember(c *fiber.Ctx) error {
+	org, err := h.memberOrganization(c)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	var request struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if request.Role == "" {
+		request.Role = models.RoleMember
+	}
+	if ok, err := checkAssignableRole(c, org, request.Role); !ok {
+		return err
+	}
+
+	user, err := h.userRepo.GetByEmail(request.Email)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if _, err := h.orgRepo.GetMembership(org.ID, user.ID); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User is already a member",
+		})
+	}
+
+	if err := h.orgRepo.AddMember(org.ID, user.ID, request.Role); err != nil {
+		return entitlementError(c, err, "Failed to add member")
+	}
+
+	membership, _ := h.orgRepo.GetMembership(org.ID, user.ID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Member added successfully",
+		"member":  membership,
+	})
+}
+
+// UpdateMember changes the role of a member, admins and owners only
+func (h *FiberOrganizationHandler) UpdateMember(c *fiber.Ctx) error {
+	org, err := h.memberOrganization(c)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	memberID, err := c.ParamsInt("userId")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if ok, err := checkAssignableRole(c, org, request.Role); !ok {
+		return err
+	}
+
+	membership, err := h.orgRepo.GetMembership(org.ID, memberID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Member not found",
+		})
+	}
+
+	// Only owners may change the role of another owner
+	if membership.Role == models.RoleOwner && org.Role != models.RoleOwner {
+		return forbiddenRole(c)
+	}
+
+	if membership.Role == models.RoleOwner && request.Role != models.RoleOwner {
+		if ok, err := h.checkNotLastOwner(c, org.ID); !ok {
+			return err
+		}
+	}
+
+	if err := h.orgRepo.UpdateMemberRole(org.ID, memberID, request.Role); err != nil {
+		logger.Error("Failed to update member: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update member",
+		})
+	}
+
+	membership.Role = request.Role
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Member updated successfully",
+		"member":  membership,
+	})
+}
+
+// RemoveMember removes a member from an organization. Admins and owners can
+// remove others, any member can leave.
+func (h *FiberOrganizationHandler) RemoveMember(c *fiber.Ctx) error {
+	org, err := h.memberOrganization(c)
+	if org == nil {
+		return err
+	}
+
+	userID, _ := currentUserID(c)
+
+	memberID, err := c.ParamsInt("userId")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if memberID != userID && !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	membership, err := h.orgRepo.GetMembership(org.ID, memberID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Member not found",
+		})
+	}
+
+	if membership.Role == models.RoleOwner {
+		if org.Role != models.RoleOwner {
+			return forbiddenRole(c)
+		}
+		if ok, err := h.checkNotLastOwner(c, org.ID); !ok {
+			return err
+		}
+	}
+
+	if err := h.orgRepo.RemoveMember(org.ID, memberID); err != nil {
+		logger.Error("Failed to remove member: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to remove member",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Member removed successfully",
+	})
+}
+
+// memberOrganization loads the organization of the :id parameter with the
+// current user's role. When it returns nil the error response has already
+// been written and the handler must return the error as is.
+func (h *FiberOrganizationHandler) memberOrganization(c *fiber.Ctx) (*models.Organization, error) {
+	return loadMemberOrganization(c, h.orgRepo)
+}
+
+// loadMemberOrganization implements memberOrganization for handlers of
+// organization sub-resources
+func loadMemberOrganization(c *fiber.Ctx, orgRepo *models.OrganizationRepository) (*models.Organization, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, unauthorized(c)
+	}
+
+	organizationID, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid organization ID",
+		})
+	}
+
+	org, err := orgRepo.GetByID(organizationID, userID)
+	if err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Organization not found",
+		})
+	}
+
+	return org, nil
+}
+
+// checkAssignableRole validates a role and checks the current user may grant
+// it. When it returns false the error response has already been written.
+func checkAssignableRole(c *fiber.Ctx, org *models.Organization, role string) (bool, error) {
+	if !models.IsValidRole(role) {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be owner, admin or member",
+		})
+	}
+
+	if role == models.RoleOwner && org.Role != models.RoleOwner {
+		return false, forbiddenRole(c)
+	}
+
+	return true, nil
+}
+
+// checkNotLastOwner prevents leaving an organization without an owner. When
+// it returns false the error response has already been written.
+func (h *FiberOrganizationHandler) checkNotLastOwner(c *fiber.Ctx, organizationID int) (bool, error) {
+	owners, err := h.orgRepo.CountOwners(organizationID)
+	if err != nil {
+		logger.Error("Failed to count owners: %v", err)
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update member",
+		})
+	}
+
+	if owners <= 1 {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "An organization must keep at least one owner",
+		})
+	}
+
+	return true, nil
+}
+
+func forbiddenRole(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "Forbidden: Insufficient role in this organization",
+	})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FiberPlanHandler exposes subscription plans and their entitlements using Fiber
+type FiberPlanHandler struct {
+	planRepo *models.PlanRepository
+	orgRepo  *models.OrganizationRepository
+}
+
+// NewFiberPlanHandler creates a new FiberPlanHandler
+func NewFiberPlanHandler(database *db.DB) *FiberPlanHandler {
+	return &FiberPlanHandler{
+		planRepo: models.NewPlanRepository(database),
+		orgRepo:  models.NewOrganizationRepository(database),
+	}
+}
+
+// GetPlans lists the available plans
+func (h *FiberPlanHandler) GetPlans(c *fiber.Ctx) error {
+	plans, err := h.planRepo.GetAll()
+	if err != nil {
+		logger.Error("Failed to get plans: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve plans",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"plans": plans,
+	})
+}
+
+// GetOrganizationPlan returns the plan of an organization with its current usage
+func (h *FiberPlanHandler) GetOrganizationPlan(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	plan, err := h.planRepo.GetForOrganization(org.ID)
+	if err != nil {
+		logger.Error("Failed to get organization plan: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve plan",
+		})
+	}
+
+	usage, err := h.planRepo.GetUsage(org.ID)
+	if err != nil {
+		logger.Error("Failed to get organization usage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve plan",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"plan":  plan,
+		"usage": usage,
+	})
+}
@@ -0,0 +1,501 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/scim"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// scimUserColumns maps filterable SCIM user attributes to SQL columns
+var scimUserColumns = map[string]scim.Column{
+	"id":                {Name: "id", Type: scim.TypeInteger},
+	"userName":          {Name: "email", Type: scim.TypeString},
+	"emails":            {Name: "email", Type: scim.TypeString},
+	"emails.value":      {Name: "email", Type: scim.TypeString},
+	"externalId":        {Name: "external_id", Type: scim.TypeString},
+	"active":            {Name: "active", Type: scim.TypeBoolean},
+	"displayName":       {Name: "name", Type: scim.TypeString},
+	"name.formatted":    {Name: "name", Type: scim.TypeString},
+	"meta.created":      {Name: "created_at", Type: scim.TypeDateTime},
+	"meta.lastModified": {Name: "updated_at", Type: scim.TypeDateTime},
+}
+
+// scimGroupColumns maps filterable SCIM group attributes to SQL columns
+var scimGroupColumns = map[string]scim.Column{
+	"id":                {Name: "id", Type: scim.TypeInteger},
+	"displayName":       {Name: "display_name", Type: scim.TypeString},
+	"externalId":        {Name: "external_id", Type: scim.TypeString},
+	"meta.created":      {Name: "created_at", Type: scim.TypeDateTime},
+	"meta.lastModified": {Name: "updated_at", Type: scim.TypeDateTime},
+}
+
+// FiberScimHandler implements the SCIM 2.0 Users and Groups endpoints
+type FiberScimHandler struct {
+	userRepo  *models.UserRepository
+	groupRepo *models.ScimGroupRepository
+}
+
+// NewFiberScimHandler creates a new FiberScimHandler
+func NewFiberScimHandler(database *db.DB) *FiberScimHandler {
+	return &FiberScimHandler{
+		userRepo:  models.NewUserRepository(database),
+		groupRepo: models.NewScimGroupRepository(database),
+	}
+}
+
+// ListUsers returns the users provisioned by the tenant, filtered and paginated
+func (h *FiberScimHandler) ListUsers(c *fiber.Ctx) error {
+	tenant := c.Locals("scimTenant").(string)
+
+	where, args, err := scimWhere(c.Query("filter"), scimUserColumns, 2)
+	if err != nil {
+		return scimFail(c, err)
+	}
+	where = "scim_tenant = $1" + where
+	args = append([]interface{}{tenant}, args...)
+
+	startIndex, count := scim.Pagination(c.QueryInt("startIndex", 1), c.QueryInt("count", scim.DefaultCount))
+
+	users, total, err := h.userRepo.Search(where, args, startIndex-1, count)
+	if err != nil {
+		logger.Error("Failed to list SCIM users: %v", err)
+		return scimFail(c, err)
+	}
+
+	resources := []*scim.User{}
+	for _, user := range users {
+		resources = append(resources, h.toScimUser(c, user))
+	}
+
+	return scimJSON(c, fiber.StatusOK, scim.NewListResponse(resources, total, startIndex, len(resources)))
+}
+
+// GetUser returns a single provisioned user
+func (h *FiberScimHandler) GetUser(c *fiber.Ctx) error {
+	user, err := h.tenantUser(c, c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusOK, h.toScimUser(c, user))
+}
+
+// CreateUser provisions a new user
+func (h *FiberScimHandler) CreateUser(c *fiber.Ctx) error {
+	tenant := c.Locals("scimTenant").(string)
+
+	var resource scim.User
+	if err := json.Unmarshal(c.Body(), &resource); err != nil {
+		return scimFail(c, scim.NewError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request format"))
+	}
+
+	if resource.UserName == "" {
+		return scimFail(c, scim.NewError(fiber.StatusBadRequest, "invalidValue", "userName is required"))
+	}
+
+	// Identity providers usually do not send a password, the user then
+	// cannot log in with credentials until one is set
+	password := models.UnusablePassword
+	if resource.Password != "" {
+		hashedPassword, err := models.HashPassword(resource.Password)
+		if err != nil {
+			logger.Error("Failed to hash password: %v", err)
+			return scimFail(c, err)
+		}
+		password = hashedPassword
+	}
+
+	user := &models.User{
+		Password:   password,
+		Active:     true,
+		ScimTenant: &tenant,
+	}
+	applyScimUser(user, &resource)
+
+	if _, err := h.userRepo.CreateWithPersonalOrganization(user); err != nil {
+		logger.Error("Failed to provision user: %v", err)
+		return scimFail(c, err)
+	}
+
+	logger.Info("SCIM tenant %s provisioned user ID: %d", tenant, user.ID)
+
+	return scimJSON(c, fiber.StatusCreated, h.toScimUser(c, user))
+}
+
+// ReplaceUser replaces all the attributes of a provisioned user
+func (h *FiberScimHandler) ReplaceUser(c *fiber.Ctx) error {
+	user, err := h.tenantUser(c, c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	var resource scim.User
+	if err := json.Unmarshal(c.Body(), &resource); err != nil {
+		return scimFail(c, scim.NewError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request format"))
+	}
+
+	if resource.UserName == "" {
+		return scimFail(c, scim.NewError(fiber.StatusBadRequest, "invalidValue", "userName is required"))
+	}
+
+	applyScimUser(user, &resource)
+
+	if err := h.userRepo.UpdateIdentity(user); err != nil {
+		logger.Error("Failed to replace SCIM user: %v", err)
+		return scimFail(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusOK, h.toScimUser(c, user))
+}
+
+// PatchUser applies a PatchOp request to a provisioned user
+func (h *FiberScimHandler) PatchUser(c *fiber.Ctx) error {
+	user, err := h.tenantUser(c, c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	var patch scim.PatchRequest
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
+		return scimFail(c, scim.NewError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request format"))
+	}
+
+	resource := h.toScimUser(c, user)
+	if err := resource.ApplyPatch(patch.Operations); err != nil {
+		return scimFail(c, err)
+	}
+	applyScimUser(user, resource)
+
+	if err := h.userRepo.UpdateIdentity(user); err != nil {
+		logger.Error("Failed to patch SCIM user: %v", err)
+		return scimFail(c, err)
+	}
+
+	if !user.Active {
+		logger.Info("SCIM tenant %s deactivated user ID: %d", *user.ScimTenant, user.ID)
+	}
+
+	return scimJSON(c, fiber.StatusOK, h.toScimUser(c, user))
+}
+
+// DeleteUser deactivates a provisioned user. The account and its tasks are
+// kept so that it can be reactivated, but the user can no longer log in.
+func (h *FiberScimHandler) DeleteUser(c *fiber.Ctx) error {
+	user, err := h.tenantUser(c, c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	if err := h.userRepo.SetActive(user.ID, false); err != nil {
+		logger.Error("Failed to deactivate SCIM user: %v", err)
+		return scimFail(c, err)
+	}
+
+	logger.Info("SCIM tenant %s deactivated user ID: %d", *user.ScimTenant, user.ID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListGroups returns the groups of the tenant, filtered and paginated
+func (h *FiberScimHandler) ListGroups(c *fiber.Ctx) error {
+	tenant := c.Locals("scimTenant").(string)
+
+	where, args, err := scimWhere(c.Query("filter"), scimGroupColumns, 2)
+	if err != nil {
+		return scimFail(c, err)
+	}
+	where = strings.TrimPrefix(where, " AND ")
+
+	startIndex, count := scim.Pagination(c.QueryInt("startIndex", 1), c.QueryInt("count", scim.DefaultCount))
+
+	groups, total, err := h.groupRepo.Search(tenant, where, args, startIndex-1, count)
+	if err != nil {
+		logger.Error("Failed to list SCIM groups: %v", err)
+		return scimFail(c, err)
+	}
+
+	resources := []*scim.Group{}
+	for _, group := range groups {
+		resources = append(resources, h.toScimGroup(c, group))
+	}
+
+	return scimJSON(c, fiber.StatusOK, scim.NewListResponse(resources, total, startIndex, len(resources)))
+}
+
+// GetGroup returns a single group
+func (h *FiberScimHandler) GetGroup(c *fiber.Ctx) error {
+	group, err := h.tenantGroup(c, c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusOK, h.toScimGroup(c, group))
+}
+
+// CreateGroup creates a group
+func (h *FiberScimHandler) CreateGroup(c *fiber.Ctx) error {
+	tenant := c.Locals("scimTenant").(string)
+
+	var resource scim.Group
+	if err := json.Unmarshal(c.Body(), &resource); err != nil {
+		return scimFail(c, scim.NewError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request format"))
+	}
+
+	group := &models.ScimGroup{Tenant: tenant}
+	if err := h.applyScimGroup(group, &resource); err != nil {
+		return scimFail(c, err)
+	}
+
+	if err := h.groupRepo.Create(group); err != nil {
+		logger.Error("Failed to create SCIM group: %v", err)
+		return scimFail(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusCreated, h.toScimGroup(c, group))
+}
+
+// ReplaceGroup replaces the attributes and members of a group
+func (h *FiberScimHandler) ReplaceGroup(c *fiber.Ctx) error {
+	group, err := h.tenantGroup(c, c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	var resource scim.Group
+	if err := json.Unmarshal(c.Body(), &resource); err != nil {
+		return scimFail(c, scim.NewError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request format"))
+	}
+
+	if err := h.applyScimGroup(group, &resource); err != nil {
+		return scimFail(c, err)
+	}
+
+	if err := h.groupRepo.Update(group); err != nil {
+		logger.Error("Failed to replace SCIM group: %v", err)
+		return scimFail(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusOK, h.toScimGroup(c, group))
+}
+
+// PatchGroup applies a PatchOp request to a group
+func (h *FiberScimHandler) PatchGroup(c *fiber.Ctx) error {
+	group, err := h.tenantGroup(c, c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	var patch scim.PatchRequest
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
+		return scimFail(c, scim.NewError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request format"))
+	}
+
+	resource := h.toScimGroup(c, group)
+	if err := resource.ApplyPatch(patch.Operations); err != nil {
+		return scimFail(c, err)
+	}
+
+	if err := h.applyScimGroup(group, resource); err != nil {
+		return scimFail(c, err)
+	}
+
+	if err := h.groupRepo.Update(group); err != nil {
+		logger.Error("Failed to patch SCIM group: %v", err)
+		return scimFail(c, err)
+	}
+
+	return scimJSON(c, fiber.StatusOK, h.toScimGroup(c, group))
+}
+
+// DeleteGroup removes a group, its members are left untouched
+func (h *FiberScimHandler) DeleteGroup(c *fiber.Ctx) error {
+	group, err := h.tenantGroup(c, c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	if err := h.groupRepo.Delete(group.ID, group.Tenant); err != nil {
+		logger.Error("Failed to delete SCIM group: %v", err)
+		return scimFail(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// tenantUser loads a user provisioned by the tenant of the request
+func (h *FiberScimHandler) tenantUser(c *fiber.Ctx, rawID string) (*models.User, error) {
+	tenant := c.Locals("scimTenant").(string)
+
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return nil, scim.NewError(fiber.StatusNotFound, "", "User not found")
+	}
+
+	user, err := h.userRepo.GetByID(id)
+	if err != nil || user.ScimTenant == nil || *user.ScimTenant != tenant {
+		return nil, scim.NewError(fiber.StatusNotFound, "", "User not found")
+	}
+
+	return user, nil
+}
+
+// tenantGroup loads a group of the tenant of the request
+func (h *FiberScimHandler) tenantGroup(c *fiber.Ctx, rawID string) (*models.ScimGroup, error) {
+	tenant := c.Locals("scimTenant").(string)
+
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return nil, scim.NewError(fiber.StatusNotFound, "", "Group not found")
+	}
+
+	group, err := h.groupRepo.GetByID(id, tenant)
+	if err != nil {
+		return nil, scim.NewError(fiber.StatusNotFound, "", "Group not found")
+	}
+
+	return group, nil
+}
+
+// applyScimGroup copies a SCIM group onto the model, members must be users
+// provisioned by the same tenant
+func (h *FiberScimHandler) applyScimGroup(group *models.ScimGroup, resource *scim.Group) error {
+	if resource.DisplayName == "" {
+		return scim.NewError(fiber.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+
+	memberIDs := []int{}
+	for _, member := range resource.Members {
+		id, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return scim.NewError(fiber.StatusBadRequest, "invalidValue", fmt.Sprintf("Unknown member %q", member.Value))
+		}
+
+		user, err := h.userRepo.GetByID(id)
+		if err != nil || user.ScimTenant == nil || *user.ScimTenant != group.Tenant {
+			return scim.NewError(fiber.StatusBadRequest, "invalidValue", fmt.Sprintf("Unknown member %q", member.Value))
+		}
+
+		memberIDs = append(memberIDs, id)
+	}
+
+	group.DisplayName = resource.DisplayName
+	group.ExternalID = optionalString(resource.ExternalID)
+	group.MemberIDs = memberIDs
+
+	return nil
+}
+
+func (h *FiberScimHandler) toScimUser(c *fiber.Ctx, user *models.User) *scim.User {
+	active := user.Active
+	resource := &scim.User{
+		Schemas:     []string{scim.UserSchema},
+		ID:          strconv.Itoa(user.ID),
+		UserName:    user.Email,
+		Name:        &scim.Name{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []scim.Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     c.BaseURL() + "/scim/v2/Users/" + strconv.Itoa(user.ID),
+		},
+	}
+	if user.ExternalID != nil {
+		resource.ExternalID = *user.ExternalID
+	}
+
+	return resource
+}
+
+func (h *FiberScimHandler) toScimGroup(c *fiber.Ctx, group *models.ScimGroup) *scim.Group {
+	resource := &scim.Group{
+		Schemas:     []string{scim.GroupSchema},
+		ID:          strconv.Itoa(group.ID),
+		DisplayName: group.DisplayName,
+		Members:     []scim.Member{},
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     c.BaseURL() + "/scim/v2/Groups/" + strconv.Itoa(group.ID),
+		},
+	}
+	if group.ExternalID != nil {
+		resource.ExternalID = *group.ExternalID
+	}
+
+	for _, id := range group.MemberIDs {
+		resource.Members = append(resource.Members, scim.Member{
+			Value: strconv.Itoa(id),
+			Ref:   c.BaseURL() + "/scim/v2/Users/" + strconv.Itoa(id),
+		})
+	}
+
+	return resource
+}
+
+// applyScimUser copies the SCIM attributes we store onto the user model
+func applyScimUser(user *models.User, resource *scim.User) {
+	user.Email = resource.UserName
+	user.Name = resource.FormattedName()
+	user.ExternalID = optionalString(resource.ExternalID)
+	if resource.Active != nil {
+		user.Active = *resource.Active
+	}
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// scimWhere parses a SCIM filter into a WHERE fragment prefixed with " AND "
+func scimWhere(rawFilter string, columns map[string]scim.Column, firstArg int) (string, []interface{}, error) {
+	if rawFilter == "" {
+		return "", nil, nil
+	}
+
+	filter, err := scim.ParseFilter(rawFilter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	where, args, err := filter.SQL(columns, firstArg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return " AND " + where, args, nil
+}
+
+func scimJSON(c *fiber.Ctx, status int, body interface{}) error {
+	return c.Status(status).JSON(body, scim.ContentType)
+}
+
+// scimFail writes err as a SCIM error response
+func scimFail(c *fiber.Ctx, err error) error {
+	var scimErr *scim.Error
+	if errors.As(err, &scimErr) {
+		return scimJSON(c, scimErr.Code(), scimErr)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return scimJSON(c, fiber.StatusConflict, scim.NewError(fiber.StatusConflict, "uniqueness", "Resource already exists"))
+	}
+
+	return scimJSON(c, fiber.StatusInternalServerError, scim.NewError(fiber.StatusInternalServerError, "", "Internal server error"))
+}
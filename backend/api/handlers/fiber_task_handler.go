@@ -1,23 +1,37 @@
 package handlers
 
 import (
+	"errors"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/LouisVannobel/SaaS-Template/backend/db"
 	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/tasklist"
 	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
 	"github.com/gofiber/fiber/v2"
 )
 
 // FiberTaskHandler handles task-related requests using Fiber
 type FiberTaskHandler struct {
-	taskRepo *models.TaskRepository
+	taskRepo  *models.TaskRepository
+	usageRepo *models.UsageCounterRepository
+	teamRepo  *models.TeamRepository
+	// requireIfMatch rejects writes without an If-Match header
+	requireIfMatch bool
 }
 
 // NewFiberTaskHandler creates a new FiberTaskHandler
 func NewFiberTaskHandler(database *db.DB) *FiberTaskHandler {
+	// Writes are conditional on the If-Match header when TASKS_REQUIRE_IF_MATCH is true
+	requireIfMatch, _ := strconv.ParseBool(os.Getenv("TASKS_REQUIRE_IF_MATCH"))
+
 	return &FiberTaskHandler{
-		taskRepo: models.NewTaskRepository(database),
+		taskRepo:       models.NewTaskRepository(database),
+		usageRepo:      models.NewUsageCounterRepository(database),
+		teamRepo:       models.NewTeamRepository(database),
+		requireIfMatch: requireIfMatch,
 	}
 }
 
@@ -43,6 +57,12 @@ func (h *FiberTaskHandler) CreateTask(c *fiber.Ctx) error {
 		})
 	}
 
+	// Get organization ID from context (set by OrganizationContext middleware)
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
 	// Parse request body
 	var task models.Task
 	if err := c.BodyParser(&task); err != nil {
@@ -59,25 +79,32 @@ func (h *FiberTaskHandler) CreateTask(c *fiber.Ctx) error {
 		})
 	}
 
-	// Set user ID
+	// Set user ID and organization ID
 	task.UserID = userID
+	task.OrganizationID = organizationID
+
+	// Validate who can see the task
+	if ok, err := checkTaskPlacement(c, h.teamRepo, &task, userID); !ok {
+		return err
+	}
 
 	// Save task to database
 	if err := h.taskRepo.Create(&task); err != nil {
-		logger.Error("Failed to create task: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create task",
-		})
+		return taskWriteError(c, err, "Failed to create task")
 	}
 
+	meterTaskWrite(h.usageRepo, organizationID, true)
+
 	// Return success response
+	c.Set(fiber.HeaderETag, taskETag(&task))
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Task created successfully",
 		"task":    task,
 	})
 }
 
-// GetAllTasks retrieves all tasks for the authenticated user
+// GetAllTasks retrieves a page of the tasks of the authenticated user, see
+// tasklist.Parse for the filters, sort and pagination parameters
 func (h *FiberTaskHandler) GetAllTasks(c *fiber.Ctx) error {
 	// Get user ID from context (set by JWTProtected middleware)
 	userIDValue := c.Locals("userID")
@@ -99,8 +126,22 @@ func (h *FiberTaskHandler) GetAllTasks(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get tasks from database
-	tasks, err := h.taskRepo.GetAllByUserID(userID)
+	// Get organization ID from context (set by OrganizationContext middleware)
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	// Parse filters, sort and cursor from the query string
+	query, err := tasklist.Parse(func(key string) string { return c.Query(key) })
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Get a page of tasks from database
+	page, err := h.taskRepo.List(userID, organizationID, query)
 	if err != nil {
 		logger.Error("Failed to get tasks: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -108,9 +149,53 @@ func (h *FiberTaskHandler) GetAllTasks(c *fiber.Ctx) error {
 		})
 	}
 
-	// Return tasks
+	// Return tasks, with the cursor of the next page unless this is the last one
+	response := fiber.Map{
+		"tasks": page.Tasks,
+	}
+	if page.NextCursor != "" {
+		response["next_cursor"] = page.NextCursor
+	}
+	if page.Total != nil {
+		response["total"] = *page.Total
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// SearchTasks retrieves the tasks of the authenticated user matching a
+// full-text search, see tasklist.ParseSearch for the parameters
+func (h *FiberTaskHandler) SearchTasks(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid user ID",
+		})
+	}
+
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	search, err := tasklist.ParseSearch(func(key string) string { return c.Query(key) })
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	results, err := h.taskRepo.Search(userID, organizationID, search)
+	if err != nil {
+		logger.Error("Failed to search tasks: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to search tasks",
+		})
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"tasks": tasks,
+		"results": results,
+		"limit":   search.Limit,
+		"offset":  search.Offset,
 	})
 }
 
@@ -136,6 +221,12 @@ func (h *FiberTaskHandler) GetTask(c *fiber.Ctx) error {
 		})
 	}
 
+	// Get organization ID from context (set by OrganizationContext middleware)
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
 	// Get task ID from URL parameter
 	taskIDStr := c.Params("id")
 	taskID, err := strconv.ParseUint(taskIDStr, 10, 32)
@@ -146,16 +237,20 @@ func (h *FiberTaskHandler) GetTask(c *fiber.Ctx) error {
 	}
 
 	// Get task from database
-	task, err := h.taskRepo.GetByID(int(taskID), userID)
+	task, err := h.taskRepo.GetByID(int(taskID), userID, organizationID)
 	if err != nil || task == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Task not found",
 		})
 	}
 
-	// The task belongs to the authenticated user (already checked in GetByID)
+	// The task belongs to the user's organization (already checked in GetByID)
 
-	// Return task
+	// Return task, or 304 when the client already has this version
+	c.Set(fiber.HeaderETag, taskETag(task))
+	if matchesETag(c.Get(fiber.HeaderIfNoneMatch), task) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"task": task,
 	})
@@ -183,6 +278,12 @@ func (h *FiberTaskHandler) UpdateTask(c *fiber.Ctx) error {
 		})
 	}
 
+	// Get organization ID from context (set by OrganizationContext middleware)
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
 	// Get task ID from URL parameter
 	taskIDStr := c.Params("id")
 	taskID, err := strconv.ParseUint(taskIDStr, 10, 32)
@@ -193,14 +294,19 @@ func (h *FiberTaskHandler) UpdateTask(c *fiber.Ctx) error {
 	}
 
 	// Get existing task from database
-	existingTask, err := h.taskRepo.GetByID(int(taskID), userID)
+	existingTask, err := h.taskRepo.GetByID(int(taskID), userID, organizationID)
 	if err != nil || existingTask == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Task not found",
 		})
 	}
 
-	// The task belongs to the authenticated user (already checked in GetByID)
+	// The task belongs to the user's organization (already checked in GetByID)
+
+	// Check the client edited the current version
+	if ok, err := h.checkIfMatch(c, existingTask); !ok {
+		return err
+	}
 
 	// Parse request body
 	var updatedTask models.Task
@@ -222,23 +328,87 @@ func (h *FiberTaskHandler) UpdateTask(c *fiber.Ctx) error {
 	existingTask.Title = updatedTask.Title
 	existingTask.Description = updatedTask.Description
 	existingTask.Status = updatedTask.Status
+	existingTask.DueDate = updatedTask.DueDate
 
 	// Save updated task to database
-	if err := h.taskRepo.Update(existingTask); err != nil {
-		logger.Error("Failed to update task: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update task",
-		})
+	if err := h.taskRepo.Update(existingTask, userID); err != nil {
+		return h.saveError(c, err, existingTask.ID, userID, organizationID, "Failed to update task")
 	}
 
+	meterTaskWrite(h.usageRepo, existingTask.OrganizationID, false)
+
 	// Return success response
+	c.Set(fiber.HeaderETag, taskETag(existingTask))
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Task updated successfully",
 		"task":    existingTask,
 	})
 }
 
-// DeleteTask deletes a specific task by ID
+// PatchTask applies an RFC 7396 JSON merge patch to a specific task by ID,
+// updating only the fields whose value changes
+func (h *FiberTaskHandler) PatchTask(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid user ID",
+		})
+	}
+
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	taskID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid task ID",
+		})
+	}
+
+	contentType := strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0])
+	if contentType != "application/merge-patch+json" && contentType != fiber.MIMEApplicationJSON {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Content-Type must be application/merge-patch+json",
+		})
+	}
+
+	task, err := h.taskRepo.GetByID(taskID, userID, organizationID)
+	if err != nil || task == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Task not found",
+		})
+	}
+
+	if ok, err := h.checkIfMatch(c, task); !ok {
+		return err
+	}
+
+	changed, err := task.ApplyMergePatch(c.Body())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid patch: " + err.Error(),
+		})
+	}
+
+	if len(changed) > 0 {
+		if err := h.taskRepo.UpdateFields(task, userID, changed); err != nil {
+			return h.saveError(c, err, task.ID, userID, organizationID, "Failed to update task")
+		}
+
+		meterTaskWrite(h.usageRepo, task.OrganizationID, false)
+	}
+
+	c.Set(fiber.HeaderETag, taskETag(task))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Task updated successfully",
+		"task":    task,
+		"changed": changed,
+	})
+}
+
+// DeleteTask moves a specific task by ID to the trash
 func (h *FiberTaskHandler) DeleteTask(c *fiber.Ctx) error {
 	// Get user ID from context (set by JWTProtected middleware)
 	userIDValue := c.Locals("userID")
@@ -260,6 +430,12 @@ func (h *FiberTaskHandler) DeleteTask(c *fiber.Ctx) error {
 		})
 	}
 
+	// Get organization ID from context (set by OrganizationContext middleware)
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
 	// Get task ID from URL parameter
 	taskIDStr := c.Params("id")
 	taskID, err := strconv.ParseUint(taskIDStr, 10, 32)
@@ -270,25 +446,380 @@ func (h *FiberTaskHandler) DeleteTask(c *fiber.Ctx) error {
 	}
 
 	// Get existing task from database
-	existingTask, err := h.taskRepo.GetByID(int(taskID), userID)
+	existingTask, err := h.taskRepo.GetByID(int(taskID), userID, organizationID)
 	if err != nil || existingTask == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Task not found",
 		})
 	}
 
-	// The task belongs to the authenticated user (already checked in GetByID)
+	// The task belongs to the user's organization (already checked in GetByID)
+
+	// Check the client deletes the version it has seen
+	if ok, err := h.checkIfMatch(c, existingTask); !ok {
+		return err
+	}
 
 	// Delete task from database
-	if err := h.taskRepo.Delete(int(taskID), userID); err != nil {
-		logger.Error("Failed to delete task: %v", err)
+	if err := h.taskRepo.Delete(int(taskID), userID, organizationID, existingTask.Version); err != nil {
+		return h.saveError(c, err, existingTask.ID, userID, organizationID, "Failed to delete task")
+	}
+
+	// Return success response, the task can be restored from the trash
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Task moved to the trash",
+	})
+}
+
+// MoveTask changes the visibility and the team of a specific task by ID
+func (h *FiberTaskHandler) MoveTask(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid user ID",
+		})
+	}
+
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	taskID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid task ID",
+		})
+	}
+
+	task, err := h.taskRepo.GetByID(taskID, userID, organizationID)
+	if err != nil || task == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Task not found",
+		})
+	}
+
+	if ok, err := h.checkIfMatch(c, task); !ok {
+		return err
+	}
+
+	var request struct {
+		Visibility string `json:"visibility"`
+		TeamID     *int   `json:"team_id"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	task.Visibility = request.Visibility
+	task.TeamID = request.TeamID
+	if ok, err := checkTaskPlacement(c, h.teamRepo, task, userID); !ok {
+		return err
+	}
+
+	if err := h.taskRepo.Move(task, userID); err != nil {
+		return h.saveError(c, err, task.ID, userID, organizationID, "Failed to move task")
+	}
+
+	c.Set(fiber.HeaderETag, taskETag(task))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Task moved successfully",
+		"task":    task,
+	})
+}
+
+// GetTrash retrieves the deleted tasks of the authenticated user that can
+// still be restored
+func (h *FiberTaskHandler) GetTrash(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid user ID",
+		})
+	}
+
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	tasks, err := h.taskRepo.GetTrash(userID, organizationID)
+	if err != nil {
+		logger.Error("Failed to get trash: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete task",
+			"error": "Failed to retrieve trash",
 		})
 	}
 
-	// Return success response
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Task deleted successfully",
+		"tasks": tasks,
+	})
+}
+
+// RestoreTask takes a specific task by ID out of the trash
+func (h *FiberTaskHandler) RestoreTask(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid user ID",
+		})
+	}
+
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	taskID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid task ID",
+		})
+	}
+
+	task, err := h.taskRepo.Restore(taskID, userID, organizationID)
+	if err != nil {
+		return trashError(c, err, "Failed to restore task")
+	}
+
+	c.Set(fiber.HeaderETag, taskETag(task))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Task restored successfully",
+		"task":    task,
+	})
+}
+
+// DeleteTaskPermanently removes a specific task by ID from the trash
+func (h *FiberTaskHandler) DeleteTaskPermanently(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid user ID",
+		})
+	}
+
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	taskID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid task ID",
+		})
+	}
+
+	if err := h.taskRepo.DeletePermanently(taskID, userID, organizationID); err != nil {
+		return trashError(c, err, "Failed to delete task")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Task deleted permanently",
+	})
+}
+
+// GetTaskHistory retrieves the change log of a specific task by ID, latest
+// version first. Tasks in the trash keep their history.
+func (h *FiberTaskHandler) GetTaskHistory(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid user ID",
+		})
+	}
+
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	taskID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid task ID",
+		})
+	}
+
+	history, err := h.taskRepo.GetHistory(taskID, userID, organizationID)
+	if err != nil {
+		if errors.Is(err, models.ErrTaskNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Task not found",
+			})
+		}
+		logger.Error("Failed to get history of task ID %d: %v", taskID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve task history",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"history": history,
+	})
+}
+
+// RevertTask restores a specific task by ID to a previous version of its
+// history, given as {"version": n}
+func (h *FiberTaskHandler) RevertTask(c *fiber.Ctx) error {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized: Invalid user ID",
+		})
+	}
+
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	taskID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid task ID",
+		})
+	}
+
+	task, err := h.taskRepo.GetByID(taskID, userID, organizationID)
+	if err != nil || task == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Task not found",
+		})
+	}
+
+	if ok, err := h.checkIfMatch(c, task); !ok {
+		return err
+	}
+
+	var request struct {
+		Version int `json:"version"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if request.Version <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Version to revert to is required",
+		})
+	}
+
+	reverted, err := h.taskRepo.Revert(task.ID, userID, organizationID, task.Version, request.Version)
+	if err != nil {
+		if errors.Is(err, models.ErrTaskRevisionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Version not found in the task history",
+			})
+		}
+		if errors.Is(err, models.ErrTaskNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Task not found",
+			})
+		}
+		return h.saveError(c, err, task.ID, userID, organizationID, "Failed to revert task")
+	}
+
+	if reverted.Version != task.Version {
+		meterTaskWrite(h.usageRepo, organizationID, false)
+	}
+
+	c.Set(fiber.HeaderETag, taskETag(reverted))
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Task reverted successfully",
+		"task":    reverted,
+	})
+}
+
+// trashError is the response sent when a task of the trash cannot be
+// restored or deleted
+func trashError(c *fiber.Ctx, err error, failure string) error {
+	if errors.Is(err, models.ErrTaskNotInTrash) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Task not found in trash",
+		})
+	}
+
+	var entitlementErr *models.EntitlementError
+	if errors.As(err, &entitlementErr) {
+		return entitlementError(c, err, failure)
+	}
+
+	logger.Error("%s: %v", failure, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": failure,
 	})
 }
+
+// taskETag is the entity tag of a task, its version
+func taskETag(task *models.Task) string {
+	return `"` + strconv.Itoa(task.Version) + `"`
+}
+
+// matchesETag reports whether an If-Match or If-None-Match header lists the
+// entity tag of a task, or is "*". Weak tags never match.
+func matchesETag(header string, task *models.Task) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == taskETag(task) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch evaluates the If-Match header of a write against the current
+// version of a task. Writes without it are unconditional unless
+// TASKS_REQUIRE_IF_MATCH is set. When it returns false the error response
+// has already been written.
+func (h *FiberTaskHandler) checkIfMatch(c *fiber.Ctx, task *models.Task) (bool, error) {
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	if strings.TrimSpace(ifMatch) == "" {
+		if !h.requireIfMatch {
+			return true, nil
+		}
+		return false, c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+			"error": "If-Match header is required, use the ETag of the task",
+		})
+	}
+
+	if !matchesETag(ifMatch, task) {
+		return false, preconditionFailed(c, task)
+	}
+	return true, nil
+}
+
+// preconditionFailed is the response sent when a write is based on an
+// outdated version of a task, with the current one
+func preconditionFailed(c *fiber.Ctx, task *models.Task) error {
+	c.Set(fiber.HeaderETag, taskETag(task))
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error": "Task was modified since it was read",
+		"task":  task,
+	})
+}
+
+// saveError is the response sent when a task cannot be saved. A task
+// modified meanwhile is answered like a failed If-Match, see taskWriteError
+// for the other errors.
+func (h *FiberTaskHandler) saveError(c *fiber.Ctx, err error, taskID, userID, organizationID int, failure string) error {
+	if !errors.Is(err, models.ErrTaskVersionConflict) {
+		return taskWriteError(c, err, failure)
+	}
+
+	current, err := h.taskRepo.GetByID(taskID, userID, organizationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Task not found",
+		})
+	}
+	return preconditionFailed(c, current)
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+// FiberTeamHandler handles the teams of organizations and their members using Fiber
+type FiberTeamHandler struct {
+	teamRepo *models.TeamRepository
+	orgRepo  *models.OrganizationRepository
+}
+
+// NewFiberTeamHandler creates a new FiberTeamHandler
+func NewFiberTeamHandler(database *db.DB) *FiberTeamHandler {
+	return &FiberTeamHandler{
+		teamRepo: models.NewTeamRepository(database),
+		orgRepo:  models.NewOrganizationRepository(database),
+	}
+}
+
+// CreateTeam creates a team in an organization, admins and owners only
+func (h *FiberTeamHandler) CreateTeam(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	name, err := parseTeamName(c)
+	if name == "" {
+		return err
+	}
+
+	team := &models.Team{OrganizationID: org.ID, Name: name}
+	if err := h.teamRepo.Create(team); err != nil {
+		return teamWriteError(c, err, "Failed to create team")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Team created successfully",
+		"team":    team,
+	})
+}
+
+// GetTeams lists the teams of an organization
+func (h *FiberTeamHandler) GetTeams(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	teams, err := h.teamRepo.GetAllForOrganization(org.ID)
+	if err != nil {
+		logger.Error("Failed to get teams: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve teams",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"teams": teams,
+	})
+}
+
+// GetTeam retrieves a team of an organization with its members
+func (h *FiberTeamHandler) GetTeam(c *fiber.Ctx) error {
+	_, team, err := h.memberTeam(c)
+	if team == nil {
+		return err
+	}
+
+	members, err := h.teamRepo.GetMembers(team.ID)
+	if err != nil {
+		logger.Error("Failed to get team members: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve team",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"team":    team,
+		"members": members,
+	})
+}
+
+// UpdateTeam renames a team, admins and owners only
+func (h *FiberTeamHandler) UpdateTeam(c *fiber.Ctx) error {
+	org, team, err := h.memberTeam(c)
+	if team == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	name, err := parseTeamName(c)
+	if name == "" {
+		return err
+	}
+
+	team.Name = name
+	if err := h.teamRepo.Update(team); err != nil {
+		return teamWriteError(c, err, "Failed to update team")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Team updated successfully",
+		"team":    team,
+	})
+}
+
+// DeleteTeam deletes a team, admins and owners only. The tasks shared with
+// the team stay visible to their creators and to admins.
+func (h *FiberTeamHandler) DeleteTeam(c *fiber.Ctx) error {
+	org, team, err := h.memberTeam(c)
+	if team == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	if err := h.teamRepo.Delete(team.ID, org.ID); err != nil {
+		logger.Error("Failed to delete team: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete team",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Team deleted successfully",
+	})
+}
+
+// AddTeamMember adds a member of the organization to a team, admins and owners only
+func (h *FiberTeamHandler) AddTeamMember(c *fiber.Ctx) error {
+	org, team, err := h.memberTeam(c)
+	if team == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	var request struct {
+		UserID int `json:"user_id"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if _, err := h.orgRepo.GetMembership(org.ID, request.UserID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Member not found",
+		})
+	}
+
+	if err := h.teamRepo.AddMember(team, request.UserID); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "User is already a member of this team",
+			})
+		}
+		logger.Error("Failed to add team member: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add team member",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Team member added successfully",
+	})
+}
+
+// RemoveTeamMember removes a member from a team. Admins and owners can
+// remove others, any member can leave.
+func (h *FiberTeamHandler) RemoveTeamMember(c *fiber.Ctx) error {
+	org, team, err := h.memberTeam(c)
+	if team == nil {
+		return err
+	}
+
+	userID, _ := currentUserID(c)
+
+	memberID, err := c.ParamsInt("userId")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if memberID != userID && !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	if err := h.teamRepo.RemoveMember(team.ID, memberID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Team member not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Team member removed successfully",
+	})
+}
+
+// memberTeam loads the organization of the :id parameter and its team of
+// the :teamId parameter. When the team is nil the error response has
+// already been written and the handler must return the error as is.
+func (h *FiberTeamHandler) memberTeam(c *fiber.Ctx) (*models.Organization, *models.Team, error) {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return nil, nil, err
+	}
+
+	teamID, err := c.ParamsInt("teamId")
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team ID",
+		})
+	}
+
+	team, err := h.teamRepo.GetByID(teamID, org.ID)
+	if err != nil {
+		return nil, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Team not found",
+		})
+	}
+
+	return org, team, nil
+}
+
+// parseTeamName reads the name of a team from the request body. When it
+// returns an empty name the error response has already been written.
+func parseTeamName(c *fiber.Ctx) (string, error) {
+	var request struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if request.Name == "" || len(request.Name) > 255 {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name is required and limited to 255 characters",
+		})
+	}
+
+	return request.Name, nil
+}
+
+// teamWriteError is the response sent when a team cannot be saved
+func teamWriteError(c *fiber.Ctx, err error, failure string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A team with this name already exists",
+		})
+	}
+
+	logger.Error("%s: %v", failure, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": failure,
+	})
+}
+
+// checkTaskPlacement validates the visibility and team of a task created or
+// moved by the current user in the active organization. A task may only be
+// placed in a team of the organization by its members or by admins, and
+// only its creator may make it private. When it returns false the error
+// response has already been written.
+func checkTaskPlacement(c *fiber.Ctx, teamRepo *models.TeamRepository, task *models.Task, userID int) (bool, error) {
+	if task.Visibility == "" {
+		task.Visibility = models.VisibilityOrganization
+		if task.TeamID != nil {
+			task.Visibility = models.VisibilityTeam
+		}
+	}
+
+	if !models.IsValidVisibility(task.Visibility) {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Visibility must be private, team or organization",
+		})
+	}
+
+	if task.Visibility == models.VisibilityPrivate && task.UserID != userID {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the creator of a task can make it private",
+		})
+	}
+
+	if task.TeamID == nil {
+		if task.Visibility == models.VisibilityTeam {
+			return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "team_id is required for team visibility",
+			})
+		}
+		return true, nil
+	}
+
+	team, err := teamRepo.GetByID(*task.TeamID, task.OrganizationID)
+	if err != nil {
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Team not found",
+		})
+	}
+
+	if models.RoleAtLeast(currentOrganizationRole(c), models.RoleAdmin) {
+		return true, nil
+	}
+
+	member, err := teamRepo.IsMember(team.ID, userID)
+	if err != nil {
+		logger.Error("Failed to check team membership: %v", err)
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check team membership",
+		})
+	}
+	if !member {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Forbidden: Not a member of this team",
+		})
+	}
+
+	return true, nil
+}
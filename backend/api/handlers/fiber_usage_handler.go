@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"strconv"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// usagePeriodLayout is the format of the period query parameter
+const usagePeriodLayout = "2006-01"
+
+// FiberUsageHandler reports metered usage using Fiber
+type FiberUsageHandler struct {
+	usageRepo *models.UsageCounterRepository
+	planRepo  *models.PlanRepository
+}
+
+// NewFiberUsageHandler creates a new FiberUsageHandler
+func NewFiberUsageHandler(database *db.DB) *FiberUsageHandler {
+	return &FiberUsageHandler{
+		usageRepo: models.NewUsageCounterRepository(database),
+		planRepo:  models.NewPlanRepository(database),
+	}
+}
+
+// GetUsage returns the metered usage of the active organization for a period
+// (?period=YYYY-MM, the current month by default) and its consumption of the
+// plan quotas
+func (h *FiberUsageHandler) GetUsage(c *fiber.Ctx) error {
+	organizationID, ok := currentOrganizationID(c)
+	if !ok {
+		return noOrganization(c)
+	}
+
+	period, err := usagePeriod(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "period must use the YYYY-MM format",
+		})
+	}
+
+	counters, err := h.usageRepo.GetForPeriod(organizationID, period)
+	if err != nil {
+		logger.Error("Failed to get usage counters: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve usage",
+		})
+	}
+
+	plan, err := h.planRepo.GetForOrganization(organizationID)
+	if err != nil {
+		logger.Error("Failed to get organization plan: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve usage",
+		})
+	}
+
+	usage, err := h.planRepo.GetUsage(organizationID)
+	if err != nil {
+		logger.Error("Failed to get organization usage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve usage",
+		})
+	}
+
+	storage, err := h.usageRepo.CurrentStorage(organizationID)
+	if err != nil {
+		logger.Error("Failed to measure organization storage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve usage",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"organization_id": organizationID,
+		"period":          period.Format(usagePeriodLayout),
+		"metered":         counters,
+		"plan":            plan.Code,
+		"quotas": fiber.Map{
+			models.EntitlementMaxTasks:   fiber.Map{"used": usage.Tasks, "limit": plan.MaxTasks},
+			models.EntitlementMaxMembers: fiber.Map{"used": usage.Members + usage.PendingInvitations, "limit": plan.MaxMembers},
+			"max_storage_bytes":          fiber.Map{"used": storage, "limit": plan.MaxStorageBytes},
+		},
+	})
+}
+
+// ExportUsage exports the counters of every organization for a period
+// (?period=YYYY-MM, the current month by default) as JSON, or as CSV with
+// ?format=csv, for invoicing
+func (h *FiberUsageHandler) ExportUsage(c *fiber.Ctx) error {
+	period, err := usagePeriod(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "period must use the YYYY-MM format",
+		})
+	}
+
+	counters, err := h.usageRepo.Export(period)
+	if err != nil {
+		logger.Error("Failed to export usage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export usage",
+		})
+	}
+
+	switch c.Query("format", "json") {
+	case "json":
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"period": period.Format(usagePeriodLayout),
+			"usage":  counters,
+		})
+	case "csv":
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="usage-`+period.Format(usagePeriodLayout)+`.csv"`)
+
+		w := csv.NewWriter(c.Response().BodyWriter())
+		w.Write([]string{"organization_id", "organization_name", "plan", "period", "metric", "quantity"})
+		for _, counter := range counters {
+			w.Write([]string{
+				strconv.Itoa(counter.OrganizationID),
+				counter.OrganizationName,
+				counter.Plan,
+				counter.PeriodStart.Format(usagePeriodLayout),
+				counter.Metric,
+				strconv.FormatInt(counter.Quantity, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be json or csv",
+		})
+	}
+}
+
+// usagePeriod parses the period query parameter, the current month when absent
+func usagePeriod(c *fiber.Ctx) (time.Time, error) {
+	value := c.Query("period")
+	if value == "" {
+		return models.PeriodStart(time.Now()), nil
+	}
+
+	period, err := time.Parse(usagePeriodLayout, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return models.PeriodStart(period), nil
+}
+
+// meterTaskWrite records the usage caused by creating or updating a task.
+// Metering never fails the request, errors are only logged.
+func meterTaskWrite(usageRepo *models.UsageCounterRepository, organizationID int, created bool) {
+	if created {
+		if err := usageRepo.Increment(organizationID, models.MetricTasksCreated, 1); err != nil {
+			logger.Error("Failed to meter task creation for organization ID %d: %v", organizationID, err)
+		}
+	}
+
+	if err := usageRepo.RecordStorage(organizationID); err != nil {
+		logger.Error("Failed to meter storage for organization ID %d: %v", organizationID, err)
+	}
+}
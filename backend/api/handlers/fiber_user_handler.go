@@ -1,39 +1,70 @@
 package handlers
 
 import (
+	"encoding/json"
 	"strings"
+	"time"
 
 	"github.com/LouisVannobel/SaaS-Template/backend/auth"
+	"github.com/LouisVannobel/SaaS-Template/backend/billing"
 	"github.com/LouisVannobel/SaaS-Template/backend/db"
 	"github.com/LouisVannobel/SaaS-Template/backend/models"
 	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
 	"github.com/gofiber/fiber/v2"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // FiberUserHandler handles user-related requests using Fiber
 type FiberUserHandler struct {
-	userRepo *models.UserRepository
+	userRepo         *models.UserRepository
+	inviteRepo       *models.InviteCodeRepository
+	invitationRepo   *models.InvitationRepository
+	subscriptionRepo *models.SubscriptionRepository
+	policy           *auth.RegistrationPolicy
+	trial            *billing.TrialConfig
 }
 
 // NewFiberUserHandler creates a new FiberUserHandler
 func NewFiberUserHandler(database *db.DB) *FiberUserHandler {
 	return &FiberUserHandler{
-		userRepo: models.NewUserRepository(database),
+		userRepo:         models.NewUserRepository(database),
+		inviteRepo:       models.NewInviteCodeRepository(database),
+		invitationRepo:   models.NewInvitationRepository(database),
+		subscriptionRepo: models.NewSubscriptionRepository(database),
+		policy:           auth.LoadRegistrationPolicy(),
+		trial:            billing.TrialFromEnv(),
 	}
 }
 
+// GetRegistrationPolicy tells clients how registration is currently restricted
+func (h *FiberUserHandler) GetRegistrationPolicy(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"registration": h.policy,
+	})
+}
+
 // Register handles user registration
 func (h *FiberUserHandler) Register(c *fiber.Ctx) error {
 	// Parse request body
-	var user models.User
-	if err := c.BodyParser(&user); err != nil {
+	var request struct {
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		Name            string `json:"name"`
+		InviteCode      string `json:"invite_code"`
+		InvitationToken string `json:"invitation_token"`
+	}
+	if err := c.BodyParser(&request); err != nil {
 		logger.Error("Failed to parse request body: %v", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request format",
 		})
 	}
 
+	user := models.User{
+		Email:    request.Email,
+		Password: request.Password,
+		Name:     request.Name,
+	}
+
 	// Validate required fields
 	if user.Email == "" || user.Password == "" || user.Name == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -41,6 +72,39 @@ func (h *FiberUserHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
+	// An organization invitation must be pending and addressed to this email
+	var invitation *models.Invitation
+	if request.InvitationToken != "" {
+		invitation, _ = h.invitationRepo.GetByToken(request.InvitationToken)
+		if invitation == nil || invitation.Status != models.InvitationStatusPending {
+			return invitationError(c, models.ErrInvitationInvalid)
+		}
+		if !strings.EqualFold(invitation.Email, user.Email) {
+			return invitationError(c, models.ErrInvitationEmailMismatch)
+		}
+	}
+
+	// Enforce the registration policy. An organization invitation stands in
+	// for an invite code or an allowed domain.
+	switch h.policy.Mode {
+	case auth.RegistrationClosed:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Registration is closed",
+		})
+	case auth.RegistrationDomain:
+		if invitation == nil && !h.policy.DomainAllowed(user.Email) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Registration is restricted to allowed email domains",
+			})
+		}
+	case auth.RegistrationInvite:
+		if invitation == nil && request.InviteCode == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "An invite code is required to register",
+			})
+		}
+	}
+
 	// Check if user already exists
 	existingUser, _ := h.userRepo.GetByEmail(user.Email)
 	if existingUser != nil {
@@ -49,8 +113,21 @@ func (h *FiberUserHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
+	// Consume one use of the invite code
+	var invite *models.InviteCode
+	if h.policy.Mode == auth.RegistrationInvite && invitation == nil {
+		var err error
+		invite, err = h.inviteRepo.Redeem(request.InviteCode)
+		if err != nil {
+			logger.Error("Invite code rejected: %v", err)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Invalid or expired invite code",
+			})
+		}
+	}
+
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := models.HashPassword(user.Password)
 	if err != nil {
 		logger.Error("Failed to hash password: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -59,16 +136,35 @@ func (h *FiberUserHandler) Register(c *fiber.Ctx) error {
 	}
 
 	// Set hashed password
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
+	user.Active = true
 
-	// Save user to database
-	if err := h.userRepo.Create(&user); err != nil {
+	// Save user to database, every user gets a personal workspace
+	personal, err := h.userRepo.CreateWithPersonalOrganization(&user)
+	if err != nil {
 		logger.Error("Failed to create user: %v", err)
+		if invite != nil {
+			if err := h.inviteRepo.Release(invite.ID); err != nil {
+				logger.Error("Failed to release invite code: %v", err)
+			}
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
 	}
 
+	startSignupTrial(h.subscriptionRepo, h.trial, personal)
+
+	// Join the inviting organization. The account already exists at this
+	// point so a failure is logged and the invitation can be accepted later.
+	if invitation != nil {
+		accepted, err := h.invitationRepo.Accept(request.InvitationToken, &user)
+		if err != nil {
+			logger.Error("Failed to accept invitation during registration: %v", err)
+		}
+		invitation = accepted
+	}
+
 	// Generate JWT token
 	token, err := auth.GenerateToken(int(user.ID))
 	if err != nil {
@@ -79,7 +175,7 @@ func (h *FiberUserHandler) Register(c *fiber.Ctx) error {
 	}
 
 	// Return success response with token
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+	response := fiber.Map{
 		"message": "User registered successfully",
 		"token":   token,
 		"user": fiber.Map{
@@ -87,7 +183,12 @@ func (h *FiberUserHandler) Register(c *fiber.Ctx) error {
 			"name":  user.Name,
 			"email": user.Email,
 		},
-	})
+	}
+	if invitation != nil {
+		response["invitation"] = invitation
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(response)
 }
 
 // Login handles user login
@@ -135,45 +236,20 @@ func (h *FiberUserHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	// Deactivated accounts cannot log in
+	if !user.Active {
+		logger.Error("Login failed: User ID %d is deactivated", user.ID)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account is deactivated",
+		})
+	}
+
 	// Log user details for debugging
 	logger.Info("User found - ID: %d, Email: %s, Password hash length: %d", user.ID, user.Email, len(user.Password))
 
-	// Verify password
-	var passwordValid bool
-	
-	// Essayer la vérification bcrypt standard
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password))
-	if err != nil {
-		logger.Error("Bcrypt password verification failed: %v", err)
-		
-		// Si le hash ne commence pas par '$', essayer une comparaison directe (pour les mots de passe non hashés)
-		if !strings.HasPrefix(user.Password, "$") {
-			logger.Info("Trying direct password comparison because hash doesn't start with $")
-			// Pour le débogage, acceptons n'importe quel mot de passe temporairement
-			passwordValid = true // Accepter n'importe quel mot de passe pour le débogage
-			logger.Info("DEBUG MODE: Accepting any password for login")
-			
-			// Générer un nouveau hash bcrypt
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
-			if err != nil {
-				logger.Error("Failed to hash password for update: %v", err)
-			} else {
-				// Mettre à jour le mot de passe dans la base de données
-				user.Password = string(hashedPassword)
-				if err := h.userRepo.Update(user); err != nil {
-					logger.Error("Failed to update user password: %v", err)
-				} else {
-					logger.Info("Password hash updated successfully for user ID: %d", user.ID)
-				}
-			}
-		}
-	} else {
-		// Si la vérification bcrypt réussit, le mot de passe est valide
-		passwordValid = true
-	}
-	
-	// Si le mot de passe n'est pas valide, renvoyer une erreur
-	if !passwordValid {
+	// Verify password, accounts without a usable password never match
+	if !user.CheckPassword(credentials.Password) {
+		logger.Error("Login failed: Invalid password for user ID %d", user.ID)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid email or password",
 		})
@@ -239,11 +315,7 @@ func (h *FiberUserHandler) GetProfile(c *fiber.Ctx) error {
 
 	// Return user profile
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"user": fiber.Map{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
-		},
+		"user": profileResponse(user),
 	})
 }
 
@@ -278,9 +350,14 @@ func (h *FiberUserHandler) UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse request body
+	// Parse request body, nil fields are left unchanged
 	var updateData struct {
-		Name string `json:"name"`
+		Name        *string         `json:"name"`
+		Timezone    *string         `json:"timezone"`
+		Locale      *string         `json:"locale"`
+		AvatarURL   *string         `json:"avatar_url"`
+		DateFormat  *string         `json:"date_format"`
+		Preferences json.RawMessage `json:"preferences"`
 	}
 
 	if err := c.BodyParser(&updateData); err != nil {
@@ -290,9 +367,60 @@ func (h *FiberUserHandler) UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update user data
-	if updateData.Name != "" {
-		user.Name = updateData.Name
+	// Validate and update user data
+	if updateData.Name != nil && *updateData.Name != "" {
+		user.Name = *updateData.Name
+	}
+
+	if updateData.Timezone != nil {
+		if err := validateTimezone(*updateData.Timezone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		user.Timezone = *updateData.Timezone
+	}
+
+	if updateData.Locale != nil {
+		locale, err := normalizeLocale(*updateData.Locale)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		user.Locale = locale
+	}
+
+	if updateData.AvatarURL != nil {
+		// An empty string removes the avatar
+		if *updateData.AvatarURL == "" {
+			user.AvatarURL = nil
+		} else {
+			if err := validateAvatarURL(*updateData.AvatarURL); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			user.AvatarURL = updateData.AvatarURL
+		}
+	}
+
+	if updateData.DateFormat != nil {
+		if err := validateDateFormat(*updateData.DateFormat); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		user.DateFormat = *updateData.DateFormat
+	}
+
+	if len(updateData.Preferences) > 0 && string(updateData.Preferences) != "null" {
+		if err := validatePreferences(updateData.Preferences); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		user.Preferences = updateData.Preferences
 	}
 
 	// Save updated user to database
@@ -306,10 +434,44 @@ func (h *FiberUserHandler) UpdateProfile(c *fiber.Ctx) error {
 	// Return updated user profile
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Profile updated successfully",
-		"user": fiber.Map{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
-		},
+		"user":    profileResponse(user),
 	})
 }
+
+// profileResponse is the profile representation returned to its owner
+func profileResponse(user *models.User) fiber.Map {
+	preferences := user.Preferences
+	if len(preferences) == 0 {
+		preferences = json.RawMessage(`{}`)
+	}
+
+	return fiber.Map{
+		"id":          user.ID,
+		"name":        user.Name,
+		"email":       user.Email,
+		"timezone":    user.Timezone,
+		"locale":      user.Locale,
+		"avatar_url":  user.AvatarURL,
+		"date_format": user.DateFormat,
+		"preferences": preferences,
+	}
+}
+
+// startSignupTrial starts the trial of the personal workspace of a new user.
+// The account already exists so a failure is only logged, the workspace
+// then stays on its plan.
+func startSignupTrial(subscriptionRepo *models.SubscriptionRepository, trial *billing.TrialConfig, org *models.Organization) {
+	if !trial.Enabled() {
+		return
+	}
+
+	endsAt := time.Now().Add(trial.Duration)
+	if err := subscriptionRepo.StartTrial(org.ID, trial.Plan, endsAt); err != nil {
+		logger.Error("Failed to start trial of organization ID %d: %v", org.ID, err)
+		return
+	}
+
+	org.Plan = trial.Plan
+	org.SubscriptionStatus = models.SubscriptionTrialing
+	org.TrialEndsAt = &endsAt
+}
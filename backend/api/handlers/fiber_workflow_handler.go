@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/LouisVannobel/SaaS-Template/backend/workflow"
+	"github.com/gofiber/fiber/v2"
+)
+
+// FiberWorkflowHandler handles the task status workflows of organizations using Fiber
+type FiberWorkflowHandler struct {
+	workflowRepo *models.TaskWorkflowRepository
+	orgRepo      *models.OrganizationRepository
+}
+
+// NewFiberWorkflowHandler creates a new FiberWorkflowHandler
+func NewFiberWorkflowHandler(database *db.DB) *FiberWorkflowHandler {
+	return &FiberWorkflowHandler{
+		workflowRepo: models.NewTaskWorkflowRepository(database),
+		orgRepo:      models.NewOrganizationRepository(database),
+	}
+}
+
+// GetWorkflow retrieves the task status workflow of an organization
+func (h *FiberWorkflowHandler) GetWorkflow(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	taskWorkflow, err := h.workflowRepo.Get(org.ID)
+	if err != nil {
+		logger.Error("Failed to get workflow of organization ID %d: %v", org.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve workflow",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"workflow": taskWorkflow,
+	})
+}
+
+// UpdateWorkflow replaces the task status workflow of an organization,
+// admins and owners only
+func (h *FiberWorkflowHandler) UpdateWorkflow(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return unauthorized(c)
+	}
+
+	w := &workflow.Workflow{}
+	if err := c.BodyParser(w); err != nil {
+		logger.Error("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request format",
+		})
+	}
+
+	if err := w.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid workflow: " + err.Error(),
+		})
+	}
+
+	taskWorkflow, err := h.workflowRepo.Save(org.ID, w, userID)
+	if err != nil {
+		logger.Error("Failed to save workflow of organization ID %d: %v", org.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update workflow",
+		})
+	}
+
+	logger.Info("Workflow of organization ID %d updated by user ID %d", org.ID, userID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Workflow updated successfully",
+		"workflow": taskWorkflow,
+	})
+}
+
+// ResetWorkflow restores the default task status workflow of an
+// organization, admins and owners only
+func (h *FiberWorkflowHandler) ResetWorkflow(c *fiber.Ctx) error {
+	org, err := loadMemberOrganization(c, h.orgRepo)
+	if org == nil {
+		return err
+	}
+
+	if !models.RoleAtLeast(org.Role, models.RoleAdmin) {
+		return forbiddenRole(c)
+	}
+
+	if err := h.workflowRepo.Reset(org.ID); err != nil {
+		logger.Error("Failed to reset workflow of organization ID %d: %v", org.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset workflow",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Workflow reset to the default",
+	})
+}
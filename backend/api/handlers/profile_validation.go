@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	// Embed the IANA time zone database so validation does not depend on
+	// the zoneinfo files of the host (missing in alpine images)
+	_ "time/tzdata"
+)
+
+// maxPreferencesSize limits the size of the preferences document in bytes
+const maxPreferencesSize = 16 * 1024
+
+// supportedDateFormats lists the date formats the frontend knows how to render
+var supportedDateFormats = map[string]bool{
+	"YYYY-MM-DD": true,
+	"DD/MM/YYYY": true,
+	"MM/DD/YYYY": true,
+	"DD.MM.YYYY": true,
+	"D MMM YYYY": true,
+}
+
+// localePattern matches well-formed BCP 47 language tags: language, optional
+// extended language, script, region, variants, extensions and private use
+var localePattern = regexp.MustCompile(`(?i)^` +
+	`([a-z]{2,3}(-[a-z]{3}){0,3}|[a-z]{4,8})` +
+	`(-[a-z]{4})?` +
+	`(-([a-z]{2}|[0-9]{3}))?` +
+	`(-([a-z0-9]{5,8}|[0-9][a-z0-9]{3}))*` +
+	`(-[0-9a-wy-z](-[a-z0-9]{2,8})+)*` +
+	`(-x(-[a-z0-9]{1,8})+)?$`)
+
+// validateTimezone checks that tz is an IANA time zone name
+func validateTimezone(tz string) error {
+	if tz == "" || tz == "Local" {
+		return errors.New("timezone must be an IANA time zone name")
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("unknown timezone %q", tz)
+	}
+	return nil
+}
+
+// normalizeLocale validates a BCP 47 language tag and returns it in its
+// canonical case (en-US, zh-Hant-TW)
+func normalizeLocale(locale string) (string, error) {
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	if len(locale) > 35 || !localePattern.MatchString(locale) {
+		return "", fmt.Errorf("invalid locale %q, expected a BCP 47 language tag", locale)
+	}
+
+	parts := strings.Split(locale, "-")
+	afterSingleton := false
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case afterSingleton || len(part) == 1:
+			// Everything from the first singleton on is left lowercase
+			afterSingleton = true
+			parts[i] = strings.ToLower(part)
+		case len(part) == 4 && isAlpha(part):
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		case len(part) == 2 && isAlpha(part):
+			parts[i] = strings.ToUpper(part)
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+
+	return strings.Join(parts, "-"), nil
+}
+
+// validateAvatarURL checks that the avatar is an absolute http(s) URL
+func validateAvatarURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("avatar_url must be an absolute http or https URL")
+	}
+	if len(raw) > 2048 {
+		return errors.New("avatar_url is too long")
+	}
+	return nil
+}
+
+// validateDateFormat checks that the date format is supported
+func validateDateFormat(format string) error {
+	if !supportedDateFormats[format] {
+		return fmt.Errorf("unsupported date_format %q", format)
+	}
+	return nil
+}
+
+// validatePreferences checks that the preferences document is a JSON object
+func validatePreferences(raw json.RawMessage) error {
+	if len(raw) > maxPreferencesSize {
+		return fmt.Errorf("preferences must not exceed %d bytes", maxPreferencesSize)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(raw, &document); err != nil || document == nil {
+		return errors.New("preferences must be a JSON object")
+	}
+	return nil
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		tz      string
+		wantErr bool
+	}{
+		{"region", "Europe/Paris", false},
+		{"nested region", "America/Argentina/Buenos_Aires", false},
+		{"UTC", "UTC", false},
+		{"empty", "", true},
+		{"host local time", "Local", true},
+		{"unknown", "Mars/Olympus_Mons", true},
+		{"offset", "+02:00", true},
+		{"wrong case", "europe/paris", true},
+	}
+
+	for _, tt := range tests {
+		if err := validateTimezone(tt.tz); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		name    string
+		locale  string
+		want    string
+		wantErr bool
+	}{
+		{"language", "FR", "fr", false},
+		{"language and region", "en-us", "en-US", false},
+		{"underscore", "pt_BR", "pt-BR", false},
+		{"surrounding spaces", " de-DE ", "de-DE", false},
+		{"script and region", "ZH-hant-tw", "zh-Hant-TW", false},
+		{"numeric region", "es-419", "es-419", false},
+		{"variant", "sl-ROZAJ", "sl-rozaj", false},
+		{"extension", "en-US-U-CA-GB", "en-US-u-ca-gb", false},
+		{"private use", "en-X-AB-CD", "en-x-ab-cd", false},
+		{"private use only language", "qaa-x-Test", "qaa-x-test", false},
+		{"empty", "", "", true},
+		{"single letter", "e", "", true},
+		{"digits", "12", "", true},
+		{"empty subtag", "en--US", "", true},
+		{"trailing dash", "en-", "", true},
+		{"path", "../en", "", true},
+		{"too long", "en-" + strings.Repeat("abcdefgh-", 4) + "ab", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeLocale(tt.locale)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAvatarURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"https", "https://cdn.example.com/avatars/1.png", false},
+		{"http", "http://example.com/a.png", false},
+		{"javascript", "javascript:alert(1)", true},
+		{"data", "data:image/png;base64,iVBORw0KGgo=", true},
+		{"file", "file:///etc/passwd", true},
+		{"relative", "/avatars/1.png", true},
+		{"protocol relative", "//example.com/a.png", true},
+		{"no host", "https:///a.png", true},
+		{"empty", "", true},
+		{"too long", "https://example.com/" + strings.Repeat("a", 2048), true},
+	}
+
+	for _, tt := range tests {
+		if err := validateAvatarURL(tt.url); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateDateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantErr bool
+	}{
+		{"ISO", "YYYY-MM-DD", false},
+		{"European", "DD/MM/YYYY", false},
+		{"American", "MM/DD/YYYY", false},
+		{"dotted", "DD.MM.YYYY", false},
+		{"month name", "D MMM YYYY", false},
+		{"Go layout", "2006-01-02", true},
+		{"lowercase", "yyyy-mm-dd", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		if err := validateDateFormat(tt.format); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidatePreferences(t *testing.T) {
+	// A JSON object of exactly maxPreferencesSize bytes
+	padding := strings.Repeat("a", maxPreferencesSize-len(`{"k":""}`))
+	atLimit := `{"k":"` + padding + `"}`
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"empty object", `{}`, false},
+		{"nested object", `{"theme": "dark", "sidebar": {"collapsed": true}}`, false},
+		{"at the size limit", atLimit, false},
+		{"over the size limit", `{"k":"a` + padding + `"}`, true},
+		{"array", `[1, 2]`, true},
+		{"string", `"dark"`, true},
+		{"number", `42`, true},
+		{"null", `null`, true},
+		{"invalid JSON", `{"theme":`, true},
+	}
+
+	for _, tt := range tests {
+		if err := validatePreferences(json.RawMessage(tt.raw)); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -2,27 +2,42 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/LouisVannobel/SaaS-Template/backend/db"
 	"github.com/LouisVannobel/SaaS-Template/backend/models"
 	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/LouisVannobel/SaaS-Template/backend/workflow"
 	"github.com/gorilla/mux"
 )
 
 // TaskHandler handles HTTP requests related to tasks
 type TaskHandler struct {
-	taskRepo *models.TaskRepository
+	taskRepo  *models.TaskRepository
+	orgRepo   *models.OrganizationRepository
+	usageRepo *models.UsageCounterRepository
 }
 
 // NewTaskHandler creates a new task handler
 func NewTaskHandler(database *db.DB) *TaskHandler {
 	return &TaskHandler{
-		taskRepo: models.NewTaskRepository(database),
+		taskRepo:  models.NewTaskRepository(database),
+		orgRepo:   models.NewOrganizationRepository(database),
+		usageRepo: models.NewUsageCounterRepository(database),
 	}
 }
 
+// defaultOrganizationID returns the organization used by the legacy API
+func (h *TaskHandler) defaultOrganizationID(userID int) (int, error) {
+	membership, err := h.orgRepo.GetDefaultMembership(userID)
+	if err != nil {
+		return 0, err
+	}
+	return membership.OrganizationID, nil
+}
+
 // CreateTask handles task creation
 func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
@@ -38,6 +53,13 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The legacy API always works in the user's default organization
+	organizationID, err := h.defaultOrganizationID(userID)
+	if err != nil {
+		http.Error(w, "No organization", http.StatusForbidden)
+		return
+	}
+
 	// Parse request body
 	var task models.Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
@@ -51,21 +73,29 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set user ID from context
+	// Set user ID and organization ID
 	task.UserID = userID
+	task.OrganizationID = organizationID
 
-	// Set default status if not provided
-	if task.Status == "" {
-		task.Status = "pending"
-	}
-
-	// Save task to database
+	// Save task to database, in the initial status of the workflow if none is provided
 	if err := h.taskRepo.Create(&task); err != nil {
+		var workflowErr *workflow.Error
+		if errors.As(err, &workflowErr) {
+			http.Error(w, "Invalid status: "+workflowErr.Message, http.StatusBadRequest)
+			return
+		}
+		var entitlementErr *models.EntitlementError
+		if errors.As(err, &entitlementErr) {
+			http.Error(w, "Plan limit reached: "+entitlementErr.Error(), http.StatusPaymentRequired)
+			return
+		}
 		logger.Error("Failed to create task: %v", err)
 		http.Error(w, "Failed to create task", http.StatusInternalServerError)
 		return
 	}
 
+	meterTaskWrite(h.usageRepo, organizationID, true)
+
 	// Return created task
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -87,8 +117,15 @@ func (h *TaskHandler) GetAllTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The legacy API always works in the user's default organization
+	organizationID, err := h.defaultOrganizationID(userID)
+	if err != nil {
+		http.Error(w, "No organization", http.StatusForbidden)
+		return
+	}
+
 	// Get tasks from database
-	tasks, err := h.taskRepo.GetAllByUserID(userID)
+	tasks, err := h.taskRepo.GetAllByUserID(userID, organizationID)
 	if err != nil {
 		logger.Error("Failed to get tasks: %v", err)
 		http.Error(w, "Failed to get tasks", http.StatusInternalServerError)
@@ -115,6 +152,13 @@ func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The legacy API always works in the user's default organization
+	organizationID, err := h.defaultOrganizationID(userID)
+	if err != nil {
+		http.Error(w, "No organization", http.StatusForbidden)
+		return
+	}
+
 	// Get task ID from URL parameters
 	vars := mux.Vars(r)
 	taskIDStr := vars["id"]
@@ -125,7 +169,7 @@ func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get task from database
-	task, err := h.taskRepo.GetByID(taskID, userID)
+	task, err := h.taskRepo.GetByID(taskID, userID, organizationID)
 	if err != nil {
 		http.Error(w, "Task not found", http.StatusNotFound)
 		return
@@ -151,6 +195,13 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The legacy API always works in the user's default organization
+	organizationID, err := h.defaultOrganizationID(userID)
+	if err != nil {
+		http.Error(w, "No organization", http.StatusForbidden)
+		return
+	}
+
 	// Get task ID from URL parameters
 	vars := mux.Vars(r)
 	taskIDStr := vars["id"]
@@ -167,17 +218,34 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set task ID and user ID
+	// Set task ID, user ID and organization ID
 	task.ID = taskID
 	task.UserID = userID
+	task.OrganizationID = organizationID
 
 	// Update task in database
-	if err := h.taskRepo.Update(&task); err != nil {
+	if err := h.taskRepo.Update(&task, userID); err != nil {
+		var workflowErr *workflow.Error
+		if errors.As(err, &workflowErr) {
+			http.Error(w, "Invalid status: "+workflowErr.Message, http.StatusBadRequest)
+			return
+		}
+		var entitlementErr *models.EntitlementError
+		if errors.As(err, &entitlementErr) {
+			http.Error(w, "Plan limit reached: "+entitlementErr.Error(), http.StatusPaymentRequired)
+			return
+		}
+		if errors.Is(err, models.ErrTaskVersionConflict) {
+			http.Error(w, "Task was modified, reload it and retry", http.StatusPreconditionFailed)
+			return
+		}
 		logger.Error("Failed to update task: %v", err)
 		http.Error(w, "Failed to update task", http.StatusInternalServerError)
 		return
 	}
 
+	meterTaskWrite(h.usageRepo, organizationID, false)
+
 	// Return updated task
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(task)
@@ -198,6 +266,13 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The legacy API always works in the user's default organization
+	organizationID, err := h.defaultOrganizationID(userID)
+	if err != nil {
+		http.Error(w, "No organization", http.StatusForbidden)
+		return
+	}
+
 	// Get task ID from URL parameters
 	vars := mux.Vars(r)
 	taskIDStr := vars["id"]
@@ -208,7 +283,7 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete task from database
-	if err := h.taskRepo.Delete(taskID, userID); err != nil {
+	if err := h.taskRepo.Delete(taskID, userID, organizationID, 0); err != nil {
 		logger.Error("Failed to delete task: %v", err)
 		http.Error(w, "Failed to delete task", http.StatusInternalServerError)
 		return
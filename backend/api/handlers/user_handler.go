@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/LouisVannobel/SaaS-Template/backend/auth"
+	"github.com/LouisVannobel/SaaS-Template/backend/billing"
 	"github.com/LouisVannobel/SaaS-Template/backend/db"
 	"github.com/LouisVannobel/SaaS-Template/backend/models"
 	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
@@ -14,13 +15,17 @@ import (
 
 // UserHandler handles HTTP requests related to users
 type UserHandler struct {
-	userRepo *models.UserRepository
+	userRepo         *models.UserRepository
+	subscriptionRepo *models.SubscriptionRepository
+	trial            *billing.TrialConfig
 }
 
 // NewUserHandler creates a new user handler
 func NewUserHandler(database *db.DB) *UserHandler {
 	return &UserHandler{
-		userRepo: models.NewUserRepository(database),
+		userRepo:         models.NewUserRepository(database),
+		subscriptionRepo: models.NewSubscriptionRepository(database),
+		trial:            billing.TrialFromEnv(),
 	}
 }
 
@@ -58,15 +63,25 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Hash password
+	hashedPassword, err := models.HashPassword(req.Password)
+	if err != nil {
+		logger.Error("Failed to hash password: %v", err)
+		http.Error(w, "Failed to process request", http.StatusInternalServerError)
+		return
+	}
+
 	// Create user object
 	user := &models.User{
 		Email:    req.Email,
-		Password: req.Password,
+		Password: hashedPassword,
 		Name:     req.Name,
+		Active:   true,
 	}
 
-	// Save user to database
-	if err := h.userRepo.Create(user); err != nil {
+	// Save user to database, every user gets a personal workspace
+	personal, err := h.userRepo.CreateWithPersonalOrganization(user)
+	if err != nil {
 		logger.Error("Failed to create user: %v", err)
 		// Log l'erreur complète pour le débogage
 		log.Printf("Detailed error: %v", err)
@@ -74,6 +89,8 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	startSignupTrial(h.subscriptionRepo, h.trial, personal)
+
 	// Generate JWT token
 	token, err := auth.GenerateToken(user.ID)
 	if err != nil {
@@ -115,12 +132,17 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check password
-	hashedPassword := models.HashPassword(req.Password)
-	if user.Password != hashedPassword {
+	if !user.CheckPassword(req.Password) {
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
+	// Deactivated accounts cannot log in
+	if !user.Active {
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	}
+
 	// Generate JWT token
 	token, err := auth.GenerateToken(user.ID)
 	if err != nil {
@@ -186,17 +208,23 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse request body
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	var updateData models.User
+	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Set user ID from context
-	user.ID = userID
+	// Load the current profile so that fields not handled here are kept
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		logger.Error("Failed to get user profile: %v", err)
+		http.Error(w, "Failed to get user profile", http.StatusInternalServerError)
+		return
+	}
+	user.Name = updateData.Name
 
 	// Update user in database
-	if err := h.userRepo.Update(&user); err != nil {
+	if err := h.userRepo.Update(user); err != nil {
 		logger.Error("Failed to update user profile: %v", err)
 		http.Error(w, "Failed to update user profile", http.StatusInternalServerError)
 		return
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminRequired is a middleware that only lets active admins through.
+// It must be registered after JWTProtected.
+func AdminRequired(database *db.DB) fiber.Handler {
+	userRepo := models.NewUserRepository(database)
+
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(int)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized: Invalid user ID",
+			})
+		}
+
+		user, err := userRepo.GetByID(userID)
+		if err != nil || !user.Active || !user.IsAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Forbidden: Admin access required",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -5,11 +5,29 @@ import (
 	"strings"
 
 	"github.com/LouisVannobel/SaaS-Template/backend/auth"
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
 	"github.com/gofiber/fiber/v2"
 )
 
-// JWTProtected is a middleware that checks for a valid JWT token
-func JWTProtected() fiber.Handler {
+// principals loads the users and service accounts tokens are issued to
+type principals struct {
+	user           func(id int) (*models.User, error)
+	serviceAccount func(id int) (*models.ServiceAccount, error)
+}
+
+// JWTProtected is a middleware that checks for a valid JWT token issued to
+// an active user or service account. Tokens of users deactivated since, by
+// SCIM or an admin, and of service accounts disabled, whose secret was
+// rotated or whose owner changed since, are rejected before they expire.
+func JWTProtected(database *db.DB) fiber.Handler {
+	return jwtProtected(principals{
+		user:           models.NewUserRepository(database).GetByID,
+		serviceAccount: models.NewServiceAccountRepository(database).GetByID,
+	})
+}
+
+func jwtProtected(principals principals) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get authorization header
 		authorization := c.Get("Authorization")
@@ -36,11 +54,74 @@ func JWTProtected() fiber.Handler {
 			})
 		}
 
+		// Reject users deactivated or deleted since the token was issued
+		user, err := principals.user(claims.UserID)
+		if err != nil || !user.Active {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized: Account is deactivated",
+			})
+		}
+
+		// Service accounts lose their tokens when disabled, when their secret
+		// is rotated and when they are transferred to another owner
+		if claims.IsServiceAccount() {
+			account, err := principals.serviceAccount(claims.ServiceAccountID)
+			if err != nil || account.DisabledAt != nil ||
+				account.SecretGeneration != claims.SecretGeneration || account.OwnerID != claims.UserID {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Unauthorized: Token was revoked",
+				})
+			}
+		}
+
 		// Store user ID in context for later use
 		c.Locals("userID", claims.UserID)
+		c.Locals("claims", claims)
 		fmt.Printf("User ID: %d\n", claims.UserID)
 
 		// Continue to the next middleware/handler
 		return c.Next()
 	}
 }
+
+// RequireScope is a middleware that rejects service accounts whose token
+// does not grant scope. It must be registered after JWTProtected.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("claims").(*auth.Claims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized: Invalid or missing token",
+			})
+		}
+
+		if !claims.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": fmt.Sprintf("Forbidden: Missing scope %s", scope),
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// UsersOnly is a middleware that rejects service accounts, for routes that
+// only make sense for humans. It must be registered after JWTProtected.
+func UsersOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("claims").(*auth.Claims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized: Invalid or missing token",
+			})
+		}
+
+		if claims.IsServiceAccount() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Forbidden: Not available to service accounts",
+			})
+		}
+
+		return c.Next()
+	}
+}
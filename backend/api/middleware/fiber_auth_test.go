@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/auth"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakePrincipals serves one user and one service account it owns
+func fakePrincipals(user *models.User, account *models.ServiceAccount) principals {
+	return principals{
+		user: func(id int) (*models.User, error) {
+			if id != user.ID {
+				return nil, errors.New("user not found")
+			}
+			return user, nil
+		},
+		serviceAccount: func(id int) (*models.ServiceAccount, error) {
+			if id != account.ID {
+				return nil, errors.New("service account not found")
+			}
+			return account, nil
+		},
+	}
+}
+
+func protectedStatus(t *testing.T, principals principals, token string) int {
+	app := fiber.New()
+	app.Get("/", jwtProtected(principals), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestJWTProtectedRevokesServiceAccountTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_secret")
+
+	token, err := auth.GenerateServiceAccountToken(7, 3, 2, []string{auth.ScopeTasksWrite})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	disabledAt := time.Now()
+	tests := []struct {
+		name    string
+		account models.ServiceAccount
+		want    int
+	}{
+		{"enabled", models.ServiceAccount{ID: 3, OwnerID: 7, SecretGeneration: 2}, fiber.StatusOK},
+		{"disabled", models.ServiceAccount{ID: 3, OwnerID: 7, SecretGeneration: 2, DisabledAt: &disabledAt}, fiber.StatusUnauthorized},
+		{"secret rotated", models.ServiceAccount{ID: 3, OwnerID: 7, SecretGeneration: 3}, fiber.StatusUnauthorized},
+		{"owner changed", models.ServiceAccount{ID: 3, OwnerID: 8, SecretGeneration: 2}, fiber.StatusUnauthorized},
+		{"deleted", models.ServiceAccount{ID: 4, OwnerID: 7, SecretGeneration: 2}, fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		account := tt.account
+		principals := fakePrincipals(&models.User{ID: 7, Active: true}, &account)
+		if got := protectedStatus(t, principals, token); got != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJWTProtectedRejectsDeactivatedUsers(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_secret")
+
+	token, err := auth.GenerateToken(7)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	user := &models.User{ID: 7, Active: true}
+	principals := fakePrincipals(user, &models.ServiceAccount{})
+	if got := protectedStatus(t, principals, token); got != fiber.StatusOK {
+		t.Errorf("Active user got status %d", got)
+	}
+
+	user.Active = false
+	if got := protectedStatus(t, principals, token); got != fiber.StatusUnauthorized {
+		t.Errorf("Deactivated user got status %d, want 401", got)
+	}
+}
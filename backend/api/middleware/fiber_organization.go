@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// OrganizationHeader selects the active organization of a request
+const OrganizationHeader = "X-Organization-ID"
+
+// OrganizationContext is a middleware that resolves the active organization
+// from the X-Organization-ID header, or the user's default organization when
+// the header is absent, and checks the user is a member. It stores the
+// organization ID and the user's role in the context. Write requests to an
+// organization whose payment is past due are refused, the organization is
+// read-only until the payment is settled. It must be registered after
+// JWTProtected.
+func OrganizationContext(database *db.DB) fiber.Handler {
+	orgRepo := models.NewOrganizationRepository(database)
+	subscriptionRepo := models.NewSubscriptionRepository(database)
+
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(int)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized: Invalid user ID",
+			})
+		}
+
+		var membership *models.Membership
+		var err error
+
+		if header := c.Get(OrganizationHeader); header != "" {
+			organizationID, convErr := strconv.Atoi(header)
+			if convErr != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid organization ID",
+				})
+			}
+			membership, err = orgRepo.GetMembership(organizationID, userID)
+		} else {
+			membership, err = orgRepo.GetDefaultMembership(userID)
+		}
+
+		if err != nil {
+			logger.Error("Failed to resolve organization for user ID %d: %v", userID, err)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Forbidden: Not a member of this organization",
+			})
+		}
+
+		if isWriteMethod(c.Method()) {
+			if ok, err := checkWritable(c, subscriptionRepo, membership.OrganizationID); !ok {
+				return err
+			}
+		}
+
+		// Store organization in context for later use
+		c.Locals("organizationID", membership.OrganizationID)
+		c.Locals("organizationRole", membership.Role)
+
+		return c.Next()
+	}
+}
+
+// WritableOrganization is a middleware that refuses write requests to the
+// organization of the :id route parameter while its payment is past due, like
+// OrganizationContext does for the active organization. Requests of users who
+// are not members are passed on, the handlers answer them. It must be
+// registered after JWTProtected.
+func WritableOrganization(database *db.DB) fiber.Handler {
+	orgRepo := models.NewOrganizationRepository(database)
+	subscriptionRepo := models.NewSubscriptionRepository(database)
+
+	return func(c *fiber.Ctx) error {
+		if !isWriteMethod(c.Method()) {
+			return c.Next()
+		}
+
+		userID, ok := c.Locals("userID").(int)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized: Invalid user ID",
+			})
+		}
+
+		organizationID, err := c.ParamsInt("id")
+		if err != nil {
+			return c.Next()
+		}
+		if _, err := orgRepo.GetMembership(organizationID, userID); err != nil {
+			return c.Next()
+		}
+
+		if ok, err := checkWritable(c, subscriptionRepo, organizationID); !ok {
+			return err
+		}
+
+		return c.Next()
+	}
+}
+
+// checkWritable refuses a write to an organization whose payment is past
+// due. When it returns false the error response has already been written.
+func checkWritable(c *fiber.Ctx, subscriptionRepo *models.SubscriptionRepository, organizationID int) (bool, error) {
+	status, err := subscriptionRepo.GetStatus(organizationID)
+	if err != nil {
+		logger.Error("Failed to get subscription status of organization ID %d: %v", organizationID, err)
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resolve organization",
+		})
+	}
+
+	if models.ReadOnlyStatus(status) {
+		return false, c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":               "Organization is read-only until its overdue payment is settled",
+			"code":                "read_only",
+			"subscription_status": status,
+		})
+	}
+
+	return true, nil
+}
+
+// isWriteMethod reports whether an HTTP method changes data
+func isWriteMethod(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
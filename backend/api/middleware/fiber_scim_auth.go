@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/scim"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SCIMProtected is a middleware that authenticates identity providers with
+// their per-tenant bearer token and stores the tenant in the context
+func SCIMProtected(database *db.DB) fiber.Handler {
+	tokenRepo := models.NewScimTokenRepository(database)
+
+	return func(c *fiber.Ctx) error {
+		authorization := c.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			return scimUnauthorized(c)
+		}
+
+		token, err := tokenRepo.Authenticate(strings.TrimPrefix(authorization, "Bearer "))
+		if err != nil {
+			logger.Error("SCIM authentication failed: %v", err)
+			return scimUnauthorized(c)
+		}
+
+		// Store tenant in context for later use
+		c.Locals("scimTenant", token.Tenant)
+
+		return c.Next()
+	}
+}
+
+func scimUnauthorized(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(
+		scim.NewError(fiber.StatusUnauthorized, "", "Unauthorized: Invalid or missing token"),
+		scim.ContentType,
+	)
+}
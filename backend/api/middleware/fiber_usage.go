@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// meterKey identifies the usage counter a buffered API call belongs to
+type meterKey struct {
+	organizationID int
+	periodStart    time.Time
+}
+
+// APICallMeter counts API calls in memory and adds them to the usage
+// counters on Flush, so that requests neither wait on nor serialize behind
+// the counter row of their organization.
+type APICallMeter struct {
+	mu        sync.Mutex
+	calls     map[meterKey]int64
+	increment func(organizationID int, periodStart time.Time, quantity int64) error
+	now       func() time.Time
+}
+
+// NewAPICallMeter creates a meter that records API calls in usage_counters
+func NewAPICallMeter(database *db.DB) *APICallMeter {
+	usageRepo := models.NewUsageCounterRepository(database)
+	return newAPICallMeter(func(organizationID int, periodStart time.Time, quantity int64) error {
+		return usageRepo.IncrementPeriod(organizationID, models.MetricAPICalls, periodStart, quantity)
+	}, time.Now)
+}
+
+func newAPICallMeter(increment func(int, time.Time, int64) error, now func() time.Time) *APICallMeter {
+	return &APICallMeter{
+		calls:     make(map[meterKey]int64),
+		increment: increment,
+		now:       now,
+	}
+}
+
+// add buffers API calls of an organization in the current period
+func (m *APICallMeter) add(key meterKey, quantity int64) {
+	m.mu.Lock()
+	m.calls[key] += quantity
+	m.mu.Unlock()
+}
+
+// Middleware counts the API calls of the active organization once the
+// request has been handled. Requests that did not resolve an organization
+// through OrganizationContext, or that were rejected (status 400 and
+// above), are not metered.
+func (m *APICallMeter) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if err != nil || c.Response().StatusCode() >= fiber.StatusBadRequest {
+			return err
+		}
+		if organizationID, ok := c.Locals("organizationID").(int); ok {
+			m.add(meterKey{organizationID, models.PeriodStart(m.now())}, 1)
+		}
+		return nil
+	}
+}
+
+// Flush records the buffered API calls. Calls that could not be recorded
+// stay buffered for the next flush.
+func (m *APICallMeter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	calls := m.calls
+	m.calls = make(map[meterKey]int64)
+	m.mu.Unlock()
+
+	failed := 0
+	var firstErr error
+	for key, quantity := range calls {
+		if err := m.increment(key.organizationID, key.periodStart, quantity); err != nil {
+			m.add(key, quantity)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("failed to record API calls of %d organization(s): %w", failed, firstErr)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// recordedCalls collects the API calls flushed by a meter
+type recordedCalls map[meterKey]int64
+
+func (r recordedCalls) increment(organizationID int, periodStart time.Time, quantity int64) error {
+	r[meterKey{organizationID, periodStart}] += quantity
+	return nil
+}
+
+func meteredRequest(t *testing.T, meter *APICallMeter, organizationID int, status int) {
+	app := fiber.New()
+	app.Get("/", meter.Middleware(), func(c *fiber.Ctx) error {
+		if organizationID != 0 {
+			c.Locals("organizationID", organizationID)
+		}
+		return c.SendStatus(status)
+	})
+
+	if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil)); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+}
+
+func TestAPICallMeterCountsHandledRequests(t *testing.T) {
+	now := time.Date(2026, time.March, 31, 23, 59, 0, 0, time.UTC)
+	recorded := recordedCalls{}
+	meter := newAPICallMeter(recorded.increment, func() time.Time { return now })
+
+	meteredRequest(t, meter, 1, fiber.StatusOK)
+	meteredRequest(t, meter, 1, fiber.StatusCreated)
+	meteredRequest(t, meter, 1, fiber.StatusPaymentRequired)
+	meteredRequest(t, meter, 1, fiber.StatusForbidden)
+	meteredRequest(t, meter, 2, fiber.StatusTooManyRequests)
+	meteredRequest(t, meter, 0, fiber.StatusOK)
+	now = now.Add(time.Hour)
+	meteredRequest(t, meter, 1, fiber.StatusOK)
+
+	if len(recorded) != 0 {
+		t.Fatalf("API calls recorded before the flush: %v", recorded)
+	}
+	if err := meter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	march := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	want := recordedCalls{{1, march}: 2, {1, april}: 1}
+	if len(recorded) != len(want) {
+		t.Fatalf("Got %v, want %v", recorded, want)
+	}
+	for key, quantity := range want {
+		if recorded[key] != quantity {
+			t.Errorf("Organization %d in %s: got %d calls, want %d", key.organizationID, key.periodStart.Format("2006-01"), recorded[key], quantity)
+		}
+	}
+
+	if err := meter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if recorded[meterKey{1, march}] != 2 {
+		t.Errorf("A second flush recorded the calls again: %v", recorded)
+	}
+}
+
+func TestAPICallMeterKeepsCallsThatFailedToFlush(t *testing.T) {
+	recorded := recordedCalls{}
+	failing := true
+	meter := newAPICallMeter(func(organizationID int, periodStart time.Time, quantity int64) error {
+		if failing {
+			return errors.New("database unavailable")
+		}
+		return recorded.increment(organizationID, periodStart, quantity)
+	}, time.Now)
+
+	meteredRequest(t, meter, 1, fiber.StatusOK)
+	if err := meter.Flush(context.Background()); err == nil {
+		t.Fatal("Expected the flush to fail")
+	}
+
+	meteredRequest(t, meter, 1, fiber.StatusOK)
+	failing = false
+	if err := meter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	var total int64
+	for _, quantity := range recorded {
+		total += quantity
+	}
+	if total != 2 {
+		t.Errorf("Got %d calls recorded, want 2", total)
+	}
+}
@@ -9,56 +9,77 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenTTL is the lifetime of an access token
+const TokenTTL = 24 * time.Hour
+
+// ServiceAccountTokenTTL is the lifetime of an access token issued to a
+// service account, they simply request a new one when it expires
+const ServiceAccountTokenTTL = time.Hour
+
+// Principal types
+const (
+	PrincipalUser           = "user"
+	PrincipalServiceAccount = "service_account"
+)
+
 // Claims represents the JWT claims
 type Claims struct {
 	UserID int `json:"user_id"`
+	// PrincipalType tells humans from machines. Tokens issued before it was
+	// introduced have no principal type and belong to users.
+	PrincipalType string `json:"principal_type,omitempty"`
+	// ServiceAccountID is set for service accounts, UserID is then the
+	// owner of the service account whose data it may access
+	ServiceAccountID int      `json:"service_account_id,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+	// SecretGeneration is the generation of the client secret a service
+	// account token was issued for
+	SecretGeneration int `json:"secret_generation,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// IsServiceAccount reports whether the token was issued to a service account
+func (c *Claims) IsServiceAccount() bool {
+	return c.PrincipalType == PrincipalServiceAccount
+}
+
 // GenerateToken creates a new JWT token for a user
 func GenerateToken(userID int) (string, error) {
-	// Get JWT secret from environment variable or use default for development
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		// Utiliser une valeur par défaut pour le développement
-		secretKey = "dev_jwt_secret_key"
-		log.Println("Warning: Using default JWT_SECRET for development")
-	}
-
-	// Set expiration time (24 hours from now)
-	expirationTime := time.Now().Add(24 * time.Hour)
-
 	// Create claims with user ID and expiration time
 	claims := &Claims{
-		UserID: userID,
+		UserID:        userID,
+		PrincipalType: PrincipalUser,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   "user_authentication",
 		},
 	}
 
-	// Create token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return signClaims(claims)
+}
 
-	// Sign token with secret key
-	tokenString, err := token.SignedString([]byte(secretKey))
-	if err != nil {
-		return "", err
+// GenerateServiceAccountToken creates a new scoped JWT token for a service account
+func GenerateServiceAccountToken(ownerID, serviceAccountID, secretGeneration int, scopes []string) (string, error) {
+	claims := &Claims{
+		UserID:           ownerID,
+		PrincipalType:    PrincipalServiceAccount,
+		ServiceAccountID: serviceAccountID,
+		Scopes:           scopes,
+		SecretGeneration: secretGeneration,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ServiceAccountTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   "service_account_authentication",
+		},
 	}
 
-	return tokenString, nil
+	return signClaims(claims)
 }
 
 // ValidateToken validates a JWT token and returns the claims
 func ValidateToken(tokenString string) (*Claims, error) {
-	// Get JWT secret from environment variable or use default for development
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		// Utiliser une valeur par défaut pour le développement
-		secretKey = "dev_jwt_secret_key"
-		log.Println("Warning: Using default JWT_SECRET for development")
-	}
+	secretKey := jwtSecret()
 
 	// Parse token
 	claims := &Claims{}
@@ -78,5 +99,34 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	if claims.PrincipalType == "" {
+		claims.PrincipalType = PrincipalUser
+	}
+
 	return claims, nil
 }
+
+// signClaims signs the claims with the JWT secret
+func signClaims(claims *Claims) (string, error) {
+	// Create token with claims
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	// Sign token with secret key
+	tokenString, err := token.SignedString([]byte(jwtSecret()))
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// jwtSecret returns the JWT secret from the environment or a default for development
+func jwtSecret() string {
+	secretKey := os.Getenv("JWT_SECRET")
+	if secretKey == "" {
+		// Utiliser une valeur par défaut pour le développement
+		secretKey = "dev_jwt_secret_key"
+		log.Println("Warning: Using default JWT_SECRET for development")
+	}
+	return secretKey
+}
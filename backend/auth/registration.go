@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// Registration modes
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationDomain = "domain"
+	RegistrationClosed = "closed"
+)
+
+// RegistrationPolicy controls who may create an account
+type RegistrationPolicy struct {
+	Mode           string   `json:"mode"`
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+}
+
+// LoadRegistrationPolicy reads the policy from REGISTRATION_MODE and
+// REGISTRATION_ALLOWED_DOMAINS (comma separated). Registration is open by default.
+func LoadRegistrationPolicy() *RegistrationPolicy {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("REGISTRATION_MODE")))
+	switch mode {
+	case RegistrationOpen, RegistrationInvite, RegistrationDomain, RegistrationClosed:
+	case "":
+		mode = RegistrationOpen
+	default:
+		log.Printf("Warning: Unknown REGISTRATION_MODE %q, closing registration", mode)
+		mode = RegistrationClosed
+	}
+
+	policy := &RegistrationPolicy{Mode: mode}
+	for _, domain := range strings.Split(os.Getenv("REGISTRATION_ALLOWED_DOMAINS"), ",") {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain != "" {
+			policy.AllowedDomains = append(policy.AllowedDomains, domain)
+		}
+	}
+
+	if mode == RegistrationDomain && len(policy.AllowedDomains) == 0 {
+		log.Println("Warning: REGISTRATION_MODE is domain but REGISTRATION_ALLOWED_DOMAINS is empty")
+	}
+
+	return policy
+}
+
+// DomainAllowed reports whether the email address belongs to an allowed domain
+func (p *RegistrationPolicy) DomainAllowed(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range p.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,34 @@
+package auth
+
+// Scopes that can be granted to service accounts
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+)
+
+// KnownScopes lists every scope a service account may be granted
+var KnownScopes = []string{ScopeTasksRead, ScopeTasksWrite}
+
+// IsKnownScope reports whether scope is a known scope
+func IsKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the claims grant scope. Users are not restricted
+// by scopes, only service accounts are.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsServiceAccount() {
+		return true
+	}
+	for _, granted := range c.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package billing
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Normalized webhook event types
+const (
+	EventSubscriptionUpdated = "subscription.updated"
+	EventSubscriptionDeleted = "subscription.deleted"
+	EventCheckoutCompleted   = "checkout.completed"
+)
+
+// Subscription statuses, as reported by the provider
+const (
+	StatusTrialing          = "trialing"
+	StatusActive            = "active"
+	StatusPastDue           = "past_due"
+	StatusCanceled          = "canceled"
+	StatusUnpaid            = "unpaid"
+	StatusIncomplete        = "incomplete"
+	StatusIncompleteExpired = "incomplete_expired"
+	StatusPaused            = "paused"
+)
+
+// Metadata keys attached to provider objects to find our records back
+const (
+	MetadataOrganizationID = "organization_id"
+	MetadataPlan           = "plan"
+	// MetadataCoupon holds the code of the coupon redeemed at checkout
+	MetadataCoupon = "coupon"
+)
+
+// ErrInvalidSignature is returned when a webhook payload is not signed by the provider
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Subscription is the provider's view of a subscription
+type Subscription struct {
+	ID                string
+	CustomerID        string
+	Status            string
+	PriceID           string
+	CurrentPeriodEnd  time.Time
+	CancelAtPeriodEnd bool
+	Metadata          map[string]string
+}
+
+// Event is a webhook event normalized across providers. Type is one of the
+// Event* constants, or the provider's type for events that are ignored.
+type Event struct {
+	ID   string
+	Type string
+	// Subscription is set for subscription events
+	Subscription *Subscription
+	// SubscriptionID is set for completed checkouts, the subscription must
+	// be fetched from the provider
+	SubscriptionID string
+}
+
+// CheckoutParams describes a checkout session for a subscription
+type CheckoutParams struct {
+	CustomerID     string
+	PriceID        string
+	SuccessURL     string
+	CancelURL      string
+	OrganizationID string
+	Plan           string
+	// CouponID is the provider coupon applied to the subscription, and
+	// CouponCode our code for it, both empty without a coupon
+	CouponID   string
+	CouponCode string
+}
+
+// CouponParams describes a coupon to create on the provider. Exactly one of
+// PercentOff and AmountOffCents is set, DurationMonths only for repeating
+// coupons.
+type CouponParams struct {
+	Name           string
+	PercentOff     int
+	AmountOffCents int64
+	Currency       string
+	Duration       string
+	DurationMonths int
+}
+
+// CheckoutSession is a hosted payment page
+type CheckoutSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// Provider is a payment provider
+type Provider interface {
+	// CreateCustomer registers a paying customer and returns its ID
+	CreateCustomer(email, name string, metadata map[string]string) (string, error)
+	// CreateCheckoutSession starts a hosted checkout for a subscription
+	CreateCheckoutSession(params *CheckoutParams) (*CheckoutSession, error)
+	// CreatePortalSession returns a link to the hosted customer portal
+	CreatePortalSession(customerID, returnURL string) (string, error)
+	// CreateCoupon registers a discount and returns its ID
+	CreateCoupon(params *CouponParams) (string, error)
+	// ApplyCoupon applies a discount to an existing subscription, replacing
+	// the previous one
+	ApplyCoupon(subscriptionID, couponID string) error
+	// GetSubscription retrieves a subscription
+	GetSubscription(id string) (*Subscription, error)
+	// ParseWebhook verifies the signature of a webhook payload and decodes it
+	ParseWebhook(payload []byte, signature string) (*Event, error)
+}
+
+// Config holds the provider-independent billing settings
+type Config struct {
+	// Prices maps plan codes to provider price IDs
+	Prices          map[string]string
+	SuccessURL      string
+	CancelURL       string
+	PortalReturnURL string
+	SignatureHeader string
+	ProviderName    string
+	// Currency of the amounts of coupons, lowercase ISO 4217
+	Currency string
+}
+
+// PriceFor returns the provider price of a plan
+func (c *Config) PriceFor(plan string) (string, bool) {
+	price, ok := c.Prices[plan]
+	return price, ok
+}
+
+// PlanFor returns the plan sold at a provider price
+func (c *Config) PlanFor(priceID string) (string, bool) {
+	for plan, price := range c.Prices {
+		if price == priceID {
+			return plan, true
+		}
+	}
+	return "", false
+}
+
+// LifecycleStatus maps a provider status to the lifecycle of an
+// organization: trialing, active, past_due or canceled. Past due
+// subscriptions keep their plan while the provider retries the payment,
+// canceled ones fall back to the free plan.
+func LifecycleStatus(status string) string {
+	switch status {
+	case StatusTrialing, StatusActive, StatusPastDue:
+		return status
+	default:
+		return StatusCanceled
+	}
+}
+
+// LoadFromEnv builds the provider selected by BILLING_PROVIDER and its
+// configuration. It returns a nil provider when billing is disabled.
+// BILLING_PRICES maps plans to prices as "pro:price_123,enterprise:price_456",
+// BILLING_CURRENCY is the currency of amount off coupons.
+func LoadFromEnv() (Provider, *Config) {
+	config := &Config{
+		Prices:          map[string]string{},
+		SuccessURL:      envOr("BILLING_SUCCESS_URL", "http://localhost:5173/billing?checkout=success"),
+		CancelURL:       envOr("BILLING_CANCEL_URL", "http://localhost:5173/billing?checkout=canceled"),
+		PortalReturnURL: PageURL(),
+		Currency:        strings.ToLower(envOr("BILLING_CURRENCY", "eur")),
+	}
+
+	for _, pair := range strings.Split(os.Getenv("BILLING_PRICES"), ",") {
+		plan, price, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && plan != "" && price != "" {
+			config.Prices[strings.TrimSpace(plan)] = strings.TrimSpace(price)
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("BILLING_PROVIDER"))) {
+	case "stripe":
+		stripe := NewStripeProvider(os.Getenv("STRIPE_SECRET_KEY"), os.Getenv("STRIPE_WEBHOOK_SECRET"))
+		if base := os.Getenv("STRIPE_API_BASE"); base != "" {
+			stripe.BaseURL = strings.TrimRight(base, "/")
+		}
+		config.ProviderName = "stripe"
+		config.SignatureHeader = StripeSignatureHeader
+		return stripe, config
+	case "":
+		return nil, config
+	default:
+		log.Printf("Warning: Unknown BILLING_PROVIDER %q, billing is disabled", os.Getenv("BILLING_PROVIDER"))
+		return nil, config
+	}
+}
+
+// PageURL is the billing page of the frontend, where owners subscribe and
+// manage their payment method. It is read from BILLING_PORTAL_RETURN_URL.
+func PageURL() string {
+	return envOr("BILLING_PORTAL_RETURN_URL", "http://localhost:5173/billing")
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
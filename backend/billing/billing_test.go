@@ -0,0 +1,39 @@
+package billing
+
+import "testing"
+
+func TestLifecycleStatus(t *testing.T) {
+	tests := map[string]string{
+		StatusTrialing:          StatusTrialing,
+		StatusActive:            StatusActive,
+		StatusPastDue:           StatusPastDue,
+		StatusUnpaid:            StatusCanceled,
+		StatusCanceled:          StatusCanceled,
+		StatusIncomplete:        StatusCanceled,
+		StatusIncompleteExpired: StatusCanceled,
+		StatusPaused:            StatusCanceled,
+		"":                      StatusCanceled,
+	}
+
+	for status, want := range tests {
+		if got := LifecycleStatus(status); got != want {
+			t.Errorf("LifecycleStatus(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestTrialFromEnv(t *testing.T) {
+	t.Setenv("TRIAL_PLAN", "enterprise")
+	t.Setenv("TRIAL_DAYS", "30")
+	t.Setenv("TRIAL_REMINDER_DAYS", "invalid")
+
+	trial := TrialFromEnv()
+	if trial.Plan != "enterprise" || trial.Duration.Hours() != 30*24 || trial.ReminderBefore.Hours() != 3*24 {
+		t.Errorf("Unexpected trial config %+v", trial)
+	}
+
+	t.Setenv("TRIAL_DAYS", "0")
+	if TrialFromEnv().Enabled() {
+		t.Error("TRIAL_DAYS=0 should disable trials")
+	}
+}
@@ -0,0 +1,348 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StripeSignatureHeader carries the signature of Stripe webhooks
+const StripeSignatureHeader = "Stripe-Signature"
+
+// DefaultSignatureTolerance is the maximum age of a signed webhook, it
+// limits replay attacks
+const DefaultSignatureTolerance = 5 * time.Minute
+
+// StripeProvider talks to the Stripe API, or any server implementing the
+// same endpoints
+type StripeProvider struct {
+	APIKey        string
+	WebhookSecret string
+	BaseURL       string
+	HTTPClient    *http.Client
+	Tolerance     time.Duration
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewStripeProvider creates a provider for the live Stripe API
+func NewStripeProvider(apiKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		APIKey:        apiKey,
+		WebhookSecret: webhookSecret,
+		BaseURL:       "https://api.stripe.com",
+		HTTPClient:    &http.Client{Timeout: 30 * time.Second},
+		Tolerance:     DefaultSignatureTolerance,
+		now:           time.Now,
+	}
+}
+
+// stripeError is the error body returned by the API
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// stripeSubscription is the subset of the subscription object we use
+type stripeSubscription struct {
+	ID                string            `json:"id"`
+	Customer          string            `json:"customer"`
+	Status            string            `json:"status"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	Metadata          map[string]string `json:"metadata"`
+	Items             struct {
+		Data []struct {
+			Price struct {
+				ID string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+func (s *stripeSubscription) normalize() *Subscription {
+	sub := &Subscription{
+		ID:                s.ID,
+		CustomerID:        s.Customer,
+		Status:            s.Status,
+		CancelAtPeriodEnd: s.CancelAtPeriodEnd,
+		Metadata:          s.Metadata,
+	}
+	if s.CurrentPeriodEnd > 0 {
+		sub.CurrentPeriodEnd = time.Unix(s.CurrentPeriodEnd, 0).UTC()
+	}
+	if len(s.Items.Data) > 0 {
+		sub.PriceID = s.Items.Data[0].Price.ID
+	}
+	if sub.Metadata == nil {
+		sub.Metadata = map[string]string{}
+	}
+	return sub
+}
+
+// CreateCustomer registers a customer
+func (p *StripeProvider) CreateCustomer(email, name string, metadata map[string]string) (string, error) {
+	form := url.Values{}
+	form.Set("email", email)
+	form.Set("name", name)
+	for key, value := range metadata {
+		form.Set("metadata["+key+"]", value)
+	}
+
+	var customer struct {
+		ID string `json:"id"`
+	}
+	if err := p.post("/v1/customers", form, &customer); err != nil {
+		return "", err
+	}
+
+	return customer.ID, nil
+}
+
+// CreateCheckoutSession starts a hosted checkout in subscription mode
+func (p *StripeProvider) CreateCheckoutSession(params *CheckoutParams) (*CheckoutSession, error) {
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("customer", params.CustomerID)
+	form.Set("line_items[0][price]", params.PriceID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", params.SuccessURL)
+	form.Set("cancel_url", params.CancelURL)
+	form.Set("client_reference_id", params.OrganizationID)
+	form.Set("metadata["+MetadataOrganizationID+"]", params.OrganizationID)
+	form.Set("subscription_data[metadata]["+MetadataOrganizationID+"]", params.OrganizationID)
+	form.Set("subscription_data[metadata]["+MetadataPlan+"]", params.Plan)
+	if params.CouponID != "" {
+		form.Set("discounts[0][coupon]", params.CouponID)
+		form.Set("subscription_data[metadata]["+MetadataCoupon+"]", params.CouponCode)
+	}
+
+	session := &CheckoutSession{}
+	if err := p.post("/v1/checkout/sessions", form, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// CreatePortalSession returns a link to the customer portal
+func (p *StripeProvider) CreatePortalSession(customerID, returnURL string) (string, error) {
+	form := url.Values{}
+	form.Set("customer", customerID)
+	form.Set("return_url", returnURL)
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := p.post("/v1/billing_portal/sessions", form, &session); err != nil {
+		return "", err
+	}
+
+	return session.URL, nil
+}
+
+// CreateCoupon creates a coupon, named after our code
+func (p *StripeProvider) CreateCoupon(params *CouponParams) (string, error) {
+	form := url.Values{}
+	form.Set("name", params.Name)
+	form.Set("duration", params.Duration)
+	form.Set("metadata["+MetadataCoupon+"]", params.Name)
+	if params.PercentOff > 0 {
+		form.Set("percent_off", strconv.Itoa(params.PercentOff))
+	} else {
+		form.Set("amount_off", strconv.FormatInt(params.AmountOffCents, 10))
+		form.Set("currency", params.Currency)
+	}
+	if params.DurationMonths > 0 {
+		form.Set("duration_in_months", strconv.Itoa(params.DurationMonths))
+	}
+
+	var coupon struct {
+		ID string `json:"id"`
+	}
+	if err := p.post("/v1/coupons", form, &coupon); err != nil {
+		return "", err
+	}
+
+	return coupon.ID, nil
+}
+
+// ApplyCoupon sets the discount of a subscription
+func (p *StripeProvider) ApplyCoupon(subscriptionID, couponID string) error {
+	form := url.Values{}
+	form.Set("discounts[0][coupon]", couponID)
+
+	var sub stripeSubscription
+	return p.post("/v1/subscriptions/"+url.PathEscape(subscriptionID), form, &sub)
+}
+
+// GetSubscription retrieves a subscription
+func (p *StripeProvider) GetSubscription(id string) (*Subscription, error) {
+	var sub stripeSubscription
+	if err := p.do(http.MethodGet, "/v1/subscriptions/"+url.PathEscape(id), nil, &sub); err != nil {
+		return nil, err
+	}
+
+	return sub.normalize(), nil
+}
+
+// ParseWebhook verifies the Stripe-Signature header and decodes the event
+func (p *StripeProvider) ParseWebhook(payload []byte, signature string) (*Event, error) {
+	if err := p.verifySignature(payload, signature); err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if raw.ID == "" {
+		return nil, fmt.Errorf("invalid webhook payload: missing event id")
+	}
+
+	event := &Event{ID: raw.ID, Type: raw.Type}
+
+	switch raw.Type {
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var sub stripeSubscription
+		if err := json.Unmarshal(raw.Data.Object, &sub); err != nil {
+			return nil, fmt.Errorf("invalid subscription object: %w", err)
+		}
+		event.Subscription = sub.normalize()
+		event.Type = EventSubscriptionUpdated
+		if raw.Type == "customer.subscription.deleted" {
+			event.Type = EventSubscriptionDeleted
+		}
+	case "checkout.session.completed":
+		var session struct {
+			Subscription string `json:"subscription"`
+		}
+		if err := json.Unmarshal(raw.Data.Object, &session); err != nil {
+			return nil, fmt.Errorf("invalid checkout session object: %w", err)
+		}
+		if session.Subscription != "" {
+			event.Type = EventCheckoutCompleted
+			event.SubscriptionID = session.Subscription
+		}
+	}
+
+	return event, nil
+}
+
+// verifySignature checks a "t=timestamp,v1=signature" header: the signature
+// is the HMAC-SHA256 of "timestamp.payload" keyed with the webhook secret
+func (p *StripeProvider) verifySignature(payload []byte, header string) error {
+	if p.WebhookSecret == "" {
+		return ErrInvalidSignature
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	if age := now().Sub(time.Unix(seconds, 0)); p.Tolerance > 0 && (age > p.Tolerance || age < -p.Tolerance) {
+		return ErrInvalidSignature
+	}
+
+	expected := SignStripePayload(p.WebhookSecret, timestamp, payload)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// SignStripePayload computes the v1 signature of a webhook payload. It is
+// exported for tests and local tools that forge webhooks.
+func SignStripePayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *StripeProvider) post(path string, form url.Values, out interface{}) error {
+	return p.do(http.MethodPost, path, form, out)
+}
+
+// do sends an authenticated form request and decodes the JSON response
+func (p *StripeProvider) do(method, path string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, p.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr stripeError
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("stripe: %s (%s)", apiErr.Error.Message, apiErr.Error.Type)
+		}
+		return fmt.Errorf("stripe: unexpected status %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,350 @@
+package billing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAPIKey        = "sk_test_123"
+	testWebhookSecret = "whsec_test"
+)
+
+// fakeStripe is a local server implementing the subset of the Stripe API
+// used by StripeProvider
+type fakeStripe struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests map[string]url.Values
+	subs     map[string]map[string]interface{}
+}
+
+func newFakeStripe(t *testing.T) *fakeStripe {
+	t.Helper()
+
+	f := &fakeStripe{
+		requests: map[string]url.Values{},
+		subs:     map[string]map[string]interface{}{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/customers", func(w http.ResponseWriter, r *http.Request) {
+		f.record(r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": "cus_1", "object": "customer"})
+	})
+	mux.HandleFunc("/v1/checkout/sessions", func(w http.ResponseWriter, r *http.Request) {
+		form := f.record(r)
+		if form.Get("line_items[0][price]") == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": map[string]string{"type": "invalid_request_error", "message": "Missing required param: line_items[0][price]."},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": "cs_1", "url": "https://checkout.example.com/cs_1"})
+	})
+	mux.HandleFunc("/v1/billing_portal/sessions", func(w http.ResponseWriter, r *http.Request) {
+		f.record(r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": "bps_1", "url": "https://portal.example.com/bps_1"})
+	})
+	mux.HandleFunc("/v1/coupons", func(w http.ResponseWriter, r *http.Request) {
+		f.record(r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": "co_1", "object": "coupon"})
+	})
+	mux.HandleFunc("/v1/subscriptions/", func(w http.ResponseWriter, r *http.Request) {
+		f.record(r)
+		id := strings.TrimPrefix(r.URL.Path, "/v1/subscriptions/")
+
+		f.mu.Lock()
+		sub, ok := f.subs[id]
+		f.mu.Unlock()
+
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{
+				"error": map[string]string{"type": "invalid_request_error", "message": "No such subscription: '" + id + "'"},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, sub)
+	})
+
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testAPIKey {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"error": map[string]string{"type": "invalid_request_error", "message": "Invalid API Key provided"},
+			})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// record stores the form of a request under its path
+func (f *fakeStripe) record(r *http.Request) url.Values {
+	r.ParseForm()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.URL.Path] = r.PostForm
+	return r.PostForm
+}
+
+func (f *fakeStripe) request(path string) url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+func (f *fakeStripe) addSubscription(sub map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subs[sub["id"].(string)] = sub
+}
+
+func (f *fakeStripe) provider() *StripeProvider {
+	p := NewStripeProvider(testAPIKey, testWebhookSecret)
+	p.BaseURL = f.URL
+	return p
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestStripeCheckoutAndPortal(t *testing.T) {
+	fake := newFakeStripe(t)
+	p := fake.provider()
+
+	customerID, err := p.CreateCustomer("owner@example.com", "Acme", map[string]string{MetadataOrganizationID: "42"})
+	if err != nil {
+		t.Fatalf("CreateCustomer returned error: %v", err)
+	}
+	if customerID != "cus_1" {
+		t.Errorf("Expected customer cus_1, got %q", customerID)
+	}
+	if got := fake.request("/v1/customers").Get("metadata[organization_id]"); got != "42" {
+		t.Errorf("Customer metadata not sent, got %q", got)
+	}
+
+	session, err := p.CreateCheckoutSession(&CheckoutParams{
+		CustomerID:     customerID,
+		PriceID:        "price_pro",
+		SuccessURL:     "https://app.example.com/ok",
+		CancelURL:      "https://app.example.com/ko",
+		OrganizationID: "42",
+		Plan:           "pro",
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession returned error: %v", err)
+	}
+	if session.URL != "https://checkout.example.com/cs_1" {
+		t.Errorf("Unexpected checkout URL %q", session.URL)
+	}
+
+	form := fake.request("/v1/checkout/sessions")
+	for key, want := range map[string]string{
+		"mode":                 "subscription",
+		"customer":             "cus_1",
+		"line_items[0][price]": "price_pro",
+		"client_reference_id":  "42",
+		"subscription_data[metadata][organization_id]": "42",
+		"subscription_data[metadata][plan]":            "pro",
+	} {
+		if got := form.Get(key); got != want {
+			t.Errorf("Checkout param %s = %q, want %q", key, got, want)
+		}
+	}
+
+	portalURL, err := p.CreatePortalSession(customerID, "https://app.example.com/billing")
+	if err != nil {
+		t.Fatalf("CreatePortalSession returned error: %v", err)
+	}
+	if portalURL != "https://portal.example.com/bps_1" {
+		t.Errorf("Unexpected portal URL %q", portalURL)
+	}
+	if got := fake.request("/v1/billing_portal/sessions").Get("return_url"); got != "https://app.example.com/billing" {
+		t.Errorf("Portal return_url = %q", got)
+	}
+}
+
+func TestStripeCoupons(t *testing.T) {
+	fake := newFakeStripe(t)
+	p := fake.provider()
+
+	couponID, err := p.CreateCoupon(&CouponParams{
+		Name: "WELCOME", AmountOffCents: 500, Currency: "eur", Duration: "repeating", DurationMonths: 3,
+	})
+	if err != nil {
+		t.Fatalf("CreateCoupon returned error: %v", err)
+	}
+	if couponID != "co_1" {
+		t.Errorf("Expected coupon co_1, got %q", couponID)
+	}
+
+	form := fake.request("/v1/coupons")
+	for key, want := range map[string]string{
+		"name": "WELCOME", "amount_off": "500", "currency": "eur", "duration": "repeating",
+		"duration_in_months": "3", "metadata[coupon]": "WELCOME", "percent_off": "",
+	} {
+		if got := form.Get(key); got != want {
+			t.Errorf("Coupon param %s = %q, want %q", key, got, want)
+		}
+	}
+
+	_, err = p.CreateCheckoutSession(&CheckoutParams{
+		CustomerID: "cus_1", PriceID: "price_pro", OrganizationID: "42", Plan: "pro",
+		CouponID: couponID, CouponCode: "WELCOME",
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession returned error: %v", err)
+	}
+	form = fake.request("/v1/checkout/sessions")
+	if form.Get("discounts[0][coupon]") != "co_1" || form.Get("subscription_data[metadata][coupon]") != "WELCOME" {
+		t.Errorf("Coupon not passed to checkout: %v", form)
+	}
+
+	fake.addSubscription(map[string]interface{}{"id": "sub_1", "customer": "cus_1", "status": "active"})
+	if err := p.ApplyCoupon("sub_1", couponID); err != nil {
+		t.Fatalf("ApplyCoupon returned error: %v", err)
+	}
+	if got := fake.request("/v1/subscriptions/sub_1").Get("discounts[0][coupon]"); got != "co_1" {
+		t.Errorf("Subscription discount = %q", got)
+	}
+}
+
+func TestStripeGetSubscription(t *testing.T) {
+	fake := newFakeStripe(t)
+	p := fake.provider()
+
+	periodEnd := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake.addSubscription(map[string]interface{}{
+		"id":                   "sub_1",
+		"customer":             "cus_1",
+		"status":               "past_due",
+		"current_period_end":   periodEnd.Unix(),
+		"cancel_at_period_end": true,
+		"metadata":             map[string]string{MetadataOrganizationID: "42"},
+		"items": map[string]interface{}{
+			"data": []interface{}{map[string]interface{}{"price": map[string]string{"id": "price_pro"}}},
+		},
+	})
+
+	sub, err := p.GetSubscription("sub_1")
+	if err != nil {
+		t.Fatalf("GetSubscription returned error: %v", err)
+	}
+
+	if sub.CustomerID != "cus_1" || sub.Status != StatusPastDue || sub.PriceID != "price_pro" {
+		t.Errorf("Unexpected subscription %+v", sub)
+	}
+	if !sub.CurrentPeriodEnd.Equal(periodEnd) || !sub.CancelAtPeriodEnd {
+		t.Errorf("Unexpected period %v / cancel %v", sub.CurrentPeriodEnd, sub.CancelAtPeriodEnd)
+	}
+	if sub.Metadata[MetadataOrganizationID] != "42" {
+		t.Errorf("Metadata not decoded: %v", sub.Metadata)
+	}
+
+	if _, err := p.GetSubscription("sub_missing"); err == nil || !strings.Contains(err.Error(), "No such subscription") {
+		t.Errorf("Expected API error for a missing subscription, got %v", err)
+	}
+}
+
+func TestStripeAPIErrors(t *testing.T) {
+	fake := newFakeStripe(t)
+
+	p := fake.provider()
+	p.APIKey = "sk_wrong"
+	if _, err := p.CreateCustomer("a@example.com", "A", nil); err == nil || !strings.Contains(err.Error(), "Invalid API Key") {
+		t.Errorf("Expected authentication error, got %v", err)
+	}
+
+	p = fake.provider()
+	if _, err := p.CreateCheckoutSession(&CheckoutParams{CustomerID: "cus_1"}); err == nil || !strings.Contains(err.Error(), "line_items") {
+		t.Errorf("Expected invalid request error, got %v", err)
+	}
+}
+
+// signedHeader builds a Stripe-Signature header for payload at time ts
+func signedHeader(secret string, ts time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, SignStripePayload(secret, timestamp, payload))
+}
+
+func TestStripeParseWebhook(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := NewStripeProvider(testAPIKey, testWebhookSecret)
+	p.now = func() time.Time { return now }
+
+	subscriptionEvent := []byte(`{"id":"evt_1","type":"customer.subscription.deleted","data":{"object":{
+		"id":"sub_1","customer":"cus_1","status":"canceled","metadata":{"organization_id":"42"}}}}`)
+	checkoutEvent := []byte(`{"id":"evt_2","type":"checkout.session.completed","data":{"object":{
+		"id":"cs_1","mode":"subscription","subscription":"sub_1"}}}`)
+	otherEvent := []byte(`{"id":"evt_3","type":"invoice.created","data":{"object":{"id":"in_1"}}}`)
+
+	event, err := p.ParseWebhook(subscriptionEvent, signedHeader(testWebhookSecret, now, subscriptionEvent))
+	if err != nil {
+		t.Fatalf("ParseWebhook returned error: %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != EventSubscriptionDeleted || event.Subscription == nil || event.Subscription.ID != "sub_1" {
+		t.Errorf("Unexpected subscription event %+v", event)
+	}
+
+	event, err = p.ParseWebhook(checkoutEvent, signedHeader(testWebhookSecret, now, checkoutEvent))
+	if err != nil {
+		t.Fatalf("ParseWebhook returned error: %v", err)
+	}
+	if event.Type != EventCheckoutCompleted || event.SubscriptionID != "sub_1" {
+		t.Errorf("Unexpected checkout event %+v", event)
+	}
+
+	event, err = p.ParseWebhook(otherEvent, signedHeader(testWebhookSecret, now, otherEvent))
+	if err != nil {
+		t.Fatalf("ParseWebhook returned error: %v", err)
+	}
+	if event.Type != "invoice.created" || event.Subscription != nil || event.SubscriptionID != "" {
+		t.Errorf("Unexpected ignored event %+v", event)
+	}
+}
+
+func TestStripeParseWebhookRejectsBadSignatures(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := NewStripeProvider(testAPIKey, testWebhookSecret)
+	p.now = func() time.Time { return now }
+
+	payload := []byte(`{"id":"evt_1","type":"customer.subscription.updated","data":{"object":{"id":"sub_1"}}}`)
+
+	tests := map[string]string{
+		"missing header":   "",
+		"wrong secret":     signedHeader("whsec_other", now, payload),
+		"tampered payload": signedHeader(testWebhookSecret, now, []byte(`{"id":"evt_2"}`)),
+		"too old":          signedHeader(testWebhookSecret, now.Add(-10*time.Minute), payload),
+		"from the future":  signedHeader(testWebhookSecret, now.Add(10*time.Minute), payload),
+		"no v1 signature":  "t=" + strconv.FormatInt(now.Unix(), 10),
+	}
+
+	for name, header := range tests {
+		if _, err := p.ParseWebhook(payload, header); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+
+	// Any of several v1 signatures may match, as during secret rotation
+	header := signedHeader("whsec_old", now, payload) + ",v1=" + SignStripePayload(testWebhookSecret, strconv.FormatInt(now.Unix(), 10), payload)
+	if _, err := p.ParseWebhook(payload, header); err != nil {
+		t.Errorf("Expected rotated secret to be accepted, got %v", err)
+	}
+}
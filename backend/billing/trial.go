@@ -0,0 +1,47 @@
+package billing
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// TrialConfig describes the trial offered to new signups
+type TrialConfig struct {
+	// Plan is the plan granted during the trial
+	Plan string
+	// Duration of the trial, trials are disabled when zero
+	Duration time.Duration
+	// ReminderBefore is how long before the end of the trial owners are reminded
+	ReminderBefore time.Duration
+}
+
+// Enabled reports whether new signups get a trial
+func (c *TrialConfig) Enabled() bool {
+	return c.Plan != "" && c.Duration > 0
+}
+
+// TrialFromEnv reads TRIAL_PLAN, TRIAL_DAYS and TRIAL_REMINDER_DAYS. New
+// signups get a 14 days trial of the pro plan by default, TRIAL_DAYS=0
+// disables trials.
+func TrialFromEnv() *TrialConfig {
+	return &TrialConfig{
+		Plan:           envOr("TRIAL_PLAN", "pro"),
+		Duration:       envDays("TRIAL_DAYS", 14),
+		ReminderBefore: envDays("TRIAL_REMINDER_DAYS", 3),
+	}
+}
+
+func envDays(key string, fallback int) time.Duration {
+	days := fallback
+	if value := os.Getenv(key); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Printf("Warning: Invalid %s %q, using %d", key, value, fallback)
+		} else {
+			days = parsed
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -12,6 +12,9 @@ import (
 // DB is a database connection pool
 type DB struct {
 	*sql.DB
+	// tenants resolves the connections of isolated organizations. It is nil
+	// in the shared tenancy mode and on the connections it resolves.
+	tenants *tenantPools
 }
 
 // NewDB creates a new database connection
@@ -23,6 +26,32 @@ func NewDB() (*DB, error) {
 	log.Println("DB_HOST:", os.Getenv("DB_HOST"))
 	log.Println("DB_PORT:", os.Getenv("DB_PORT"))
 
+	connStr := connectionString()
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		return nil, err
+	}
+
+	log.Println("Successfully connected to database")
+
+	database := &DB{DB: db}
+	if mode := os.Getenv("TENANCY_MODE"); mode == TenancyIsolated {
+		database.tenants = newTenantPools(connStr)
+		log.Println("Tenancy mode: isolated organizations use their own schema or database")
+	} else if mode != "" && mode != TenancyShared {
+		log.Printf("Warning: Unknown TENANCY_MODE %q, using %s", mode, TenancyShared)
+	}
+
+	return database, nil
+}
+
+// connectionString builds the URL of the main database from the DB_* variables
+func connectionString() string {
 	// Utiliser des valeurs par défaut si les variables d'environnement ne sont pas définies
 	dbUser := "postgres"
 	if os.Getenv("DB_USER") != "" {
@@ -50,18 +79,6 @@ func NewDB() (*DB, error) {
 		dbPort = os.Getenv("DB_PORT")
 	}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		dbUser, dbPassword, dbHost, dbPort, dbName)
-
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		return nil, err
-	}
-
-	if err = db.Ping(); err != nil {
-		return nil, err
-	}
-
-	log.Println("Successfully connected to database")
-	return &DB{db}, nil
 }
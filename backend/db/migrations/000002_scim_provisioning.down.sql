@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS scim_group_members;
+DROP TABLE IF EXISTS scim_groups;
+DROP TABLE IF EXISTS scim_tokens;
+DROP INDEX IF EXISTS idx_users_scim_external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS scim_tenant;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS active;
@@ -0,0 +1,34 @@
+-- Account state managed by SCIM provisioning
+ALTER TABLE users ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS scim_tenant VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_scim_external_id ON users(scim_tenant, external_id) WHERE external_id IS NOT NULL;
+
+-- Bearer tokens used by identity providers, one or more per tenant
+CREATE TABLE IF NOT EXISTS scim_tokens (
+    id SERIAL PRIMARY KEY,
+    tenant VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS scim_groups (
+    id SERIAL PRIMARY KEY,
+    tenant VARCHAR(255) NOT NULL,
+    display_name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant, display_name)
+);
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+    group_id INTEGER REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX idx_scim_groups_tenant ON scim_groups(tenant);
+CREATE INDEX idx_scim_group_members_user_id ON scim_group_members(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS invite_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS device_authorizations;
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,18 @@
+-- Machine principals authenticating with the client credentials grant
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(64) UNIQUE NOT NULL,
+    client_secret_hash VARCHAR(255) NOT NULL,
+    -- Incremented when the secret is rotated, tokens carry the generation
+    -- they were issued for
+    secret_generation INTEGER NOT NULL DEFAULT 1,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    disabled_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_service_accounts_owner_id ON service_accounts(owner_id);
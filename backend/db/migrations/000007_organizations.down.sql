@@ -0,0 +1,3 @@
+ALTER TABLE tasks DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS organization_memberships;
+DROP TABLE IF EXISTS organizations;
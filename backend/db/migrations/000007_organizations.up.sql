@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    personal BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS organization_memberships (
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+
+-- Give every existing user a personal workspace owning their tasks
+DO $$
+DECLARE
+    u RECORD;
+    org_id INTEGER;
+BEGIN
+    FOR u IN
+        SELECT id, name, email FROM users
+        WHERE NOT EXISTS (SELECT 1 FROM organization_memberships m WHERE m.user_id = users.id)
+    LOOP
+        INSERT INTO organizations (name, personal)
+        VALUES (COALESCE(NULLIF(u.name, ''), u.email), TRUE)
+        RETURNING id INTO org_id;
+
+        INSERT INTO organization_memberships (organization_id, user_id, role)
+        VALUES (org_id, u.id, 'owner');
+
+        UPDATE tasks SET organization_id = org_id WHERE user_id = u.id AND organization_id IS NULL;
+    END LOOP;
+END $$;
+
+CREATE INDEX idx_tasks_organization_id ON tasks(organization_id);
+CREATE INDEX idx_organization_memberships_user_id ON organization_memberships(user_id);
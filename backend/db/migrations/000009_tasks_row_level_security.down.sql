@@ -0,0 +1,14 @@
+DROP POLICY IF EXISTS tasks_tenant_isolation ON tasks;
+ALTER TABLE tasks DISABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'app_tenant') THEN
+        ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE ALL ON TABLES FROM app_tenant;
+        ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE ALL ON SEQUENCES FROM app_tenant;
+        REVOKE ALL ON ALL TABLES IN SCHEMA public FROM app_tenant;
+        REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM app_tenant;
+        REVOKE USAGE ON SCHEMA public FROM app_tenant;
+        DROP ROLE app_tenant;
+    END IF;
+END $$;
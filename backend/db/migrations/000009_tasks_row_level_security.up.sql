@@ -0,0 +1,41 @@
+-- Restricted role assumed by the application (SET LOCAL ROLE) for requests
+-- made on behalf of a tenant. It is not the owner of the tables so row level
+-- security applies to it, even when the application connects as a superuser.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'app_tenant') THEN
+        CREATE ROLE app_tenant NOLOGIN NOBYPASSRLS;
+    END IF;
+    EXECUTE format('GRANT app_tenant TO %I', current_user);
+END $$;
+
+-- The role only gets the tables tenant transactions use, later migrations
+-- grant their own tables explicitly
+GRANT USAGE ON SCHEMA public TO app_tenant;
+GRANT SELECT, INSERT, UPDATE, DELETE ON tasks TO app_tenant;
+GRANT USAGE, SELECT ON SEQUENCE tasks_id_seq TO app_tenant;
+
+-- Read by the policies below
+GRANT SELECT ON organization_memberships TO app_tenant;
+
+-- Tasks are only visible in the current organization, and only to its members.
+-- Unset settings read as NULL so that a connection without a tenant sees nothing.
+ALTER TABLE tasks ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY tasks_tenant_isolation ON tasks
+    USING (
+        organization_id = NULLIF(current_setting('app.current_org_id', true), '')::INTEGER
+        AND EXISTS (
+            SELECT 1 FROM organization_memberships m
+            WHERE m.organization_id = tasks.organization_id
+                AND m.user_id = NULLIF(current_setting('app.current_user_id', true), '')::INTEGER
+        )
+    )
+    WITH CHECK (
+        organization_id = NULLIF(current_setting('app.current_org_id', true), '')::INTEGER
+        AND EXISTS (
+            SELECT 1 FROM organization_memberships m
+            WHERE m.organization_id = tasks.organization_id
+                AND m.user_id = NULLIF(current_setting('app.current_user_id', true), '')::INTEGER
+        )
+    );
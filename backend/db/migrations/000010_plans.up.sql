@@ -0,0 +1,20 @@
+-- NULL limits are unlimited
+CREATE TABLE IF NOT EXISTS plans (
+    code VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    max_tasks INTEGER,
+    max_members INTEGER,
+    max_storage_bytes BIGINT,
+    features TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (code, name, max_tasks, max_members, max_storage_bytes, features) VALUES
+    ('free', 'Free', 100, 3, 104857600, '{}'),
+    ('pro', 'Pro', 10000, 25, 10737418240, '{invitations}'),
+    ('enterprise', 'Enterprise', NULL, NULL, NULL, '{invitations}')
+ON CONFLICT (code) DO NOTHING;
+
+-- A user's plan is the plan of their personal workspace
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS plan_code VARCHAR(50) NOT NULL DEFAULT 'free' REFERENCES plans(code);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS billing_events;
+DROP TABLE IF EXISTS subscriptions;
+ALTER TABLE organizations DROP COLUMN IF EXISTS billing_customer_id;
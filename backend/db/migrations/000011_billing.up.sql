@@ -0,0 +1,23 @@
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS billing_customer_id VARCHAR(255) UNIQUE;
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    provider_subscription_id VARCHAR(255) UNIQUE NOT NULL,
+    provider_customer_id VARCHAR(255) NOT NULL,
+    plan_code VARCHAR(50) NOT NULL REFERENCES plans(code),
+    status VARCHAR(30) NOT NULL,
+    current_period_end TIMESTAMP WITH TIME ZONE,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_subscriptions_organization_id ON subscriptions(organization_id);
+
+-- Webhook events already processed, providers deliver at least once
+CREATE TABLE IF NOT EXISTS billing_events (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,11 @@
+-- Metered usage aggregated per organization, metric and monthly period
+CREATE TABLE IF NOT EXISTS usage_counters (
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    metric VARCHAR(50) NOT NULL,
+    period_start DATE NOT NULL,
+    quantity BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, metric, period_start)
+);
+
+CREATE INDEX idx_usage_counters_period_start ON usage_counters(period_start);
@@ -0,0 +1,15 @@
+-- Feature flags evaluated by the API. Variants lists the values a flag can
+-- serve, the first one is served when the flag is disabled. Rules are
+-- evaluated in order, the default variant is served when none matches.
+CREATE TABLE IF NOT EXISTS feature_flags (
+    key VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(20) NOT NULL DEFAULT 'boolean',
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    variants TEXT[] NOT NULL DEFAULT ARRAY['off', 'on'],
+    default_variant VARCHAR(100) NOT NULL DEFAULT 'off',
+    rules JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT feature_flags_kind_check CHECK (kind IN ('boolean', 'multivariate'))
+);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_organizations_subscription_status;
+
+ALTER TABLE organizations DROP CONSTRAINT IF EXISTS organizations_subscription_status_check;
+
+ALTER TABLE organizations
+    DROP COLUMN IF EXISTS dunning_notified_at,
+    DROP COLUMN IF EXISTS past_due_since,
+    DROP COLUMN IF EXISTS trial_reminder_sent_at,
+    DROP COLUMN IF EXISTS trial_ends_at,
+    DROP COLUMN IF EXISTS subscription_status;
@@ -0,0 +1,16 @@
+-- Subscription lifecycle of organizations: trials started at signup and
+-- dunning of past due subscriptions. Organizations without a paid
+-- subscription are active on their plan.
+ALTER TABLE organizations
+    ADD COLUMN IF NOT EXISTS subscription_status VARCHAR(20) NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS trial_ends_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS trial_reminder_sent_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS past_due_since TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS dunning_notified_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE organizations ADD CONSTRAINT organizations_subscription_status_check
+    CHECK (subscription_status IN ('trialing', 'active', 'past_due', 'canceled'));
+
+-- Organizations in a subscription state that scheduled jobs follow up
+CREATE INDEX idx_organizations_subscription_status ON organizations(subscription_status)
+    WHERE subscription_status IN ('trialing', 'past_due');
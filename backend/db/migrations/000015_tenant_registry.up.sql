@@ -0,0 +1,15 @@
+-- Registry of the organizations whose data is physically separated, used
+-- when TENANCY_MODE=isolated. Schema tenants live in a schema of this
+-- database, database tenants in a database of their own. Their tables are
+-- created by the migrations of db/migrations/tenant.
+CREATE TABLE IF NOT EXISTS tenants (
+    organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE RESTRICT,
+    mode VARCHAR(20) NOT NULL,
+    schema_name VARCHAR(63) UNIQUE,
+    database_url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT tenants_mode_check CHECK (
+        (mode = 'schema' AND schema_name IS NOT NULL AND database_url IS NULL)
+        OR (mode = 'database' AND database_url IS NOT NULL AND schema_name IS NULL)
+    )
+);
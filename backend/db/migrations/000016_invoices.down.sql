@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS invoices;
+DROP TABLE IF EXISTS invoice_sequences;
+ALTER TABLE organizations
+    DROP COLUMN IF EXISTS billing_name,
+    DROP COLUMN IF EXISTS billing_email,
+    DROP COLUMN IF EXISTS billing_address,
+    DROP COLUMN IF EXISTS billing_country,
+    DROP COLUMN IF EXISTS billing_tax_id;
+ALTER TABLE plans DROP COLUMN IF EXISTS price_cents;
@@ -0,0 +1,46 @@
+-- Monthly price of each plan, in cents of the invoicing currency
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS price_cents BIGINT NOT NULL DEFAULT 0;
+
+UPDATE plans SET price_cents = 2900 WHERE code = 'pro' AND price_cents = 0;
+UPDATE plans SET price_cents = 9900 WHERE code = 'enterprise' AND price_cents = 0;
+
+-- Details printed on the invoices of an organization
+ALTER TABLE organizations
+    ADD COLUMN IF NOT EXISTS billing_name VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS billing_email VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS billing_address TEXT,
+    ADD COLUMN IF NOT EXISTS billing_country VARCHAR(2),
+    ADD COLUMN IF NOT EXISTS billing_tax_id VARCHAR(50);
+
+-- Last invoice number issued each year, numbers are assigned in the
+-- transaction inserting the invoice so that they have no gaps
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    year INTEGER PRIMARY KEY,
+    last_number INTEGER NOT NULL
+);
+
+-- Invoices are legal documents: the parties and lines are copied at issue
+-- time and invoices outlive the organization they were sent to
+CREATE TABLE IF NOT EXISTS invoices (
+    id SERIAL PRIMARY KEY,
+    number VARCHAR(50) UNIQUE NOT NULL,
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL,
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    seller JSONB NOT NULL,
+    customer JSONB NOT NULL,
+    lines JSONB NOT NULL,
+    subtotal_cents BIGINT NOT NULL,
+    tax_name VARCHAR(50) NOT NULL,
+    tax_rate_basis_points INTEGER NOT NULL,
+    tax_cents BIGINT NOT NULL,
+    total_cents BIGINT NOT NULL,
+    html_key VARCHAR(255),
+    pdf_key VARCHAR(255),
+    issued_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, period_start)
+);
+
+-- Invoices whose documents are not stored yet
+CREATE INDEX idx_invoices_pending_documents ON invoices(id) WHERE pdf_key IS NULL;
@@ -0,0 +1,5 @@
+DROP POLICY IF EXISTS tasks_visibility ON tasks;
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_visibility_check;
+ALTER TABLE tasks DROP COLUMN IF EXISTS team_id, DROP COLUMN IF EXISTS visibility;
+DROP TABLE IF EXISTS team_memberships;
+DROP TABLE IF EXISTS teams;
@@ -0,0 +1,63 @@
+-- Teams group members of an organization, such as departments
+CREATE TABLE IF NOT EXISTS teams (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, name),
+    UNIQUE (id, organization_id)
+);
+
+-- Team members must be members of the organization, and leave its teams
+-- when they leave it
+CREATE TABLE IF NOT EXISTS team_memberships (
+    team_id INTEGER NOT NULL,
+    organization_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id),
+    FOREIGN KEY (team_id, organization_id) REFERENCES teams(id, organization_id) ON DELETE CASCADE,
+    FOREIGN KEY (organization_id, user_id) REFERENCES organization_memberships(organization_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_team_memberships_user_id ON team_memberships(user_id);
+
+-- Read by the tasks_visibility policy below
+GRANT SELECT ON team_memberships TO app_tenant;
+
+-- Tasks are visible to their creator only (private), to the members of their
+-- team (team) or to every member of the organization (organization). Tasks
+-- of a deleted team stay visible to their creator and to admins only.
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'organization',
+    ADD COLUMN IF NOT EXISTS team_id INTEGER REFERENCES teams(id) ON DELETE SET NULL;
+
+ALTER TABLE tasks ADD CONSTRAINT tasks_visibility_check
+    CHECK (visibility IN ('private', 'team', 'organization'));
+
+CREATE INDEX idx_tasks_team_id ON tasks(team_id);
+
+-- Backs up the visibility conditions of the application. Restrictive
+-- policies are combined with tasks_tenant_isolation, both must pass.
+CREATE POLICY tasks_visibility ON tasks AS RESTRICTIVE
+    USING (
+        visibility = 'organization'
+        OR user_id = NULLIF(current_setting('app.current_user_id', true), '')::INTEGER
+        OR (
+            visibility = 'team'
+            AND (
+                EXISTS (
+                    SELECT 1 FROM team_memberships tm
+                    WHERE tm.team_id = tasks.team_id
+                        AND tm.user_id = NULLIF(current_setting('app.current_user_id', true), '')::INTEGER
+                )
+                OR EXISTS (
+                    SELECT 1 FROM organization_memberships m
+                    WHERE m.organization_id = tasks.organization_id
+                        AND m.user_id = NULLIF(current_setting('app.current_user_id', true), '')::INTEGER
+                        AND m.role IN ('owner', 'admin')
+                )
+            )
+        )
+    );
@@ -0,0 +1,18 @@
+-- Audit trail of the transfers of tasks, service accounts and organization
+-- ownership from one user to another. The emails are kept so that records
+-- stay readable once the users are deleted.
+CREATE TABLE IF NOT EXISTS ownership_transfers (
+    id SERIAL PRIMARY KEY,
+    from_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    from_email VARCHAR(255) NOT NULL,
+    to_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    to_email VARCHAR(255) NOT NULL,
+    performed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    tasks INTEGER NOT NULL DEFAULT 0,
+    service_accounts INTEGER NOT NULL DEFAULT 0,
+    organizations INTEGER NOT NULL DEFAULT 0,
+    memberships INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ownership_transfers_from_user_id ON ownership_transfers(from_user_id);
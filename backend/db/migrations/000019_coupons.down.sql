@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_invoices_coupon_code;
+ALTER TABLE invoices DROP COLUMN IF EXISTS discount_cents, DROP COLUMN IF EXISTS coupon_code;
+DROP TABLE IF EXISTS coupon_redemptions;
+DROP TABLE IF EXISTS coupons;
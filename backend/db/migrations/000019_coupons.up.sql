@@ -0,0 +1,47 @@
+-- Discount codes. A coupon takes a percentage or a fixed amount off the
+-- plan price, once, for a number of months or forever. Coupons are archived
+-- rather than deleted so that their redemptions stay reportable.
+CREATE TABLE IF NOT EXISTS coupons (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    percent_off INTEGER CHECK (percent_off BETWEEN 1 AND 100),
+    amount_off_cents BIGINT CHECK (amount_off_cents > 0),
+    duration VARCHAR(20) NOT NULL CHECK (duration IN ('once', 'repeating', 'forever')),
+    duration_months INTEGER CHECK (duration_months > 0),
+    max_redemptions INTEGER CHECK (max_redemptions > 0),
+    redemption_count INTEGER NOT NULL DEFAULT 0,
+    -- Plans the coupon applies to, any paid plan when empty
+    plan_codes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    provider_coupon_id VARCHAR(255),
+    archived_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((percent_off IS NULL) <> (amount_off_cents IS NULL)),
+    CHECK ((duration = 'repeating') = (duration_months IS NOT NULL))
+);
+
+-- An organization redeems a coupon once. The discount applies to the
+-- monthly periods from starts_at until ends_at, forever when it is NULL.
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id SERIAL PRIMARY KEY,
+    coupon_id INTEGER NOT NULL REFERENCES coupons(id),
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL,
+    redeemed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    plan_code VARCHAR(50) NOT NULL,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('checkout', 'subscription')),
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (coupon_id, organization_id)
+);
+
+CREATE INDEX idx_coupon_redemptions_organization_id ON coupon_redemptions(organization_id);
+
+-- Discount granted on each invoice, for reporting
+ALTER TABLE invoices
+    ADD COLUMN IF NOT EXISTS coupon_code VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS discount_cents BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_invoices_coupon_code ON invoices(coupon_code) WHERE coupon_code IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Indexes of the task list, which is always scoped to an organization and
+-- paginated with a keyset on its sort keys followed by the task ID. Tasks
+-- without a due date sort as if due at infinity.
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_created_at ON tasks(organization_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_updated_at ON tasks(organization_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_due_date
+    ON tasks(organization_id, (COALESCE(due_date, 'infinity'::timestamptz)), id);
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_status ON tasks(organization_id, status, id);
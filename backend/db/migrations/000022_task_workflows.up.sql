@@ -0,0 +1,14 @@
+-- Status workflow of the tasks of an organization: statuses, transitions
+-- and hooks, see the workflow package. Organizations without a row use the
+-- default workflow.
+CREATE TABLE IF NOT EXISTS task_workflows (
+    organization_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    definition JSONB NOT NULL,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Set by the workflow hooks when a task enters a done status
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE tasks SET completed_at = updated_at WHERE status = 'completed' AND completed_at IS NULL;
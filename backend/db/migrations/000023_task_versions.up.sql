@@ -0,0 +1,3 @@
+-- Version of tasks for optimistic concurrency control, incremented by every
+-- update and exposed as the ETag of tasks
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
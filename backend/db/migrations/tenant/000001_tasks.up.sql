@@ -0,0 +1,39 @@
+-- Tasks of an isolated tenant. Users and organizations stay in the shared
+-- database, so user_id and organization_id have no foreign key here.
+CREATE TABLE IF NOT EXISTS tasks (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    due_date TIMESTAMP WITH TIME ZONE,
+    user_id INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    organization_id INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_user_id ON tasks(user_id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_id ON tasks(organization_id);
+
+-- Same restricted role as the shared schema, see migration 000009. Roles are
+-- global to a Postgres cluster, a dedicated database may need to create it.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'app_tenant') THEN
+        CREATE ROLE app_tenant NOLOGIN NOBYPASSRLS;
+    END IF;
+    EXECUTE format('GRANT app_tenant TO %I', current_user);
+    EXECUTE format('GRANT USAGE ON SCHEMA %I TO app_tenant', current_schema());
+END $$;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON tasks TO app_tenant;
+GRANT USAGE, SELECT ON SEQUENCE tasks_id_seq TO app_tenant;
+
+-- The tenant only holds its own organization, membership is checked by the
+-- application against the shared database before the transaction starts
+ALTER TABLE tasks ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY tasks_tenant_isolation ON tasks
+    USING (organization_id = NULLIF(current_setting('app.current_org_id', true), '')::INTEGER)
+    WITH CHECK (organization_id = NULLIF(current_setting('app.current_org_id', true), '')::INTEGER);
@@ -0,0 +1,2 @@
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_visibility_check;
+ALTER TABLE tasks DROP COLUMN IF EXISTS team_id, DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,10 @@
+-- Task visibility, see migration 000017 of the shared schema. Teams live in
+-- the shared database, visibility is enforced by the application.
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'organization',
+    ADD COLUMN IF NOT EXISTS team_id INTEGER;
+
+ALTER TABLE tasks ADD CONSTRAINT tasks_visibility_check
+    CHECK (visibility IN ('private', 'team', 'organization'));
+
+CREATE INDEX IF NOT EXISTS idx_tasks_team_id ON tasks(team_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_tasks_organization_status;
+DROP INDEX IF EXISTS idx_tasks_organization_due_date;
+DROP INDEX IF EXISTS idx_tasks_organization_updated_at;
+DROP INDEX IF EXISTS idx_tasks_organization_created_at;
@@ -0,0 +1,6 @@
+-- Indexes of the task list, see migration 000020 of the shared schema
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_created_at ON tasks(organization_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_updated_at ON tasks(organization_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_due_date
+    ON tasks(organization_id, (COALESCE(due_date, 'infinity'::timestamptz)), id);
+CREATE INDEX IF NOT EXISTS idx_tasks_organization_status ON tasks(organization_id, status, id);
@@ -0,0 +1,5 @@
+-- Completion time of tasks, see migration 000022 of the shared schema.
+-- Workflows live in the shared database.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE tasks SET completed_at = updated_at WHERE status = 'completed' AND completed_at IS NULL;
@@ -0,0 +1,2 @@
+-- Version of tasks, see migration 000023 of the shared schema
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,7 @@
+-- Trash of tasks, see migration 000024 of the shared schema. Users live in
+-- the shared database, deleted_by has no foreign key here.
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS deleted_by INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_deleted_at ON tasks(deleted_at) WHERE deleted_at IS NOT NULL;
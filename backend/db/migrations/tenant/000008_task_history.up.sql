@@ -0,0 +1,35 @@
+-- Change log of tasks, see migration 000025 of the shared schema. Users live
+-- in the shared database, actor_id has no foreign key here.
+CREATE TABLE IF NOT EXISTS task_history (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor_id INTEGER,
+    changes JSONB NOT NULL,
+    reverted_to INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (task_id, version)
+);
+
+GRANT SELECT, INSERT ON task_history TO app_tenant;
+GRANT USAGE, SELECT ON SEQUENCE task_history_id_seq TO app_tenant;
+
+ALTER TABLE task_history ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY task_history_tenant_isolation ON task_history
+    USING (EXISTS (SELECT 1 FROM tasks WHERE tasks.id = task_history.task_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM tasks WHERE tasks.id = task_history.task_id));
+
+INSERT INTO task_history (task_id, version, action, changes, created_at)
+SELECT t.id, t.version, 'snapshot', (
+    SELECT COALESCE(jsonb_object_agg(f.key, jsonb_build_object('old', NULL, 'new', f.value)), '{}'::jsonb)
+    FROM jsonb_each(jsonb_build_object(
+        'title', t.title, 'description', t.description, 'status', t.status,
+        'due_date', t.due_date, 'completed_at', t.completed_at, 'visibility', t.visibility,
+        'team_id', t.team_id, 'user_id', t.user_id, 'deleted_at', t.deleted_at
+    )) AS f
+    WHERE f.value <> 'null'::jsonb
+), t.updated_at
+FROM tasks t
+ON CONFLICT (task_id, version) DO NOTHING;
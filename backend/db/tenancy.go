@@ -0,0 +1,344 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// Tenancy modes, selected by TENANCY_MODE
+const (
+	// TenancyShared keeps every organization in the public schema, isolated
+	// by row level security
+	TenancyShared = "shared"
+	// TenancyIsolated stores the data of the organizations listed in the
+	// tenant registry in their own schema or database
+	TenancyIsolated = "isolated"
+)
+
+// Storage of an isolated tenant
+const (
+	TenantModeSchema   = "schema"
+	TenantModeDatabase = "database"
+)
+
+// TenantMigrationsDir holds the migrations of the tables stored per tenant
+const TenantMigrationsDir = "db/migrations/tenant"
+
+// ErrTenantNotFound is returned for organizations that are not isolated
+var ErrTenantNotFound = errors.New("tenant not found")
+
+var schemaNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// Tenant is an organization whose data is physically separated, in a schema
+// of the main database or in a database of its own
+type Tenant struct {
+	OrganizationID int
+	Mode           string
+	SchemaName     string
+	DatabaseURL    string
+}
+
+// Validate checks the storage of a tenant is fully described
+func (t *Tenant) Validate() error {
+	switch t.Mode {
+	case TenantModeSchema:
+		if !schemaNamePattern.MatchString(t.SchemaName) || t.SchemaName == "public" || strings.HasPrefix(t.SchemaName, "pg_") {
+			return fmt.Errorf("invalid schema name %q", t.SchemaName)
+		}
+	case TenantModeDatabase:
+		if t.DatabaseURL == "" {
+			return errors.New("database mode requires a database URL")
+		}
+	default:
+		return fmt.Errorf("mode must be %s or %s", TenantModeSchema, TenantModeDatabase)
+	}
+	return nil
+}
+
+// tenantPools caches one connection pool per isolated tenant
+type tenantPools struct {
+	baseURL string
+
+	mu    sync.Mutex
+	pools map[int]*DB
+}
+
+func newTenantPools(baseURL string) *tenantPools {
+	return &tenantPools{baseURL: baseURL, pools: map[int]*DB{}}
+}
+
+// Isolated reports whether organizations may have their own schema or database
+func (d *DB) Isolated() bool {
+	return d.tenants != nil
+}
+
+// GetTenant retrieves the registry entry of an isolated organization
+func (d *DB) GetTenant(organizationID int) (*Tenant, error) {
+	t := &Tenant{}
+	var schemaName, databaseURL sql.NullString
+
+	query := `SELECT organization_id, mode, schema_name, database_url FROM tenants WHERE organization_id = $1`
+	err := d.QueryRow(query, organizationID).Scan(&t.OrganizationID, &t.Mode, &schemaName, &databaseURL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTenantNotFound
+		}
+		return nil, err
+	}
+
+	t.SchemaName = schemaName.String
+	t.DatabaseURL = databaseURL.String
+	return t, nil
+}
+
+// GetTenants lists the registry
+func (d *DB) GetTenants() ([]*Tenant, error) {
+	rows, err := d.Query(`SELECT organization_id, mode, schema_name, database_url FROM tenants ORDER BY organization_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []*Tenant{}
+	for rows.Next() {
+		t := &Tenant{}
+		var schemaName, databaseURL sql.NullString
+		if err := rows.Scan(&t.OrganizationID, &t.Mode, &schemaName, &databaseURL); err != nil {
+			return nil, err
+		}
+		t.SchemaName = schemaName.String
+		t.DatabaseURL = databaseURL.String
+		tenants = append(tenants, t)
+	}
+
+	return tenants, rows.Err()
+}
+
+// ForOrganization returns the connection holding the data of an
+// organization: the pool of its schema or database when it is isolated, d
+// otherwise. Repositories work unchanged on the returned connection. The
+// registry is read on every call so that an organization isolated by
+// another process is picked up immediately, pools are reused.
+func (d *DB) ForOrganization(organizationID int) (*DB, error) {
+	if d.tenants == nil {
+		return d, nil
+	}
+
+	tenant, err := d.GetTenant(organizationID)
+	if err == ErrTenantNotFound {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return d.tenants.pool(tenant)
+}
+
+// ForTenant returns the connection of a registered tenant
+func (d *DB) ForTenant(tenant *Tenant) (*DB, error) {
+	if d.tenants == nil {
+		return nil, errors.New("tenant isolation is disabled, set TENANCY_MODE=" + TenancyIsolated)
+	}
+	return d.tenants.pool(tenant)
+}
+
+// pool returns the cached pool of a tenant, opening it on first use
+func (p *tenantPools) pool(tenant *Tenant) (*DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pool, ok := p.pools[tenant.OrganizationID]; ok {
+		return pool, nil
+	}
+
+	connStr, err := tenantConnString(p.baseURL, tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+	pool.SetMaxOpenConns(tenantMaxOpenConns())
+
+	p.pools[tenant.OrganizationID] = &DB{DB: pool}
+	return p.pools[tenant.OrganizationID], nil
+}
+
+// tenantConnString returns the connection string of a tenant. Schema tenants
+// use the main database with a search_path starting with their schema, so
+// that unqualified table names resolve to the tenant tables first and to the
+// shared tables of the public schema otherwise.
+func tenantConnString(baseURL string, tenant *Tenant) (string, error) {
+	if err := tenant.Validate(); err != nil {
+		return "", err
+	}
+
+	if tenant.Mode == TenantModeDatabase {
+		return tenant.DatabaseURL, nil
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	// lib/pq sends unknown parameters to the server as run-time settings
+	query := u.Query()
+	query.Set("search_path", tenant.SchemaName+",public")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// tenantMaxOpenConns bounds each tenant pool with DB_TENANT_MAX_OPEN_CONNS
+func tenantMaxOpenConns() int {
+	if n, err := strconv.Atoi(os.Getenv("DB_TENANT_MAX_OPEN_CONNS")); err == nil && n > 0 {
+		return n
+	}
+	return 5
+}
+
+// RegisterTenant creates the storage of a tenant, applies the tenant
+// migrations found in dir and adds it to the registry. Schemas are created,
+// databases must already exist. The organization must not have tasks in the
+// shared schema yet, existing data is not moved.
+func (d *DB) RegisterTenant(tenant *Tenant, dir string) error {
+	if err := tenant.Validate(); err != nil {
+		return err
+	}
+
+	var shared int
+	if err := d.QueryRow(`SELECT COUNT(*) FROM public.tasks WHERE organization_id = $1`, tenant.OrganizationID).Scan(&shared); err != nil {
+		return err
+	}
+	if shared > 0 {
+		return fmt.Errorf("organization %d already has %d tasks in the shared schema", tenant.OrganizationID, shared)
+	}
+
+	if tenant.Mode == TenantModeSchema {
+		if _, err := d.Exec(`CREATE SCHEMA IF NOT EXISTS ` + pq.QuoteIdentifier(tenant.SchemaName)); err != nil {
+			return err
+		}
+	}
+
+	pool, err := d.ForTenant(tenant)
+	if err != nil {
+		return err
+	}
+
+	if _, err := pool.MigrateTenant(dir); err != nil {
+		return err
+	}
+
+	_, err = d.Exec(`
+		INSERT INTO tenants (organization_id, mode, schema_name, database_url, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NOW())
+	`, tenant.OrganizationID, tenant.Mode, tenant.SchemaName, tenant.DatabaseURL)
+	return err
+}
+
+// MigrateTenants applies the tenant migrations found in dir to every
+// registered tenant. It returns the number of migrations applied per
+// organization.
+func (d *DB) MigrateTenants(dir string) (map[int]int, error) {
+	tenants, err := d.GetTenants()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]int{}
+	for _, tenant := range tenants {
+		pool, err := d.ForTenant(tenant)
+		if err != nil {
+			return applied, err
+		}
+
+		n, err := pool.MigrateTenant(dir)
+		if err != nil {
+			return applied, fmt.Errorf("organization %d: %w", tenant.OrganizationID, err)
+		}
+		applied[tenant.OrganizationID] = n
+	}
+
+	return applied, nil
+}
+
+// MigrateTenant applies the *.up.sql migrations of dir that the tenant
+// connection d has not run yet, in order, each in its own transaction. The
+// versions applied are recorded in the tenant_migrations table of the
+// tenant schema or database.
+func (d *DB) MigrateTenant(dir string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(files)
+
+	// The first schema of the search_path is the tenant schema
+	_, err = d.Exec(`
+		CREATE TABLE IF NOT EXISTS tenant_migrations (
+			version VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, file := range files {
+		version := strings.TrimSuffix(filepath.Base(file), ".up.sql")
+
+		var exists bool
+		if err := d.QueryRow(`SELECT EXISTS (SELECT 1 FROM tenant_migrations WHERE version = $1)`, version).Scan(&exists); err != nil {
+			return applied, err
+		}
+		if exists {
+			continue
+		}
+
+		script, err := os.ReadFile(file)
+		if err != nil {
+			return applied, err
+		}
+
+		if err := d.runMigration(version, string(script)); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", version, err)
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+func (d *DB) runMigration(version, script string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO tenant_migrations (version) VALUES ($1)`, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// TenantRole is the restricted role assumed by tenant transactions. Row level
+// security policies apply to it, see migration 000009.
+const TenantRole = "app_tenant"
+
+// WithTenant runs fn in a transaction acting on behalf of a user in an
+// organization. The transaction switches to TenantRole and sets
+// app.current_user_id and app.current_org_id, so that row level security
+// hides the rows of every other tenant whatever the queries run by fn.
+// The transaction runs on the connection of the organization, see
+// ForOrganization. It is committed when fn returns nil and rolled back
+// otherwise.
+func (d *DB) WithTenant(userID, organizationID int, fn func(tx *sql.Tx) error) error {
+	conn, err := d.ForOrganization(organizationID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// SET LOCAL and set_config(..., true) only last until the end of the
+	// transaction, the pooled connection is clean when it is released
+	if _, err := tx.Exec(`SET LOCAL ROLE ` + pq.QuoteIdentifier(TenantRole)); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`SELECT set_config('app.current_user_id', $1, true), set_config('app.current_org_id', $2, true)`,
+		strconv.Itoa(userID), strconv.Itoa(organizationID),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
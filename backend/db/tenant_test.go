@@ -0,0 +1,219 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// tenantFixture is a user who belongs to one organization owning one task
+type tenantFixture struct {
+	userID, organizationID, taskID int
+}
+
+// openTenantTestDB connects to the test database and skips the test when it
+// is unavailable or the row level security migration has not been applied
+func openTenantTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := NewDB()
+	if err != nil {
+		t.Skipf("Database unavailable: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	var enabled bool
+	err = db.QueryRow(`SELECT relrowsecurity FROM pg_class WHERE relname = 'tasks'`).Scan(&enabled)
+	if err != nil || !enabled {
+		t.Skip("Row level security is not enabled on tasks, run the migrations first")
+	}
+
+	return db
+}
+
+// createTenant inserts a user, an organization they own and a task in it
+// using the unrestricted connection
+func createTenant(t *testing.T, db *DB, label string) tenantFixture {
+	t.Helper()
+
+	var f tenantFixture
+	email := fmt.Sprintf("rls-%s-%d@example.com", label, time.Now().UnixNano())
+
+	err := db.QueryRow(
+		`INSERT INTO users (email, password, name) VALUES ($1, 'x', $2) RETURNING id`, email, label,
+	).Scan(&f.userID)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	err = db.QueryRow(`INSERT INTO organizations (name) VALUES ($1) RETURNING id`, label).Scan(&f.organizationID)
+	if err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM organizations WHERE id = $1`, f.organizationID)
+		db.Exec(`DELETE FROM users WHERE id = $1`, f.userID)
+	})
+
+	_, err = db.Exec(
+		`INSERT INTO organization_memberships (organization_id, user_id, role) VALUES ($1, $2, 'owner')`,
+		f.organizationID, f.userID,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create membership: %v", err)
+	}
+
+	err = db.QueryRow(
+		`INSERT INTO tasks (title, status, user_id, organization_id) VALUES ($1, 'pending', $2, $3) RETURNING id`,
+		label+" task", f.userID, f.organizationID,
+	).Scan(&f.taskID)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	return f
+}
+
+// visibleTasks returns the IDs among ids that a tenant transaction can read
+func visibleTasks(t *testing.T, db *DB, userID, organizationID int, ids ...int) []int {
+	t.Helper()
+
+	visible := []int{}
+	err := db.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		for _, id := range ids {
+			var found int
+			err := tx.QueryRow(`SELECT id FROM tasks WHERE id = $1`, id).Scan(&found)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			visible = append(visible, found)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Tenant transaction failed: %v", err)
+	}
+
+	return visible
+}
+
+func TestWithTenantIsolatesTasks(t *testing.T) {
+	db := openTenantTestDB(t)
+	alice := createTenant(t, db, "alice")
+	bob := createTenant(t, db, "bob")
+
+	// Each tenant only reads its own task, even without a WHERE on the tenant
+	if got := visibleTasks(t, db, alice.userID, alice.organizationID, alice.taskID, bob.taskID); len(got) != 1 || got[0] != alice.taskID {
+		t.Errorf("Alice should only see task %d, got %v", alice.taskID, got)
+	}
+	if got := visibleTasks(t, db, bob.userID, bob.organizationID, alice.taskID, bob.taskID); len(got) != 1 || got[0] != bob.taskID {
+		t.Errorf("Bob should only see task %d, got %v", bob.taskID, got)
+	}
+
+	// Claiming another organization without being a member reveals nothing
+	if got := visibleTasks(t, db, alice.userID, bob.organizationID, alice.taskID, bob.taskID); len(got) != 0 {
+		t.Errorf("Alice should see no task in Bob's organization, got %v", got)
+	}
+}
+
+func TestWithTenantBlocksCrossTenantWrites(t *testing.T) {
+	db := openTenantTestDB(t)
+	alice := createTenant(t, db, "alice")
+	bob := createTenant(t, db, "bob")
+
+	err := db.WithTenant(alice.userID, alice.organizationID, func(tx *sql.Tx) error {
+		for _, query := range []string{
+			`UPDATE tasks SET title = 'hacked' WHERE id = $1`,
+			`DELETE FROM tasks WHERE id = $1`,
+		} {
+			result, err := tx.Exec(query, bob.taskID)
+			if err != nil {
+				return err
+			}
+			if n, _ := result.RowsAffected(); n != 0 {
+				t.Errorf("%q affected %d rows of another tenant", query, n)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Tenant transaction failed: %v", err)
+	}
+
+	// Inserting into another organization violates the policy
+	err = db.WithTenant(alice.userID, alice.organizationID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO tasks (title, status, user_id, organization_id) VALUES ('intruder', 'pending', $1, $2)`,
+			alice.userID, bob.organizationID,
+		)
+		return err
+	})
+	if err == nil {
+		t.Error("Inserting a task into another organization should fail")
+	}
+
+	var title string
+	if err := db.QueryRow(`SELECT title FROM tasks WHERE id = $1`, bob.taskID).Scan(&title); err != nil {
+		t.Fatalf("Bob's task should still exist: %v", err)
+	}
+	if title != "bob task" {
+		t.Errorf("Bob's task was modified: %q", title)
+	}
+}
+
+func TestWithTenantEnforcesTaskVisibility(t *testing.T) {
+	db := openTenantTestDB(t)
+	owner := createTenant(t, db, "owner")
+	member := createTenant(t, db, "member")
+
+	_, err := db.Exec(
+		`INSERT INTO organization_memberships (organization_id, user_id, role) VALUES ($1, $2, 'member')`,
+		owner.organizationID, member.userID,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create membership: %v", err)
+	}
+
+	var teamID, privateID, teamTaskID int
+	if err := db.QueryRow(
+		`INSERT INTO teams (organization_id, name) VALUES ($1, 'Sales') RETURNING id`, owner.organizationID,
+	).Scan(&teamID); err != nil {
+		t.Fatalf("Failed to create team: %v", err)
+	}
+
+	insert := `INSERT INTO tasks (title, status, user_id, organization_id, visibility, team_id)
+		VALUES ('scoped', 'pending', $1, $2, $3, $4) RETURNING id`
+	if err := db.QueryRow(insert, owner.userID, owner.organizationID, "private", nil).Scan(&privateID); err != nil {
+		t.Fatalf("Failed to create private task: %v", err)
+	}
+	if err := db.QueryRow(insert, owner.userID, owner.organizationID, "team", teamID).Scan(&teamTaskID); err != nil {
+		t.Fatalf("Failed to create team task: %v", err)
+	}
+
+	// The member only sees the organization wide task until they join the team
+	if got := visibleTasks(t, db, member.userID, owner.organizationID, owner.taskID, privateID, teamTaskID); len(got) != 1 || got[0] != owner.taskID {
+		t.Errorf("Member should only see task %d, got %v", owner.taskID, got)
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO team_memberships (team_id, organization_id, user_id) VALUES ($1, $2, $3)`,
+		teamID, owner.organizationID, member.userID,
+	)
+	if err != nil {
+		t.Fatalf("Failed to join team: %v", err)
+	}
+
+	if got := visibleTasks(t, db, member.userID, owner.organizationID, owner.taskID, privateID, teamTaskID); len(got) != 2 || got[1] != teamTaskID {
+		t.Errorf("Team member should see tasks %d and %d, got %v", owner.taskID, teamTaskID, got)
+	}
+
+	// The creator always sees their private task
+	if got := visibleTasks(t, db, owner.userID, owner.organizationID, privateID); len(got) != 1 {
+		t.Errorf("Owner should see their private task, got %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+package flags
+
+import (
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ContextFrom builds the evaluation context of a request from the user ID
+// set by JWTProtected and the organization set by OrganizationContext. On
+// routes without OrganizationContext only user targeting applies.
+func (s *Service) ContextFrom(c *fiber.Ctx) Context {
+	ctx := Context{}
+	ctx.UserID, _ = c.Locals("userID").(int)
+	ctx.OrganizationID, _ = c.Locals("organizationID").(int)
+
+	if ctx.OrganizationID != 0 && s.PlanOf != nil {
+		plan, err := s.PlanOf(ctx.OrganizationID)
+		if err != nil {
+			logger.Error("Failed to resolve plan of organization ID %d for feature flags: %v", ctx.OrganizationID, err)
+		}
+		ctx.Plan = plan
+	}
+
+	return ctx
+}
+
+// EnabledFor reports whether a flag is enabled for the current request
+func (s *Service) EnabledFor(c *fiber.Ctx, key string) bool {
+	return s.Enabled(key, s.ContextFrom(c))
+}
+
+// VariantFor returns the variant of a flag served to the current request
+func (s *Service) VariantFor(c *fiber.Ctx, key string) string {
+	return s.Variant(key, s.ContextFrom(c))
+}
@@ -0,0 +1,246 @@
+// Package flags evaluates feature flags. Flags are stored in Postgres and
+// cached in memory by a Service, evaluation itself never touches the database.
+package flags
+
+import (
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+)
+
+// DefaultCacheTTL is how long flags are served from memory before being
+// reloaded. Changes made through another instance are visible after at most
+// this delay.
+const DefaultCacheTTL = 30 * time.Second
+
+// Context describes the subject a flag is evaluated for. Zero values match
+// no targeting condition.
+type Context struct {
+	UserID         int
+	OrganizationID int
+	Plan           string
+}
+
+// Store loads the flag definitions
+type Store interface {
+	GetAll() ([]*models.FeatureFlag, error)
+}
+
+// Evaluate returns the variant of flag served to ctx. Rules are tried in
+// order, the first rule matching ctx and, for percentage rollouts, whose
+// bucket includes the subject wins.
+func Evaluate(flag *models.FeatureFlag, ctx Context) string {
+	if !flag.Enabled {
+		return flag.OffVariant()
+	}
+
+	for _, rule := range flag.Rules {
+		if matches(&rule, ctx) && inRollout(flag.Key, &rule, ctx) {
+			return rule.Variant
+		}
+	}
+
+	return flag.DefaultVariant
+}
+
+func matches(rule *models.FlagRule, ctx Context) bool {
+	if len(rule.UserIDs) > 0 && !containsInt(rule.UserIDs, ctx.UserID) {
+		return false
+	}
+	if len(rule.OrganizationIDs) > 0 && !containsInt(rule.OrganizationIDs, ctx.OrganizationID) {
+		return false
+	}
+	if len(rule.Plans) > 0 && !containsString(rule.Plans, ctx.Plan) {
+		return false
+	}
+	return true
+}
+
+// inRollout places the subject of the rule in one of 100 buckets. The
+// bucket only depends on the flag key and the subject, so a user keeps the
+// same variant across requests and instances and stays included when the
+// percentage grows.
+func inRollout(key string, rule *models.FlagRule, ctx Context) bool {
+	if rule.Percentage == nil {
+		return true
+	}
+
+	subject := ctx.UserID
+	if rule.BucketBy == models.BucketByOrganization {
+		subject = ctx.OrganizationID
+	}
+	if subject == 0 {
+		return false
+	}
+
+	return Bucket(key, subject) < *rule.Percentage
+}
+
+// Bucket returns the stable rollout bucket, between 0 and 99, of a subject for a flag
+func Bucket(key string, subject int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	h.Write([]byte(":"))
+	h.Write([]byte(strconv.Itoa(subject)))
+	return int(h.Sum32() % 100)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Service evaluates flags from an in-memory copy of the store, reloaded
+// when older than its TTL
+type Service struct {
+	store Store
+	ttl   time.Duration
+	// PlanOf resolves the plan of an organization for the request helpers,
+	// plan targeting is skipped when nil
+	PlanOf func(organizationID int) (string, error)
+
+	mu       sync.RWMutex
+	flags    map[string]*models.FeatureFlag
+	loadedAt time.Time
+	loaded   bool
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewService creates a service reading flags from store
+func NewService(store Store, ttl time.Duration) *Service {
+	return &Service{
+		store: store,
+		ttl:   ttl,
+		flags: map[string]*models.FeatureFlag{},
+		now:   time.Now,
+	}
+}
+
+// NewDatabaseService creates a service reading flags from Postgres, with
+// plan targeting and the cache TTL of FEATURE_FLAGS_CACHE_TTL
+func NewDatabaseService(database *db.DB) *Service {
+	s := NewService(models.NewFeatureFlagRepository(database), CacheTTLFromEnv())
+
+	planRepo := models.NewPlanRepository(database)
+	s.PlanOf = func(organizationID int) (string, error) {
+		plan, err := planRepo.GetForOrganization(organizationID)
+		if err != nil {
+			return "", err
+		}
+		return plan.Code, nil
+	}
+
+	return s
+}
+
+// Variant returns the variant of a flag served to ctx, or an empty string
+// when the flag does not exist
+func (s *Service) Variant(key string, ctx Context) string {
+	flag, ok := s.snapshot()[key]
+	if !ok {
+		return ""
+	}
+	return Evaluate(flag, ctx)
+}
+
+// Enabled reports whether ctx gets another variant than the off variant of
+// a flag. Unknown flags are disabled.
+func (s *Service) Enabled(key string, ctx Context) bool {
+	flag, ok := s.snapshot()[key]
+	if !ok {
+		return false
+	}
+	return Evaluate(flag, ctx) != flag.OffVariant()
+}
+
+// EvaluateAll returns the variant of every flag served to ctx
+func (s *Service) EvaluateAll(ctx Context) map[string]string {
+	variants := map[string]string{}
+	for key, flag := range s.snapshot() {
+		variants[key] = Evaluate(flag, ctx)
+	}
+	return variants
+}
+
+// Invalidate drops the cache, the next evaluation reloads the flags
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = false
+}
+
+// snapshot returns the cached flags, reloading them when stale. When the
+// store fails the previous flags are kept until the next reload.
+func (s *Service) snapshot() map[string]*models.FeatureFlag {
+	s.mu.RLock()
+	flags, fresh := s.flags, s.fresh()
+	s.mu.RUnlock()
+	if fresh {
+		return flags
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another request may have reloaded while we waited for the lock
+	if s.fresh() {
+		return s.flags
+	}
+
+	all, err := s.store.GetAll()
+	s.loaded = true
+	s.loadedAt = s.now()
+	if err != nil {
+		logger.Error("Failed to load feature flags: %v", err)
+		return s.flags
+	}
+
+	s.flags = make(map[string]*models.FeatureFlag, len(all))
+	for _, flag := range all {
+		s.flags[flag.Key] = flag
+	}
+
+	return s.flags
+}
+
+// fresh must be called with the lock held
+func (s *Service) fresh() bool {
+	return s.loaded && s.now().Sub(s.loadedAt) < s.ttl
+}
+
+// CacheTTLFromEnv reads FEATURE_FLAGS_CACHE_TTL, a Go duration
+func CacheTTLFromEnv() time.Duration {
+	value := os.Getenv("FEATURE_FLAGS_CACHE_TTL")
+	if value == "" {
+		return DefaultCacheTTL
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		log.Printf("Warning: Invalid FEATURE_FLAGS_CACHE_TTL %q, using %s", value, DefaultCacheTTL)
+		return DefaultCacheTTL
+	}
+
+	return ttl
+}
@@ -0,0 +1,204 @@
+package flags
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+)
+
+func percentage(p int) *int {
+	return &p
+}
+
+// fakeStore counts loads and serves flags or an error
+type fakeStore struct {
+	flags []*models.FeatureFlag
+	err   error
+	loads int
+}
+
+func (s *fakeStore) GetAll() ([]*models.FeatureFlag, error) {
+	s.loads++
+	return s.flags, s.err
+}
+
+func TestEvaluateTargeting(t *testing.T) {
+	flag := &models.FeatureFlag{
+		Key:            "new-editor",
+		Kind:           models.FlagKindMultivariate,
+		Enabled:        true,
+		Variants:       []string{"control", "compact", "wide"},
+		DefaultVariant: "control",
+		Rules: []models.FlagRule{
+			{UserIDs: []int{7}, Variant: "wide"},
+			{OrganizationIDs: []int{3}, Plans: []string{"pro"}, Variant: "compact"},
+			{Plans: []string{"enterprise"}, Variant: "wide"},
+		},
+	}
+	if err := flag.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  Context
+		want string
+	}{
+		{"targeted user", Context{UserID: 7, OrganizationID: 3, Plan: "free"}, "wide"},
+		{"organization and plan", Context{UserID: 1, OrganizationID: 3, Plan: "pro"}, "compact"},
+		{"organization with another plan", Context{UserID: 1, OrganizationID: 3, Plan: "free"}, "control"},
+		{"plan", Context{UserID: 1, OrganizationID: 9, Plan: "enterprise"}, "wide"},
+		{"no match", Context{UserID: 1, OrganizationID: 9, Plan: "free"}, "control"},
+		{"anonymous", Context{}, "control"},
+	}
+
+	for _, tt := range tests {
+		if got := Evaluate(flag, tt.ctx); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	flag.Enabled = false
+	if got := Evaluate(flag, Context{UserID: 7}); got != "control" {
+		t.Errorf("Disabled flag served %q, want the off variant", got)
+	}
+}
+
+func TestEvaluatePercentageRollout(t *testing.T) {
+	flag := &models.FeatureFlag{
+		Key:     "fast-sync",
+		Enabled: true,
+		Rules:   []models.FlagRule{{Percentage: percentage(25), Variant: models.VariantOn}},
+	}
+	if err := flag.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	enabled := map[int]bool{}
+	for userID := 1; userID <= 10000; userID++ {
+		enabled[userID] = Evaluate(flag, Context{UserID: userID}) == models.VariantOn
+	}
+
+	count := 0
+	for _, on := range enabled {
+		if on {
+			count++
+		}
+	}
+	if count < 2250 || count > 2750 {
+		t.Errorf("Expected about 25%% of users in the rollout, got %d out of 10000", count)
+	}
+
+	// Evaluation is stable and growing the rollout keeps included users
+	flag.Rules[0].Percentage = percentage(50)
+	for userID, on := range enabled {
+		got := Evaluate(flag, Context{UserID: userID}) == models.VariantOn
+		if on && !got {
+			t.Fatalf("User %d left the rollout when it grew", userID)
+		}
+	}
+
+	// Users without an ID are never part of a rollout
+	if got := Evaluate(flag, Context{}); got != models.VariantOff {
+		t.Errorf("Anonymous context served %q", got)
+	}
+}
+
+func TestEvaluateRolloutByOrganization(t *testing.T) {
+	flag := &models.FeatureFlag{
+		Key:     "bulk-import",
+		Enabled: true,
+		Rules: []models.FlagRule{{
+			Percentage: percentage(50),
+			BucketBy:   models.BucketByOrganization,
+			Variant:    models.VariantOn,
+		}},
+	}
+	if err := flag.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	// Every member of an organization gets the same variant
+	for orgID := 1; orgID <= 50; orgID++ {
+		want := Evaluate(flag, Context{UserID: 1, OrganizationID: orgID})
+		for userID := 2; userID <= 20; userID++ {
+			if got := Evaluate(flag, Context{UserID: userID, OrganizationID: orgID}); got != want {
+				t.Fatalf("Organization %d: user %d got %q, user 1 got %q", orgID, userID, got, want)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := map[string]*models.FeatureFlag{
+		"bad key":              {Key: "Bad Key"},
+		"unknown kind":         {Key: "a", Kind: "percentage"},
+		"single variant":       {Key: "a", Kind: models.FlagKindMultivariate, Variants: []string{"a"}},
+		"duplicate variants":   {Key: "a", Kind: models.FlagKindMultivariate, Variants: []string{"a", "a"}},
+		"unknown default":      {Key: "a", DefaultVariant: "maybe"},
+		"unknown rule variant": {Key: "a", Rules: []models.FlagRule{{Variant: "maybe"}}},
+		"percentage too high":  {Key: "a", Rules: []models.FlagRule{{Variant: "on", Percentage: percentage(101)}}},
+		"unknown bucket":       {Key: "a", Rules: []models.FlagRule{{Variant: "on", BucketBy: "plan"}}},
+	}
+
+	for name, flag := range invalid {
+		if err := flag.Validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+
+	flag := &models.FeatureFlag{Key: "beta.reports", Variants: []string{"x"}}
+	if err := flag.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if flag.Kind != models.FlagKindBoolean || len(flag.Variants) != 2 || flag.DefaultVariant != models.VariantOff {
+		t.Errorf("Boolean flag not normalized: %+v", flag)
+	}
+}
+
+func TestServiceCache(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeStore{flags: []*models.FeatureFlag{
+		{Key: "beta", Enabled: true, Variants: []string{"off", "on"}, DefaultVariant: "on"},
+	}}
+
+	s := NewService(store, time.Minute)
+	s.now = func() time.Time { return now }
+
+	if !s.Enabled("beta", Context{UserID: 1}) || s.Enabled("missing", Context{UserID: 1}) {
+		t.Fatal("Unexpected evaluation")
+	}
+	s.Variant("beta", Context{})
+	if store.loads != 1 {
+		t.Errorf("Expected flags to be loaded once, got %d loads", store.loads)
+	}
+
+	// Stale flags are reloaded
+	store.flags = nil
+	now = now.Add(2 * time.Minute)
+	if s.Enabled("beta", Context{UserID: 1}) {
+		t.Error("Deleted flag still enabled after the TTL")
+	}
+	if store.loads != 2 {
+		t.Errorf("Expected a reload after the TTL, got %d loads", store.loads)
+	}
+
+	// Invalidate forces a reload
+	store.flags = []*models.FeatureFlag{{Key: "beta", Enabled: true, Variants: []string{"off", "on"}, DefaultVariant: "on"}}
+	s.Invalidate()
+	if !s.Enabled("beta", Context{UserID: 1}) {
+		t.Error("Flag not reloaded after Invalidate")
+	}
+
+	// Store errors keep the previous flags
+	store.err = errors.New("connection refused")
+	s.Invalidate()
+	if !s.Enabled("beta", Context{UserID: 1}) {
+		t.Error("Flags lost when the store failed")
+	}
+	if got := s.EvaluateAll(Context{UserID: 1}); got["beta"] != "on" {
+		t.Errorf("EvaluateAll returned %v", got)
+	}
+}
@@ -0,0 +1,85 @@
+package invoicing
+
+import (
+	"bytes"
+	"html/template"
+	"strconv"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+)
+
+var htmlTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"amount":    FormatAmount,
+	"rate":      FormatRate,
+	"unitPrice": unitPrice,
+	"date":      formatDate,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 40px; font-size: 14px; }
+h1 { font-size: 24px; margin: 0 0 4px; }
+.parties { display: flex; justify-content: space-between; margin: 32px 0; }
+.party { white-space: pre-line; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.number { text-align: right; }
+.totals td { border: none; }
+.total td { font-weight: bold; border-top: 2px solid #222; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<div>Issued on {{date .IssuedAt}}</div>
+<div>Period: {{date .PeriodStart}} to {{date .PeriodEnd}}</div>
+
+<div class="parties">
+{{template "party" .Seller}}
+<div>
+<strong>Bill to</strong>
+{{template "party" .Customer}}
+</div>
+</div>
+
+<table>
+<thead>
+<tr><th>Description</th><th class="number">Quantity</th><th class="number">Unit price</th><th class="number">Amount</th></tr>
+</thead>
+<tbody>
+{{range .Lines}}<tr><td>{{.Description}}</td><td class="number">{{.Quantity}}</td><td class="number">{{unitPrice . $.Currency}}</td><td class="number">{{amount .AmountCents $.Currency}}</td></tr>
+{{end}}</tbody>
+<tbody class="totals">
+<tr><td colspan="3" class="number">Subtotal</td><td class="number">{{amount .SubtotalCents .Currency}}</td></tr>
+<tr><td colspan="3" class="number">{{.TaxName}} ({{rate .TaxRateBasisPoints}})</td><td class="number">{{amount .TaxCents .Currency}}</td></tr>
+<tr class="total"><td colspan="3" class="number">Total</td><td class="number">{{amount .TotalCents .Currency}}</td></tr>
+</tbody>
+</table>
+</body>
+</html>
+{{define "party"}}<div class="party"><strong>{{.Name}}</strong>
+{{with .Address}}{{.}}
+{{end}}{{with .Country}}{{.}}
+{{end}}{{with .Email}}{{.}}
+{{end}}{{with .TaxID}}Tax ID: {{.}}{{end}}</div>{{end}}
+`))
+
+// RenderHTML renders an invoice as an HTML page
+func RenderHTML(invoice *models.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, invoice); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unitPrice formats the unit price of a line, with the number of units it
+// is charged for when usage is priced per batch
+func unitPrice(line models.InvoiceLine, currency string) string {
+	price := FormatAmount(line.UnitPriceCents, currency)
+	if line.UnitSize > 1 {
+		price += " / " + strconv.FormatInt(line.UnitSize, 10)
+	}
+	return price
+}
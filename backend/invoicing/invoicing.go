@@ -0,0 +1,218 @@
+package invoicing
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+)
+
+// UsagePrice is the price of a metered metric: Cents for every Per units
+type UsagePrice struct {
+	Cents int64
+	Per   int64
+}
+
+// Config holds the details printed on every invoice and the prices of
+// metered usage
+type Config struct {
+	Seller       models.BillingDetails
+	Currency     string
+	NumberPrefix string
+	TaxName      string
+	// TaxRateBasisPoints is the tax rate in hundredths of a percent, 2000 for 20%
+	TaxRateBasisPoints int
+	// UsagePrices maps metrics to their price, metrics without a price are not billed
+	UsagePrices map[string]UsagePrice
+}
+
+// ConfigFromEnv reads the seller from INVOICE_SELLER_NAME,
+// INVOICE_SELLER_EMAIL, INVOICE_SELLER_ADDRESS, INVOICE_SELLER_COUNTRY and
+// INVOICE_SELLER_TAX_ID, and INVOICE_CURRENCY, INVOICE_NUMBER_PREFIX,
+// INVOICE_TAX_NAME and INVOICE_TAX_RATE (a percentage). INVOICE_USAGE_PRICES
+// prices metrics as "api_calls:5/1000,tasks_created:1", in cents for a
+// number of units.
+func ConfigFromEnv() *Config {
+	config := &Config{
+		Seller: models.BillingDetails{
+			Name:    envOr("INVOICE_SELLER_NAME", "SaaS Template"),
+			Email:   os.Getenv("INVOICE_SELLER_EMAIL"),
+			Address: strings.ReplaceAll(os.Getenv("INVOICE_SELLER_ADDRESS"), `\n`, "\n"),
+			Country: strings.ToUpper(os.Getenv("INVOICE_SELLER_COUNTRY")),
+			TaxID:   os.Getenv("INVOICE_SELLER_TAX_ID"),
+		},
+		Currency:     strings.ToUpper(envOr("INVOICE_CURRENCY", "EUR")),
+		NumberPrefix: envOr("INVOICE_NUMBER_PREFIX", "INV"),
+		TaxName:      envOr("INVOICE_TAX_NAME", "VAT"),
+		UsagePrices:  map[string]UsagePrice{},
+	}
+
+	if value := os.Getenv("INVOICE_TAX_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 100 {
+			log.Printf("Warning: Invalid INVOICE_TAX_RATE %q, invoices are issued without tax", value)
+		} else {
+			config.TaxRateBasisPoints = int(math.Round(rate * 100))
+		}
+	}
+
+	for _, pair := range strings.Split(os.Getenv("INVOICE_USAGE_PRICES"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		metric, price, err := parseUsagePrice(pair)
+		if err != nil {
+			log.Printf("Warning: Ignoring INVOICE_USAGE_PRICES entry %q: %v", pair, err)
+			continue
+		}
+		config.UsagePrices[metric] = price
+	}
+
+	return config
+}
+
+// parseUsagePrice parses "metric:cents" or "metric:cents/units"
+func parseUsagePrice(pair string) (string, UsagePrice, error) {
+	metric, value, ok := strings.Cut(pair, ":")
+	if !ok || metric == "" {
+		return "", UsagePrice{}, fmt.Errorf("expected metric:cents/units")
+	}
+
+	price := UsagePrice{Per: 1}
+	cents, per, hasPer := strings.Cut(value, "/")
+
+	var err error
+	if price.Cents, err = strconv.ParseInt(cents, 10, 64); err != nil || price.Cents < 0 {
+		return "", UsagePrice{}, fmt.Errorf("invalid price %q", cents)
+	}
+	if hasPer {
+		if price.Per, err = strconv.ParseInt(per, 10, 64); err != nil || price.Per <= 0 {
+			return "", UsagePrice{}, fmt.Errorf("invalid number of units %q", per)
+		}
+	}
+
+	return metric, price, nil
+}
+
+// usageDescriptions labels the metered metrics on invoices
+var usageDescriptions = map[string]string{
+	models.MetricTasksCreated: "Tasks created",
+	models.MetricAPICalls:     "API calls",
+	models.MetricStorageBytes: "Peak storage (bytes)",
+}
+
+// Build computes the invoice of an organization for the period starting at
+// periodStart from its plan and its metered usage. The subscription line
+// bills the plan the organization is on when the invoice is issued, trials
+// and canceled subscriptions are not charged. The coupon of the period, if
+// it applies to the plan, discounts the subscription line only. It returns
+// nil when there is nothing to bill.
+func (c *Config) Build(org *models.BillableOrganization, usage map[string]int64, periodStart time.Time) *models.Invoice {
+	invoice := &models.Invoice{
+		OrganizationID:     &org.OrganizationID,
+		PeriodStart:        periodStart,
+		PeriodEnd:          periodStart.AddDate(0, 1, -1),
+		Currency:           c.Currency,
+		Seller:             c.Seller,
+		Customer:           org.Billing,
+		Lines:              []models.InvoiceLine{},
+		TaxName:            c.TaxName,
+		TaxRateBasisPoints: c.TaxRateBasisPoints,
+	}
+
+	charged := org.SubscriptionStatus == models.SubscriptionActive || org.SubscriptionStatus == models.SubscriptionPastDue
+	if charged && org.PlanPriceCents > 0 {
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			Description:    fmt.Sprintf("%s plan, %s", org.PlanName, periodStart.Format("January 2006")),
+			Quantity:       1,
+			UnitPriceCents: org.PlanPriceCents,
+			UnitSize:       1,
+			AmountCents:    org.PlanPriceCents,
+		})
+
+		if coupon := org.Discount; coupon != nil && coupon.AppliesTo(org.PlanCode) {
+			discount := coupon.AmountOff(org.PlanPriceCents)
+			terms := FormatAmount(discount, c.Currency)
+			if coupon.PercentOff != nil {
+				terms = strconv.Itoa(*coupon.PercentOff) + "%"
+			}
+
+			invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+				Description:    fmt.Sprintf("Discount %s (%s off)", coupon.Code, terms),
+				Quantity:       1,
+				UnitPriceCents: -discount,
+				UnitSize:       1,
+				AmountCents:    -discount,
+			})
+			invoice.CouponCode = coupon.Code
+			invoice.DiscountCents = discount
+		}
+	}
+
+	for _, metric := range models.Metrics {
+		price, ok := c.UsagePrices[metric]
+		if !ok || usage[metric] == 0 {
+			continue
+		}
+
+		invoice.Lines = append(invoice.Lines, models.InvoiceLine{
+			Description:    usageDescriptions[metric],
+			Quantity:       usage[metric],
+			UnitPriceCents: price.Cents,
+			UnitSize:       price.Per,
+			// Rounded to the nearest cent
+			AmountCents: (usage[metric]*price.Cents + price.Per/2) / price.Per,
+		})
+	}
+
+	if len(invoice.Lines) == 0 {
+		return nil
+	}
+
+	for _, line := range invoice.Lines {
+		invoice.SubtotalCents += line.AmountCents
+	}
+	invoice.TaxCents = (invoice.SubtotalCents*int64(invoice.TaxRateBasisPoints) + 5000) / 10000
+	invoice.TotalCents = invoice.SubtotalCents + invoice.TaxCents
+
+	return invoice
+}
+
+// FormatAmount formats an amount in cents, as "1,234.56 EUR"
+func FormatAmount(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	units := strconv.FormatInt(cents/100, 10)
+	for i := len(units) - 3; i > 0; i -= 3 {
+		units = units[:i] + "," + units[i:]
+	}
+
+	return fmt.Sprintf("%s%s.%02d %s", sign, units, cents%100, currency)
+}
+
+// FormatRate formats a tax rate in basis points as a percentage
+func FormatRate(basisPoints int) string {
+	return strconv.FormatFloat(float64(basisPoints)/100, 'f', -1, 64) + "%"
+}
+
+// formatDate formats the dates printed on invoices
+func formatDate(t time.Time) string {
+	return t.UTC().Format("January 2, 2006")
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,246 @@
+package invoicing
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+)
+
+func testConfig() *Config {
+	return &Config{
+		Seller:             models.BillingDetails{Name: "Seller SAS", Address: "1 rue de la Paix\n75002 Paris", Country: "FR"},
+		Currency:           "EUR",
+		NumberPrefix:       "INV",
+		TaxName:            "VAT",
+		TaxRateBasisPoints: 2000,
+		UsagePrices: map[string]UsagePrice{
+			models.MetricAPICalls: {Cents: 5, Per: 1000},
+		},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	period := time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)
+	org := &models.BillableOrganization{
+		OrganizationID:     7,
+		SubscriptionStatus: models.SubscriptionActive,
+		PlanName:           "Pro",
+		PlanPriceCents:     2900,
+		Billing:            models.BillingDetails{Name: "Acme"},
+	}
+	usage := map[string]int64{models.MetricAPICalls: 123500, models.MetricTasksCreated: 40}
+
+	invoice := testConfig().Build(org, usage, period)
+	if invoice == nil {
+		t.Fatal("Expected an invoice")
+	}
+
+	if len(invoice.Lines) != 2 {
+		t.Fatalf("Expected a plan line and an API calls line, got %+v", invoice.Lines)
+	}
+	if invoice.Lines[0].Description != "Pro plan, February 2026" || invoice.Lines[0].AmountCents != 2900 {
+		t.Errorf("Unexpected plan line %+v", invoice.Lines[0])
+	}
+	// 123500 calls at 5 cents per 1000 is 617.5 cents, rounded to 618
+	if invoice.Lines[1].AmountCents != 618 {
+		t.Errorf("Expected 618 cents of API calls, got %+v", invoice.Lines[1])
+	}
+
+	if invoice.SubtotalCents != 3518 || invoice.TaxCents != 704 || invoice.TotalCents != 4222 {
+		t.Errorf("Unexpected totals %d + %d = %d", invoice.SubtotalCents, invoice.TaxCents, invoice.TotalCents)
+	}
+	if !invoice.PeriodEnd.Equal(time.Date(2026, time.February, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected period end %s", invoice.PeriodEnd)
+	}
+	if *invoice.OrganizationID != 7 || invoice.Customer.Name != "Acme" || invoice.Seller.Name != "Seller SAS" {
+		t.Errorf("Unexpected parties %+v", invoice)
+	}
+}
+
+func TestBuildAppliesDiscount(t *testing.T) {
+	period := time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)
+	percent, amount := 20, int64(5000)
+
+	cases := []struct {
+		coupon   *models.Coupon
+		discount int64
+		line     string
+	}{
+		{&models.Coupon{Code: "SPRING", PercentOff: &percent}, 580, "Discount SPRING (20% off)"},
+		// Amounts off never exceed the plan price
+		{&models.Coupon{Code: "FIFTY", AmountOffCents: &amount}, 2900, "Discount FIFTY (29.00 EUR off)"},
+		{&models.Coupon{Code: "BIGCO", PercentOff: &percent, PlanCodes: []string{"enterprise"}}, 0, ""},
+	}
+
+	for _, tc := range cases {
+		org := &models.BillableOrganization{
+			SubscriptionStatus: models.SubscriptionActive,
+			PlanCode:           "pro",
+			PlanName:           "Pro",
+			PlanPriceCents:     2900,
+			Discount:           tc.coupon,
+		}
+
+		invoice := testConfig().Build(org, map[string]int64{models.MetricAPICalls: 1000}, period)
+		if invoice.DiscountCents != tc.discount {
+			t.Errorf("%s: expected a discount of %d cents, got %d", tc.coupon.Code, tc.discount, invoice.DiscountCents)
+		}
+		if tc.discount == 0 {
+			if len(invoice.Lines) != 2 || invoice.CouponCode != "" {
+				t.Errorf("%s: the coupon should not apply, got %+v", tc.coupon.Code, invoice.Lines)
+			}
+			continue
+		}
+
+		line := invoice.Lines[1]
+		if line.Description != tc.line || line.AmountCents != -tc.discount || invoice.CouponCode != tc.coupon.Code {
+			t.Errorf("%s: unexpected discount line %+v", tc.coupon.Code, line)
+		}
+		// The usage line is not discounted
+		if invoice.SubtotalCents != 2900-tc.discount+5 {
+			t.Errorf("%s: unexpected subtotal %d", tc.coupon.Code, invoice.SubtotalCents)
+		}
+	}
+}
+
+func TestBuildSkipsTrialsWithoutUsage(t *testing.T) {
+	org := &models.BillableOrganization{
+		SubscriptionStatus: models.SubscriptionTrialing,
+		PlanName:           "Pro",
+		PlanPriceCents:     2900,
+	}
+
+	invoice := testConfig().Build(org, map[string]int64{models.MetricTasksCreated: 12}, time.Now())
+	if invoice != nil {
+		t.Errorf("Trials and unpriced usage should not be invoiced, got %+v", invoice.Lines)
+	}
+}
+
+func TestParseUsagePrice(t *testing.T) {
+	metric, price, err := parseUsagePrice("api_calls:5/1000")
+	if err != nil || metric != "api_calls" || price != (UsagePrice{Cents: 5, Per: 1000}) {
+		t.Errorf("Unexpected price %s %+v (%v)", metric, price, err)
+	}
+
+	_, price, err = parseUsagePrice("tasks_created:2")
+	if err != nil || price != (UsagePrice{Cents: 2, Per: 1}) {
+		t.Errorf("Unexpected price %+v (%v)", price, err)
+	}
+
+	for _, invalid := range []string{"api_calls", ":5", "api_calls:-1", "api_calls:5/0", "api_calls:abc"} {
+		if _, _, err := parseUsagePrice(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	cases := map[int64]string{
+		0:         "0.00 EUR",
+		5:         "0.05 EUR",
+		4222:      "42.22 EUR",
+		123456789: "1,234,567.89 EUR",
+		-1500:     "-15.00 EUR",
+	}
+	for cents, want := range cases {
+		if got := FormatAmount(cents, "EUR"); got != want {
+			t.Errorf("FormatAmount(%d) = %q, want %q", cents, got, want)
+		}
+	}
+
+	if got := FormatRate(2050); got != "20.5%" {
+		t.Errorf("FormatRate(2050) = %q", got)
+	}
+}
+
+func testInvoice() *models.Invoice {
+	config := testConfig()
+	org := &models.BillableOrganization{
+		OrganizationID:     1,
+		SubscriptionStatus: models.SubscriptionActive,
+		PlanName:           "Pro",
+		PlanPriceCents:     2900,
+		Billing:            models.BillingDetails{Name: "Société <Acme> (Europe)", TaxID: "FR123"},
+	}
+
+	invoice := config.Build(org, map[string]int64{}, time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC))
+	invoice.Number = "INV-2026-000042"
+	invoice.IssuedAt = time.Date(2026, time.April, 1, 3, 0, 0, 0, time.UTC)
+	return invoice
+}
+
+func TestRenderHTML(t *testing.T) {
+	html, err := RenderHTML(testInvoice())
+	if err != nil {
+		t.Fatalf("RenderHTML returned error: %v", err)
+	}
+
+	for _, want := range []string{
+		"Invoice INV-2026-000042", "Société &lt;Acme&gt; (Europe)", "Tax ID: FR123",
+		"29.00 EUR", "VAT (20%)", "5.80 EUR", "34.80 EUR", "March 31, 2026",
+	} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("HTML is missing %q", want)
+		}
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	pdf := RenderPDF(testInvoice())
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("Not a PDF document")
+	}
+
+	// Every object is found at the offset given by the cross-reference table
+	xref := regexp.MustCompile(`(?m)^(\d{10}) 00000 n $`).FindAllSubmatch(pdf, -1)
+	if len(xref) != 6 {
+		t.Fatalf("Expected 6 objects, got %d", len(xref))
+	}
+	for i, entry := range xref {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if !bytes.HasPrefix(pdf[offset:], []byte(strconv.Itoa(i+1)+" 0 obj")) {
+			t.Errorf("Object %d is not at offset %d", i+1, offset)
+		}
+	}
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	offset, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(pdf[offset:], []byte("xref\n")) {
+		t.Error("startxref does not point to the cross-reference table")
+	}
+
+	for _, want := range []string{"(Invoice INV-2026-000042)", "(Soci\xe9t\xe9 <Acme> \\(Europe\\))", "(34.80 EUR)"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("PDF is missing %q", want)
+		}
+	}
+}
+
+func TestStoreDocuments(t *testing.T) {
+	storage := &FileStorage{Dir: t.TempDir()}
+
+	htmlKey, pdfKey, err := StoreDocuments(storage, testInvoice())
+	if err != nil {
+		t.Fatalf("StoreDocuments returned error: %v", err)
+	}
+	if htmlKey != "2026/INV-2026-000042.html" || pdfKey != "2026/INV-2026-000042.pdf" {
+		t.Errorf("Unexpected keys %s and %s", htmlKey, pdfKey)
+	}
+
+	pdf, err := storage.Get(pdfKey)
+	if err != nil || !bytes.HasPrefix(pdf, []byte("%PDF")) {
+		t.Errorf("Stored PDF not found (%v)", err)
+	}
+
+	for _, key := range []string{"../secret", "/etc/passwd", "2026/../../secret"} {
+		if _, err := storage.Get(key); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package invoicing
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+)
+
+// A4 page size and margins, in points
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+	pageMargin = 50
+)
+
+// helveticaWidths are the widths of the printable ASCII characters in
+// Helvetica, in thousandths of the font size, from the standard font metrics
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// RenderPDF renders an invoice as a PDF document
+func RenderPDF(invoice *models.Invoice) []byte {
+	w := newPDFWriter()
+
+	w.text(pageMargin, 20, true, "Invoice "+invoice.Number)
+	w.newline(20)
+	w.text(pageMargin, 10, false, "Issued on "+formatDate(invoice.IssuedAt))
+	w.newline(14)
+	w.text(pageMargin, 10, false, fmt.Sprintf("Period: %s to %s", formatDate(invoice.PeriodStart), formatDate(invoice.PeriodEnd)))
+	w.newline(36)
+
+	seller := partyLines(invoice.Seller)
+	customer := append([]string{"Bill to"}, partyLines(invoice.Customer)...)
+	for i := 0; i < len(seller) || i < len(customer); i++ {
+		if i < len(seller) {
+			w.text(pageMargin, 10, i == 0, seller[i])
+		}
+		if i < len(customer) {
+			w.text(320, 10, i <= 1, customer[i])
+		}
+		w.newline(14)
+	}
+	w.newline(22)
+
+	w.text(pageMargin, 10, true, "Description")
+	w.textRight(340, 10, true, "Quantity")
+	w.textRight(450, 10, true, "Unit price")
+	w.textRight(pageWidth-pageMargin, 10, true, "Amount")
+	w.newline(8)
+	w.rule()
+	w.newline(16)
+
+	for _, line := range invoice.Lines {
+		w.text(pageMargin, 10, false, line.Description)
+		w.textRight(340, 10, false, strconv.FormatInt(line.Quantity, 10))
+		w.textRight(450, 10, false, unitPrice(line, invoice.Currency))
+		w.textRight(pageWidth-pageMargin, 10, false, FormatAmount(line.AmountCents, invoice.Currency))
+		w.newline(18)
+	}
+
+	w.rule()
+	w.newline(18)
+
+	totals := []struct {
+		label string
+		cents int64
+	}{
+		{"Subtotal", invoice.SubtotalCents},
+		{fmt.Sprintf("%s (%s)", invoice.TaxName, FormatRate(invoice.TaxRateBasisPoints)), invoice.TaxCents},
+		{"Total", invoice.TotalCents},
+	}
+	for i, total := range totals {
+		bold := i == len(totals)-1
+		w.textRight(450, 10, bold, total.label)
+		w.textRight(pageWidth-pageMargin, 10, bold, FormatAmount(total.cents, invoice.Currency))
+		w.newline(16)
+	}
+
+	return w.bytes()
+}
+
+// partyLines returns the lines printed for a party, its name first
+func partyLines(party models.BillingDetails) []string {
+	lines := []string{party.Name}
+	for _, line := range strings.Split(party.Address, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	for _, line := range []string{party.Country, party.Email} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if party.TaxID != "" {
+		lines = append(lines, "Tax ID: "+party.TaxID)
+	}
+	return lines
+}
+
+// pdfWriter lays text out on A4 pages with the Helvetica fonts every PDF
+// reader provides, so that no font has to be embedded. Text is written at
+// the current line, which moves down the page.
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func newPDFWriter() *pdfWriter {
+	w := &pdfWriter{}
+	w.newPage()
+	return w
+}
+
+func (w *pdfWriter) newPage() {
+	w.page = &bytes.Buffer{}
+	w.pages = append(w.pages, w.page)
+	w.y = pageHeight - pageMargin
+}
+
+// newline moves the current line down, to the next page when it is full
+func (w *pdfWriter) newline(height float64) {
+	w.y -= height
+	if w.y < pageMargin {
+		w.newPage()
+	}
+}
+
+// text writes s with its left edge at x
+func (w *pdfWriter) text(x, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.page, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, w.y, pdfString(s))
+}
+
+// textRight writes s with its right edge at x
+func (w *pdfWriter) textRight(x, size float64, bold bool, s string) {
+	w.text(x-textWidth(s, size), size, bold, s)
+}
+
+// rule draws a horizontal line across the page at the current line
+func (w *pdfWriter) rule() {
+	fmt.Fprintf(w.page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", float64(pageMargin), w.y, pageWidth-pageMargin, w.y)
+}
+
+// bytes assembles the document: the catalog, the page tree, the two fonts,
+// then each page and its content stream, followed by the cross-reference
+// table locating every object
+func (w *pdfWriter) bytes() []byte {
+	var out bytes.Buffer
+	offsets := []int{}
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range w.pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// winAnsi maps the characters outside Latin-1 that WinAnsiEncoding supports
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, 'œ': 0x9c, 'Œ': 0x8c,
+}
+
+// pdfString encodes s as the body of a PDF literal string in
+// WinAnsiEncoding, characters the fonts cannot show are replaced with ?
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case winAnsi[r] != 0:
+			b.WriteByte(winAnsi[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// textWidth measures s in points, characters outside ASCII are counted as
+// digits, which is close enough to align amounts
+func textWidth(s string, size float64) float64 {
+	width := 0
+	for _, r := range s {
+		if r >= 0x20 && r < 0x7f {
+			width += helveticaWidths[r-0x20]
+		} else {
+			width += 556
+		}
+	}
+	return float64(width) * size / 1000
+}
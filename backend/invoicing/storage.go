@@ -0,0 +1,87 @@
+package invoicing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+)
+
+// Storage keeps the rendered invoice documents
+type Storage interface {
+	Put(key string, content []byte) error
+	Get(key string) ([]byte, error)
+}
+
+// StorageFromEnv stores the documents under INVOICE_STORAGE_DIR, "invoices"
+// by default
+func StorageFromEnv() Storage {
+	return &FileStorage{Dir: envOr("INVOICE_STORAGE_DIR", "invoices")}
+}
+
+// FileStorage stores documents as files under Dir
+type FileStorage struct {
+	Dir string
+}
+
+// Put writes a document, replacing any previous version
+func (s *FileStorage) Put(key string, content []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Written under a temporary name first so that readers never see a partial document
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get reads a document
+func (s *FileStorage) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s *FileStorage) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if filepath.IsAbs(clean) || clean == "." || strings.HasPrefix(clean, "..") {
+		return "", errors.New("invalid document key")
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// StoreDocuments renders an invoice to HTML and PDF and stores both. It
+// returns their keys, grouped by year of issue.
+func StoreDocuments(storage Storage, invoice *models.Invoice) (string, string, error) {
+	base := fmt.Sprintf("%d/%s", invoice.IssuedAt.Year(), unsafeKeyChars.ReplaceAllString(invoice.Number, "_"))
+
+	html, err := RenderHTML(invoice)
+	if err != nil {
+		return "", "", err
+	}
+	if err := storage.Put(base+".html", html); err != nil {
+		return "", "", err
+	}
+
+	if err := storage.Put(base+".pdf", RenderPDF(invoice)); err != nil {
+		return "", "", err
+	}
+
+	return base + ".html", base + ".pdf", nil
+}
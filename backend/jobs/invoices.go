@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/invoicing"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+)
+
+// Invoices issues the invoices of the previous month once it is over and
+// stores their documents
+type Invoices struct {
+	invoiceRepo *models.InvoiceRepository
+	usageRepo   *models.UsageCounterRepository
+	config      *invoicing.Config
+	storage     invoicing.Storage
+}
+
+// NewInvoices creates the invoicing jobs
+func NewInvoices(database *db.DB, config *invoicing.Config, storage invoicing.Storage) *Invoices {
+	return &Invoices{
+		invoiceRepo: models.NewInvoiceRepository(database),
+		usageRepo:   models.NewUsageCounterRepository(database),
+		config:      config,
+		storage:     storage,
+	}
+}
+
+// Jobs returns the invoicing jobs, run every interval
+func (i *Invoices) Jobs(interval time.Duration) []Job {
+	return []Job{
+		{Name: "invoices", Interval: interval, Run: i.IssueInvoices},
+		{Name: "invoice-documents", Interval: interval, Run: i.StoreDocuments},
+	}
+}
+
+// IssueInvoices invoices the organizations that owe something for the
+// previous month. Organizations are invoiced once per period, an instance
+// losing the race to another one skips the organization.
+func (i *Invoices) IssueInvoices(ctx context.Context) error {
+	period := models.PeriodStart(time.Now()).AddDate(0, -1, 0)
+
+	orgs, err := i.invoiceRepo.GetBillable(period)
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		usage, err := i.usageRepo.GetForPeriod(org.OrganizationID, period)
+		if err != nil {
+			return err
+		}
+
+		invoice := i.config.Build(org, usage, period)
+		if invoice == nil {
+			continue
+		}
+
+		err = i.invoiceRepo.Create(invoice, i.config.NumberPrefix)
+		if err == models.ErrInvoiceExists {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Issued invoice %s to organization ID %d", invoice.Number, org.OrganizationID)
+
+		// Failures are retried by StoreDocuments
+		i.storeDocuments(invoice)
+	}
+
+	return nil
+}
+
+// StoreDocuments renders and stores the documents of the invoices issued
+// without them
+func (i *Invoices) StoreDocuments(ctx context.Context) error {
+	invoices, err := i.invoiceRepo.GetPendingDocuments()
+	if err != nil {
+		return err
+	}
+
+	for _, invoice := range invoices {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		i.storeDocuments(invoice)
+	}
+
+	return nil
+}
+
+func (i *Invoices) storeDocuments(invoice *models.Invoice) {
+	htmlKey, pdfKey, err := invoicing.StoreDocuments(i.storage, invoice)
+	if err == nil {
+		err = i.invoiceRepo.SetDocuments(invoice.ID, htmlKey, pdfKey)
+	}
+	if err != nil {
+		logger.Error("Failed to store the documents of invoice %s: %v", invoice.Number, err)
+	}
+}
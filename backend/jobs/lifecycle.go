@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/billing"
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/mailer"
+)
+
+// Lifecycle follows up on trials and past due subscriptions: it reminds
+// owners before their trial ends, moves expired trials back to the free
+// plan and tells owners when a payment failed
+type Lifecycle struct {
+	subscriptionRepo *models.SubscriptionRepository
+	orgRepo          *models.OrganizationRepository
+	mailer           mailer.Mailer
+	trial            *billing.TrialConfig
+	// billingURL is the page where owners subscribe or update their payment method
+	billingURL string
+}
+
+// NewLifecycle creates the lifecycle jobs
+func NewLifecycle(database *db.DB, m mailer.Mailer, trial *billing.TrialConfig, billingURL string) *Lifecycle {
+	return &Lifecycle{
+		subscriptionRepo: models.NewSubscriptionRepository(database),
+		orgRepo:          models.NewOrganizationRepository(database),
+		mailer:           m,
+		trial:            trial,
+		billingURL:       billingURL,
+	}
+}
+
+// Jobs returns the lifecycle jobs, run every interval
+func (l *Lifecycle) Jobs(interval time.Duration) []Job {
+	return []Job{
+		{Name: "trial-reminders", Interval: interval, Run: l.SendTrialReminders},
+		{Name: "trial-expiry", Interval: interval, Run: l.ExpireTrials},
+		{Name: "dunning", Interval: interval, Run: l.SendDunningNotices},
+	}
+}
+
+// SendTrialReminders emails the owners of organizations whose trial ends soon
+func (l *Lifecycle) SendTrialReminders(ctx context.Context) error {
+	orgs, err := l.subscriptionRepo.ClaimTrialReminders(time.Now().Add(l.trial.ReminderBefore))
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		l.notifyOwners(org,
+			fmt.Sprintf("Your %s trial ends soon", org.Name),
+			fmt.Sprintf(
+				"The trial of %s on the %s plan ends on %s.\n\n"+
+					"Subscribe before then to keep your plan:\n%s\n\n"+
+					"Without a subscription the organization moves to the free plan and its limits.\n",
+				org.Name, org.Plan, org.TrialEndsAt.UTC().Format("January 2, 2006 15:04 MST"), l.billingURL,
+			),
+		)
+	}
+
+	return nil
+}
+
+// ExpireTrials moves the organizations whose trial ended to the free plan
+// and tells their owners
+func (l *Lifecycle) ExpireTrials(ctx context.Context) error {
+	orgs, err := l.subscriptionRepo.ExpireTrials()
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		logger.Info("Trial of organization ID %d ended, moved to the %s plan", org.ID, org.Plan)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		l.notifyOwners(org,
+			fmt.Sprintf("Your %s trial has ended", org.Name),
+			fmt.Sprintf(
+				"The trial of %s has ended and the organization is now on the free plan.\n\n"+
+					"Your data is kept. Subscribe at any time to lift the free plan limits:\n%s\n",
+				org.Name, l.billingURL,
+			),
+		)
+	}
+
+	return nil
+}
+
+// SendDunningNotices emails the owners of organizations whose payment failed
+func (l *Lifecycle) SendDunningNotices(ctx context.Context) error {
+	orgs, err := l.subscriptionRepo.ClaimDunningNotices()
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		l.notifyOwners(org,
+			fmt.Sprintf("Payment failed for %s", org.Name),
+			fmt.Sprintf(
+				"We could not collect the payment of the %s subscription of %s.\n\n"+
+					"Until the payment succeeds the organization is read-only: its data can be "+
+					"read but not changed. Update your payment method here:\n%s\n",
+				org.Plan, org.Name, l.billingURL,
+			),
+		)
+	}
+
+	return nil
+}
+
+// notifyOwners emails every owner of an organization. Failures are logged,
+// a notification is never sent twice.
+func (l *Lifecycle) notifyOwners(org *models.Organization, subject, body string) {
+	members, err := l.orgRepo.GetMembers(org.ID)
+	if err != nil {
+		logger.Error("Failed to get owners of organization ID %d: %v", org.ID, err)
+		return
+	}
+
+	for _, member := range members {
+		if member.Role != models.RoleOwner {
+			continue
+		}
+
+		err := l.mailer.Send(&mailer.Message{To: member.Email, Subject: subject, Body: body})
+		if err != nil {
+			logger.Error("Failed to email owner of organization ID %d: %v", org.ID, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package jobs runs periodic background work inside the API process.
+// Jobs must be safe to run concurrently from several instances, usually by
+// claiming their rows with a single UPDATE ... RETURNING statement.
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+)
+
+// Job is a task run every Interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs jobs until its context is canceled
+type Scheduler struct {
+	jobs []Job
+	wg   sync.WaitGroup
+}
+
+// NewScheduler creates an empty scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add registers jobs, it must be called before Start
+func (s *Scheduler) Add(jobs ...Job) {
+	s.jobs = append(s.jobs, jobs...)
+}
+
+// Start runs every job once, then at its interval, each in its own
+// goroutine. A failed run is logged and retried at the next tick.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+
+			ticker := time.NewTicker(job.Interval)
+			defer ticker.Stop()
+
+			for {
+				if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+					logger.Error("Job %s failed: %v", job.Name, err)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(job)
+	}
+}
+
+// Wait blocks until every job returned after the context was canceled
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// IntervalFromEnv reads a Go duration from the environment
+func IntervalFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Warning: Invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+
+	return interval
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerRunsJobsUntilCanceled(t *testing.T) {
+	var runs, failures atomic.Int32
+
+	s := NewScheduler()
+	s.Add(
+		Job{Name: "count", Interval: 5 * time.Millisecond, Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}},
+		Job{Name: "fail", Interval: 5 * time.Millisecond, Run: func(ctx context.Context) error {
+			failures.Add(1)
+			return errors.New("boom")
+		}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for (runs.Load() < 3 || failures.Load() < 3) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if runs.Load() < 3 || failures.Load() < 3 {
+		t.Fatalf("Expected jobs to run repeatedly, got %d runs and %d failing runs", runs.Load(), failures.Load())
+	}
+
+	cancel()
+	s.Wait()
+
+	stopped := runs.Load()
+	time.Sleep(20 * time.Millisecond)
+	if runs.Load() != stopped {
+		t.Error("Job still running after the scheduler stopped")
+	}
+}
+
+func TestSchedulerRunsJobsImmediately(t *testing.T) {
+	ran := make(chan struct{}, 1)
+
+	s := NewScheduler()
+	s.Add(Job{Name: "once", Interval: time.Hour, Run: func(ctx context.Context) error {
+		ran <- struct{}{}
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("Job did not run at startup")
+	}
+}
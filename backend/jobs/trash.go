@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+)
+
+// Trash purges the tasks left in the trash longer than the retention period
+type Trash struct {
+	taskRepo  *models.TaskRepository
+	retention time.Duration
+}
+
+// NewTrash creates the trash jobs, a zero retention keeps deleted tasks
+// until they are deleted permanently
+func NewTrash(database *db.DB, retention time.Duration) *Trash {
+	return &Trash{
+		taskRepo:  models.NewTaskRepository(database),
+		retention: retention,
+	}
+}
+
+// TrashRetentionFromEnv reads TASK_TRASH_RETENTION_DAYS, 30 days by default.
+// 0 disables the purge.
+func TrashRetentionFromEnv() time.Duration {
+	days := 30
+	if value := os.Getenv("TASK_TRASH_RETENTION_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Printf("Warning: Invalid TASK_TRASH_RETENTION_DAYS %q, using %d", value, days)
+		} else {
+			days = parsed
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Jobs returns the trash jobs, run every interval, none when the purge is
+// disabled
+func (t *Trash) Jobs(interval time.Duration) []Job {
+	if t.retention == 0 {
+		return nil
+	}
+	return []Job{
+		{Name: "trash-purge", Interval: interval, Run: t.Purge},
+	}
+}
+
+// Purge permanently removes the tasks deleted before the retention period.
+// Concurrent runs delete disjoint rows.
+func (t *Trash) Purge(ctx context.Context) error {
+	purged, err := t.taskRepo.PurgeTrash(time.Now().Add(-t.retention))
+	if purged > 0 {
+		logger.Info("Purged %d tasks from the trash", purged)
+	}
+	return err
+}
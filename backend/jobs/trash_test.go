@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrashRetentionFromEnv(t *testing.T) {
+	t.Setenv("TASK_TRASH_RETENTION_DAYS", "")
+	if retention := TrashRetentionFromEnv(); retention != 30*24*time.Hour {
+		t.Errorf("Expected 30 days by default, got %s", retention)
+	}
+
+	t.Setenv("TASK_TRASH_RETENTION_DAYS", "invalid")
+	if retention := TrashRetentionFromEnv(); retention != 30*24*time.Hour {
+		t.Errorf("Expected the default for an invalid value, got %s", retention)
+	}
+
+	t.Setenv("TASK_TRASH_RETENTION_DAYS", "0")
+	if jobs := NewTrash(nil, TrashRetentionFromEnv()).Jobs(time.Hour); len(jobs) != 0 {
+		t.Errorf("TASK_TRASH_RETENTION_DAYS=0 should disable the purge, got %d jobs", len(jobs))
+	}
+}
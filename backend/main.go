@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/LouisVannobel/SaaS-Template/backend/api/handlers"
 	"github.com/LouisVannobel/SaaS-Template/backend/api/middleware"
+	"github.com/LouisVannobel/SaaS-Template/backend/auth"
+	"github.com/LouisVannobel/SaaS-Template/backend/billing"
 	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/flags"
+	"github.com/LouisVannobel/SaaS-Template/backend/invoicing"
+	"github.com/LouisVannobel/SaaS-Template/backend/jobs"
 	"github.com/LouisVannobel/SaaS-Template/backend/utils/logger"
+	"github.com/LouisVannobel/SaaS-Template/backend/utils/mailer"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	fiberlogger "github.com/gofiber/fiber/v2/middleware/logger" // Fiber logger middleware
@@ -58,14 +66,22 @@ func main() {
 
 	// Middleware
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://localhost:5173", // Frontend URL
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, PUT, DELETE",
+		AllowOrigins:  "http://localhost:5173", // Frontend URL
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-Organization-ID, If-Match, If-None-Match",
+		AllowMethods:  "GET, POST, PUT, PATCH, DELETE",
+		ExposeHeaders: "ETag",
 	}))
 	app.Use(fiberlogger.New())
 
+	// API calls are counted in memory and flushed by a background job
+	apiCallMeter := middleware.NewAPICallMeter(database)
+
 	// Setup routes
-	setupRoutes(app, database)
+	setupRoutes(app, database, apiCallMeter)
+
+	// Start background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	scheduler := startJobs(jobsCtx, database, apiCallMeter)
 
 	// Start server in a goroutine
 	go func() {
@@ -82,18 +98,61 @@ func main() {
 
 	log.Println("Server shutting down...")
 
+	stopJobs()
+	scheduler.Wait()
+
 	if err := app.Shutdown(); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Record the API calls counted since the last flush
+	if err := apiCallMeter.Flush(context.Background()); err != nil {
+		log.Printf("Failed to flush API calls: %v", err)
+	}
+
 	log.Println("Server exited properly")
 }
 
+// startJobs schedules the background jobs
+func startJobs(ctx context.Context, database *db.DB, apiCallMeter *middleware.APICallMeter) *jobs.Scheduler {
+	lifecycle := jobs.NewLifecycle(database, mailer.New(), billing.TrialFromEnv(), billing.PageURL())
+	invoices := jobs.NewInvoices(database, invoicing.ConfigFromEnv(), invoicing.StorageFromEnv())
+	trash := jobs.NewTrash(database, jobs.TrashRetentionFromEnv())
+
+	scheduler := jobs.NewScheduler()
+	scheduler.Add(lifecycle.Jobs(jobs.IntervalFromEnv("LIFECYCLE_JOBS_INTERVAL", time.Hour))...)
+	scheduler.Add(invoices.Jobs(jobs.IntervalFromEnv("INVOICE_JOBS_INTERVAL", time.Hour))...)
+	scheduler.Add(trash.Jobs(jobs.IntervalFromEnv("TASK_TRASH_PURGE_INTERVAL", time.Hour))...)
+	scheduler.Add(jobs.Job{
+		Name:     "flush-api-calls",
+		Interval: jobs.IntervalFromEnv("API_CALLS_FLUSH_INTERVAL", 30*time.Second),
+		Run:      apiCallMeter.Flush,
+	})
+	scheduler.Start(ctx)
+
+	return scheduler
+}
+
 // setupRoutes configures all the routes for our application
-func setupRoutes(app *fiber.App, database *db.DB) {
+func setupRoutes(app *fiber.App, database *db.DB, apiCallMeter *middleware.APICallMeter) {
 	// Create handlers
 	userHandler := handlers.NewFiberUserHandler(database)
 	taskHandler := handlers.NewFiberTaskHandler(database)
+	scimHandler := handlers.NewFiberScimHandler(database)
+	adminHandler := handlers.NewFiberAdminHandler(database)
+	oauthHandler := handlers.NewFiberOAuthHandler(database)
+	orgHandler := handlers.NewFiberOrganizationHandler(database)
+	teamHandler := handlers.NewFiberTeamHandler(database)
+	workflowHandler := handlers.NewFiberWorkflowHandler(database)
+	invitationHandler := handlers.NewFiberInvitationHandler(database, mailer.New())
+	planHandler := handlers.NewFiberPlanHandler(database)
+	usageHandler := handlers.NewFiberUsageHandler(database)
+	flagService := flags.NewDatabaseService(database)
+	flagHandler := handlers.NewFiberFeatureFlagHandler(database, flagService)
+	billingProvider, billingConfig := billing.LoadFromEnv()
+	billingHandler := handlers.NewFiberBillingHandler(database, billingProvider, billingConfig)
+	invoiceHandler := handlers.NewFiberInvoiceHandler(database, invoicing.StorageFromEnv())
+	couponHandler := handlers.NewFiberCouponHandler(database)
 
 	// Health check route
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -106,22 +165,155 @@ func setupRoutes(app *fiber.App, database *db.DB) {
 	api := app.Group("/api")
 
 	// Public routes (no auth required)
+	api.Get("/registration", userHandler.GetRegistrationPolicy)
 	api.Post("/register", userHandler.Register)
 	api.Post("/login", userHandler.Login)
+	api.Post("/device/code", oauthHandler.DeviceCode)
+	api.Post("/oauth/token", oauthHandler.Token)
+	api.Get("/invitations/:token", invitationHandler.GetInvitation)
 
 	// Protected routes (auth required)
 	// Create a protected group
 	protected := api.Group("/")
-	protected.Use(middleware.JWTProtected())
+	protected.Use(middleware.JWTProtected(database))
+
+	// Counts API calls of the organization resolved by orgContext
+	protected.Use(apiCallMeter.Middleware())
+
+	// Scope checks only restrict service accounts
+	usersOnly := middleware.UsersOnly()
+	tasksRead := middleware.RequireScope(auth.ScopeTasksRead)
+	tasksWrite := middleware.RequireScope(auth.ScopeTasksWrite)
+
+	// Resolves the active organization from the X-Organization-ID header
+	orgContext := middleware.OrganizationContext(database)
+
+	// Refuses writes to the organization of the :id parameter while its
+	// payment is past due, billing routes stay open to settle it
+	writable := middleware.WritableOrganization(database)
 
 	// User routes
-	protected.Get("/users/profile", userHandler.GetProfile)
-	protected.Put("/users/profile", userHandler.UpdateProfile)
+	protected.Get("/users/profile", usersOnly, userHandler.GetProfile)
+	protected.Put("/users/profile", usersOnly, userHandler.UpdateProfile)
+
+	// Device authorization routes
+	protected.Get("/device", usersOnly, oauthHandler.GetDeviceAuthorization)
+	protected.Post("/device/approve", usersOnly, oauthHandler.ApproveDevice)
+
+	// Organization routes
+	protected.Post("/organizations", usersOnly, orgHandler.CreateOrganization)
+	protected.Get("/organizations", usersOnly, orgHandler.GetOrganizations)
+	protected.Get("/organizations/:id", usersOnly, orgHandler.GetOrganization)
+	protected.Put("/organizations/:id", usersOnly, writable, orgHandler.UpdateOrganization)
+	protected.Delete("/organizations/:id", usersOnly, writable, orgHandler.DeleteOrganization)
+	protected.Get("/organizations/:id/members", usersOnly, orgHandler.GetMembers)
+	protected.Post("/organizations/:id/members", usersOnly, writable, orgHandler.AddMember)
+	protected.Put("/organizations/:id/members/:userId", usersOnly, writable, orgHandler.UpdateMember)
+	protected.Delete("/organizations/:id/members/:userId", usersOnly, writable, orgHandler.RemoveMember)
+	protected.Post("/organizations/:id/invitations", usersOnly, writable, invitationHandler.CreateInvitation)
+	protected.Get("/organizations/:id/invitations", usersOnly, invitationHandler.GetInvitations)
+	protected.Delete("/organizations/:id/invitations/:invitationId", usersOnly, writable, invitationHandler.RevokeInvitation)
+	protected.Post("/invitations/accept", usersOnly, invitationHandler.AcceptInvitation)
+
+	// Team routes
+	protected.Post("/organizations/:id/teams", usersOnly, writable, teamHandler.CreateTeam)
+	protected.Get("/organizations/:id/teams", usersOnly, teamHandler.GetTeams)
+	protected.Get("/organizations/:id/teams/:teamId", usersOnly, teamHandler.GetTeam)
+	protected.Put("/organizations/:id/teams/:teamId", usersOnly, writable, teamHandler.UpdateTeam)
+	protected.Delete("/organizations/:id/teams/:teamId", usersOnly, writable, teamHandler.DeleteTeam)
+	protected.Post("/organizations/:id/teams/:teamId/members", usersOnly, writable, teamHandler.AddTeamMember)
+	protected.Delete("/organizations/:id/teams/:teamId/members/:userId", usersOnly, writable, teamHandler.RemoveTeamMember)
+
+	// Task workflow routes
+	protected.Get("/organizations/:id/workflow", usersOnly, workflowHandler.GetWorkflow)
+	protected.Put("/organizations/:id/workflow", usersOnly, writable, workflowHandler.UpdateWorkflow)
+	protected.Delete("/organizations/:id/workflow", usersOnly, writable, workflowHandler.ResetWorkflow)
+
+	// Plan routes
+	protected.Get("/plans", usersOnly, planHandler.GetPlans)
+	protected.Get("/organizations/:id/plan", usersOnly, planHandler.GetOrganizationPlan)
+
+	// Billing routes
+	protected.Get("/organizations/:id/billing/subscription", usersOnly, billingHandler.GetSubscription)
+	protected.Post("/organizations/:id/billing/checkout", usersOnly, billingHandler.CreateCheckout)
+	protected.Post("/organizations/:id/billing/portal", usersOnly, billingHandler.CreatePortal)
+	protected.Post("/organizations/:id/billing/coupon", usersOnly, billingHandler.RedeemCoupon)
+	protected.Get("/organizations/:id/billing/details", usersOnly, invoiceHandler.GetBillingDetails)
+	protected.Put("/organizations/:id/billing/details", usersOnly, invoiceHandler.UpdateBillingDetails)
+	protected.Get("/billing/invoices", usersOnly, orgContext, invoiceHandler.GetInvoices)
+	protected.Get("/billing/invoices/:id/download", usersOnly, orgContext, invoiceHandler.DownloadInvoice)
+
+	// Feature flags evaluated for the current user and organization
+	protected.Get("/flags", usersOnly, orgContext, flagHandler.GetFlags)
+
+	// Usage routes
+	protected.Get("/usage", usersOnly, orgContext, usageHandler.GetUsage)
 
 	// Task routes
-	protected.Post("/tasks", taskHandler.CreateTask)
-	protected.Get("/tasks", taskHandler.GetAllTasks)
-	protected.Get("/tasks/:id", taskHandler.GetTask)
-	protected.Put("/tasks/:id", taskHandler.UpdateTask)
-	protected.Delete("/tasks/:id", taskHandler.DeleteTask)
+	protected.Post("/tasks", tasksWrite, orgContext, taskHandler.CreateTask)
+	protected.Get("/tasks", tasksRead, orgContext, taskHandler.GetAllTasks)
+	protected.Get("/tasks/search", tasksRead, orgContext, taskHandler.SearchTasks)
+	protected.Get("/tasks/trash", tasksRead, orgContext, taskHandler.GetTrash)
+	protected.Delete("/tasks/trash/:id", tasksWrite, orgContext, taskHandler.DeleteTaskPermanently)
+	protected.Get("/tasks/:id", tasksRead, orgContext, taskHandler.GetTask)
+	protected.Put("/tasks/:id", tasksWrite, orgContext, taskHandler.UpdateTask)
+	protected.Patch("/tasks/:id", tasksWrite, orgContext, taskHandler.PatchTask)
+	protected.Delete("/tasks/:id", tasksWrite, orgContext, taskHandler.DeleteTask)
+	protected.Post("/tasks/:id/move", tasksWrite, orgContext, taskHandler.MoveTask)
+	protected.Post("/tasks/:id/restore", tasksWrite, orgContext, taskHandler.RestoreTask)
+	protected.Get("/tasks/:id/history", tasksRead, orgContext, taskHandler.GetTaskHistory)
+	protected.Post("/tasks/:id/revert", tasksWrite, orgContext, taskHandler.RevertTask)
+
+	// Admin routes
+	admin := protected.Group("/admin")
+	admin.Use(usersOnly, middleware.AdminRequired(database))
+
+	admin.Post("/invite-codes", adminHandler.CreateInviteCode)
+	admin.Get("/invite-codes", adminHandler.GetInviteCodes)
+	admin.Delete("/invite-codes/:id", adminHandler.RevokeInviteCode)
+
+	admin.Post("/service-accounts", adminHandler.CreateServiceAccount)
+	admin.Get("/service-accounts", adminHandler.GetServiceAccounts)
+	admin.Post("/service-accounts/:id/rotate-secret", adminHandler.RotateServiceAccountSecret)
+	admin.Delete("/service-accounts/:id", adminHandler.DisableServiceAccount)
+
+	admin.Put("/organizations/:id/plan", adminHandler.SetOrganizationPlan)
+	admin.Put("/users/:id/plan", adminHandler.SetUserPlan)
+
+	admin.Post("/users/:id/transfer", adminHandler.TransferOwnership)
+	admin.Get("/ownership-transfers", adminHandler.GetOwnershipTransfers)
+
+	admin.Get("/usage/export", usageHandler.ExportUsage)
+
+	admin.Get("/coupons", couponHandler.GetCoupons)
+	admin.Post("/coupons", couponHandler.CreateCoupon)
+	admin.Get("/coupons/:code", couponHandler.GetCoupon)
+	admin.Delete("/coupons/:code", couponHandler.ArchiveCoupon)
+
+	admin.Get("/feature-flags", flagHandler.GetFeatureFlags)
+	admin.Post("/feature-flags", flagHandler.CreateFeatureFlag)
+	admin.Get("/feature-flags/:key", flagHandler.GetFeatureFlag)
+	admin.Put("/feature-flags/:key", flagHandler.UpdateFeatureFlag)
+	admin.Delete("/feature-flags/:key", flagHandler.DeleteFeatureFlag)
+
+	// Billing provider webhooks (authenticated by their signature)
+	app.Post("/webhooks/billing", billingHandler.Webhook)
+
+	// SCIM provisioning routes (per-tenant bearer token)
+	scimGroup := app.Group("/scim/v2")
+	scimGroup.Use(middleware.SCIMProtected(database))
+
+	scimGroup.Get("/Users", scimHandler.ListUsers)
+	scimGroup.Post("/Users", scimHandler.CreateUser)
+	scimGroup.Get("/Users/:id", scimHandler.GetUser)
+	scimGroup.Put("/Users/:id", scimHandler.ReplaceUser)
+	scimGroup.Patch("/Users/:id", scimHandler.PatchUser)
+	scimGroup.Delete("/Users/:id", scimHandler.DeleteUser)
+
+	scimGroup.Get("/Groups", scimHandler.ListGroups)
+	scimGroup.Post("/Groups", scimHandler.CreateGroup)
+	scimGroup.Get("/Groups/:id", scimHandler.GetGroup)
+	scimGroup.Put("/Groups/:id", scimHandler.ReplaceGroup)
+	scimGroup.Patch("/Groups/:id", scimHandler.PatchGroup)
+	scimGroup.Delete("/Groups/:id", scimHandler.DeleteGroup)
 }
@@ -0,0 +1,499 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/lib/pq"
+)
+
+// Coupon durations: the discount applies to the first billing period only,
+// to DurationMonths periods, or as long as the subscription lasts
+const (
+	CouponOnce      = "once"
+	CouponRepeating = "repeating"
+	CouponForever   = "forever"
+)
+
+// Sources of coupon redemptions
+const (
+	RedemptionCheckout     = "checkout"
+	RedemptionSubscription = "subscription"
+)
+
+// Errors returned when a coupon cannot be redeemed
+var (
+	ErrCouponNotFound        = errors.New("coupon not found")
+	ErrCouponExpired         = errors.New("coupon has expired")
+	ErrCouponExhausted       = errors.New("coupon has reached its redemption limit")
+	ErrCouponPlanNotEligible = errors.New("coupon does not apply to this plan")
+	ErrCouponAlreadyRedeemed = errors.New("coupon already redeemed by this organization")
+)
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,50}$`)
+
+// Coupon is a discount code. Exactly one of PercentOff and AmountOffCents is
+// set. The discount applies to the plan price only, never to metered usage.
+type Coupon struct {
+	ID              int    `json:"id"`
+	Code            string `json:"code"`
+	Description     string `json:"description"`
+	PercentOff      *int   `json:"percent_off"`
+	AmountOffCents  *int64 `json:"amount_off_cents"`
+	Duration        string `json:"duration"`
+	DurationMonths  *int   `json:"duration_months"`
+	MaxRedemptions  *int   `json:"max_redemptions"`
+	RedemptionCount int    `json:"redemption_count"`
+	// PlanCodes restricts the plans the coupon applies to, empty for any
+	// paid plan
+	PlanCodes        []string   `json:"plan_codes"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	ProviderCouponID string     `json:"-"`
+	ArchivedAt       *time.Time `json:"archived_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// Validate normalizes the code of a new coupon and checks its terms
+func (c *Coupon) Validate() error {
+	c.Code = strings.ToUpper(strings.TrimSpace(c.Code))
+	c.Description = strings.TrimSpace(c.Description)
+
+	if !couponCodePattern.MatchString(c.Code) {
+		return errors.New("code must be 3 to 50 letters, digits, dashes or underscores")
+	}
+	if (c.PercentOff == nil) == (c.AmountOffCents == nil) {
+		return errors.New("exactly one of percent_off and amount_off_cents is required")
+	}
+	if c.PercentOff != nil && (*c.PercentOff < 1 || *c.PercentOff > 100) {
+		return errors.New("percent_off must be between 1 and 100")
+	}
+	if c.AmountOffCents != nil && *c.AmountOffCents < 1 {
+		return errors.New("amount_off_cents must be positive")
+	}
+
+	switch c.Duration {
+	case CouponOnce, CouponForever:
+		if c.DurationMonths != nil {
+			return errors.New("duration_months is only allowed for repeating coupons")
+		}
+	case CouponRepeating:
+		if c.DurationMonths == nil || *c.DurationMonths < 1 {
+			return errors.New("duration_months is required for repeating coupons")
+		}
+	default:
+		return errors.New("duration must be once, repeating or forever")
+	}
+
+	if c.MaxRedemptions != nil && *c.MaxRedemptions < 1 {
+		return errors.New("max_redemptions must be at least 1")
+	}
+	if c.ExpiresAt != nil && c.ExpiresAt.Before(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	if c.PlanCodes == nil {
+		c.PlanCodes = []string{}
+	}
+
+	return nil
+}
+
+// AppliesTo reports whether the coupon discounts a plan
+func (c *Coupon) AppliesTo(plan string) bool {
+	if len(c.PlanCodes) == 0 {
+		return true
+	}
+	for _, code := range c.PlanCodes {
+		if code == plan {
+			return true
+		}
+	}
+	return false
+}
+
+// Redeemable checks that the coupon can still be redeemed for a plan at now
+func (c *Coupon) Redeemable(plan string, now time.Time) error {
+	if c.ArchivedAt != nil {
+		return ErrCouponNotFound
+	}
+	if c.ExpiresAt != nil && !now.Before(*c.ExpiresAt) {
+		return ErrCouponExpired
+	}
+	if c.MaxRedemptions != nil && c.RedemptionCount >= *c.MaxRedemptions {
+		return ErrCouponExhausted
+	}
+	if !c.AppliesTo(plan) {
+		return ErrCouponPlanNotEligible
+	}
+	return nil
+}
+
+// AmountOff returns the discount on a price in cents, rounded to the
+// nearest cent and never more than the price
+func (c *Coupon) AmountOff(priceCents int64) int64 {
+	if c.PercentOff != nil {
+		return (priceCents*int64(*c.PercentOff) + 50) / 100
+	}
+	if c.AmountOffCents != nil && *c.AmountOffCents < priceCents {
+		return *c.AmountOffCents
+	}
+	return priceCents
+}
+
+// DiscountPeriod returns the monthly periods discounted by a coupon redeemed
+// at redeemedAt: from the start of its month until the returned end, nil for
+// forever
+func (c *Coupon) DiscountPeriod(redeemedAt time.Time) (time.Time, *time.Time) {
+	redeemedAt = redeemedAt.UTC()
+	start := time.Date(redeemedAt.Year(), redeemedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	months := 0
+	switch c.Duration {
+	case CouponOnce:
+		months = 1
+	case CouponRepeating:
+		months = *c.DurationMonths
+	default:
+		return start, nil
+	}
+
+	end := start.AddDate(0, months, 0)
+	return start, &end
+}
+
+// CouponRedemption is the redemption of a coupon by an organization
+type CouponRedemption struct {
+	ID               int        `json:"id"`
+	CouponID         int        `json:"coupon_id"`
+	OrganizationID   *int       `json:"organization_id"`
+	OrganizationName string     `json:"organization_name,omitempty"`
+	RedeemedBy       *int       `json:"redeemed_by"`
+	Plan             string     `json:"plan"`
+	Source           string     `json:"source"`
+	StartsAt         time.Time  `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+	// DiscountCents is the total discount granted on the invoices of the
+	// organization so far
+	DiscountCents int64     `json:"discount_cents"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CouponReport sums up the redemptions of a coupon
+type CouponReport struct {
+	Redemptions int `json:"redemptions"`
+	// Active counts the redemptions whose discount still applies
+	Active        int   `json:"active"`
+	DiscountCents int64 `json:"discount_cents"`
+}
+
+// couponColumns lists the columns read by scanCoupon, in order
+const couponColumns = `id, code, description, percent_off, amount_off_cents, duration, duration_months,
+	max_redemptions, redemption_count, plan_codes, expires_at, provider_coupon_id, archived_at, created_at, updated_at`
+
+func scanCoupon(row rowScanner, c *Coupon) error {
+	var percentOff, amountOff, durationMonths, maxRedemptions sql.NullInt64
+	var providerID sql.NullString
+
+	err := row.Scan(
+		&c.ID, &c.Code, &c.Description, &percentOff, &amountOff, &c.Duration, &durationMonths,
+		&maxRedemptions, &c.RedemptionCount, pq.Array(&c.PlanCodes), &c.ExpiresAt, &providerID,
+		&c.ArchivedAt, &c.CreatedAt, &c.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	c.PercentOff = nullableInt(percentOff)
+	c.DurationMonths = nullableInt(durationMonths)
+	c.MaxRedemptions = nullableInt(maxRedemptions)
+	if amountOff.Valid {
+		c.AmountOffCents = &amountOff.Int64
+	}
+	c.ProviderCouponID = providerID.String
+	if c.PlanCodes == nil {
+		c.PlanCodes = []string{}
+	}
+
+	return nil
+}
+
+// CouponRepository handles database operations for coupons and their
+// redemptions
+type CouponRepository struct {
+	DB *db.DB
+}
+
+// NewCouponRepository creates a new coupon repository
+func NewCouponRepository(database *db.DB) *CouponRepository {
+	return &CouponRepository{DB: database}
+}
+
+// Create adds a new coupon
+func (r *CouponRepository) Create(c *Coupon) error {
+	row := r.DB.QueryRow(`
+		INSERT INTO coupons (code, description, percent_off, amount_off_cents, duration, duration_months,
+			max_redemptions, plan_codes, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
+		RETURNING `+couponColumns,
+		c.Code, c.Description, c.PercentOff, c.AmountOffCents, c.Duration, c.DurationMonths,
+		c.MaxRedemptions, pq.Array(c.PlanCodes), c.ExpiresAt,
+	)
+	return scanCoupon(row, c)
+}
+
+// GetByCode retrieves a coupon by its code, case insensitively
+func (r *CouponRepository) GetByCode(code string) (*Coupon, error) {
+	c := &Coupon{}
+
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE code = $1`
+	if err := scanCoupon(r.DB.QueryRow(query, strings.ToUpper(strings.TrimSpace(code))), c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetAll retrieves every coupon, archived ones last
+func (r *CouponRepository) GetAll() ([]*Coupon, error) {
+	rows, err := r.DB.Query(`SELECT ` + couponColumns + ` FROM coupons ORDER BY archived_at IS NOT NULL, created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := []*Coupon{}
+	for rows.Next() {
+		c := &Coupon{}
+		if err := scanCoupon(rows, c); err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return coupons, nil
+}
+
+// Archive stops the redemption of a coupon. Discounts already granted keep
+// running until their end.
+func (r *CouponRepository) Archive(code string) error {
+	query := `UPDATE coupons SET archived_at = NOW(), updated_at = NOW() WHERE code = $1 AND archived_at IS NULL`
+
+	result, err := r.DB.Exec(query, strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrCouponNotFound
+	}
+
+	return nil
+}
+
+// SetProviderCouponID records the coupon created on the billing provider
+func (r *CouponRepository) SetProviderCouponID(id int, providerCouponID string) error {
+	_, err := r.DB.Exec(`UPDATE coupons SET provider_coupon_id = $1, updated_at = NOW() WHERE id = $2`, providerCouponID, id)
+	return err
+}
+
+// HasRedeemed reports whether an organization already redeemed a coupon
+func (r *CouponRepository) HasRedeemed(couponID, organizationID int) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM coupon_redemptions WHERE coupon_id = $1 AND organization_id = $2)`
+	err := r.DB.QueryRow(query, couponID, organizationID).Scan(&exists)
+	return exists, err
+}
+
+// Redeem redeems a coupon for the subscription of an organization to a
+// plan. The coupon is locked while its terms are checked and the redemption
+// recorded, and apply, which may be nil, is called before the commit so
+// that a failure to apply the discount on the provider cancels the
+// redemption.
+func (r *CouponRepository) Redeem(code string, redemption *CouponRedemption, apply func(*Coupon) error) (*Coupon, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	c := &Coupon{}
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE code = $1 FOR UPDATE`
+	if err := scanCoupon(tx.QueryRow(query, strings.ToUpper(strings.TrimSpace(code))), c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+
+	if err := c.Redeemable(redemption.Plan, time.Now()); err != nil {
+		return nil, err
+	}
+
+	inserted, err := insertRedemption(tx, c, redemption)
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		return nil, ErrCouponAlreadyRedeemed
+	}
+
+	if apply != nil {
+		if err := apply(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	c.RedemptionCount++
+	return c, nil
+}
+
+// insertRedemption records a redemption and counts it on its coupon. It
+// returns false when the organization already redeemed the coupon.
+func insertRedemption(tx *sql.Tx, c *Coupon, redemption *CouponRedemption) (bool, error) {
+	redemption.CouponID = c.ID
+	redemption.StartsAt, redemption.EndsAt = c.DiscountPeriod(time.Now())
+
+	err := tx.QueryRow(`
+		INSERT INTO coupon_redemptions (coupon_id, organization_id, redeemed_by, plan_code, source,
+			starts_at, ends_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (coupon_id, organization_id) DO NOTHING
+		RETURNING id, created_at
+	`,
+		c.ID, redemption.OrganizationID, redemption.RedeemedBy, redemption.Plan, redemption.Source,
+		redemption.StartsAt, redemption.EndsAt,
+	).Scan(&redemption.ID, &redemption.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`UPDATE coupons SET redemption_count = redemption_count + 1, updated_at = NOW() WHERE id = $1`, c.ID)
+	return err == nil, err
+}
+
+// redeemAtCheckout records the redemption of the coupon passed to a
+// completed checkout, in the transaction applying the subscription. Its
+// terms were checked when the checkout started, they are not checked again
+// since the customer already paid the discounted price.
+func redeemAtCheckout(tx *sql.Tx, code string, organizationID int, plan string) error {
+	c := &Coupon{}
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE code = $1 FOR UPDATE`
+	if err := scanCoupon(tx.QueryRow(query, code), c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	_, err := insertRedemption(tx, c, &CouponRedemption{
+		OrganizationID: &organizationID,
+		Plan:           plan,
+		Source:         RedemptionCheckout,
+	})
+	return err
+}
+
+// GetActiveForOrganization returns the coupon discounting the current
+// period of an organization and its redemption, nil when there is none
+func (r *CouponRepository) GetActiveForOrganization(organizationID int) (*Coupon, *CouponRedemption, error) {
+	redemption := &CouponRedemption{OrganizationID: &organizationID}
+
+	err := r.DB.QueryRow(`
+		SELECT id, coupon_id, plan_code, source, starts_at, ends_at, created_at
+		FROM coupon_redemptions
+		WHERE organization_id = $1 AND starts_at <= NOW() AND (ends_at IS NULL OR ends_at > NOW())
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, organizationID).Scan(
+		&redemption.ID, &redemption.CouponID, &redemption.Plan, &redemption.Source,
+		&redemption.StartsAt, &redemption.EndsAt, &redemption.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &Coupon{}
+	query := `SELECT ` + couponColumns + ` FROM coupons WHERE id = $1`
+	if err := scanCoupon(r.DB.QueryRow(query, redemption.CouponID), c); err != nil {
+		return nil, nil, err
+	}
+
+	return c, redemption, nil
+}
+
+// GetRedemptions returns the redemptions of a coupon, most recent first,
+// with the discount granted on invoices, and their summary
+func (r *CouponRepository) GetRedemptions(c *Coupon) ([]*CouponRedemption, *CouponReport, error) {
+	rows, err := r.DB.Query(`
+		SELECT cr.id, cr.organization_id, COALESCE(o.name, ''), cr.redeemed_by, cr.plan_code, cr.source,
+			cr.starts_at, cr.ends_at, cr.created_at,
+			COALESCE((
+				SELECT SUM(i.discount_cents) FROM invoices i
+				WHERE i.organization_id = cr.organization_id AND i.coupon_code = $2
+			), 0)
+		FROM coupon_redemptions cr
+		LEFT JOIN organizations o ON o.id = cr.organization_id
+		WHERE cr.coupon_id = $1
+		ORDER BY cr.created_at DESC
+	`, c.ID, c.Code)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	report := &CouponReport{}
+	redemptions := []*CouponRedemption{}
+	for rows.Next() {
+		redemption := &CouponRedemption{CouponID: c.ID}
+		var organizationID, redeemedBy sql.NullInt64
+		err := rows.Scan(
+			&redemption.ID, &organizationID, &redemption.OrganizationName, &redeemedBy, &redemption.Plan,
+			&redemption.Source, &redemption.StartsAt, &redemption.EndsAt, &redemption.CreatedAt, &redemption.DiscountCents,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		redemption.OrganizationID = nullableInt(organizationID)
+		redemption.RedeemedBy = nullableInt(redeemedBy)
+
+		report.Redemptions++
+		if redemption.EndsAt == nil || redemption.EndsAt.After(now) {
+			report.Active++
+		}
+		report.DiscountCents += redemption.DiscountCents
+		redemptions = append(redemptions, redemption)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return redemptions, report, nil
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// Device authorization statuses
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+	DeviceStatusConsumed = "consumed"
+)
+
+// DeviceCodeTTL is how long a device authorization request stays valid
+const DeviceCodeTTL = 10 * time.Minute
+
+// DevicePollInterval is the minimum delay in seconds between two polls
+const DevicePollInterval = 5
+
+// userCodeAlphabet follows RFC 8628 section 6.1: consonants only, no vowels
+// so that codes never spell words, and no ambiguous characters
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// Errors returned while polling, they map to the RFC 8628 error codes
+var (
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+	ErrAccessDenied         = errors.New("access_denied")
+	ErrExpiredToken         = errors.New("expired_token")
+	ErrInvalidGrant         = errors.New("invalid_grant")
+)
+
+// DeviceAuthorization is a pending device flow login
+type DeviceAuthorization struct {
+	ID           int        `json:"id"`
+	UserCode     string     `json:"user_code"`
+	ClientID     string     `json:"client_id"`
+	Status       string     `json:"status"`
+	UserID       *int       `json:"user_id,omitempty"`
+	PollInterval int        `json:"interval"`
+	LastPolledAt *time.Time `json:"-"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// DeviceAuthorizationRepository handles database operations for device authorizations
+type DeviceAuthorizationRepository struct {
+	DB *db.DB
+}
+
+// NewDeviceAuthorizationRepository creates a new device authorization repository
+func NewDeviceAuthorizationRepository(database *db.DB) *DeviceAuthorizationRepository {
+	return &DeviceAuthorizationRepository{DB: database}
+}
+
+// Create starts a new device authorization and returns the plain device code
+func (r *DeviceAuthorizationRepository) Create(clientID string) (*DeviceAuthorization, string, error) {
+	deviceCode, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	auth := &DeviceAuthorization{
+		UserCode:     userCode,
+		ClientID:     clientID,
+		Status:       DeviceStatusPending,
+		PollInterval: DevicePollInterval,
+		ExpiresAt:    time.Now().Add(DeviceCodeTTL),
+	}
+
+	query := `
+		INSERT INTO device_authorizations (device_code_hash, user_code, client_id, status, poll_interval, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at
+	`
+
+	err = r.DB.QueryRow(
+		query, hashToken(deviceCode), auth.UserCode, auth.ClientID, auth.Status, auth.PollInterval, auth.ExpiresAt,
+	).Scan(&auth.ID, &auth.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return auth, deviceCode, nil
+}
+
+// GetPendingByUserCode retrieves a pending, unexpired authorization by the
+// code typed by the user
+func (r *DeviceAuthorizationRepository) GetPendingByUserCode(userCode string) (*DeviceAuthorization, error) {
+	auth := &DeviceAuthorization{}
+
+	query := `
+		SELECT id, user_code, client_id, status, user_id, poll_interval, last_polled_at, expires_at, created_at
+		FROM device_authorizations
+		WHERE user_code = $1 AND status = $2 AND expires_at > NOW()
+	`
+
+	err := r.DB.QueryRow(query, NormalizeUserCode(userCode), DeviceStatusPending).Scan(
+		&auth.ID, &auth.UserCode, &auth.ClientID, &auth.Status, &auth.UserID,
+		&auth.PollInterval, &auth.LastPolledAt, &auth.ExpiresAt, &auth.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("device authorization not found")
+		}
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// Decide approves or denies a pending authorization on behalf of a user
+func (r *DeviceAuthorizationRepository) Decide(userCode string, userID int, approve bool) error {
+	status := DeviceStatusDenied
+	if approve {
+		status = DeviceStatusApproved
+	}
+
+	query := `
+		UPDATE device_authorizations
+		SET status = $1, user_id = $2
+		WHERE user_code = $3 AND status = $4 AND expires_at > NOW()
+	`
+
+	result, err := r.DB.Exec(query, status, userID, NormalizeUserCode(userCode), DeviceStatusPending)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("device authorization not found")
+	}
+
+	return nil
+}
+
+// Poll is called by the device with its device code. It returns the
+// approving user ID once, or one of the RFC 8628 polling errors.
+func (r *DeviceAuthorizationRepository) Poll(deviceCode string) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	auth := &DeviceAuthorization{}
+	query := `
+		SELECT id, client_id, status, user_id, poll_interval, last_polled_at, expires_at
+		FROM device_authorizations
+		WHERE device_code_hash = $1
+		FOR UPDATE
+	`
+
+	err = tx.QueryRow(query, hashToken(deviceCode)).Scan(
+		&auth.ID, &auth.ClientID, &auth.Status, &auth.UserID, &auth.PollInterval, &auth.LastPolledAt, &auth.ExpiresAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidGrant
+		}
+		return 0, err
+	}
+
+	userID, pollErr := auth.poll(time.Now())
+	if pollErr == ErrExpiredToken {
+		return 0, pollErr
+	}
+
+	_, err = tx.Exec(
+		`UPDATE device_authorizations SET last_polled_at = $1, poll_interval = $2, status = $3 WHERE id = $4`,
+		auth.LastPolledAt, auth.PollInterval, auth.Status, auth.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, pollErr
+}
+
+// poll records a poll of the device at now. It returns the approving user
+// ID once, the approval being consumed, or one of the RFC 8628 polling
+// errors. Expired authorizations are left unchanged.
+func (a *DeviceAuthorization) poll(now time.Time) (int, error) {
+	if now.After(a.ExpiresAt) {
+		return 0, ErrExpiredToken
+	}
+
+	// Clients polling faster than the interval get it increased by 5 seconds
+	tooFast := a.LastPolledAt != nil && now.Sub(*a.LastPolledAt) < time.Duration(a.PollInterval)*time.Second
+	if tooFast {
+		a.PollInterval += 5
+	}
+	a.LastPolledAt = &now
+
+	switch a.Status {
+	case DeviceStatusApproved:
+		a.Status = DeviceStatusConsumed
+		return *a.UserID, nil
+	case DeviceStatusDenied:
+		return 0, ErrAccessDenied
+	case DeviceStatusConsumed:
+		return 0, ErrInvalidGrant
+	}
+
+	if tooFast {
+		return 0, ErrSlowDown
+	}
+	return 0, ErrAuthorizationPending
+}
+
+// NormalizeUserCode uppercases a user code and restores its XXXX-XXXX form
+func NormalizeUserCode(userCode string) string {
+	code := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+func generateUserCode() (string, error) {
+	code := make([]byte, 0, 8)
+	raw := make([]byte, 16)
+
+	for len(code) < 8 {
+		if _, err := rand.Read(raw); err != nil {
+			return "", err
+		}
+		for _, b := range raw {
+			// Reject bytes above the largest multiple of the alphabet size
+			// so that every character is equally likely
+			if int(b) >= 256-256%len(userCodeAlphabet) || len(code) == 8 {
+				continue
+			}
+			code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+		}
+	}
+
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
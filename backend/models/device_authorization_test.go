@@ -0,0 +1,133 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeUserCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		userCode string
+		want     string
+	}{
+		{"canonical", "BCDF-GHJK", "BCDF-GHJK"},
+		{"lowercase", "bcdf-ghjk", "BCDF-GHJK"},
+		{"no dash", "bcdfghjk", "BCDF-GHJK"},
+		{"spaces", " bcdf ghjk ", "BCDF-GHJK"},
+		{"misplaced dashes", "BC-DF-GH-JK", "BCDF-GHJK"},
+		{"too short", "bcd-fgh", "BCDFGH"},
+		{"too long", "bcdf-ghjk-l", "BCDFGHJKL"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeUserCode(tt.userCode); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateUserCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := generateUserCode()
+		if err != nil {
+			t.Fatalf("Failed to generate user code: %v", err)
+		}
+		if len(code) != 9 || code[4] != '-' {
+			t.Fatalf("Got %q, want the XXXX-XXXX form", code)
+		}
+		for _, c := range strings.Replace(code, "-", "", 1) {
+			if !strings.ContainsRune(userCodeAlphabet, c) {
+				t.Fatalf("Got %q, %q is not in the user code alphabet", code, c)
+			}
+		}
+		if NormalizeUserCode(code) != code {
+			t.Fatalf("Generated code %q is not normalized", code)
+		}
+	}
+}
+
+func TestDeviceAuthorizationPoll(t *testing.T) {
+	now := time.Date(2026, time.June, 1, 10, 0, 0, 0, time.UTC)
+	userID := 7
+
+	pending := func(lastPolled time.Duration) *DeviceAuthorization {
+		auth := &DeviceAuthorization{
+			Status:       DeviceStatusPending,
+			PollInterval: DevicePollInterval,
+			ExpiresAt:    now.Add(DeviceCodeTTL),
+		}
+		if lastPolled > 0 {
+			polledAt := now.Add(-lastPolled)
+			auth.LastPolledAt = &polledAt
+		}
+		return auth
+	}
+	approved := func(lastPolled time.Duration) *DeviceAuthorization {
+		auth := pending(lastPolled)
+		auth.Status = DeviceStatusApproved
+		auth.UserID = &userID
+		return auth
+	}
+	with := func(auth *DeviceAuthorization, update func(*DeviceAuthorization)) *DeviceAuthorization {
+		update(auth)
+		return auth
+	}
+
+	tests := []struct {
+		name         string
+		auth         *DeviceAuthorization
+		wantUserID   int
+		wantErr      error
+		wantStatus   string
+		wantInterval int
+	}{
+		{"first poll", pending(0), 0, ErrAuthorizationPending, DeviceStatusPending, 5},
+		{"poll after the interval", pending(5 * time.Second), 0, ErrAuthorizationPending, DeviceStatusPending, 5},
+		{"poll too fast", pending(2 * time.Second), 0, ErrSlowDown, DeviceStatusPending, 10},
+		{"poll too fast after slow_down", with(pending(7*time.Second), func(a *DeviceAuthorization) { a.PollInterval = 10 }),
+			0, ErrSlowDown, DeviceStatusPending, 15},
+		{"poll after the increased interval", with(pending(10*time.Second), func(a *DeviceAuthorization) { a.PollInterval = 10 }),
+			0, ErrAuthorizationPending, DeviceStatusPending, 10},
+		{"approved", approved(5 * time.Second), userID, nil, DeviceStatusConsumed, 5},
+		{"approved polled too fast", approved(time.Second), userID, nil, DeviceStatusConsumed, 10},
+		{"denied", with(pending(0), func(a *DeviceAuthorization) { a.Status = DeviceStatusDenied }),
+			0, ErrAccessDenied, DeviceStatusDenied, 5},
+		{"consumed", with(approved(0), func(a *DeviceAuthorization) { a.Status = DeviceStatusConsumed }),
+			0, ErrInvalidGrant, DeviceStatusConsumed, 5},
+		{"expired", with(approved(0), func(a *DeviceAuthorization) { a.ExpiresAt = now.Add(-time.Second) }),
+			0, ErrExpiredToken, DeviceStatusApproved, 5},
+	}
+
+	for _, tt := range tests {
+		gotUserID, err := tt.auth.poll(now)
+		if gotUserID != tt.wantUserID || err != tt.wantErr {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", tt.name, gotUserID, err, tt.wantUserID, tt.wantErr)
+		}
+		if tt.auth.Status != tt.wantStatus {
+			t.Errorf("%s: got status %q, want %q", tt.name, tt.auth.Status, tt.wantStatus)
+		}
+		if tt.auth.PollInterval != tt.wantInterval {
+			t.Errorf("%s: got interval %d, want %d", tt.name, tt.auth.PollInterval, tt.wantInterval)
+		}
+	}
+}
+
+func TestDeviceCodeIsSingleUse(t *testing.T) {
+	now := time.Date(2026, time.June, 1, 10, 0, 0, 0, time.UTC)
+	userID := 7
+	auth := &DeviceAuthorization{
+		Status:       DeviceStatusApproved,
+		UserID:       &userID,
+		PollInterval: DevicePollInterval,
+		ExpiresAt:    now.Add(DeviceCodeTTL),
+	}
+
+	if got, err := auth.poll(now); got != userID || err != nil {
+		t.Fatalf("First poll: got (%d, %v), want (%d, nil)", got, err, userID)
+	}
+	if got, err := auth.poll(now.Add(time.Minute)); got != 0 || err != ErrInvalidGrant {
+		t.Errorf("Second poll: got (%d, %v), want (0, %v)", got, err, ErrInvalidGrant)
+	}
+}
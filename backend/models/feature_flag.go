@@ -0,0 +1,266 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/lib/pq"
+)
+
+// Feature flag kinds
+const (
+	FlagKindBoolean      = "boolean"
+	FlagKindMultivariate = "multivariate"
+)
+
+// Variants of boolean flags
+const (
+	VariantOff = "off"
+	VariantOn  = "on"
+)
+
+// Subjects a percentage rollout can be bucketed by
+const (
+	BucketByUser         = "user"
+	BucketByOrganization = "organization"
+)
+
+var flagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,99}$`)
+
+// FlagRule serves a variant to the requests matching all of its conditions.
+// Empty conditions match everything.
+type FlagRule struct {
+	UserIDs         []int    `json:"user_ids,omitempty"`
+	OrganizationIDs []int    `json:"organization_ids,omitempty"`
+	Plans           []string `json:"plans,omitempty"`
+	// Percentage limits the rule to a stable share of the matching users or
+	// organizations, see BucketBy. The rule applies to all of them when nil.
+	Percentage *int   `json:"percentage,omitempty"`
+	BucketBy   string `json:"bucket_by,omitempty"`
+	Variant    string `json:"variant"`
+}
+
+// FeatureFlag is a boolean or multivariate flag with its targeting rules
+type FeatureFlag struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Kind        string `json:"kind"`
+	// Enabled is the kill switch, a disabled flag serves its off variant
+	Enabled bool `json:"enabled"`
+	// Variants lists the values the flag can serve, the first one is the off
+	// variant. Boolean flags always have "off" and "on".
+	Variants       []string   `json:"variants"`
+	DefaultVariant string     `json:"default_variant"`
+	Rules          []FlagRule `json:"rules"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// OffVariant returns the variant served when the flag is disabled
+func (f *FeatureFlag) OffVariant() string {
+	if len(f.Variants) == 0 {
+		return VariantOff
+	}
+	return f.Variants[0]
+}
+
+// HasVariant reports whether the flag can serve variant
+func (f *FeatureFlag) HasVariant(variant string) bool {
+	for _, v := range f.Variants {
+		if v == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate normalizes the flag and checks its variants and rules are consistent
+func (f *FeatureFlag) Validate() error {
+	if !flagKeyPattern.MatchString(f.Key) {
+		return errors.New("key must be 1 to 100 lowercase letters, digits, '_', '.' or '-'")
+	}
+
+	if f.Kind == "" {
+		f.Kind = FlagKindBoolean
+	}
+
+	switch f.Kind {
+	case FlagKindBoolean:
+		f.Variants = []string{VariantOff, VariantOn}
+	case FlagKindMultivariate:
+		if len(f.Variants) < 2 {
+			return errors.New("multivariate flags need at least two variants")
+		}
+		seen := map[string]bool{}
+		for _, v := range f.Variants {
+			if v == "" || len(v) > 100 || seen[v] {
+				return fmt.Errorf("invalid or duplicate variant %q", v)
+			}
+			seen[v] = true
+		}
+	default:
+		return fmt.Errorf("kind must be %s or %s", FlagKindBoolean, FlagKindMultivariate)
+	}
+
+	if f.DefaultVariant == "" {
+		f.DefaultVariant = f.OffVariant()
+	}
+	if !f.HasVariant(f.DefaultVariant) {
+		return fmt.Errorf("unknown default variant %q", f.DefaultVariant)
+	}
+
+	if f.Rules == nil {
+		f.Rules = []FlagRule{}
+	}
+	for i := range f.Rules {
+		rule := &f.Rules[i]
+		if !f.HasVariant(rule.Variant) {
+			return fmt.Errorf("rule %d: unknown variant %q", i, rule.Variant)
+		}
+		if rule.Percentage != nil && (*rule.Percentage < 0 || *rule.Percentage > 100) {
+			return fmt.Errorf("rule %d: percentage must be between 0 and 100", i)
+		}
+		if rule.BucketBy == "" {
+			rule.BucketBy = BucketByUser
+		}
+		if rule.BucketBy != BucketByUser && rule.BucketBy != BucketByOrganization {
+			return fmt.Errorf("rule %d: bucket_by must be %s or %s", i, BucketByUser, BucketByOrganization)
+		}
+	}
+
+	return nil
+}
+
+// featureFlagColumns lists the columns read by scanFeatureFlag, in order
+const featureFlagColumns = `key, description, kind, enabled, variants, default_variant, rules, created_at, updated_at`
+
+func scanFeatureFlag(row rowScanner, flag *FeatureFlag) error {
+	var rules []byte
+	err := row.Scan(
+		&flag.Key, &flag.Description, &flag.Kind, &flag.Enabled, pq.Array(&flag.Variants),
+		&flag.DefaultVariant, &rules, &flag.CreatedAt, &flag.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(rules, &flag.Rules)
+}
+
+// FeatureFlagRepository handles database operations for feature flags
+type FeatureFlagRepository struct {
+	DB *db.DB
+}
+
+// NewFeatureFlagRepository creates a new feature flag repository
+func NewFeatureFlagRepository(database *db.DB) *FeatureFlagRepository {
+	return &FeatureFlagRepository{DB: database}
+}
+
+// GetAll retrieves every feature flag
+func (r *FeatureFlagRepository) GetAll() ([]*FeatureFlag, error) {
+	query := `SELECT ` + featureFlagColumns + ` FROM feature_flags ORDER BY key`
+
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []*FeatureFlag{}
+	for rows.Next() {
+		flag := &FeatureFlag{}
+		if err := scanFeatureFlag(rows, flag); err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return flags, nil
+}
+
+// GetByKey retrieves a feature flag by its key
+func (r *FeatureFlagRepository) GetByKey(key string) (*FeatureFlag, error) {
+	flag := &FeatureFlag{}
+
+	query := `SELECT ` + featureFlagColumns + ` FROM feature_flags WHERE key = $1`
+	if err := scanFeatureFlag(r.DB.QueryRow(query, key), flag); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("feature flag not found")
+		}
+		return nil, err
+	}
+
+	return flag, nil
+}
+
+// Create inserts a new feature flag
+func (r *FeatureFlagRepository) Create(flag *FeatureFlag) error {
+	rules, err := json.Marshal(flag.Rules)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO feature_flags (key, description, kind, enabled, variants, default_variant, rules, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING created_at, updated_at
+	`
+
+	return r.DB.QueryRow(
+		query, flag.Key, flag.Description, flag.Kind, flag.Enabled, pq.Array(flag.Variants),
+		flag.DefaultVariant, rules,
+	).Scan(&flag.CreatedAt, &flag.UpdatedAt)
+}
+
+// Update replaces the definition of a feature flag
+func (r *FeatureFlagRepository) Update(flag *FeatureFlag) error {
+	rules, err := json.Marshal(flag.Rules)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE feature_flags
+		SET description = $1, kind = $2, enabled = $3, variants = $4, default_variant = $5, rules = $6, updated_at = NOW()
+		WHERE key = $7
+		RETURNING created_at, updated_at
+	`
+
+	err = r.DB.QueryRow(
+		query, flag.Description, flag.Kind, flag.Enabled, pq.Array(flag.Variants),
+		flag.DefaultVariant, rules, flag.Key,
+	).Scan(&flag.CreatedAt, &flag.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("feature flag not found")
+	}
+
+	return err
+}
+
+// Delete removes a feature flag
+func (r *FeatureFlagRepository) Delete(key string) error {
+	result, err := r.DB.Exec(`DELETE FROM feature_flags WHERE key = $1`, key)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("feature flag not found")
+	}
+
+	return nil
+}
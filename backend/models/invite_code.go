@@ -0,0 +1,160 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// inviteCodeAlphabet avoids characters that are easily confused (0/O, 1/I)
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// InviteCode is an admin-generated code allowing registration when
+// registration is invite-only
+type InviteCode struct {
+	ID        int        `json:"id"`
+	Code      string     `json:"code"`
+	CreatedBy *int       `json:"created_by,omitempty"`
+	MaxUses   *int       `json:"max_uses,omitempty"`
+	UseCount  int        `json:"use_count"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// InviteCodeRepository handles database operations for invite codes
+type InviteCodeRepository struct {
+	DB *db.DB
+}
+
+// NewInviteCodeRepository creates a new invite code repository
+func NewInviteCodeRepository(database *db.DB) *InviteCodeRepository {
+	return &InviteCodeRepository{DB: database}
+}
+
+// Create generates a new random code and stores it
+func (r *InviteCodeRepository) Create(invite *InviteCode) error {
+	code, err := generateInviteCode(12)
+	if err != nil {
+		return err
+	}
+	invite.Code = code
+
+	query := `
+		INSERT INTO invite_codes (code, created_by, max_uses, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, use_count, created_at
+	`
+
+	return r.DB.QueryRow(query, invite.Code, invite.CreatedBy, invite.MaxUses, invite.ExpiresAt).Scan(
+		&invite.ID, &invite.UseCount, &invite.CreatedAt,
+	)
+}
+
+// GetAll retrieves all invite codes, newest first
+func (r *InviteCodeRepository) GetAll() ([]*InviteCode, error) {
+	query := `
+		SELECT id, code, created_by, max_uses, use_count, expires_at, revoked_at, created_at
+		FROM invite_codes
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*InviteCode{}
+	for rows.Next() {
+		invite := &InviteCode{}
+		if err := rows.Scan(
+			&invite.ID, &invite.Code, &invite.CreatedBy, &invite.MaxUses, &invite.UseCount,
+			&invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// Redeem atomically consumes one use of a code. It fails if the code does
+// not exist, is revoked, expired or has no uses left.
+func (r *InviteCodeRepository) Redeem(code string) (*InviteCode, error) {
+	invite := &InviteCode{}
+
+	query := `
+		UPDATE invite_codes
+		SET use_count = use_count + 1
+		WHERE code = $1
+			AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > NOW())
+			AND (max_uses IS NULL OR use_count < max_uses)
+		RETURNING id, code, created_by, max_uses, use_count, expires_at, revoked_at, created_at
+	`
+
+	err := r.DB.QueryRow(query, strings.ToUpper(strings.TrimSpace(code))).Scan(
+		&invite.ID, &invite.Code, &invite.CreatedBy, &invite.MaxUses, &invite.UseCount,
+		&invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid or expired invite code")
+		}
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// Release gives back a use consumed by Redeem when registration fails afterwards
+func (r *InviteCodeRepository) Release(id int) error {
+	query := `UPDATE invite_codes SET use_count = use_count - 1 WHERE id = $1 AND use_count > 0`
+	_, err := r.DB.Exec(query, id)
+	return err
+}
+
+// Revoke disables a code
+func (r *InviteCodeRepository) Revoke(id int) error {
+	query := `UPDATE invite_codes SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	result, err := r.DB.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("invite code not found or already revoked")
+	}
+
+	return nil
+}
+
+func generateInviteCode(length int) (string, error) {
+	raw := make([]byte, length)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, length)
+	for i, b := range raw {
+		code[i] = inviteCodeAlphabet[int(b)%len(inviteCodeAlphabet)]
+	}
+
+	return string(code), nil
+}
@@ -0,0 +1,385 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/lib/pq"
+)
+
+// ErrInvoiceExists is returned when an organization was already invoiced for a period
+var ErrInvoiceExists = errors.New("invoice already issued for this period")
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// BillingDetails identifies a party on an invoice: the seller, or an
+// organization as a customer
+type BillingDetails struct {
+	Name    string `json:"name"`
+	Email   string `json:"email,omitempty"`
+	Address string `json:"address,omitempty"`
+	// Country is an ISO 3166-1 alpha-2 code
+	Country string `json:"country,omitempty"`
+	TaxID   string `json:"tax_id,omitempty"`
+}
+
+// Validate normalizes and checks billing details entered by a customer
+func (d *BillingDetails) Validate() error {
+	d.Name = strings.TrimSpace(d.Name)
+	d.Email = strings.TrimSpace(d.Email)
+	d.Address = strings.TrimSpace(d.Address)
+	d.Country = strings.ToUpper(strings.TrimSpace(d.Country))
+	d.TaxID = strings.TrimSpace(d.TaxID)
+
+	if len(d.Name) > 255 || len(d.Email) > 255 || len(d.Address) > 1000 || len(d.TaxID) > 50 {
+		return errors.New("billing details are too long")
+	}
+	if d.Email != "" {
+		if _, err := mail.ParseAddress(d.Email); err != nil {
+			return errors.New("invalid billing email")
+		}
+	}
+	if d.Country != "" && !countryCodePattern.MatchString(d.Country) {
+		return errors.New("country must be a two-letter ISO code")
+	}
+
+	return nil
+}
+
+// InvoiceLine is a charge on an invoice. UnitPriceCents is charged for each
+// UnitSize units, 1 unless usage is priced per batch such as 1000 API calls.
+type InvoiceLine struct {
+	Description    string `json:"description"`
+	Quantity       int64  `json:"quantity"`
+	UnitPriceCents int64  `json:"unit_price_cents"`
+	UnitSize       int64  `json:"unit_size"`
+	AmountCents    int64  `json:"amount_cents"`
+}
+
+// Invoice is an invoice issued to an organization for a monthly period.
+// PeriodEnd is the last day of the period. The parties and lines are copied
+// at issue time, OrganizationID is nil once the organization is deleted.
+// DiscountCents is the amount taken off by the coupon CouponCode, if any.
+type Invoice struct {
+	ID                 int            `json:"id"`
+	Number             string         `json:"number"`
+	OrganizationID     *int           `json:"organization_id"`
+	PeriodStart        time.Time      `json:"period_start"`
+	PeriodEnd          time.Time      `json:"period_end"`
+	Currency           string         `json:"currency"`
+	Seller             BillingDetails `json:"seller"`
+	Customer           BillingDetails `json:"customer"`
+	Lines              []InvoiceLine  `json:"lines"`
+	SubtotalCents      int64          `json:"subtotal_cents"`
+	TaxName            string         `json:"tax_name"`
+	TaxRateBasisPoints int            `json:"tax_rate_basis_points"`
+	TaxCents           int64          `json:"tax_cents"`
+	TotalCents         int64          `json:"total_cents"`
+	CouponCode         string         `json:"coupon_code,omitempty"`
+	DiscountCents      int64          `json:"discount_cents"`
+	HTMLKey            string         `json:"-"`
+	PDFKey             string         `json:"-"`
+	IssuedAt           time.Time      `json:"issued_at"`
+}
+
+// BillableOrganization is an organization to invoice for a period, with the
+// plan it is on
+type BillableOrganization struct {
+	OrganizationID     int
+	Name               string
+	SubscriptionStatus string
+	PlanCode           string
+	PlanName           string
+	PlanPriceCents     int64
+	Billing            BillingDetails
+	// Discount is the coupon redeemed for the period, nil without one
+	Discount *Coupon
+}
+
+// invoiceColumns lists the columns read by scanInvoice, in order
+const invoiceColumns = `id, number, organization_id, period_start, period_end, currency, seller, customer, lines,
+	subtotal_cents, tax_name, tax_rate_basis_points, tax_cents, total_cents, COALESCE(coupon_code, ''), discount_cents,
+	html_key, pdf_key, issued_at`
+
+func scanInvoice(row rowScanner, invoice *Invoice) error {
+	var organizationID sql.NullInt64
+	var seller, customer, lines []byte
+	var htmlKey, pdfKey sql.NullString
+
+	err := row.Scan(
+		&invoice.ID, &invoice.Number, &organizationID, &invoice.PeriodStart, &invoice.PeriodEnd, &invoice.Currency,
+		&seller, &customer, &lines, &invoice.SubtotalCents, &invoice.TaxName, &invoice.TaxRateBasisPoints,
+		&invoice.TaxCents, &invoice.TotalCents, &invoice.CouponCode, &invoice.DiscountCents,
+		&htmlKey, &pdfKey, &invoice.IssuedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if organizationID.Valid {
+		id := int(organizationID.Int64)
+		invoice.OrganizationID = &id
+	}
+	invoice.HTMLKey = htmlKey.String
+	invoice.PDFKey = pdfKey.String
+
+	if err := json.Unmarshal(seller, &invoice.Seller); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(customer, &invoice.Customer); err != nil {
+		return err
+	}
+	return json.Unmarshal(lines, &invoice.Lines)
+}
+
+// InvoiceRepository handles database operations for invoices and the
+// billing details of organizations
+type InvoiceRepository struct {
+	DB *db.DB
+}
+
+// NewInvoiceRepository creates a new invoice repository
+func NewInvoiceRepository(database *db.DB) *InvoiceRepository {
+	return &InvoiceRepository{DB: database}
+}
+
+// GetBillingDetails returns the billing details of an organization
+func (r *InvoiceRepository) GetBillingDetails(organizationID int) (*BillingDetails, error) {
+	details := &BillingDetails{}
+	var email, address, country, taxID sql.NullString
+
+	query := `
+		SELECT COALESCE(billing_name, name), billing_email, billing_address, billing_country, billing_tax_id
+		FROM organizations WHERE id = $1
+	`
+	err := r.DB.QueryRow(query, organizationID).Scan(&details.Name, &email, &address, &country, &taxID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("organization not found")
+		}
+		return nil, err
+	}
+
+	details.Email = email.String
+	details.Address = address.String
+	details.Country = country.String
+	details.TaxID = taxID.String
+	return details, nil
+}
+
+// UpdateBillingDetails replaces the billing details of an organization. An
+// empty name bills the organization under its own name.
+func (r *InvoiceRepository) UpdateBillingDetails(organizationID int, details *BillingDetails) error {
+	query := `
+		UPDATE organizations
+		SET billing_name = NULLIF($1, ''), billing_email = NULLIF($2, ''), billing_address = NULLIF($3, ''),
+			billing_country = NULLIF($4, ''), billing_tax_id = NULLIF($5, ''), updated_at = NOW()
+		WHERE id = $6
+	`
+
+	result, err := r.DB.Exec(query, details.Name, details.Email, details.Address, details.Country, details.TaxID, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("organization not found")
+	}
+
+	return nil
+}
+
+// GetBillable returns the organizations that may owe something for the
+// period starting at periodStart and have no invoice for it yet: those on a
+// paid plan with an active or past due subscription, and those with metered
+// usage. Organizations created after the period are left out. The coupon
+// redeemed most recently among those discounting the period is attached.
+func (r *InvoiceRepository) GetBillable(periodStart time.Time) ([]*BillableOrganization, error) {
+	query := `
+		SELECT o.id, o.name, o.subscription_status, p.code, p.name, p.price_cents,
+			COALESCE(o.billing_name, o.name), COALESCE(o.billing_email, ''), COALESCE(o.billing_address, ''),
+			COALESCE(o.billing_country, ''), COALESCE(o.billing_tax_id, ''),
+			d.code, d.percent_off, d.amount_off_cents, d.plan_codes
+		FROM organizations o
+		JOIN plans p ON p.code = o.plan_code
+		LEFT JOIN LATERAL (
+			SELECT c.code, c.percent_off, c.amount_off_cents, c.plan_codes
+			FROM coupon_redemptions cr
+			JOIN coupons c ON c.id = cr.coupon_id
+			WHERE cr.organization_id = o.id AND cr.starts_at <= $1 AND (cr.ends_at IS NULL OR cr.ends_at > $1)
+			ORDER BY cr.created_at DESC
+			LIMIT 1
+		) d ON TRUE
+		WHERE o.created_at < $2
+			AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.organization_id = o.id AND i.period_start = $1)
+			AND (
+				(p.price_cents > 0 AND o.subscription_status IN ($3, $4))
+				OR EXISTS (SELECT 1 FROM usage_counters u WHERE u.organization_id = o.id AND u.period_start = $1 AND u.quantity > 0)
+			)
+		ORDER BY o.id
+	`
+
+	rows, err := r.DB.Query(query, periodStart, periodStart.AddDate(0, 1, 0), SubscriptionActive, SubscriptionPastDue)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*BillableOrganization{}
+	for rows.Next() {
+		org := &BillableOrganization{}
+		var couponCode sql.NullString
+		var percentOff, amountOff sql.NullInt64
+		var planCodes []string
+		if err := rows.Scan(
+			&org.OrganizationID, &org.Name, &org.SubscriptionStatus, &org.PlanCode, &org.PlanName, &org.PlanPriceCents,
+			&org.Billing.Name, &org.Billing.Email, &org.Billing.Address, &org.Billing.Country, &org.Billing.TaxID,
+			&couponCode, &percentOff, &amountOff, pq.Array(&planCodes),
+		); err != nil {
+			return nil, err
+		}
+		if couponCode.Valid {
+			org.Discount = &Coupon{Code: couponCode.String, PercentOff: nullableInt(percentOff), PlanCodes: planCodes}
+			if amountOff.Valid {
+				org.Discount.AmountOffCents = &amountOff.Int64
+			}
+		}
+		orgs = append(orgs, org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// Create issues an invoice: it takes the next number of the year, formatted
+// as PREFIX-YEAR-000042, and inserts the invoice in the same transaction so
+// that numbers are sequential without gaps. It returns ErrInvoiceExists when
+// the organization already has an invoice for the period.
+func (r *InvoiceRepository) Create(invoice *Invoice, numberPrefix string) error {
+	seller, err := json.Marshal(invoice.Seller)
+	if err != nil {
+		return err
+	}
+	customer, err := json.Marshal(invoice.Customer)
+	if err != nil {
+		return err
+	}
+	lines, err := json.Marshal(invoice.Lines)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	issuedAt := time.Now().UTC()
+
+	var sequence int
+	err = tx.QueryRow(`
+		INSERT INTO invoice_sequences (year, last_number) VALUES ($1, 1)
+		ON CONFLICT (year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+		RETURNING last_number
+	`, issuedAt.Year()).Scan(&sequence)
+	if err != nil {
+		return err
+	}
+
+	invoice.Number = fmt.Sprintf("%s-%d-%06d", numberPrefix, issuedAt.Year(), sequence)
+
+	row := tx.QueryRow(`
+		INSERT INTO invoices (number, organization_id, period_start, period_end, currency, seller, customer, lines,
+			subtotal_cents, tax_name, tax_rate_basis_points, tax_cents, total_cents, coupon_code, discount_cents, issued_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), $15, $16)
+		RETURNING `+invoiceColumns,
+		invoice.Number, invoice.OrganizationID, invoice.PeriodStart, invoice.PeriodEnd, invoice.Currency,
+		seller, customer, lines, invoice.SubtotalCents, invoice.TaxName, invoice.TaxRateBasisPoints,
+		invoice.TaxCents, invoice.TotalCents, invoice.CouponCode, invoice.DiscountCents, issuedAt,
+	)
+	if err := scanInvoice(row, invoice); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint != "invoices_number_key" {
+			return ErrInvoiceExists
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetDocuments records the storage keys of the rendered documents of an invoice
+func (r *InvoiceRepository) SetDocuments(id int, htmlKey, pdfKey string) error {
+	query := `UPDATE invoices SET html_key = $1, pdf_key = $2 WHERE id = $3`
+	_, err := r.DB.Exec(query, htmlKey, pdfKey, id)
+	return err
+}
+
+// GetPendingDocuments returns the invoices whose documents are not stored yet
+func (r *InvoiceRepository) GetPendingDocuments() ([]*Invoice, error) {
+	return r.query(`SELECT ` + invoiceColumns + ` FROM invoices WHERE pdf_key IS NULL ORDER BY id`)
+}
+
+// GetForOrganization returns the invoices of an organization, most recent first
+func (r *InvoiceRepository) GetForOrganization(organizationID int) ([]*Invoice, error) {
+	return r.query(`
+		SELECT `+invoiceColumns+`
+		FROM invoices
+		WHERE organization_id = $1
+		ORDER BY issued_at DESC, id DESC
+	`, organizationID)
+}
+
+// GetByID retrieves an invoice of an organization
+func (r *InvoiceRepository) GetByID(id, organizationID int) (*Invoice, error) {
+	invoice := &Invoice{}
+
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE id = $1 AND organization_id = $2`
+	if err := scanInvoice(r.DB.QueryRow(query, id, organizationID), invoice); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invoice not found")
+		}
+		return nil, err
+	}
+
+	return invoice, nil
+}
+
+func (r *InvoiceRepository) query(query string, args ...interface{}) ([]*Invoice, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := []*Invoice{}
+	for rows.Next() {
+		invoice := &Invoice{}
+		if err := scanInvoice(rows, invoice); err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
@@ -0,0 +1,381 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// Membership roles, from most to least privileged
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+var roleRanks = map[string]int{
+	RoleOwner:  3,
+	RoleAdmin:  2,
+	RoleMember: 1,
+}
+
+// IsValidRole reports whether role is a known membership role
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants at least the privileges of minimum
+func RoleAtLeast(role, minimum string) bool {
+	return roleRanks[role] >= roleRanks[minimum] && roleRanks[role] > 0
+}
+
+// Organization is a workspace shared by its members. SubscriptionStatus is
+// trialing, active, past_due or canceled.
+type Organization struct {
+	ID                 int        `json:"id"`
+	Name               string     `json:"name"`
+	Personal           bool       `json:"personal"`
+	Plan               string     `json:"plan"`
+	SubscriptionStatus string     `json:"subscription_status"`
+	TrialEndsAt        *time.Time `json:"trial_ends_at,omitempty"`
+	Role               string     `json:"role,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// Membership links a user to an organization with a role
+type Membership struct {
+	OrganizationID int       `json:"organization_id"`
+	UserID         int       `json:"user_id"`
+	Role           string    `json:"role"`
+	Email          string    `json:"email,omitempty"`
+	Name           string    `json:"name,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// OrganizationRepository handles database operations for organizations and memberships
+type OrganizationRepository struct {
+	DB *db.DB
+}
+
+// NewOrganizationRepository creates a new organization repository
+func NewOrganizationRepository(database *db.DB) *OrganizationRepository {
+	return &OrganizationRepository{DB: database}
+}
+
+// Create adds a new organization with ownerID as its owner
+func (r *OrganizationRepository) Create(org *Organization, ownerID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createOrganization(tx, org, ownerID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// createOrganization adds a new organization with ownerID as its owner in tx
+func createOrganization(tx *sql.Tx, org *Organization, ownerID int) error {
+	query := `
+		INSERT INTO organizations (name, personal, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		RETURNING id, plan_code, subscription_status, trial_ends_at, created_at, updated_at
+	`
+
+	err := tx.QueryRow(query, org.Name, org.Personal).Scan(
+		&org.ID, &org.Plan, &org.SubscriptionStatus, &org.TrialEndsAt, &org.CreatedAt, &org.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO organization_memberships (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`, org.ID, ownerID, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	org.Role = RoleOwner
+	return nil
+}
+
+// createPersonal creates the personal workspace of a new user in tx, see
+// UserRepository.CreateWithPersonalOrganization
+func createPersonal(tx *sql.Tx, user *User) (*Organization, error) {
+	name := user.Name
+	if name == "" {
+		name = user.Email
+	}
+
+	org := &Organization{Name: name, Personal: true}
+	if err := createOrganization(tx, org, user.ID); err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// GetByID retrieves an organization as seen by one of its members
+func (r *OrganizationRepository) GetByID(id, userID int) (*Organization, error) {
+	org := &Organization{}
+
+	query := `
+		SELECT o.id, o.name, o.personal, o.plan_code, o.subscription_status, o.trial_ends_at, m.role, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN organization_memberships m ON m.organization_id = o.id
+		WHERE o.id = $1 AND m.user_id = $2
+	`
+
+	err := r.DB.QueryRow(query, id, userID).Scan(
+		&org.ID, &org.Name, &org.Personal, &org.Plan, &org.SubscriptionStatus, &org.TrialEndsAt,
+		&org.Role, &org.CreatedAt, &org.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("organization not found")
+		}
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// GetAllForUser retrieves the organizations a user belongs to
+func (r *OrganizationRepository) GetAllForUser(userID int) ([]*Organization, error) {
+	query := `
+		SELECT o.id, o.name, o.personal, o.plan_code, o.subscription_status, o.trial_ends_at, m.role, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN organization_memberships m ON m.organization_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.personal DESC, o.created_at
+	`
+
+	rows, err := r.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+	for rows.Next() {
+		org := &Organization{}
+		err := rows.Scan(
+			&org.ID, &org.Name, &org.Personal, &org.Plan, &org.SubscriptionStatus, &org.TrialEndsAt,
+			&org.Role, &org.CreatedAt, &org.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// Update renames an organization
+func (r *OrganizationRepository) Update(org *Organization) error {
+	query := `UPDATE organizations SET name = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at`
+
+	err := r.DB.QueryRow(query, org.Name, org.ID).Scan(&org.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("organization not found")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes an organization together with its tasks and memberships
+func (r *OrganizationRepository) Delete(id int) error {
+	result, err := r.DB.Exec(`DELETE FROM organizations WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("organization not found")
+	}
+
+	return nil
+}
+
+// GetMembership retrieves the membership of a user in an organization
+func (r *OrganizationRepository) GetMembership(organizationID, userID int) (*Membership, error) {
+	membership := &Membership{}
+
+	query := `
+		SELECT m.organization_id, m.user_id, m.role, u.email, u.name, m.created_at
+		FROM organization_memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.user_id = $2
+	`
+
+	err := r.DB.QueryRow(query, organizationID, userID).Scan(
+		&membership.OrganizationID, &membership.UserID, &membership.Role,
+		&membership.Email, &membership.Name, &membership.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("membership not found")
+		}
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+// GetDefaultMembership retrieves the membership used when a request does
+// not select an organization: the personal workspace, else the oldest one
+func (r *OrganizationRepository) GetDefaultMembership(userID int) (*Membership, error) {
+	membership := &Membership{}
+
+	query := `
+		SELECT m.organization_id, m.user_id, m.role, m.created_at
+		FROM organization_memberships m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = $1
+		ORDER BY o.personal DESC, m.created_at
+		LIMIT 1
+	`
+
+	err := r.DB.QueryRow(query, userID).Scan(
+		&membership.OrganizationID, &membership.UserID, &membership.Role, &membership.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user has no organization")
+		}
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+// GetMembers retrieves the members of an organization
+func (r *OrganizationRepository) GetMembers(organizationID int) ([]*Membership, error) {
+	query := `
+		SELECT m.organization_id, m.user_id, m.role, u.email, u.name, m.created_at
+		FROM organization_memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1
+		ORDER BY m.created_at
+	`
+
+	rows, err := r.DB.Query(query, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Membership{}
+	for rows.Next() {
+		membership := &Membership{}
+		if err := rows.Scan(
+			&membership.OrganizationID, &membership.UserID, &membership.Role,
+			&membership.Email, &membership.Name, &membership.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		members = append(members, membership)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// AddMember adds a user to an organization. An *EntitlementError is
+// returned when its plan has no seat left, pending invitations included.
+func (r *OrganizationRepository) AddMember(organizationID, userID int, role string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkMemberQuota(tx, organizationID, true); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO organization_memberships (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`
+	if _, err := tx.Exec(query, organizationID, userID, role); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateMemberRole changes the role of a member
+func (r *OrganizationRepository) UpdateMemberRole(organizationID, userID int, role string) error {
+	query := `UPDATE organization_memberships SET role = $1 WHERE organization_id = $2 AND user_id = $3`
+
+	result, err := r.DB.Exec(query, role, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("membership not found")
+	}
+
+	return nil
+}
+
+// RemoveMember removes a user from an organization
+func (r *OrganizationRepository) RemoveMember(organizationID, userID int) error {
+	query := `DELETE FROM organization_memberships WHERE organization_id = $1 AND user_id = $2`
+
+	result, err := r.DB.Exec(query, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("membership not found")
+	}
+
+	return nil
+}
+
+// CountOwners returns the number of owners of an organization
+func (r *OrganizationRepository) CountOwners(organizationID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM organization_memberships WHERE organization_id = $1 AND role = $2`
+	err := r.DB.QueryRow(query, organizationID, RoleOwner).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,300 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// InvitationTTL is how long an organization invitation stays valid
+const InvitationTTL = 7 * 24 * time.Hour
+
+// Invitation statuses, derived from the invitation timestamps
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusRevoked  = "revoked"
+	InvitationStatusExpired  = "expired"
+)
+
+// Errors returned when accepting an invitation
+var (
+	ErrInvitationInvalid       = errors.New("invalid or expired invitation")
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to another email address")
+)
+
+// Invitation invites an email address to join an organization with a role
+type Invitation struct {
+	ID               int        `json:"id"`
+	OrganizationID   int        `json:"organization_id"`
+	OrganizationName string     `json:"organization_name,omitempty"`
+	Email            string     `json:"email"`
+	Role             string     `json:"role"`
+	Status           string     `json:"status"`
+	InvitedBy        *int       `json:"invited_by,omitempty"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	AcceptedAt       *time.Time `json:"accepted_at,omitempty"`
+	AcceptedBy       *int       `json:"accepted_by,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// invitationColumns lists the columns read by scanInvitation, in order
+const invitationColumns = `i.id, i.organization_id, o.name, i.email, i.role, i.invited_by,
+	i.expires_at, i.accepted_at, i.accepted_by, i.revoked_at, i.created_at`
+
+// scanInvitation scans invitationColumns and derives the status
+func scanInvitation(row rowScanner, invitation *Invitation) error {
+	err := row.Scan(
+		&invitation.ID, &invitation.OrganizationID, &invitation.OrganizationName,
+		&invitation.Email, &invitation.Role, &invitation.InvitedBy,
+		&invitation.ExpiresAt, &invitation.AcceptedAt, &invitation.AcceptedBy,
+		&invitation.RevokedAt, &invitation.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	invitation.Status = invitation.status(time.Now())
+	return nil
+}
+
+func (i *Invitation) status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationStatusAccepted
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case !i.ExpiresAt.After(now):
+		return InvitationStatusExpired
+	default:
+		return InvitationStatusPending
+	}
+}
+
+// InvitationRepository handles database operations for organization invitations
+type InvitationRepository struct {
+	DB *db.DB
+}
+
+// NewInvitationRepository creates a new invitation repository
+func NewInvitationRepository(database *db.DB) *InvitationRepository {
+	return &InvitationRepository{DB: database}
+}
+
+// Create stores a new invitation and returns its plain single-use token.
+// Only the SHA256 hash is stored. Pending invitations reserve a seat, an
+// *EntitlementError is returned when the plan has none left.
+func (r *InvitationRepository) Create(invitation *Invitation) (string, error) {
+	plain, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	invitation.Email = strings.TrimSpace(invitation.Email)
+	invitation.ExpiresAt = time.Now().Add(InvitationTTL)
+	invitation.Status = InvitationStatusPending
+
+	query := `
+		INSERT INTO organization_invitations (organization_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at
+	`
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if err := checkMemberQuota(tx, invitation.OrganizationID, true); err != nil {
+		return "", err
+	}
+
+	err = tx.QueryRow(
+		query, invitation.OrganizationID, invitation.Email, invitation.Role,
+		hashToken(plain), invitation.InvitedBy, invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return plain, nil
+}
+
+// GetAllByOrganization retrieves the invitations of an organization, newest first
+func (r *InvitationRepository) GetAllByOrganization(organizationID int) ([]*Invitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.organization_id = $1
+		ORDER BY i.created_at DESC
+	`
+
+	rows, err := r.DB.Query(query, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		invitation := &Invitation{}
+		if err := scanInvitation(rows, invitation); err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// HasPending reports whether an email address already has a pending
+// invitation to an organization
+func (r *InvitationRepository) HasPending(organizationID int, email string) (bool, error) {
+	var exists bool
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM organization_invitations
+			WHERE organization_id = $1 AND LOWER(email) = LOWER($2)
+				AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		)
+	`
+
+	err := r.DB.QueryRow(query, organizationID, strings.TrimSpace(email)).Scan(&exists)
+	return exists, err
+}
+
+// GetByToken retrieves an invitation from its plain token, whatever its status
+func (r *InvitationRepository) GetByToken(plain string) (*Invitation, error) {
+	invitation := &Invitation{}
+
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.token_hash = $1
+	`
+
+	err := scanInvitation(r.DB.QueryRow(query, hashToken(plain)), invitation)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invitation not found")
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// Revoke cancels a pending invitation of an organization
+func (r *InvitationRepository) Revoke(organizationID, id int) error {
+	query := `
+		UPDATE organization_invitations
+		SET revoked_at = NOW()
+		WHERE id = $1 AND organization_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.DB.Exec(query, id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("invitation not found or no longer pending")
+	}
+
+	return nil
+}
+
+// Accept consumes a pending invitation on behalf of user and adds them to
+// the organization. The invitation must have been sent to the user's email
+// address. Users who are already members keep their current role. A
+// *ReadOnlyError is returned while the organization's payment is past due.
+// The seat may have been lost since the invitation was sent, for instance
+// after a downgrade, an *EntitlementError is then returned.
+func (r *InvitationRepository) Accept(plain string, user *User) (*Invitation, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	invitation := &Invitation{}
+
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM organization_invitations i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.token_hash = $1
+		FOR UPDATE OF i
+	`
+
+	if err := scanInvitation(tx.QueryRow(query, hashToken(plain)), invitation); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvitationInvalid
+		}
+		return nil, err
+	}
+
+	if invitation.Status != InvitationStatusPending {
+		return nil, ErrInvitationInvalid
+	}
+
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	if err := checkWritable(tx, invitation.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	if err := checkMemberQuota(tx, invitation.OrganizationID, false); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE organization_invitations
+		SET accepted_at = NOW(), accepted_by = $1
+		WHERE id = $2
+		RETURNING accepted_at
+	`, user.ID, invitation.ID).Scan(&invitation.AcceptedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO organization_memberships (organization_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (organization_id, user_id) DO NOTHING
+	`, invitation.OrganizationID, user.ID, invitation.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	invitation.AcceptedBy = &user.ID
+	invitation.Status = InvitationStatusAccepted
+	return invitation, nil
+}
@@ -0,0 +1,425 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// Errors returned by OwnershipTransferRepository.Transfer for invalid requests
+var (
+	ErrTransferSameUser       = errors.New("cannot transfer ownership to the same user")
+	ErrTransferTargetInactive = errors.New("cannot transfer ownership to an inactive user")
+	ErrTransferUserNotFound   = errors.New("user not found")
+)
+
+// OwnershipTransfer records what was reassigned from one user to another,
+// typically when an employee leaves
+type OwnershipTransfer struct {
+	ID          int    `json:"id"`
+	FromUserID  *int   `json:"from_user_id"`
+	FromEmail   string `json:"from_email"`
+	ToUserID    *int   `json:"to_user_id"`
+	ToEmail     string `json:"to_email"`
+	PerformedBy *int   `json:"performed_by"`
+	// Tasks is the number of tasks reassigned, in every organization
+	Tasks           int `json:"tasks"`
+	ServiceAccounts int `json:"service_accounts"`
+	// Organizations is the number of organizations whose ownership was
+	// transferred
+	Organizations int `json:"organizations"`
+	// Memberships is the number of organizations the new owner was added to
+	// in order to see the tasks and organizations transferred
+	Memberships int       `json:"memberships"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// transferHistory records in the task history the reassignment of the tasks
+// returned by the reassigned CTE, from user $2 to user $1 as action $3 by
+// user $4. The number of rows it affects is the number of tasks.
+const transferHistory = `
+	INSERT INTO task_history (task_id, version, action, actor_id, changes, created_at)
+	SELECT id, version, $3::TEXT, $4::INTEGER, jsonb_build_object('user_id', jsonb_build_object('old', $2::INTEGER, 'new', $1::INTEGER)), NOW()
+	FROM reassigned`
+
+// OwnershipTransferRepository transfers ownership between users and keeps
+// the audit trail of the transfers
+type OwnershipTransferRepository struct {
+	DB *db.DB
+}
+
+// NewOwnershipTransferRepository creates a new ownership transfer repository
+func NewOwnershipTransferRepository(database *db.DB) *OwnershipTransferRepository {
+	return &OwnershipTransferRepository{DB: database}
+}
+
+// Transfer reassigns the tasks and service accounts of a user to another
+// one, and makes the other user owner of the organizations the first one
+// owns, demoting the first one to member. The other user joins every
+// organization holding transferred tasks, regardless of plan quotas. Tasks
+// of the personal workspace are moved to the personal workspace of the
+// other user, without their team.
+//
+// Everything happens in one transaction of the shared database, recorded
+// in the audit trail and in the history of every reassigned task. Tasks of
+// tenants stored in their own schema or database are reassigned in a
+// transaction per tenant, committed just before the shared one: if the
+// shared commit fails the transfer can be run again. With dryRun the same
+// changes are made then rolled back, and the returned counts are what the
+// transfer would do.
+func (r *OwnershipTransferRepository) Transfer(fromUserID, toUserID, performedBy int, dryRun bool) (*OwnershipTransfer, error) {
+	if fromUserID == toUserID {
+		return nil, ErrTransferSameUser
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer := &OwnershipTransfer{FromUserID: &fromUserID, ToUserID: &toUserID, PerformedBy: &performedBy}
+
+	// Locking both users, in a stable order, serializes concurrent transfers
+	// and blocks the creation of new tasks by the first user meanwhile
+	rows, err := tx.Query(`SELECT id, email, active FROM users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`, fromUserID, toUserID)
+	if err != nil {
+		return nil, err
+	}
+	found := 0
+	for rows.Next() {
+		var id int
+		var email string
+		var active bool
+		if err := rows.Scan(&id, &email, &active); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found++
+		if id == fromUserID {
+			transfer.FromEmail = email
+		} else {
+			transfer.ToEmail = email
+			if !active {
+				rows.Close()
+				return nil, ErrTransferTargetInactive
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if found != 2 {
+		return nil, ErrTransferUserNotFound
+	}
+
+	// Personal workspaces are merged rather than handed over, unless one of
+	// them is stored in an isolated tenant
+	fromPersonal, err := r.personalWorkspace(tx, fromUserID)
+	if err != nil {
+		return nil, err
+	}
+	toPersonal, err := r.personalWorkspace(tx, toUserID)
+	if err != nil {
+		return nil, err
+	}
+	merge := fromPersonal != 0 && toPersonal != 0 && !r.isolated(fromPersonal) && !r.isolated(toPersonal)
+
+	if merge {
+		result, err := tx.Exec(`
+			WITH reassigned AS (
+				UPDATE tasks
+				SET user_id = $1, organization_id = $2, team_id = NULL, version = tasks.version + 1,
+					visibility = CASE WHEN tasks.visibility = 'team' THEN 'private' ELSE tasks.visibility END
+				FROM tasks old
+				WHERE old.id = tasks.id AND tasks.user_id = $3 AND tasks.organization_id = $4
+				RETURNING tasks.id, tasks.version, tasks.visibility, old.visibility AS old_visibility, old.team_id AS old_team_id
+			)
+			INSERT INTO task_history (task_id, version, action, actor_id, changes, created_at)
+			SELECT id, version, $5::TEXT, $6::INTEGER,
+				jsonb_build_object(
+					'user_id', jsonb_build_object('old', $3::INTEGER, 'new', $1::INTEGER),
+					'organization_id', jsonb_build_object('old', $4::INTEGER, 'new', $2::INTEGER)
+				)
+				|| CASE WHEN old_team_id IS NULL THEN '{}'::jsonb
+					ELSE jsonb_build_object('team_id', jsonb_build_object('old', old_team_id, 'new', NULL)) END
+				|| CASE WHEN old_visibility = visibility THEN '{}'::jsonb
+					ELSE jsonb_build_object('visibility', jsonb_build_object('old', old_visibility, 'new', visibility)) END,
+				NOW()
+			FROM reassigned
+		`, toUserID, toPersonal, fromUserID, fromPersonal, TaskActionTransfer, performedBy)
+		if err != nil {
+			return nil, err
+		}
+		transfer.Tasks += rowsAffected(result)
+	}
+
+	// Organizations where the new owner must be a member
+	organizations := map[int]bool{}
+
+	rows, err = tx.Query(`SELECT DISTINCT organization_id FROM tasks WHERE user_id = $1`, fromUserID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var organizationID int
+		if err := rows.Scan(&organizationID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		organizations[organizationID] = false
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		WITH reassigned AS (
+			UPDATE tasks SET user_id = $1, version = version + 1 WHERE user_id = $2
+			RETURNING id, version
+		)
+		`+transferHistory, toUserID, fromUserID, TaskActionTransfer, performedBy)
+	if err != nil {
+		return nil, err
+	}
+	transfer.Tasks += rowsAffected(result)
+
+	tenantTxs, err := r.transferTenantTasks(fromUserID, toUserID, performedBy, transfer, organizations)
+	for _, tenantTx := range tenantTxs {
+		defer tenantTx.Rollback()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	merged := 0
+	if merge {
+		merged = fromPersonal
+	}
+
+	rows, err = tx.Query(`
+		SELECT organization_id FROM organization_memberships
+		WHERE user_id = $1 AND role = $2 AND organization_id <> $3
+	`, fromUserID, RoleOwner, merged)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var organizationID int
+		if err := rows.Scan(&organizationID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		organizations[organizationID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for organizationID, owned := range organizations {
+		role := RoleMember
+		if owned {
+			role = RoleOwner
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO organization_memberships (organization_id, user_id, role, created_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (organization_id, user_id) DO NOTHING
+		`, organizationID, toUserID, role)
+		if err != nil {
+			return nil, err
+		}
+		transfer.Memberships += rowsAffected(result)
+
+		if !owned {
+			continue
+		}
+
+		_, err = tx.Exec(
+			`UPDATE organization_memberships SET role = $1 WHERE organization_id = $2 AND user_id = $3`,
+			RoleOwner, organizationID, toUserID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(
+			`UPDATE organization_memberships SET role = $1 WHERE organization_id = $2 AND user_id = $3`,
+			RoleMember, organizationID, fromUserID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		transfer.Organizations++
+	}
+
+	result, err = tx.Exec(`UPDATE service_accounts SET owner_id = $1, updated_at = NOW() WHERE owner_id = $2`, toUserID, fromUserID)
+	if err != nil {
+		return nil, err
+	}
+	transfer.ServiceAccounts = rowsAffected(result)
+
+	err = tx.QueryRow(`
+		INSERT INTO ownership_transfers
+			(from_user_id, from_email, to_user_id, to_email, performed_by,
+			tasks, service_accounts, organizations, memberships, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+		RETURNING id, created_at
+	`,
+		fromUserID, transfer.FromEmail, toUserID, transfer.ToEmail, performedBy,
+		transfer.Tasks, transfer.ServiceAccounts, transfer.Organizations, transfer.Memberships,
+	).Scan(&transfer.ID, &transfer.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		transfer.ID = 0
+		return transfer, nil
+	}
+
+	for _, tenantTx := range tenantTxs {
+		if err := tenantTx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// transferTenantTasks reassigns the tasks stored in isolated tenants, each
+// in a transaction left open for the caller to commit or roll back. The
+// organizations holding reassigned tasks are added to organizations.
+func (r *OwnershipTransferRepository) transferTenantTasks(fromUserID, toUserID, performedBy int, transfer *OwnershipTransfer, organizations map[int]bool) ([]*sql.Tx, error) {
+	if !r.DB.Isolated() {
+		return nil, nil
+	}
+
+	tenants, err := r.DB.GetTenants()
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*sql.Tx
+	for _, tenant := range tenants {
+		conn, err := r.DB.ForTenant(tenant)
+		if err != nil {
+			return txs, err
+		}
+
+		tx, err := conn.Begin()
+		if err != nil {
+			return txs, err
+		}
+		txs = append(txs, tx)
+
+		result, err := tx.Exec(`
+			WITH reassigned AS (
+				UPDATE tasks SET user_id = $1, version = version + 1 WHERE user_id = $2 AND organization_id = $5
+				RETURNING id, version
+			)
+			`+transferHistory,
+			toUserID, fromUserID, TaskActionTransfer, performedBy, tenant.OrganizationID,
+		)
+		if err != nil {
+			return txs, err
+		}
+
+		if n := rowsAffected(result); n > 0 {
+			transfer.Tasks += n
+			if _, ok := organizations[tenant.OrganizationID]; !ok {
+				organizations[tenant.OrganizationID] = false
+			}
+		}
+	}
+
+	return txs, nil
+}
+
+// personalWorkspace returns the ID of the personal workspace owned by a
+// user, 0 when they have none
+func (r *OwnershipTransferRepository) personalWorkspace(tx *sql.Tx, userID int) (int, error) {
+	var organizationID int
+	err := tx.QueryRow(`
+		SELECT o.id FROM organizations o
+		JOIN organization_memberships m ON m.organization_id = o.id
+		WHERE m.user_id = $1 AND m.role = $2 AND o.personal
+		ORDER BY o.id
+		LIMIT 1
+	`, userID, RoleOwner).Scan(&organizationID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return organizationID, err
+}
+
+// isolated reports whether an organization is stored in an isolated tenant
+func (r *OwnershipTransferRepository) isolated(organizationID int) bool {
+	conn, err := r.DB.ForOrganization(organizationID)
+	return err != nil || conn != r.DB
+}
+
+// GetAll retrieves the audit trail of the transfers, most recent first
+func (r *OwnershipTransferRepository) GetAll() ([]*OwnershipTransfer, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, from_user_id, from_email, to_user_id, to_email, performed_by,
+			tasks, service_accounts, organizations, memberships, created_at
+		FROM ownership_transfers
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []*OwnershipTransfer{}
+	for rows.Next() {
+		t := &OwnershipTransfer{}
+		var fromUserID, toUserID, performedBy sql.NullInt64
+		err := rows.Scan(
+			&t.ID, &fromUserID, &t.FromEmail, &toUserID, &t.ToEmail, &performedBy,
+			&t.Tasks, &t.ServiceAccounts, &t.Organizations, &t.Memberships, &t.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		t.FromUserID = nullableInt(fromUserID)
+		t.ToUserID = nullableInt(toUserID)
+		t.PerformedBy = nullableInt(performedBy)
+		transfers = append(transfers, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// rowsAffected returns the number of rows changed by a statement, 0 when
+// the driver cannot tell
+func rowsAffected(result sql.Result) int {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func nullableInt(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	v := int(value.Int64)
+	return &v
+}
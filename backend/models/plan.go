@@ -0,0 +1,377 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/lib/pq"
+)
+
+// Quotas that can be exceeded
+const (
+	EntitlementMaxTasks        = "max_tasks"
+	EntitlementMaxMembers      = "max_members"
+	EntitlementMaxStorageBytes = "max_storage_bytes"
+)
+
+// Features that plans can toggle
+const (
+	FeatureInvitations = "invitations"
+)
+
+// Plan is a subscription tier and the entitlements it grants. Nil limits
+// are unlimited. PriceCents is the monthly price in cents of the invoicing
+// currency.
+type Plan struct {
+	Code            string    `json:"code"`
+	Name            string    `json:"name"`
+	MaxTasks        *int      `json:"max_tasks"`
+	MaxMembers      *int      `json:"max_members"`
+	MaxStorageBytes *int64    `json:"max_storage_bytes"`
+	Features        []string  `json:"features"`
+	PriceCents      int64     `json:"price_cents"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// HasFeature reports whether the plan includes a feature
+func (p *Plan) HasFeature(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// EntitlementError reports an action not allowed by an organization's plan.
+// Feature is set when the plan lacks a feature, otherwise Entitlement and
+// Limit describe the exceeded quota.
+type EntitlementError struct {
+	Plan        string
+	Entitlement string
+	Limit       int64
+	Feature     string
+}
+
+func (e *EntitlementError) Error() string {
+	if e.Feature != "" {
+		return fmt.Sprintf("the %s plan does not include %s", e.Plan, e.Feature)
+	}
+	return fmt.Sprintf("the %s plan is limited to %s = %d", e.Plan, e.Entitlement, e.Limit)
+}
+
+// planColumns lists the columns read by scanPlan, in order
+const planColumns = `p.code, p.name, p.max_tasks, p.max_members, p.max_storage_bytes, p.features,
+	p.price_cents, p.created_at, p.updated_at`
+
+func scanPlan(row rowScanner, plan *Plan) error {
+	return row.Scan(
+		&plan.Code, &plan.Name, &plan.MaxTasks, &plan.MaxMembers, &plan.MaxStorageBytes,
+		pq.Array(&plan.Features), &plan.PriceCents, &plan.CreatedAt, &plan.UpdatedAt,
+	)
+}
+
+// PlanRepository handles database operations for plans and enforces their entitlements
+type PlanRepository struct {
+	DB *db.DB
+}
+
+// NewPlanRepository creates a new plan repository
+func NewPlanRepository(database *db.DB) *PlanRepository {
+	return &PlanRepository{DB: database}
+}
+
+// GetAll retrieves every plan
+func (r *PlanRepository) GetAll() ([]*Plan, error) {
+	query := `SELECT ` + planColumns + ` FROM plans p ORDER BY p.max_tasks NULLS LAST, p.code`
+
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []*Plan{}
+	for rows.Next() {
+		plan := &Plan{}
+		if err := scanPlan(rows, plan); err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+// GetByCode retrieves a plan by its code
+func (r *PlanRepository) GetByCode(code string) (*Plan, error) {
+	plan := &Plan{}
+
+	query := `SELECT ` + planColumns + ` FROM plans p WHERE p.code = $1`
+	if err := scanPlan(r.DB.QueryRow(query, code), plan); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("plan not found")
+		}
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// GetForOrganization retrieves the plan of an organization
+func (r *PlanRepository) GetForOrganization(organizationID int) (*Plan, error) {
+	plan := &Plan{}
+
+	query := `
+		SELECT ` + planColumns + `
+		FROM plans p
+		JOIN organizations o ON o.plan_code = p.code
+		WHERE o.id = $1
+	`
+	if err := scanPlan(r.DB.QueryRow(query, organizationID), plan); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("organization not found")
+		}
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// AssignToOrganization changes the plan of an organization
+func (r *PlanRepository) AssignToOrganization(organizationID int, code string) error {
+	query := `UPDATE organizations SET plan_code = $1, updated_at = NOW() WHERE id = $2`
+
+	result, err := r.DB.Exec(query, code, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("organization not found")
+	}
+
+	return nil
+}
+
+// AssignToUser changes the plan of a user's personal workspace
+func (r *PlanRepository) AssignToUser(userID int, code string) error {
+	query := `
+		UPDATE organizations SET plan_code = $1, updated_at = NOW()
+		WHERE personal AND id IN (
+			SELECT organization_id FROM organization_memberships WHERE user_id = $2 AND role = $3
+		)
+	`
+
+	result, err := r.DB.Exec(query, code, userID, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("personal organization not found")
+	}
+
+	return nil
+}
+
+// taskCountQuery counts the tasks of organization $1. Tasks in the trash do
+// not count, restoring them checks the quota again.
+const taskCountQuery = `SELECT COUNT(*) FROM tasks WHERE organization_id = $1 AND deleted_at IS NULL`
+
+// seatCountQuery counts the members and the pending invitations of
+// organization $1
+const seatCountQuery = `
+	SELECT
+		(SELECT COUNT(*) FROM organization_memberships WHERE organization_id = $1),
+		(SELECT COUNT(*) FROM organization_invitations
+			WHERE organization_id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW())
+`
+
+// lockPlanQuery reads the plan of organization $1 and locks the organization
+// FOR NO KEY UPDATE until the end of the transaction. Quota checks take the
+// lock so that concurrent writes check the quota one at a time, the lock
+// still lets new rows reference the organization.
+const lockPlanQuery = `
+	SELECT ` + planColumns + `
+	FROM organizations o
+	JOIN plans p ON p.code = o.plan_code
+	WHERE o.id = $1
+	FOR NO KEY UPDATE OF o
+`
+
+// Usage is the consumption of an organization measured against its plan
+type Usage struct {
+	Tasks   int `json:"tasks"`
+	Members int `json:"members"`
+	// Pending invitations reserve a member seat
+	PendingInvitations int `json:"pending_invitations"`
+}
+
+// GetUsage measures what an organization currently consumes
+func (r *PlanRepository) GetUsage(organizationID int) (*Usage, error) {
+	usage := &Usage{}
+
+	err := r.DB.QueryRow(seatCountQuery, organizationID).Scan(&usage.Members, &usage.PendingInvitations)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tasks may live in the schema or database of an isolated organization
+	conn, err := r.DB.ForOrganization(organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.QueryRow(taskCountQuery, organizationID).Scan(&usage.Tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// TaskQuota holds the task quotas of an organization locked for a task
+// write, see LockTaskQuota
+type TaskQuota struct {
+	tx             *sql.Tx
+	conn           *db.DB
+	plan           *Plan
+	organizationID int
+}
+
+// LockTaskQuota locks the task quotas of an organization until Release is
+// called. Task writes hold the lock until they are committed, so that
+// concurrent writes check the quotas one at a time and each counts the tasks
+// of the previous ones, see lockPlanQuery. Nothing is locked when the plan
+// limits neither tasks nor storage.
+func (r *PlanRepository) LockTaskQuota(organizationID int) (*TaskQuota, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	if err := scanPlan(tx.QueryRow(lockPlanQuery, organizationID), plan); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, errors.New("organization not found")
+		}
+		return nil, err
+	}
+
+	quota := &TaskQuota{tx: tx, plan: plan, organizationID: organizationID}
+	if plan.MaxTasks == nil && plan.MaxStorageBytes == nil {
+		quota.Release()
+		return quota, nil
+	}
+
+	// Tasks may live in the schema or database of an isolated organization.
+	// They are counted outside of tenant transactions, row level security
+	// would hide those the user cannot see.
+	if quota.conn, err = r.DB.ForOrganization(organizationID); err != nil {
+		quota.Release()
+		return nil, err
+	}
+
+	return quota, nil
+}
+
+// Check returns an *EntitlementError when the organization cannot take
+// tasks more tasks and bytes more bytes of task content. Tasks in the trash
+// count toward the storage but not the task quota.
+func (q *TaskQuota) Check(tasks int, bytes int64) error {
+	if tasks > 0 && q.plan.MaxTasks != nil {
+		var count int
+		if err := q.conn.QueryRow(taskCountQuery, q.organizationID).Scan(&count); err != nil {
+			return err
+		}
+		if count+tasks > *q.plan.MaxTasks {
+			return &EntitlementError{Plan: q.plan.Code, Entitlement: EntitlementMaxTasks, Limit: int64(*q.plan.MaxTasks)}
+		}
+	}
+
+	if bytes > 0 && q.plan.MaxStorageBytes != nil {
+		var storage int64
+		if err := q.conn.QueryRow(taskStorageQuery, q.organizationID).Scan(&storage); err != nil {
+			return err
+		}
+		if storage+bytes > *q.plan.MaxStorageBytes {
+			return &EntitlementError{Plan: q.plan.Code, Entitlement: EntitlementMaxStorageBytes, Limit: *q.plan.MaxStorageBytes}
+		}
+	}
+
+	return nil
+}
+
+// Release unlocks the task quotas
+func (q *TaskQuota) Release() {
+	if q.tx != nil {
+		q.tx.Rollback()
+		q.tx = nil
+	}
+}
+
+// checkMemberQuota locks an organization in tx, see lockPlanQuery, and
+// returns an *EntitlementError when it cannot take another member. Callers
+// add the member or invitation in tx, so that concurrent additions check the
+// seats one at a time. Pending invitations count as seats unless
+// includePending is false, which is the case when one of them is accepted.
+func checkMemberQuota(tx *sql.Tx, organizationID int, includePending bool) error {
+	plan := &Plan{}
+	if err := scanPlan(tx.QueryRow(lockPlanQuery, organizationID), plan); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("organization not found")
+		}
+		return err
+	}
+
+	usage := &Usage{}
+	if err := tx.QueryRow(seatCountQuery, organizationID).Scan(&usage.Members, &usage.PendingInvitations); err != nil {
+		return err
+	}
+
+	seats := usage.Members
+	if includePending {
+		seats += usage.PendingInvitations
+	}
+
+	if plan.MaxMembers != nil && seats >= *plan.MaxMembers {
+		return &EntitlementError{Plan: plan.Code, Entitlement: EntitlementMaxMembers, Limit: int64(*plan.MaxMembers)}
+	}
+
+	return nil
+}
+
+// CheckFeature returns an *EntitlementError when the organization's plan
+// does not include a feature
+func (r *PlanRepository) CheckFeature(organizationID int, feature string) error {
+	plan, err := r.GetForOrganization(organizationID)
+	if err != nil {
+		return err
+	}
+
+	if !plan.HasFeature(feature) {
+		return &EntitlementError{Plan: plan.Code, Feature: feature}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// RefreshTokenTTL is how long a refresh token stays valid
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// RefreshToken lets a client obtain new access tokens without credentials
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RefreshTokenRepository handles database operations for refresh tokens
+type RefreshTokenRepository struct {
+	DB *db.DB
+}
+
+// NewRefreshTokenRepository creates a new refresh token repository
+func NewRefreshTokenRepository(database *db.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{DB: database}
+}
+
+// Issue creates a refresh token for a user and returns its plain value.
+// Only the SHA256 hash is stored.
+func (r *RefreshTokenRepository) Issue(userID int) (string, error) {
+	plain, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`
+
+	if _, err := r.DB.Exec(query, userID, hashToken(plain), time.Now().Add(RefreshTokenTTL)); err != nil {
+		return "", err
+	}
+
+	return plain, nil
+}
+
+// errInvalidRefreshToken is returned for unknown, used or expired tokens
+var errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// Consume revokes a valid refresh token and returns its user ID. Each
+// refresh token can only be used once, callers issue a new one.
+func (r *RefreshTokenRepository) Consume(plain string) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	token := &RefreshToken{}
+	query := `
+		SELECT id, user_id, expires_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`
+
+	err = tx.QueryRow(query, hashToken(plain)).Scan(
+		&token.ID, &token.UserID, &token.ExpiresAt, &token.RevokedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errInvalidRefreshToken
+		}
+		return 0, err
+	}
+
+	if err := token.consume(time.Now()); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2`, token.RevokedAt, token.ID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return token.UserID, nil
+}
+
+// consume marks the token used at now. Tokens already used, because they
+// were rotated or revoked, and expired tokens are rejected.
+func (t *RefreshToken) consume(now time.Time) error {
+	if t.RevokedAt != nil || !now.Before(t.ExpiresAt) {
+		return errInvalidRefreshToken
+	}
+	t.RevokedAt = &now
+	return nil
+}
+
+// RevokeAllForUser revokes every active refresh token of a user
+func (r *RefreshTokenRepository) RevokeAllForUser(userID int) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.DB.Exec(query, userID)
+	return err
+}
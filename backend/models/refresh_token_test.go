@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenConsume(t *testing.T) {
+	now := time.Date(2026, time.June, 1, 10, 0, 0, 0, time.UTC)
+	revokedAt := now.Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		token   RefreshToken
+		wantErr bool
+	}{
+		{"valid", RefreshToken{ExpiresAt: now.Add(RefreshTokenTTL)}, false},
+		{"rotated", RefreshToken{ExpiresAt: now.Add(RefreshTokenTTL), RevokedAt: &revokedAt}, true},
+		{"expired", RefreshToken{ExpiresAt: now.Add(-time.Second)}, true},
+		{"expiring now", RefreshToken{ExpiresAt: now}, true},
+	}
+
+	for _, tt := range tests {
+		token := tt.token
+		err := token.consume(now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && (token.RevokedAt == nil || !token.RevokedAt.Equal(now)) {
+			t.Errorf("%s: token was not revoked when consumed", tt.name)
+		}
+	}
+}
+
+func TestRotatedRefreshTokenCannotBeReused(t *testing.T) {
+	now := time.Date(2026, time.June, 1, 10, 0, 0, 0, time.UTC)
+	token := &RefreshToken{UserID: 7, ExpiresAt: now.Add(RefreshTokenTTL)}
+
+	if err := token.consume(now); err != nil {
+		t.Fatalf("First use failed: %v", err)
+	}
+	if err := token.consume(now.Add(time.Second)); err != errInvalidRefreshToken {
+		t.Errorf("Reuse: got %v, want %v", err, errInvalidRefreshToken)
+	}
+	if !token.RevokedAt.Equal(now) {
+		t.Errorf("Reuse moved the revocation time to %s", token.RevokedAt)
+	}
+}
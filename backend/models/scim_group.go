@@ -0,0 +1,228 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// ScimGroup represents a group provisioned by an identity provider
+type ScimGroup struct {
+	ID          int       `json:"id"`
+	Tenant      string    `json:"tenant"`
+	DisplayName string    `json:"display_name"`
+	ExternalID  *string   `json:"external_id,omitempty"`
+	MemberIDs   []int     `json:"member_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ScimGroupRepository handles database operations for SCIM groups
+type ScimGroupRepository struct {
+	DB *db.DB
+}
+
+// NewScimGroupRepository creates a new SCIM group repository
+func NewScimGroupRepository(database *db.DB) *ScimGroupRepository {
+	return &ScimGroupRepository{DB: database}
+}
+
+// Create adds a new group and its members
+func (r *ScimGroupRepository) Create(group *ScimGroup) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO scim_groups (tenant, display_name, external_id, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+
+	err = tx.QueryRow(query, group.Tenant, group.DisplayName, group.ExternalID).Scan(
+		&group.ID, &group.CreatedAt, &group.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceScimGroupMembers(tx, group.ID, group.MemberIDs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetByID retrieves a group of a tenant with its members
+func (r *ScimGroupRepository) GetByID(id int, tenant string) (*ScimGroup, error) {
+	group := &ScimGroup{}
+
+	query := `
+		SELECT id, tenant, display_name, external_id, created_at, updated_at
+		FROM scim_groups
+		WHERE id = $1 AND tenant = $2
+	`
+
+	err := r.DB.QueryRow(query, id, tenant).Scan(
+		&group.ID, &group.Tenant, &group.DisplayName, &group.ExternalID, &group.CreatedAt, &group.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("group not found")
+		}
+		return nil, err
+	}
+
+	if group.MemberIDs, err = r.memberIDs(group.ID); err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// Search retrieves a page of groups of a tenant matching an optional WHERE
+// fragment and returns the total number of matches. Placeholders in where
+// must start at $2, $1 is the tenant.
+func (r *ScimGroupRepository) Search(tenant, where string, args []interface{}, offset, limit int) ([]*ScimGroup, int, error) {
+	if where == "" {
+		where = "TRUE"
+	}
+	args = append([]interface{}{tenant}, args...)
+
+	var total int
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM scim_groups WHERE tenant = $1 AND %s`, where)
+	if err := r.DB.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, tenant, display_name, external_id, created_at, updated_at
+		FROM scim_groups
+		WHERE tenant = $1 AND %s
+		ORDER BY id
+		OFFSET $%d LIMIT $%d
+	`, where, len(args)+1, len(args)+2)
+
+	rows, err := r.DB.Query(query, append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	groups := []*ScimGroup{}
+	for rows.Next() {
+		group := &ScimGroup{}
+		if err := rows.Scan(
+			&group.ID, &group.Tenant, &group.DisplayName, &group.ExternalID, &group.CreatedAt, &group.UpdatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for _, group := range groups {
+		if group.MemberIDs, err = r.memberIDs(group.ID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return groups, total, nil
+}
+
+// Update saves the group attributes and replaces its members
+func (r *ScimGroupRepository) Update(group *ScimGroup) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE scim_groups
+		SET display_name = $1, external_id = $2, updated_at = NOW()
+		WHERE id = $3 AND tenant = $4
+		RETURNING updated_at
+	`
+
+	err = tx.QueryRow(query, group.DisplayName, group.ExternalID, group.ID, group.Tenant).Scan(&group.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("group not found")
+		}
+		return err
+	}
+
+	if err := replaceScimGroupMembers(tx, group.ID, group.MemberIDs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a group of a tenant
+func (r *ScimGroupRepository) Delete(id int, tenant string) error {
+	query := `DELETE FROM scim_groups WHERE id = $1 AND tenant = $2`
+
+	result, err := r.DB.Exec(query, id, tenant)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("group not found")
+	}
+
+	return nil
+}
+
+func (r *ScimGroupRepository) memberIDs(groupID int) ([]int, error) {
+	rows, err := r.DB.Query(`SELECT user_id FROM scim_group_members WHERE group_id = $1 ORDER BY user_id`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func replaceScimGroupMembers(tx *sql.Tx, groupID int, userIDs []int) error {
+	if _, err := tx.Exec(`DELETE FROM scim_group_members WHERE group_id = $1`, groupID); err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		_, err := tx.Exec(`
+			INSERT INTO scim_group_members (group_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, groupID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// ScimToken is a bearer token an identity provider uses to provision users
+type ScimToken struct {
+	ID         int        `json:"id"`
+	Tenant     string     `json:"tenant"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// ScimTokenRepository handles database operations for SCIM tokens
+type ScimTokenRepository struct {
+	DB *db.DB
+}
+
+// NewScimTokenRepository creates a new SCIM token repository
+func NewScimTokenRepository(database *db.DB) *ScimTokenRepository {
+	return &ScimTokenRepository{DB: database}
+}
+
+// Create generates a new token for a tenant and returns its plain value.
+// Only the SHA256 hash is stored, the plain value cannot be retrieved later.
+func (r *ScimTokenRepository) Create(tenant string) (*ScimToken, string, error) {
+	plain, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &ScimToken{Tenant: tenant}
+	query := `
+		INSERT INTO scim_tokens (tenant, token_hash, created_at)
+		VALUES ($1, $2, NOW())
+		RETURNING id, created_at
+	`
+
+	if err := r.DB.QueryRow(query, tenant, hashToken(plain)).Scan(&token.ID, &token.CreatedAt); err != nil {
+		return nil, "", err
+	}
+
+	return token, plain, nil
+}
+
+// Authenticate resolves a plain token to its tenant and records its use
+func (r *ScimTokenRepository) Authenticate(plain string) (*ScimToken, error) {
+	token := &ScimToken{}
+
+	query := `
+		UPDATE scim_tokens
+		SET last_used_at = NOW()
+		WHERE token_hash = $1
+		RETURNING id, tenant, created_at, last_used_at
+	`
+
+	err := r.DB.QueryRow(query, hashToken(plain)).Scan(
+		&token.ID, &token.Tenant, &token.CreatedAt, &token.LastUsedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid token")
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ServiceAccount is a non-human principal owned by an admin. It acts on the
+// data of its owner, limited to its scopes.
+type ServiceAccount struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	OwnerID    int        `json:"owner_id"`
+	ClientID   string     `json:"client_id"`
+	Scopes     []string   `json:"scopes"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	// SecretGeneration counts the client secrets of the account, tokens
+	// issued for a previous secret are rejected
+	SecretGeneration int `json:"-"`
+}
+
+// ServiceAccountRepository handles database operations for service accounts
+type ServiceAccountRepository struct {
+	DB *db.DB
+}
+
+// NewServiceAccountRepository creates a new service account repository
+func NewServiceAccountRepository(database *db.DB) *ServiceAccountRepository {
+	return &ServiceAccountRepository{DB: database}
+}
+
+// Create adds a new service account and returns its plain client secret.
+// Only a bcrypt hash of the secret is stored.
+func (r *ServiceAccountRepository) Create(account *ServiceAccount) (string, error) {
+	clientID, err := randomHex(8)
+	if err != nil {
+		return "", err
+	}
+	account.ClientID = "sa_" + clientID
+
+	secret, hash, err := newClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO service_accounts (name, owner_id, client_id, client_secret_hash, scopes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING id, created_at, updated_at, secret_generation
+	`
+
+	err = r.DB.QueryRow(
+		query, account.Name, account.OwnerID, account.ClientID, hash, pq.Array(account.Scopes),
+	).Scan(&account.ID, &account.CreatedAt, &account.UpdatedAt, &account.SecretGeneration)
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// GetByID retrieves a service account by ID
+func (r *ServiceAccountRepository) GetByID(id int) (*ServiceAccount, error) {
+	account := &ServiceAccount{}
+
+	query := `
+		SELECT id, name, owner_id, client_id, scopes, disabled_at, last_used_at, created_at, updated_at, secret_generation
+		FROM service_accounts
+		WHERE id = $1
+	`
+
+	err := r.DB.QueryRow(query, id).Scan(
+		&account.ID, &account.Name, &account.OwnerID, &account.ClientID, pq.Array(&account.Scopes),
+		&account.DisabledAt, &account.LastUsedAt, &account.CreatedAt, &account.UpdatedAt, &account.SecretGeneration,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("service account not found")
+		}
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// GetAll retrieves all service accounts
+func (r *ServiceAccountRepository) GetAll() ([]*ServiceAccount, error) {
+	query := `
+		SELECT id, name, owner_id, client_id, scopes, disabled_at, last_used_at, created_at, updated_at, secret_generation
+		FROM service_accounts
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []*ServiceAccount{}
+	for rows.Next() {
+		account := &ServiceAccount{}
+		if err := rows.Scan(
+			&account.ID, &account.Name, &account.OwnerID, &account.ClientID, pq.Array(&account.Scopes),
+			&account.DisabledAt, &account.LastUsedAt, &account.CreatedAt, &account.UpdatedAt, &account.SecretGeneration,
+		); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// Authenticate checks client credentials and returns the enabled service account
+func (r *ServiceAccountRepository) Authenticate(clientID, clientSecret string) (*ServiceAccount, error) {
+	account := &ServiceAccount{}
+	var secretHash string
+
+	query := `
+		SELECT id, name, owner_id, client_id, client_secret_hash, scopes, disabled_at, last_used_at, created_at, updated_at, secret_generation
+		FROM service_accounts
+		WHERE client_id = $1
+	`
+
+	err := r.DB.QueryRow(query, clientID).Scan(
+		&account.ID, &account.Name, &account.OwnerID, &account.ClientID, &secretHash, pq.Array(&account.Scopes),
+		&account.DisabledAt, &account.LastUsedAt, &account.CreatedAt, &account.UpdatedAt, &account.SecretGeneration,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid client credentials")
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(secretHash), []byte(clientSecret)); err != nil {
+		return nil, errors.New("invalid client credentials")
+	}
+
+	if account.DisabledAt != nil {
+		return nil, errors.New("service account is disabled")
+	}
+
+	if _, err := r.DB.Exec(`UPDATE service_accounts SET last_used_at = NOW() WHERE id = $1`, account.ID); err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// RotateSecret replaces the client secret and returns the new plain value.
+// Tokens issued with the previous secret are revoked.
+func (r *ServiceAccountRepository) RotateSecret(id int) (string, error) {
+	secret, hash, err := newClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		UPDATE service_accounts
+		SET client_secret_hash = $1, secret_generation = secret_generation + 1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	result, err := r.DB.Exec(query, hash, id)
+	if err != nil {
+		return "", err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+
+	if rowsAffected == 0 {
+		return "", errors.New("service account not found")
+	}
+
+	return secret, nil
+}
+
+// Disable prevents a service account from obtaining new tokens and revokes
+// those it holds
+func (r *ServiceAccountRepository) Disable(id int) error {
+	query := `UPDATE service_accounts SET disabled_at = NOW(), updated_at = NOW() WHERE id = $1 AND disabled_at IS NULL`
+
+	result, err := r.DB.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("service account not found or already disabled")
+	}
+
+	return nil
+}
+
+// newClientSecret generates a client secret and its bcrypt hash
+func newClientSecret() (string, string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, string(hash), nil
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// FreePlan is the plan of organizations without a paid subscription
+const FreePlan = "free"
+
+// Subscription is a paid subscription of an organization, mirrored from the
+// billing provider
+type Subscription struct {
+	ID                     int        `json:"id"`
+	OrganizationID         int        `json:"organization_id"`
+	ProviderSubscriptionID string     `json:"provider_subscription_id"`
+	ProviderCustomerID     string     `json:"provider_customer_id"`
+	Plan                   string     `json:"plan"`
+	Status                 string     `json:"status"`
+	CurrentPeriodEnd       *time.Time `json:"current_period_end,omitempty"`
+	CancelAtPeriodEnd      bool       `json:"cancel_at_period_end"`
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
+	// CouponCode is the coupon redeemed at checkout, read from the provider
+	CouponCode string `json:"-"`
+}
+
+// subscriptionColumns lists the columns read by scanSubscription, in order
+const subscriptionColumns = `id, organization_id, provider_subscription_id, provider_customer_id, plan_code,
+	status, current_period_end, cancel_at_period_end, created_at, updated_at`
+
+func scanSubscription(row rowScanner, sub *Subscription) error {
+	return row.Scan(
+		&sub.ID, &sub.OrganizationID, &sub.ProviderSubscriptionID, &sub.ProviderCustomerID, &sub.Plan,
+		&sub.Status, &sub.CurrentPeriodEnd, &sub.CancelAtPeriodEnd, &sub.CreatedAt, &sub.UpdatedAt,
+	)
+}
+
+// SubscriptionRepository handles database operations for subscriptions and
+// billing webhook events
+type SubscriptionRepository struct {
+	DB *db.DB
+}
+
+// NewSubscriptionRepository creates a new subscription repository
+func NewSubscriptionRepository(database *db.DB) *SubscriptionRepository {
+	return &SubscriptionRepository{DB: database}
+}
+
+// GetCustomerID returns the billing customer of an organization, or an
+// empty string when it has none yet
+func (r *SubscriptionRepository) GetCustomerID(organizationID int) (string, error) {
+	var customerID sql.NullString
+
+	query := `SELECT billing_customer_id FROM organizations WHERE id = $1`
+	if err := r.DB.QueryRow(query, organizationID).Scan(&customerID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("organization not found")
+		}
+		return "", err
+	}
+
+	return customerID.String, nil
+}
+
+// SetCustomerID records the billing customer of an organization
+func (r *SubscriptionRepository) SetCustomerID(organizationID int, customerID string) error {
+	query := `UPDATE organizations SET billing_customer_id = $1, updated_at = NOW() WHERE id = $2`
+	_, err := r.DB.Exec(query, customerID, organizationID)
+	return err
+}
+
+// GetOrganizationByCustomer returns the organization of a billing customer
+func (r *SubscriptionRepository) GetOrganizationByCustomer(customerID string) (int, error) {
+	var organizationID int
+
+	query := `SELECT id FROM organizations WHERE billing_customer_id = $1`
+	if err := r.DB.QueryRow(query, customerID).Scan(&organizationID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errors.New("organization not found")
+		}
+		return 0, err
+	}
+
+	return organizationID, nil
+}
+
+// GetByOrganization retrieves the most recent subscription of an organization
+func (r *SubscriptionRepository) GetByOrganization(organizationID int) (*Subscription, error) {
+	sub := &Subscription{}
+
+	query := `
+		SELECT ` + subscriptionColumns + `
+		FROM subscriptions
+		WHERE organization_id = $1
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`
+
+	if err := scanSubscription(r.DB.QueryRow(query, organizationID), sub); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("subscription not found")
+		}
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// ApplyEvent records a webhook event and, when sub is not nil, stores the
+// subscription and moves its organization to status, one of the
+// Subscription* lifecycle statuses, and to the plan it grants. The coupon
+// redeemed at checkout, if any, is recorded the first time. Everything
+// happens in one transaction so that a failed event can be delivered again.
+// It returns false without changing anything when the event was already
+// processed.
+func (r *SubscriptionRepository) ApplyEvent(eventID, eventType string, sub *Subscription, status string) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO billing_events (id, type, received_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (id) DO NOTHING
+	`, eventID, eventType)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+
+	if sub != nil {
+		row := tx.QueryRow(`
+			INSERT INTO subscriptions (organization_id, provider_subscription_id, provider_customer_id, plan_code,
+				status, current_period_end, cancel_at_period_end, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+			ON CONFLICT (provider_subscription_id) DO UPDATE
+			SET plan_code = EXCLUDED.plan_code, status = EXCLUDED.status,
+				current_period_end = EXCLUDED.current_period_end,
+				cancel_at_period_end = EXCLUDED.cancel_at_period_end, updated_at = NOW()
+			RETURNING `+subscriptionColumns,
+			sub.OrganizationID, sub.ProviderSubscriptionID, sub.ProviderCustomerID, sub.Plan,
+			sub.Status, sub.CurrentPeriodEnd, sub.CancelAtPeriodEnd,
+		)
+		if err := scanSubscription(row, sub); err != nil {
+			return false, err
+		}
+
+		plan := sub.Plan
+		if status == SubscriptionCanceled {
+			plan = FreePlan
+		}
+
+		// The provider now manages the trial, a local trial no longer expires.
+		// Dunning starts over each time the subscription falls past due.
+		_, err = tx.Exec(`
+			UPDATE organizations
+			SET plan_code = $1, billing_customer_id = COALESCE(billing_customer_id, $2),
+				subscription_status = $3, trial_ends_at = NULL,
+				past_due_since = CASE WHEN $3 = 'past_due' THEN COALESCE(past_due_since, NOW()) END,
+				dunning_notified_at = CASE WHEN $3 = 'past_due' THEN dunning_notified_at END,
+				updated_at = NOW()
+			WHERE id = $4
+		`, plan, sub.ProviderCustomerID, status, sub.OrganizationID)
+		if err != nil {
+			return false, err
+		}
+
+		if sub.CouponCode != "" {
+			if err := redeemAtCheckout(tx, sub.CouponCode, sub.OrganizationID, sub.Plan); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Subscription lifecycle statuses of an organization
+const (
+	SubscriptionTrialing = "trialing"
+	SubscriptionActive   = "active"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionCanceled = "canceled"
+)
+
+// ReadOnlyStatus reports whether organizations in this status can only read
+// their data until the overdue payment is settled
+func ReadOnlyStatus(status string) bool {
+	return status == SubscriptionPastDue
+}
+
+// ReadOnlyError is returned when adding to an organization that is
+// read-only, see ReadOnlyStatus
+type ReadOnlyError struct {
+	Status string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return "organization is read-only until its overdue payment is settled"
+}
+
+// checkWritable returns a *ReadOnlyError when an organization is read-only
+func checkWritable(tx *sql.Tx, organizationID int) error {
+	var status string
+	if err := tx.QueryRow(`SELECT subscription_status FROM organizations WHERE id = $1`, organizationID).Scan(&status); err != nil {
+		return err
+	}
+
+	if ReadOnlyStatus(status) {
+		return &ReadOnlyError{Status: status}
+	}
+
+	return nil
+}
+
+// StartTrial moves an organization to a trial of plan ending at endsAt
+func (r *SubscriptionRepository) StartTrial(organizationID int, plan string, endsAt time.Time) error {
+	query := `
+		UPDATE organizations
+		SET plan_code = $1, subscription_status = $2, trial_ends_at = $3, trial_reminder_sent_at = NULL, updated_at = NOW()
+		WHERE id = $4
+	`
+
+	result, err := r.DB.Exec(query, plan, SubscriptionTrialing, endsAt, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("organization not found")
+	}
+
+	return nil
+}
+
+// GetStatus returns the subscription lifecycle status of an organization
+func (r *SubscriptionRepository) GetStatus(organizationID int) (string, error) {
+	var status string
+
+	query := `SELECT subscription_status FROM organizations WHERE id = $1`
+	if err := r.DB.QueryRow(query, organizationID).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.New("organization not found")
+		}
+		return "", err
+	}
+
+	return status, nil
+}
+
+// ClaimTrialReminders returns the organizations whose trial ends before
+// remindBefore and marks their reminder as sent. Claiming and marking in
+// one statement lets several instances run the job without sending the
+// reminder twice.
+func (r *SubscriptionRepository) ClaimTrialReminders(remindBefore time.Time) ([]*Organization, error) {
+	query := `
+		UPDATE organizations
+		SET trial_reminder_sent_at = NOW()
+		WHERE subscription_status = $1 AND trial_reminder_sent_at IS NULL
+			AND trial_ends_at > NOW() AND trial_ends_at <= $2
+		RETURNING ` + lifecycleColumns
+
+	return r.queryLifecycle(query, SubscriptionTrialing, remindBefore)
+}
+
+// ExpireTrials cancels the trials that ended without a paid subscription and
+// moves their organizations back to the free plan
+func (r *SubscriptionRepository) ExpireTrials() ([]*Organization, error) {
+	query := `
+		UPDATE organizations
+		SET subscription_status = $1, plan_code = $2, updated_at = NOW()
+		WHERE subscription_status = $3 AND trial_ends_at <= NOW()
+		RETURNING ` + lifecycleColumns
+
+	return r.queryLifecycle(query, SubscriptionCanceled, FreePlan, SubscriptionTrialing)
+}
+
+// ClaimDunningNotices returns the past due organizations whose owners were
+// not notified yet and marks them as notified
+func (r *SubscriptionRepository) ClaimDunningNotices() ([]*Organization, error) {
+	query := `
+		UPDATE organizations
+		SET dunning_notified_at = NOW()
+		WHERE subscription_status = $1 AND dunning_notified_at IS NULL
+		RETURNING ` + lifecycleColumns
+
+	return r.queryLifecycle(query, SubscriptionPastDue)
+}
+
+// lifecycleColumns lists the columns read by queryLifecycle, in order
+const lifecycleColumns = `id, name, personal, plan_code, subscription_status, trial_ends_at, created_at, updated_at`
+
+func (r *SubscriptionRepository) queryLifecycle(query string, args ...interface{}) ([]*Organization, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+	for rows.Next() {
+		org := &Organization{}
+		err := rows.Scan(
+			&org.ID, &org.Name, &org.Personal, &org.Plan, &org.SubscriptionStatus, &org.TrialEndsAt,
+			&org.CreatedAt, &org.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
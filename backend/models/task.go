@@ -3,24 +3,109 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/tasklist"
+	"github.com/LouisVannobel/SaaS-Template/backend/workflow"
+	"github.com/lib/pq"
 )
 
-// Task represents a task in the system
+// Task visibilities
+const (
+	// VisibilityPrivate tasks are only visible to their creator
+	VisibilityPrivate = "private"
+	// VisibilityTeam tasks are visible to their creator, the members of
+	// their team and the owners and admins of the organization
+	VisibilityTeam = "team"
+	// VisibilityOrganization tasks are visible to every member
+	VisibilityOrganization = "organization"
+)
+
+// IsValidVisibility reports whether visibility is a known task visibility
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPrivate, VisibilityTeam, VisibilityOrganization:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrTaskVersionConflict is returned when a task was modified since the
+// version a change was based on
+var ErrTaskVersionConflict = errors.New("task was modified by another request")
+
+// ErrTaskNotInTrash is returned when restoring or permanently deleting a task
+// that is not in the trash, or that the user cannot see
+var ErrTaskNotInTrash = errors.New("task not found in trash")
+
+// Task represents a task in the system. Its status follows the workflow of
+// its organization, whose hooks maintain CompletedAt. Version is incremented
+// by every update, each recorded in the task history. Deleted tasks stay in
+// the trash, with DeletedAt set, until they are restored or purged.
 type Task struct {
-	ID          int          `json:"id"`
-	Title       string       `json:"title"`
-	Description string       `json:"description"`
-	Status      string       `json:"status"`
-	DueDate     *time.Time   `json:"due_date,omitempty"`
-	UserID      int          `json:"user_id"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
+	ID             int        `json:"id"`
+	Title          string     `json:"title"`
+	Description    string     `json:"description"`
+	Status         string     `json:"status"`
+	DueDate        *time.Time `json:"due_date,omitempty"`
+	UserID         int        `json:"user_id"`
+	OrganizationID int        `json:"organization_id"`
+	Visibility     string     `json:"visibility"`
+	TeamID         *int       `json:"team_id"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	Version        int        `json:"version"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy      *int       `json:"deleted_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// taskColumns lists the columns read by scanTask, in order
+const taskColumns = `tasks.id, tasks.title, tasks.description, tasks.status, tasks.due_date,
+	tasks.user_id, tasks.organization_id, tasks.visibility, tasks.team_id, tasks.completed_at,
+	tasks.version, tasks.deleted_at, tasks.deleted_by, tasks.created_at, tasks.updated_at`
+
+// visibleCondition restricts tasks to those a user may see: organization
+// tasks, the tasks they created and the team tasks of their teams, or of
+// every team for owners and admins. It takes the user ID, whether they are
+// an admin and the IDs of their teams as parameters.
+const visibleCondition = `(
+	tasks.visibility = 'organization' OR tasks.user_id = %[1]s
+	OR (tasks.visibility = 'team' AND (%[2]s OR tasks.team_id = ANY(%[3]s)))
+)`
+
+// scanTask scans taskColumns into task, followed by any extra destinations
+func scanTask(row rowScanner, task *Task, extra ...interface{}) error {
+	dest := []interface{}{
+		&task.ID, &task.Title, &task.Description, &task.Status, &task.DueDate,
+		&task.UserID, &task.OrganizationID, &task.Visibility, &task.TeamID, &task.CompletedAt,
+		&task.Version, &task.DeletedAt, &task.DeletedBy, &task.CreatedAt, &task.UpdatedAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// contentSize is the number of bytes of task content counted toward the
+// storage quota, as measured by taskStorageQuery
+func (t *Task) contentSize() int64 {
+	return int64(len(t.Title) + len(t.Description))
 }
 
-// TaskRepository handles database operations for tasks
+// taskAccess is what a member may see of the tasks of an organization
+type taskAccess struct {
+	admin   bool
+	teamIDs []int64
+}
+
+// TaskRepository handles database operations for tasks. Every query runs in
+// a tenant transaction so that row level security backs up the organization,
+// membership and visibility conditions. Membership and teams are read from
+// the shared database first: the tasks of an isolated organization may live
+// in a database of their own.
 type TaskRepository struct {
 	DB *db.DB
 }
@@ -30,50 +115,150 @@ func NewTaskRepository(database *db.DB) *TaskRepository {
 	return &TaskRepository{DB: database}
 }
 
-// Create adds a new task to the database
-func (r *TaskRepository) Create(task *Task) error {
+// access returns what a user may see in an organization, nil when they are
+// not a member
+func (r *TaskRepository) access(userID, organizationID int) (*taskAccess, error) {
 	query := `
-		INSERT INTO tasks (title, description, status, due_date, user_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
-		RETURNING id, created_at, updated_at
+		SELECT m.role, ARRAY(
+			SELECT tm.team_id FROM team_memberships tm
+			WHERE tm.organization_id = m.organization_id AND tm.user_id = m.user_id
+		)
+		FROM organization_memberships m
+		WHERE m.organization_id = $1 AND m.user_id = $2
 	`
 
-	err := r.DB.QueryRow(
-		query,
-		task.Title,
-		task.Description,
-		task.Status,
-		task.DueDate,
-		task.UserID,
-	).Scan(&task.ID, &task.CreatedAt, &task.UpdatedAt)
+	var role string
+	access := &taskAccess{}
+	err := r.DB.QueryRow(query, organizationID, userID).Scan(&role, pq.Array(&access.teamIDs))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	access.admin = RoleAtLeast(role, RoleAdmin)
+	return access, nil
 }
 
-// GetByID retrieves a task by ID and user ID
-func (r *TaskRepository) GetByID(id, userID int) (*Task, error) {
+// lockTask locks a task the user can see, in the trash or not, until the
+// end of tx and returns it as it is before the change. It returns
+// sql.ErrNoRows when there is no such task, and ErrTaskVersionConflict when
+// its version is not version, unless version is 0.
+func (r *TaskRepository) lockTask(tx *sql.Tx, id, organizationID, version, userID int, access *taskAccess, trashed bool) (*Task, error) {
+	deleted := "tasks.deleted_at IS NULL"
+	if trashed {
+		deleted = "tasks.deleted_at IS NOT NULL"
+	}
+
+	query := `
+		SELECT ` + taskColumns + ` FROM tasks
+		WHERE tasks.id = $1 AND tasks.organization_id = $2 AND ` + deleted + `
+			AND ` + fmt.Sprintf(visibleCondition, "$3", "$4", "$5") + `
+		FOR UPDATE
+	`
+
 	task := &Task{}
+	if err := scanTask(tx.QueryRow(query, id, organizationID, userID, access.admin, pq.Array(access.teamIDs)), task); err != nil {
+		return nil, err
+	}
+	if version != 0 && version != task.Version {
+		return nil, ErrTaskVersionConflict
+	}
+
+	return task, nil
+}
+
+// workflow returns the status workflow of an organization
+func (r *TaskRepository) workflow(organizationID int) (*workflow.Workflow, error) {
+	taskWorkflow, err := NewTaskWorkflowRepository(r.DB).Get(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	return taskWorkflow.Workflow, nil
+}
+
+// Create adds a new task to the database, visible to the whole organization
+// unless another visibility is set, and starts its history. The status must
+// be defined by the workflow of the organization, its initial status when
+// empty; a *workflow.Error is returned otherwise. An *EntitlementError is
+// returned when the plan of the organization has no room for the task.
+func (r *TaskRepository) Create(task *Task) error {
+	if task.Visibility == "" {
+		task.Visibility = VisibilityOrganization
+	}
+
+	w, err := r.workflow(task.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if task.Status, err = w.Create(task.Status); err != nil {
+		return err
+	}
+	task.CompletedAt = w.CompletedAt("", task.Status, nil, time.Now())
 
 	query := `
-		SELECT id, title, description, status, due_date, user_id, created_at, updated_at
-		FROM tasks
-		WHERE id = $1 AND user_id = $2
+		INSERT INTO tasks (title, description, status, due_date, user_id, organization_id, visibility, team_id, completed_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
+		RETURNING id, version, created_at, updated_at
 	`
 
-	err := r.DB.QueryRow(query, id, userID).Scan(
-		&task.ID,
-		&task.Title,
-		&task.Description,
-		&task.Status,
-		&task.DueDate,
-		&task.UserID,
-		&task.CreatedAt,
-		&task.UpdatedAt,
-	)
+	quota, err := NewPlanRepository(r.DB).LockTaskQuota(task.OrganizationID)
+	if err != nil {
+		return err
+	}
+	defer quota.Release()
+
+	if err := quota.Check(1, task.contentSize()); err != nil {
+		return err
+	}
+
+	return r.DB.WithTenant(task.UserID, task.OrganizationID, func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			query,
+			task.Title,
+			task.Description,
+			task.Status,
+			task.DueDate,
+			task.UserID,
+			task.OrganizationID,
+			task.Visibility,
+			task.TeamID,
+			task.CompletedAt,
+		).Scan(&task.ID, &task.Version, &task.CreatedAt, &task.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return recordHistory(tx, TaskActionCreate, task.UserID, nil, task, nil)
+	})
+}
+
+// GetByID retrieves a task by ID within an organization the user belongs to,
+// if its visibility lets them see it
+func (r *TaskRepository) GetByID(id, userID, organizationID int) (*Task, error) {
+	access, err := r.access(userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if access == nil {
+		return nil, ErrTaskNotFound
+	}
+
+	task := &Task{}
+
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE tasks.id = $1 AND tasks.organization_id = $2 AND tasks.deleted_at IS NULL
+			AND ` + fmt.Sprintf(visibleCondition, "$3", "$4", "$5")
 
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		return scanTask(tx.QueryRow(query, id, organizationID, userID, access.admin, pq.Array(access.teamIDs)), task)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("task not found")
+			return nil, ErrTaskNotFound
 		}
 		return nil, err
 	}
@@ -81,100 +266,580 @@ func (r *TaskRepository) GetByID(id, userID int) (*Task, error) {
 	return task, nil
 }
 
-// GetAllByUserID retrieves all tasks for a specific user
-func (r *TaskRepository) GetAllByUserID(userID int) ([]*Task, error) {
+// GetAllByUserID retrieves the tasks of an organization the user belongs to
+// that their visibility lets them see
+func (r *TaskRepository) GetAllByUserID(userID, organizationID int) ([]*Task, error) {
+	tasks := []*Task{}
+
+	access, err := r.access(userID, organizationID)
+	if err != nil || access == nil {
+		return tasks, err
+	}
+
 	query := `
-		SELECT id, title, description, status, due_date, user_id, created_at, updated_at
+		SELECT ` + taskColumns + `
 		FROM tasks
-		WHERE user_id = $1
-		ORDER BY created_at DESC
+		WHERE tasks.organization_id = $1 AND tasks.deleted_at IS NULL
+			AND ` + fmt.Sprintf(visibleCondition, "$2", "$3", "$4") + `
+		ORDER BY tasks.created_at DESC
 	`
 
-	rows, err := r.DB.Query(query, userID)
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, organizationID, userID, access.admin, pq.Array(access.teamIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			task := &Task{}
+			if err := scanTask(rows, task); err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+		}
+
+		return rows.Err()
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	tasks := []*Task{}
+	return tasks, nil
+}
 
-	for rows.Next() {
-		task := &Task{}
-		err := rows.Scan(
-			&task.ID,
-			&task.Title,
-			&task.Description,
-			&task.Status,
-			&task.DueDate,
-			&task.UserID,
-			&task.CreatedAt,
-			&task.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
+// TaskPage is a page of the task list
+type TaskPage struct {
+	Tasks []*Task
+	// NextCursor is the cursor of the next page, empty on the last one
+	NextCursor string
+	// Total is the number of tasks matching the filters, across pages, when
+	// requested
+	Total *int
+}
+
+// List retrieves a page of the tasks of an organization the user belongs to
+// that their visibility lets them see, filtered and sorted in the database
+func (r *TaskRepository) List(userID, organizationID int, q *tasklist.Query) (*TaskPage, error) {
+	page := &TaskPage{Tasks: []*Task{}}
+
+	access, err := r.access(userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if access == nil {
+		if q.IncludeTotal {
+			page.Total = new(int)
 		}
-		tasks = append(tasks, task)
+		return page, nil
 	}
 
-	if err = rows.Err(); err != nil {
+	args := []interface{}{organizationID, userID, access.admin, pq.Array(access.teamIDs)}
+	where := `tasks.organization_id = $1 AND tasks.deleted_at IS NULL AND ` + fmt.Sprintf(visibleCondition, "$2", "$3", "$4")
+	filters, filterArgs := q.Filters(len(args) + 1)
+	where += filters
+	args = append(args, filterArgs...)
+
+	after, afterArgs := q.After(len(args) + 1)
+	listArgs := append(append([]interface{}{}, args...), afterArgs...)
+
+	// One more task than the page tells whether there is a next page
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE ` + where + after + `
+		ORDER BY ` + q.OrderBy() + `
+		LIMIT ` + strconv.Itoa(q.Limit+1)
+
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, listArgs...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			task := &Task{}
+			if err := scanTask(rows, task); err != nil {
+				return err
+			}
+			page.Tasks = append(page.Tasks, task)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if !q.IncludeTotal {
+			return nil
+		}
+		page.Total = new(int)
+		return tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE `+where, args...).Scan(page.Total)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return tasks, nil
+	if len(page.Tasks) > q.Limit {
+		page.Tasks = page.Tasks[:q.Limit]
+		last := page.Tasks[q.Limit-1]
+		page.NextCursor = q.NextCursor(last.ID, last.sortValue)
+	}
+
+	return page, nil
+}
+
+// sortValue returns the value of a sort field of the task list
+func (t *Task) sortValue(field string) interface{} {
+	switch field {
+	case "created_at":
+		return t.CreatedAt
+	case "updated_at":
+		return t.UpdatedAt
+	case "due_date":
+		return t.DueDate
+	case "title":
+		return t.Title
+	case "status":
+		return t.Status
+	default:
+		return nil
+	}
 }
 
-// Update updates a task
-func (r *TaskRepository) Update(task *Task) error {
+// TaskSearchResult is a task matching a search, with its matches
+// highlighted in <mark> elements in its title and in a snippet of its
+// description
+type TaskSearchResult struct {
+	Task    *Task   `json:"task"`
+	Rank    float64 `json:"rank"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+}
+
+// Search retrieves the tasks of an organization the user belongs to that
+// match a full-text search and their visibility lets them see, best matches
+// first
+func (r *TaskRepository) Search(userID, organizationID int, s *tasklist.Search) ([]*TaskSearchResult, error) {
+	results := []*TaskSearchResult{}
+
+	access, err := r.access(userID, organizationID)
+	if err != nil || access == nil {
+		return results, err
+	}
+
 	query := `
-		UPDATE tasks
-		SET title = $1, description = $2, status = $3, due_date = $4, updated_at = NOW()
-		WHERE id = $5 AND user_id = $6
-		RETURNING updated_at
+		SELECT ` + taskColumns + `,
+			ts_rank_cd(tasks.search_vector, q.query) AS rank,
+			ts_headline($5::regconfig, tasks.title, q.query, $6),
+			ts_headline($5::regconfig, COALESCE(tasks.description, ''), q.query, $7)
+		FROM tasks, to_tsquery($5::regconfig, $8) AS q(query)
+		WHERE tasks.organization_id = $1 AND tasks.deleted_at IS NULL
+			AND ` + fmt.Sprintf(visibleCondition, "$2", "$3", "$4") + `
+			AND tasks.search_vector @@ q.query
+		ORDER BY rank DESC, tasks.updated_at DESC, tasks.id DESC
+		LIMIT $9 OFFSET $10
 	`
 
-	result, err := r.DB.Exec(
-		query,
-		task.Title,
-		task.Description,
-		task.Status,
-		task.DueDate,
-		task.ID,
-		task.UserID,
-	)
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			query, organizationID, userID, access.admin, pq.Array(access.teamIDs),
+			tasklist.SearchConfig, tasklist.TitleOptions, tasklist.HeadlineOptions, s.TSQuery, s.Limit, s.Offset,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			result := &TaskSearchResult{Task: &Task{}}
+			if err := scanTask(rows, result.Task, &result.Rank, &result.Title, &result.Snippet); err != nil {
+				return err
+			}
+			result.Title = tasklist.Highlight(result.Title)
+			result.Snippet = tasklist.Highlight(result.Snippet)
+			results = append(results, result)
+		}
 
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// TaskEditableFields are the fields of a task members can edit directly,
+// as named in JSON. Visibility and team are changed with Move.
+var TaskEditableFields = []string{"title", "description", "status", "due_date"}
+
+// Update updates the editable fields of a task on behalf of a member of its
+// organization who can see it, see UpdateFields
+func (r *TaskRepository) Update(task *Task, userID int) error {
+	return r.UpdateFields(task, userID, TaskEditableFields)
+}
+
+// UpdateFields updates the given editable fields of a task, and only them,
+// on behalf of a member of its organization who can see it, and records the
+// change in its history. The update is based on task.Version,
+// ErrTaskVersionConflict is returned when the task changed since, unless it
+// is 0. A status change must be allowed by the workflow of the
+// organization, a *workflow.Error is returned otherwise, and runs its hooks.
+// Content growing past the storage quota returns an *EntitlementError.
+func (r *TaskRepository) UpdateFields(task *Task, userID int, fields []string) error {
+	access, err := r.access(userID, task.OrganizationID)
 	if err != nil {
 		return err
 	}
+	if access == nil {
+		return errors.New("task not found or not accessible to user")
+	}
 
-	rowsAffected, err := result.RowsAffected()
+	w, err := r.workflow(task.OrganizationID)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return errors.New("task not found or not owned by user")
+	quota, err := NewPlanRepository(r.DB).LockTaskQuota(task.OrganizationID)
+	if err != nil {
+		return err
+	}
+	defer quota.Release()
+
+	err = r.DB.WithTenant(userID, task.OrganizationID, func(tx *sql.Tx) error {
+		// The current status is locked until the update so that concurrent
+		// changes cannot skip a transition
+		before, err := r.lockTask(tx, task.ID, task.OrganizationID, task.Version, userID, access, false)
+		if err != nil {
+			return err
+		}
+
+		return updateFields(tx, w, quota, before, task, userID, fields, TaskActionUpdate, nil)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("task not found or not accessible to user")
+		}
+		return err
 	}
 
 	return nil
 }
 
-// Delete removes a task
-func (r *TaskRepository) Delete(id, userID int) error {
-	query := `DELETE FROM tasks WHERE id = $1 AND user_id = $2`
+// updateFields saves the given editable fields of task, locked as before in
+// tx, checks the storage quota and records the change in its history as
+// action
+func updateFields(tx *sql.Tx, w *workflow.Workflow, quota *TaskQuota, before, task *Task, userID int, fields []string, action string, revertedTo *int) error {
+	set := []string{}
+	args := []interface{}{}
+	column := func(name string, value interface{}) {
+		args = append(args, value)
+		set = append(set, fmt.Sprintf("%s = $%d", name, len(args)))
+	}
+
+	for _, field := range fields {
+		switch field {
+		case "title":
+			column("title", task.Title)
+		case "description":
+			column("description", task.Description)
+		case "due_date":
+			column("due_date", task.DueDate)
+		case "status":
+			if err := w.Transition(before.Status, task.Status); err != nil {
+				return err
+			}
+			task.CompletedAt = w.CompletedAt(before.Status, task.Status, before.CompletedAt, time.Now())
+			column("status", task.Status)
+			column("completed_at", task.CompletedAt)
+		default:
+			return fmt.Errorf("task field %q cannot be updated", field)
+		}
+	}
+
+	args = append(args, task.ID, task.OrganizationID)
+	query := `
+		UPDATE tasks
+		SET ` + strings.Join(append(set, "version = version + 1", "updated_at = NOW()"), ", ") + fmt.Sprintf(`
+		WHERE id = $%d AND organization_id = $%d
+		RETURNING `, len(args)-1, len(args)) + taskColumns
+
+	if err := scanTask(tx.QueryRow(query, args...), task); err != nil {
+		return err
+	}
+
+	// Only content growth is checked, an organization over its quota can
+	// still shorten its tasks
+	if err := quota.Check(0, task.contentSize()-before.contentSize()); err != nil {
+		return err
+	}
 
-	result, err := r.DB.Exec(query, id, userID)
+	return recordHistory(tx, action, userID, before, task, revertedTo)
+}
+
+// Move changes the visibility and team of a task on behalf of a member who
+// can see it, based on task.Version like UpdateFields. Callers check the
+// member may place the task in its new team.
+func (r *TaskRepository) Move(task *Task, userID int) error {
+	access, err := r.access(userID, task.OrganizationID)
 	if err != nil {
 		return err
 	}
+	if access == nil {
+		return errors.New("task not found or not accessible to user")
+	}
+
+	query := `
+		UPDATE tasks
+		SET visibility = $1, team_id = $2, version = version + 1, updated_at = NOW()
+		WHERE id = $3 AND organization_id = $4
+		RETURNING ` + taskColumns
+
+	err = r.DB.WithTenant(userID, task.OrganizationID, func(tx *sql.Tx) error {
+		before, err := r.lockTask(tx, task.ID, task.OrganizationID, task.Version, userID, access, false)
+		if err != nil {
+			return err
+		}
+		if err := scanTask(tx.QueryRow(query, task.Visibility, task.TeamID, task.ID, task.OrganizationID), task); err != nil {
+			return err
+		}
+		return recordHistory(tx, TaskActionMove, userID, before, task, nil)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("task not found or not accessible to user")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete moves a task to the trash on behalf of a member of its organization
+// who can see it, recorded in its history. ErrTaskVersionConflict is
+// returned when the task is no longer at version, unless it is 0.
+func (r *TaskRepository) Delete(id, userID, organizationID, version int) error {
+	access, err := r.access(userID, organizationID)
+	if err != nil {
+		return err
+	}
+	if access == nil {
+		return errors.New("task not found or not accessible to user")
+	}
+
+	query := `
+		UPDATE tasks
+		SET deleted_at = NOW(), deleted_by = $1, version = version + 1, updated_at = NOW()
+		WHERE id = $2 AND organization_id = $3
+		RETURNING ` + taskColumns
+
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		before, err := r.lockTask(tx, id, organizationID, version, userID, access, false)
+		if err != nil {
+			return err
+		}
+
+		task := &Task{}
+		if err := scanTask(tx.QueryRow(query, userID, id, organizationID), task); err != nil {
+			return err
+		}
+		return recordHistory(tx, TaskActionDelete, userID, before, task, nil)
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("task not found or not accessible to user")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetTrash retrieves the tasks in the trash of an organization the user
+// belongs to that their visibility lets them see, last deleted first
+func (r *TaskRepository) GetTrash(userID, organizationID int) ([]*Task, error) {
+	tasks := []*Task{}
+
+	access, err := r.access(userID, organizationID)
+	if err != nil || access == nil {
+		return tasks, err
+	}
+
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE tasks.organization_id = $1 AND tasks.deleted_at IS NOT NULL
+			AND ` + fmt.Sprintf(visibleCondition, "$2", "$3", "$4") + `
+		ORDER BY tasks.deleted_at DESC, tasks.id DESC
+	`
+
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, organizationID, userID, access.admin, pq.Array(access.teamIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			task := &Task{}
+			if err := scanTask(rows, task); err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// Restore takes a task out of the trash on behalf of a member of its
+// organization who can see it. An *EntitlementError is returned when the
+// plan of the organization has no room for the task.
+func (r *TaskRepository) Restore(id, userID, organizationID int) (*Task, error) {
+	access, err := r.access(userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if access == nil {
+		return nil, ErrTaskNotInTrash
+	}
+
+	query := `
+		UPDATE tasks
+		SET deleted_at = NULL, deleted_by = NULL, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND organization_id = $2
+		RETURNING ` + taskColumns
 
-	rowsAffected, err := result.RowsAffected()
+	quota, err := NewPlanRepository(r.DB).LockTaskQuota(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer quota.Release()
+
+	// Tasks in the trash already count toward the storage
+	if err := quota.Check(1, 0); err != nil {
+		return nil, err
+	}
+
+	task := &Task{}
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		before, err := r.lockTask(tx, id, organizationID, 0, userID, access, true)
+		if err != nil {
+			return err
+		}
+		if err := scanTask(tx.QueryRow(query, id, organizationID), task); err != nil {
+			return err
+		}
+		return recordHistory(tx, TaskActionRestore, userID, before, task, nil)
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTaskNotInTrash
+		}
+		return nil, err
+	}
+
+	return task, nil
+}
+
+// DeletePermanently removes a task of the trash on behalf of a member of
+// its organization who can see it. Its history is kept, with a last purge
+// version recording who removed it.
+func (r *TaskRepository) DeletePermanently(id, userID, organizationID int) error {
+	access, err := r.access(userID, organizationID)
 	if err != nil {
 		return err
 	}
+	if access == nil {
+		return ErrTaskNotInTrash
+	}
+
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		before, err := r.lockTask(tx, id, organizationID, 0, userID, access, true)
+		if err != nil {
+			return err
+		}
+
+		// Recorded first, the history policy checks the task exists
+		if err := recordHistory(tx, TaskActionPurge, userID, before, nil, nil); err != nil {
+			return err
+		}
 
-	if rowsAffected == 0 {
-		return errors.New("task not found or not owned by user")
+		_, err = tx.Exec(`DELETE FROM tasks WHERE id = $1 AND organization_id = $2`, id, organizationID)
+		return err
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTaskNotInTrash
+		}
+		return err
 	}
 
 	return nil
 }
+
+// purgeTrash deletes the tasks of the trash deleted before $1 and records a
+// last purge version, without actor, in their history. The fields are
+// encoded like the snapshots of migration 000025.
+const purgeTrash = `
+	WITH purged AS (
+		DELETE FROM tasks WHERE deleted_at < $1
+		RETURNING id, version, title, description, status, due_date, completed_at,
+			visibility, team_id, user_id, deleted_at
+	)
+	INSERT INTO task_history (task_id, version, action, changes, created_at)
+	SELECT p.id, p.version + 1, '` + TaskActionPurge + `', (
+		SELECT COALESCE(jsonb_object_agg(f.key, jsonb_build_object('old', f.value, 'new', NULL)), '{}'::jsonb)
+		FROM jsonb_each(jsonb_build_object(
+			'title', p.title, 'description', p.description, 'status', p.status,
+			'due_date', p.due_date, 'completed_at', p.completed_at, 'visibility', p.visibility,
+			'team_id', p.team_id, 'user_id', p.user_id, 'deleted_at', p.deleted_at
+		)) AS f
+		WHERE f.value <> 'null'::jsonb
+	), NOW()
+	FROM purged p
+`
+
+// PurgeTrash permanently removes the tasks deleted before a time, in the
+// shared database and in every isolated tenant, and returns how many. Their
+// history is kept, see purgeTrash.
+func (r *TaskRepository) PurgeTrash(before time.Time) (int, error) {
+	query := purgeTrash
+
+	result, err := r.DB.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+	purged := rowsAffected(result)
+
+	if !r.DB.Isolated() {
+		return purged, nil
+	}
+
+	tenants, err := r.DB.GetTenants()
+	if err != nil {
+		return purged, err
+	}
+
+	for _, tenant := range tenants {
+		conn, err := r.DB.ForTenant(tenant)
+		if err != nil {
+			return purged, err
+		}
+
+		result, err := conn.Exec(query, before)
+		if err != nil {
+			return purged, err
+		}
+		purged += rowsAffected(result)
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,278 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/taskhistory"
+	"github.com/lib/pq"
+)
+
+// Task history actions
+const (
+	TaskActionCreate  = "create"
+	TaskActionUpdate  = "update"
+	TaskActionMove    = "move"
+	TaskActionDelete  = "delete"
+	TaskActionRestore = "restore"
+	TaskActionRevert  = "revert"
+	// TaskActionTransfer is an ownership transfer, see
+	// OwnershipTransferRepository.Transfer
+	TaskActionTransfer = "transfer"
+	// TaskActionSnapshot is the state of a task created before the history
+	// was recorded
+	TaskActionSnapshot = "snapshot"
+	// TaskActionPurge is the permanent deletion of a task, the last version
+	// of its history which outlives it
+	TaskActionPurge = "purge"
+)
+
+// ErrTaskNotFound is returned when a task does not exist or the user cannot
+// see it
+var ErrTaskNotFound = errors.New("task not found")
+
+// ErrTaskRevisionNotFound is returned when reverting a task to a version its
+// history does not record
+var ErrTaskRevisionNotFound = errors.New("revision not found in the task history")
+
+// TaskHistoryEntry is a version of a task in its history: who made it, when,
+// and the fields it changed with their old and new values
+type TaskHistoryEntry struct {
+	ID      int                 `json:"id"`
+	TaskID  int                 `json:"task_id"`
+	Version int                 `json:"version"`
+	Action  string              `json:"action"`
+	ActorID *int                `json:"actor_id"`
+	Changes taskhistory.Changes `json:"changes"`
+	// RevertedTo is the version a revert went back to
+	RevertedTo *int      `json:"reverted_to,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// historyFields returns the fields of a task tracked by its history
+func (t *Task) historyFields() taskhistory.Fields {
+	return taskhistory.Fields{
+		"title":        t.Title,
+		"description":  t.Description,
+		"status":       t.Status,
+		"due_date":     utcTime(t.DueDate),
+		"completed_at": utcTime(t.CompletedAt),
+		"visibility":   t.Visibility,
+		"team_id":      t.TeamID,
+		"user_id":      t.UserID,
+		"deleted_at":   utcTime(t.DeletedAt),
+	}
+}
+
+// utcTime returns an optional time in UTC, so that the history does not
+// depend on the time zone of the connection
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// recordHistory appends the change of a task from before, nil for a new
+// task, to after, nil for a task deleted permanently, in its history, in the
+// transaction of the change
+func recordHistory(tx *sql.Tx, action string, actorID int, before, after *Task, revertedTo *int) error {
+	var old, current taskhistory.Fields
+	if before != nil {
+		old = before.historyFields()
+	}
+
+	var id, version int
+	if after != nil {
+		current = after.historyFields()
+		id, version = after.ID, after.Version
+	} else {
+		id, version = before.ID, before.Version+1
+	}
+
+	changes, err := taskhistory.Diff(old, current)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO task_history (task_id, version, action, actor_id, changes, reverted_to, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	`, id, version, action, actorID, data, revertedTo)
+	return err
+}
+
+// GetHistory retrieves the history of a task, in the trash or not, that a
+// member of its organization can see, latest version first.
+// ErrTaskNotFound is returned when there is no such task.
+func (r *TaskRepository) GetHistory(id, userID, organizationID int) ([]*TaskHistoryEntry, error) {
+	access, err := r.access(userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if access == nil {
+		return nil, ErrTaskNotFound
+	}
+
+	visible := `
+		SELECT 1 FROM tasks
+		WHERE tasks.id = $1 AND tasks.organization_id = $2
+			AND ` + fmt.Sprintf(visibleCondition, "$3", "$4", "$5")
+
+	query := `
+		SELECT id, task_id, version, action, actor_id, changes, reverted_to, created_at
+		FROM task_history
+		WHERE task_id = $1
+		ORDER BY version DESC
+	`
+
+	entries := []*TaskHistoryEntry{}
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		var found int
+		if err := tx.QueryRow(visible, id, organizationID, userID, access.admin, pq.Array(access.teamIDs)).Scan(&found); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(query, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			entry := &TaskHistoryEntry{}
+			var actorID, revertedTo sql.NullInt64
+			var changes []byte
+			if err := rows.Scan(&entry.ID, &entry.TaskID, &entry.Version, &entry.Action, &actorID, &changes, &revertedTo, &entry.CreatedAt); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+				return err
+			}
+			entry.ActorID = nullableInt(actorID)
+			entry.RevertedTo = nullableInt(revertedTo)
+			entries = append(entries, entry)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Revert restores the editable fields of a task to their value at a
+// previous version, on behalf of a member of its organization who can see
+// it. The revert is a new version, based on version like UpdateFields: its
+// status change must be allowed by the workflow and its content fit the
+// storage quota. Visibility and team are left as they are.
+// ErrTaskRevisionNotFound is returned when the history does not record to.
+func (r *TaskRepository) Revert(id, userID, organizationID, version, to int) (*Task, error) {
+	access, err := r.access(userID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if access == nil {
+		return nil, ErrTaskNotFound
+	}
+
+	w, err := r.workflow(organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, err := NewPlanRepository(r.DB).LockTaskQuota(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer quota.Release()
+
+	task := &Task{}
+	err = r.DB.WithTenant(userID, organizationID, func(tx *sql.Tx) error {
+		before, err := r.lockTask(tx, id, organizationID, version, userID, access, false)
+		if err != nil {
+			return err
+		}
+		*task = *before
+
+		revisions, err := taskRevisions(tx, id, to)
+		if err != nil {
+			return err
+		}
+		state, err := taskhistory.State(revisions, to)
+		if err != nil {
+			return ErrTaskRevisionNotFound
+		}
+
+		changed, err := task.applyRevision(state)
+		if err != nil || len(changed) == 0 {
+			return err
+		}
+
+		return updateFields(tx, w, quota, before, task, userID, changed, TaskActionRevert, &to)
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTaskNotFound
+		}
+		return nil, err
+	}
+
+	return task, nil
+}
+
+// taskRevisions reads the history of a task up to a version
+func taskRevisions(tx *sql.Tx, id, version int) ([]taskhistory.Revision, error) {
+	rows, err := tx.Query(`SELECT version, changes FROM task_history WHERE task_id = $1 AND version <= $2 ORDER BY version`, id, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []taskhistory.Revision{}
+	for rows.Next() {
+		var revision taskhistory.Revision
+		var changes []byte
+		if err := rows.Scan(&revision.Version, &changes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changes, &revision.Changes); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// applyRevision sets the editable fields of a task to their value in a
+// state rebuilt from its history, and returns those that changed
+func (t *Task) applyRevision(state map[string]json.RawMessage) ([]string, error) {
+	patch := map[string]json.RawMessage{}
+	for _, field := range TaskEditableFields {
+		value, ok := state[field]
+		if !ok {
+			value = json.RawMessage("null")
+		}
+		patch[field] = value
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	return t.ApplyMergePatch(data)
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TaskPatchError is a patch that cannot be applied to a task
+type TaskPatchError struct {
+	Field   string
+	Message string
+}
+
+func (e *TaskPatchError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// taskReadOnlyFields are the fields of a task a patch cannot change
+var taskReadOnlyFields = map[string]string{
+	"id":              "is read-only",
+	"user_id":         "is read-only",
+	"organization_id": "is read-only",
+	"created_at":      "is read-only",
+	"updated_at":      "is read-only",
+	"completed_at":    "is maintained by the workflow",
+	"visibility":      "is changed with POST /api/tasks/:id/move",
+	"team_id":         "is changed with POST /api/tasks/:id/move",
+}
+
+// ApplyMergePatch applies an RFC 7396 JSON merge patch to the editable
+// fields of a task and returns those whose value changed, in the order of
+// TaskEditableFields. Members absent from the patch are left untouched, null
+// clears the description and the due date; title and status cannot be
+// null. The result is validated, except the status which is checked against
+// the workflow when saved.
+func (t *Task) ApplyMergePatch(patch []byte) ([]string, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(patch), []byte("{")) {
+		return nil, &TaskPatchError{Message: "merge patch must be a JSON object"}
+	}
+
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(patch, &members); err != nil {
+		return nil, &TaskPatchError{Message: "invalid JSON: " + err.Error()}
+	}
+
+	editable := map[string]bool{}
+	for _, field := range TaskEditableFields {
+		editable[field] = true
+	}
+	for name := range members {
+		if reason, ok := taskReadOnlyFields[name]; ok {
+			return nil, &TaskPatchError{Field: name, Message: reason}
+		}
+		if !editable[name] {
+			return nil, &TaskPatchError{Field: name, Message: "unknown field"}
+		}
+	}
+
+	changed := []string{}
+	for _, field := range TaskEditableFields {
+		raw, ok := members[field]
+		if !ok {
+			continue
+		}
+		null := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch field {
+		case "title", "status", "description":
+			var value string
+			if !null {
+				if err := json.Unmarshal(raw, &value); err != nil {
+					return nil, &TaskPatchError{Field: field, Message: "must be a string"}
+				}
+			} else if field != "description" {
+				return nil, &TaskPatchError{Field: field, Message: "cannot be null"}
+			}
+
+			target := map[string]*string{"title": &t.Title, "status": &t.Status, "description": &t.Description}[field]
+			if *target != value {
+				*target = value
+				changed = append(changed, field)
+			}
+		case "due_date":
+			var value *time.Time
+			if !null {
+				value = &time.Time{}
+				if err := json.Unmarshal(raw, value); err != nil {
+					return nil, &TaskPatchError{Field: field, Message: "must be an RFC 3339 timestamp or null"}
+				}
+			}
+
+			if !sameTime(t.DueDate, value) {
+				t.DueDate = value
+				changed = append(changed, field)
+			}
+		}
+	}
+
+	if strings.TrimSpace(t.Title) == "" {
+		return nil, &TaskPatchError{Field: "title", Message: "is required"}
+	}
+	if utf8.RuneCountInString(t.Title) > 255 {
+		return nil, &TaskPatchError{Field: "title", Message: "must be at most 255 characters"}
+	}
+
+	return changed, nil
+}
+
+// sameTime reports whether two optional times are the same instant
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
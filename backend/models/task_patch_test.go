@@ -0,0 +1,87 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	due := time.Date(2026, time.June, 1, 10, 0, 0, 0, time.UTC)
+	later := time.Date(2026, time.July, 1, 10, 0, 0, 0, time.UTC)
+
+	task := func() *Task {
+		due := due
+		return &Task{Title: "Draft", Description: "First", Status: "pending", DueDate: &due}
+	}
+
+	tests := []struct {
+		name    string
+		patch   string
+		changed []string
+		want    *Task
+	}{
+		{"empty patch", `{}`, []string{}, task()},
+		{"absent members", `{"title": "Draft"}`, []string{}, task()},
+		{"description null", `{"description": null}`, []string{"description"},
+			&Task{Title: "Draft", Status: "pending", DueDate: &due}},
+		{"due_date null", `{"due_date": null}`, []string{"due_date"},
+			&Task{Title: "Draft", Description: "First", Status: "pending"}},
+		{"same due date in another zone", `{"due_date": "2026-06-01T12:00:00+02:00"}`, []string{}, task()},
+		{"every field", `{"due_date": "2026-07-01T10:00:00Z", "status": "completed", "description": "Second", "title": "Final"}`,
+			[]string{"title", "description", "status", "due_date"},
+			&Task{Title: "Final", Description: "Second", Status: "completed", DueDate: &later}},
+	}
+
+	for _, tt := range tests {
+		got := task()
+		changed, err := got.ApplyMergePatch([]byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s: ApplyMergePatch returned error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(changed, tt.changed) {
+			t.Errorf("%s: changed %v, want %v", tt.name, changed, tt.changed)
+		}
+		if got.Title != tt.want.Title || got.Description != tt.want.Description || got.Status != tt.want.Status || !sameTime(got.DueDate, tt.want.DueDate) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyMergePatchRejectsInvalidPatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		field string
+	}{
+		{"array", `[{"title": "Final"}]`, ""},
+		{"string", `"Final"`, ""},
+		{"null", `null`, ""},
+		{"invalid JSON", `{"title": }`, ""},
+		{"title null", `{"title": null}`, "title"},
+		{"status null", `{"status": null}`, "status"},
+		{"empty title", `{"title": "  "}`, "title"},
+		{"title not a string", `{"title": 42}`, "title"},
+		{"invalid due date", `{"due_date": "tomorrow"}`, "due_date"},
+		{"read-only member", `{"id": 7}`, "id"},
+		{"workflow member", `{"completed_at": null}`, "completed_at"},
+		{"moved member", `{"team_id": 3}`, "team_id"},
+		{"unknown member", `{"priority": "high"}`, "priority"},
+	}
+
+	for _, tt := range tests {
+		task := &Task{Title: "Draft", Status: "pending"}
+		_, err := task.ApplyMergePatch([]byte(tt.patch))
+
+		var patchErr *TaskPatchError
+		if !errors.As(err, &patchErr) {
+			t.Errorf("%s: expected a *TaskPatchError, got %v", tt.name, err)
+			continue
+		}
+		if patchErr.Field != tt.field {
+			t.Errorf("%s: error on field %q, want %q", tt.name, patchErr.Field, tt.field)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/workflow"
+)
+
+// TaskWorkflow is the status workflow of an organization. Default is true,
+// and UpdatedAt nil, for organizations that did not define theirs.
+type TaskWorkflow struct {
+	OrganizationID int                `json:"organization_id"`
+	Workflow       *workflow.Workflow `json:"workflow"`
+	Default        bool               `json:"default"`
+	UpdatedBy      *int               `json:"updated_by,omitempty"`
+	UpdatedAt      *time.Time         `json:"updated_at,omitempty"`
+}
+
+// TaskWorkflowRepository handles database operations for task workflows.
+// Workflows live in the shared database, whatever the tenancy of their
+// organization.
+type TaskWorkflowRepository struct {
+	DB *db.DB
+}
+
+// NewTaskWorkflowRepository creates a new task workflow repository
+func NewTaskWorkflowRepository(database *db.DB) *TaskWorkflowRepository {
+	return &TaskWorkflowRepository{DB: database}
+}
+
+// Get retrieves the workflow of an organization, the default one when it
+// did not define one
+func (r *TaskWorkflowRepository) Get(organizationID int) (*TaskWorkflow, error) {
+	query := `SELECT definition, updated_by, updated_at FROM task_workflows WHERE organization_id = $1`
+
+	var definition []byte
+	var updatedBy sql.NullInt64
+	var updatedAt time.Time
+	err := r.DB.QueryRow(query, organizationID).Scan(&definition, &updatedBy, &updatedAt)
+	if err == sql.ErrNoRows {
+		return &TaskWorkflow{OrganizationID: organizationID, Workflow: workflow.Default(), Default: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w := &workflow.Workflow{}
+	if err := json.Unmarshal(definition, w); err != nil {
+		return nil, err
+	}
+
+	return &TaskWorkflow{
+		OrganizationID: organizationID,
+		Workflow:       w,
+		UpdatedBy:      nullableInt(updatedBy),
+		UpdatedAt:      &updatedAt,
+	}, nil
+}
+
+// Save replaces the workflow of an organization. Callers validate it first.
+// Tasks keep their status even when it is no longer defined, they can then
+// move to any status.
+func (r *TaskWorkflowRepository) Save(organizationID int, w *workflow.Workflow, userID int) (*TaskWorkflow, error) {
+	definition, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO task_workflows (organization_id, definition, updated_by, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (organization_id) DO UPDATE
+		SET definition = EXCLUDED.definition, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`
+
+	saved := &TaskWorkflow{OrganizationID: organizationID, Workflow: w, UpdatedBy: &userID}
+	var updatedAt time.Time
+	if err := r.DB.QueryRow(query, organizationID, definition, userID).Scan(&updatedAt); err != nil {
+		return nil, err
+	}
+	saved.UpdatedAt = &updatedAt
+
+	return saved, nil
+}
+
+// Reset restores the default workflow of an organization
+func (r *TaskWorkflowRepository) Reset(organizationID int) error {
+	_, err := r.DB.Exec(`DELETE FROM task_workflows WHERE organization_id = $1`, organizationID)
+	return err
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// Team is a group of members of an organization, such as a department
+type Team struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Name           string    `json:"name"`
+	MemberCount    int       `json:"member_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TeamMember is a member of a team
+type TeamMember struct {
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// teamColumns lists the columns read by scanTeam, in order
+const teamColumns = `t.id, t.organization_id, t.name,
+	(SELECT COUNT(*) FROM team_memberships tm WHERE tm.team_id = t.id), t.created_at, t.updated_at`
+
+func scanTeam(row rowScanner, team *Team) error {
+	return row.Scan(&team.ID, &team.OrganizationID, &team.Name, &team.MemberCount, &team.CreatedAt, &team.UpdatedAt)
+}
+
+// TeamRepository handles database operations for teams and their members
+type TeamRepository struct {
+	DB *db.DB
+}
+
+// NewTeamRepository creates a new team repository
+func NewTeamRepository(database *db.DB) *TeamRepository {
+	return &TeamRepository{DB: database}
+}
+
+// Create adds a new team to an organization
+func (r *TeamRepository) Create(team *Team) error {
+	query := `
+		INSERT INTO teams (organization_id, name, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+	return r.DB.QueryRow(query, team.OrganizationID, team.Name).Scan(&team.ID, &team.CreatedAt, &team.UpdatedAt)
+}
+
+// GetByID retrieves a team of an organization
+func (r *TeamRepository) GetByID(id, organizationID int) (*Team, error) {
+	team := &Team{}
+
+	query := `SELECT ` + teamColumns + ` FROM teams t WHERE t.id = $1 AND t.organization_id = $2`
+	if err := scanTeam(r.DB.QueryRow(query, id, organizationID), team); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("team not found")
+		}
+		return nil, err
+	}
+
+	return team, nil
+}
+
+// GetAllForOrganization retrieves the teams of an organization
+func (r *TeamRepository) GetAllForOrganization(organizationID int) ([]*Team, error) {
+	query := `SELECT ` + teamColumns + ` FROM teams t WHERE t.organization_id = $1 ORDER BY t.name`
+
+	rows, err := r.DB.Query(query, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []*Team{}
+	for rows.Next() {
+		team := &Team{}
+		if err := scanTeam(rows, team); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// Update renames a team
+func (r *TeamRepository) Update(team *Team) error {
+	query := `
+		UPDATE teams SET name = $1, updated_at = NOW()
+		WHERE id = $2 AND organization_id = $3
+		RETURNING updated_at
+	`
+
+	err := r.DB.QueryRow(query, team.Name, team.ID, team.OrganizationID).Scan(&team.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("team not found")
+	}
+
+	return err
+}
+
+// Delete removes a team and its memberships. Its team tasks stay visible to
+// their creators and to admins only.
+func (r *TeamRepository) Delete(id, organizationID int) error {
+	result, err := r.DB.Exec(`DELETE FROM teams WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("team not found")
+	}
+
+	return nil
+}
+
+// GetMembers retrieves the members of a team
+func (r *TeamRepository) GetMembers(teamID int) ([]*TeamMember, error) {
+	query := `
+		SELECT tm.user_id, u.email, u.name, tm.created_at
+		FROM team_memberships tm
+		JOIN users u ON u.id = tm.user_id
+		WHERE tm.team_id = $1
+		ORDER BY tm.created_at
+	`
+
+	rows, err := r.DB.Query(query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*TeamMember{}
+	for rows.Next() {
+		member := &TeamMember{}
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Name, &member.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// IsMember reports whether a user belongs to a team
+func (r *TeamRepository) IsMember(teamID, userID int) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM team_memberships WHERE team_id = $1 AND user_id = $2)`
+	err := r.DB.QueryRow(query, teamID, userID).Scan(&exists)
+	return exists, err
+}
+
+// AddMember adds a member of the organization to one of its teams. The
+// database refuses users who are not members of the organization.
+func (r *TeamRepository) AddMember(team *Team, userID int) error {
+	query := `
+		INSERT INTO team_memberships (team_id, organization_id, user_id, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`
+	_, err := r.DB.Exec(query, team.ID, team.OrganizationID, userID)
+	return err
+}
+
+// RemoveMember removes a user from a team
+func (r *TeamRepository) RemoveMember(teamID, userID int) error {
+	result, err := r.DB.Exec(`DELETE FROM team_memberships WHERE team_id = $1 AND user_id = $2`, teamID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("team membership not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"time"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+// Metered metrics
+const (
+	MetricTasksCreated = "tasks_created"
+	MetricAPICalls     = "api_calls"
+	// MetricStorageBytes is the peak size of the task content stored during the period
+	MetricStorageBytes = "storage_bytes"
+)
+
+// Metrics lists every metered metric, in reporting order
+var Metrics = []string{MetricTasksCreated, MetricAPICalls, MetricStorageBytes}
+
+// taskStorageQuery measures the bytes of task content stored by organization $1
+const taskStorageQuery = `
+	SELECT COALESCE(SUM(OCTET_LENGTH(title) + OCTET_LENGTH(COALESCE(description, ''))), 0)
+	FROM tasks WHERE organization_id = $1
+`
+
+// PeriodStart returns the first day of the monthly usage period containing t, in UTC
+func PeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// UsageCounter is the aggregated quantity of a metric for an organization
+// during a monthly period
+type UsageCounter struct {
+	OrganizationID   int       `json:"organization_id"`
+	OrganizationName string    `json:"organization_name,omitempty"`
+	Plan             string    `json:"plan,omitempty"`
+	Metric           string    `json:"metric"`
+	PeriodStart      time.Time `json:"period_start"`
+	Quantity         int64     `json:"quantity"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// UsageCounterRepository records metered usage
+type UsageCounterRepository struct {
+	DB *db.DB
+}
+
+// NewUsageCounterRepository creates a new usage counter repository
+func NewUsageCounterRepository(database *db.DB) *UsageCounterRepository {
+	return &UsageCounterRepository{DB: database}
+}
+
+// Increment adds quantity to a metric of the current period
+func (r *UsageCounterRepository) Increment(organizationID int, metric string, quantity int64) error {
+	return r.IncrementPeriod(organizationID, metric, PeriodStart(time.Now()), quantity)
+}
+
+// IncrementPeriod adds quantity to a metric of the period starting at
+// periodStart, for usage that was buffered before being recorded
+func (r *UsageCounterRepository) IncrementPeriod(organizationID int, metric string, periodStart time.Time, quantity int64) error {
+	query := `
+		INSERT INTO usage_counters (organization_id, metric, period_start, quantity, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (organization_id, metric, period_start) DO UPDATE
+		SET quantity = usage_counters.quantity + EXCLUDED.quantity, updated_at = NOW()
+	`
+	_, err := r.DB.Exec(query, organizationID, metric, periodStart, quantity)
+	return err
+}
+
+// RecordStorage measures the task storage of an organization and keeps the
+// peak of the current period
+func (r *UsageCounterRepository) RecordStorage(organizationID int) error {
+	bytes, err := r.CurrentStorage(organizationID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO usage_counters (organization_id, metric, period_start, quantity, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (organization_id, metric, period_start) DO UPDATE
+		SET quantity = GREATEST(usage_counters.quantity, EXCLUDED.quantity), updated_at = NOW()
+	`
+	_, err = r.DB.Exec(query, organizationID, MetricStorageBytes, PeriodStart(time.Now()), bytes)
+	return err
+}
+
+// CurrentStorage measures the task storage of an organization right now, in
+// its own schema or database when it is isolated
+func (r *UsageCounterRepository) CurrentStorage(organizationID int) (int64, error) {
+	conn, err := r.DB.ForOrganization(organizationID)
+	if err != nil {
+		return 0, err
+	}
+
+	var bytes int64
+	err = conn.QueryRow(taskStorageQuery, organizationID).Scan(&bytes)
+	return bytes, err
+}
+
+// GetForPeriod returns the counters of an organization for the period
+// starting at periodStart, with zero for metrics without usage
+func (r *UsageCounterRepository) GetForPeriod(organizationID int, periodStart time.Time) (map[string]int64, error) {
+	counters := map[string]int64{}
+	for _, metric := range Metrics {
+		counters[metric] = 0
+	}
+
+	query := `SELECT metric, quantity FROM usage_counters WHERE organization_id = $1 AND period_start = $2`
+
+	rows, err := r.DB.Query(query, organizationID, periodStart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var metric string
+		var quantity int64
+		if err := rows.Scan(&metric, &quantity); err != nil {
+			return nil, err
+		}
+		counters[metric] = quantity
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// Export returns the counters of every organization for a period, ordered
+// by organization and metric, for invoicing
+func (r *UsageCounterRepository) Export(periodStart time.Time) ([]*UsageCounter, error) {
+	query := `
+		SELECT u.organization_id, o.name, o.plan_code, u.metric, u.period_start, u.quantity, u.updated_at
+		FROM usage_counters u
+		JOIN organizations o ON o.id = u.organization_id
+		WHERE u.period_start = $1
+		ORDER BY u.organization_id, u.metric
+	`
+
+	rows, err := r.DB.Query(query, periodStart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := []*UsageCounter{}
+	for rows.Next() {
+		counter := &UsageCounter{}
+		if err := rows.Scan(
+			&counter.OrganizationID, &counter.OrganizationName, &counter.Plan, &counter.Metric,
+			&counter.PeriodStart, &counter.Quantity, &counter.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		counters = append(counters, counter)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
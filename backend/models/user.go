@@ -1,23 +1,64 @@
 package models
 
 import (
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// UnusablePassword is stored for accounts that cannot log in with a
+// password, such as users provisioned without one. It is not a bcrypt hash,
+// so no password matches it.
+const UnusablePassword = "!"
+
 // User represents a user in the system
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password,omitempty"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          int             `json:"id"`
+	Email       string          `json:"email"`
+	Password    string          `json:"password,omitempty"`
+	Name        string          `json:"name"`
+	Active      bool            `json:"active"`
+	IsAdmin     bool            `json:"is_admin"`
+	ExternalID  *string         `json:"external_id,omitempty"`
+	ScimTenant  *string         `json:"-"`
+	Timezone    string          `json:"timezone"`
+	Locale      string          `json:"locale"`
+	AvatarURL   *string         `json:"avatar_url,omitempty"`
+	DateFormat  string          `json:"date_format"`
+	Preferences json.RawMessage `json:"preferences,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// userColumns lists the columns read by scanUser, in order
+const userColumns = `id, email, name, active, is_admin, external_id, scim_tenant,
+	timezone, locale, avatar_url, date_format, preferences, created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans userColumns into user, followed by any extra destinations
+func scanUser(row rowScanner, user *User, extra ...interface{}) error {
+	var preferences []byte
+	dest := []interface{}{
+		&user.ID, &user.Email, &user.Name, &user.Active, &user.IsAdmin,
+		&user.ExternalID, &user.ScimTenant,
+		&user.Timezone, &user.Locale, &user.AvatarURL, &user.DateFormat, &preferences,
+		&user.CreatedAt, &user.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	user.Preferences = json.RawMessage(preferences)
+	return nil
 }
 
 // UserRepository handles database operations for users
@@ -30,27 +71,63 @@ func NewUserRepository(database *db.DB) *UserRepository {
 	return &UserRepository{DB: database}
 }
 
-// HashPassword creates a SHA256 hash of the password
-func HashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
+// HashPassword creates a bcrypt hash of the password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the stored hash of the
+// user. Accounts with UnusablePassword never match.
+func (u *User) CheckPassword(password string) bool {
+	if u.Password == UnusablePassword {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
 }
 
-// Create adds a new user to the database
-func (r *UserRepository) Create(user *User) error {
-	// Hash the password before storing
-	hashedPassword := HashPassword(user.Password)
+// CreateWithPersonalOrganization adds a new user to the database with their
+// personal workspace, in one transaction so that no account exists without
+// one
+func (r *UserRepository) CreateWithPersonalOrganization(user *User) (*Organization, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := createUser(tx, user); err != nil {
+		return nil, err
+	}
+
+	personal, err := createPersonal(tx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return personal, nil
+}
 
+// createUser inserts a new user in tx. user.Password must already be hashed
+// with HashPassword, or be UnusablePassword.
+func createUser(tx *sql.Tx, user *User) error {
 	// SQL query to insert a new user
 	query := `
-		INSERT INTO users (email, password, name, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
-		RETURNING id, created_at, updated_at
+		INSERT INTO users (email, password, name, active, external_id, scim_tenant, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		RETURNING id, timezone, locale, date_format, created_at, updated_at
 	`
 
 	// Execute the query
-	err := r.DB.QueryRow(query, user.Email, hashedPassword, user.Name).Scan(
-		&user.ID, &user.CreatedAt, &user.UpdatedAt,
+	err := tx.QueryRow(query, user.Email, user.Password, user.Name, user.Active, user.ExternalID, user.ScimTenant).Scan(
+		&user.ID, &user.Timezone, &user.Locale, &user.DateFormat, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err != nil {
@@ -66,10 +143,8 @@ func (r *UserRepository) Create(user *User) error {
 func (r *UserRepository) GetByID(id int) (*User, error) {
 	user := &User{}
 
-	query := `SELECT id, email, name, created_at, updated_at FROM users WHERE id = $1`
-	err := r.DB.QueryRow(query, id).Scan(
-		&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	err := scanUser(r.DB.QueryRow(query, id), user)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -85,10 +160,8 @@ func (r *UserRepository) GetByID(id int) (*User, error) {
 func (r *UserRepository) GetByEmail(email string) (*User, error) {
 	user := &User{}
 
-	query := `SELECT id, email, password, name, created_at, updated_at FROM users WHERE email = $1`
-	err := r.DB.QueryRow(query, email).Scan(
-		&user.ID, &user.Email, &user.Password, &user.Name, &user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + `, password FROM users WHERE email = $1`
+	err := scanUser(r.DB.QueryRow(query, email), user, &user.Password)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -102,14 +175,22 @@ func (r *UserRepository) GetByEmail(email string) (*User, error) {
 
 // Update updates a user's information
 func (r *UserRepository) Update(user *User) error {
+	preferences := user.Preferences
+	if len(preferences) == 0 {
+		preferences = json.RawMessage(`{}`)
+	}
+
 	query := `
 		UPDATE users
-		SET name = $1, updated_at = NOW()
-		WHERE id = $2
+		SET name = $1, timezone = $2, locale = $3, avatar_url = $4, date_format = $5, preferences = $6,
+			updated_at = NOW()
+		WHERE id = $7
 		RETURNING updated_at
 	`
 
-	err := r.DB.QueryRow(query, user.Name, user.ID).Scan(&user.UpdatedAt)
+	err := r.DB.QueryRow(
+		query, user.Name, user.Timezone, user.Locale, user.AvatarURL, user.DateFormat, []byte(preferences), user.ID,
+	).Scan(&user.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -119,9 +200,117 @@ func (r *UserRepository) Update(user *User) error {
 
 // UpdatePassword updates a user's password
 func (r *UserRepository) UpdatePassword(userID int, password string) error {
-	hashedPassword := HashPassword(password)
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
 
 	query := `UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.DB.Exec(query, hashedPassword, userID)
+	_, err = r.DB.Exec(query, hashedPassword, userID)
 	return err
 }
+
+// Search retrieves a page of users matching an optional WHERE fragment
+// and returns the total number of matches
+func (r *UserRepository) Search(where string, args []interface{}, offset, limit int) ([]*User, int, error) {
+	if where == "" {
+		where = "TRUE"
+	}
+
+	var total int
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM users WHERE %s`, where)
+	if err := r.DB.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM users
+		WHERE %s
+		ORDER BY id
+		OFFSET $%d LIMIT $%d
+	`, userColumns, where, len(args)+1, len(args)+2)
+
+	rows, err := r.DB.Query(query, append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		if err := scanUser(rows, user); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// UpdateIdentity updates the attributes managed by an identity provider
+func (r *UserRepository) UpdateIdentity(user *User) error {
+	query := `
+		UPDATE users
+		SET email = $1, name = $2, active = $3, external_id = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING updated_at
+	`
+
+	err := r.DB.QueryRow(query, user.Email, user.Name, user.Active, user.ExternalID, user.ID).Scan(&user.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("user not found")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// SetActive activates or deactivates a user account
+func (r *UserRepository) SetActive(userID int, active bool) error {
+	query := `UPDATE users SET active = $1, updated_at = NOW() WHERE id = $2`
+
+	result, err := r.DB.Exec(query, active, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// SetAdmin grants or revokes admin rights
+func (r *UserRepository) SetAdmin(userID int, isAdmin bool) error {
+	query := `UPDATE users SET is_admin = $1, updated_at = NOW() WHERE id = $2`
+
+	result, err := r.DB.Exec(query, isAdmin, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword returned error: %v", err)
+	}
+
+	user := &User{Password: hash}
+	if !user.CheckPassword("correct horse") {
+		t.Error("Expected the password to match its hash")
+	}
+	if user.CheckPassword("battery staple") {
+		t.Error("Expected another password not to match")
+	}
+
+	// Provisioned accounts without a password cannot log in with any
+	user.Password = UnusablePassword
+	for _, password := range []string{"", "!", "correct horse"} {
+		if user.CheckPassword(password) {
+			t.Errorf("Unusable password matched %q", password)
+		}
+	}
+}
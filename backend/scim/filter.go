@@ -0,0 +1,290 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Comparison is a single "attribute operator value" expression
+type Comparison struct {
+	Attribute string
+	Operator  string
+	Value     interface{}
+}
+
+// Filter is a list of comparisons joined with "and"
+type Filter []Comparison
+
+// Attribute types, which decide how filter values are compared
+const (
+	TypeString   = "string"
+	TypeInteger  = "integer"
+	TypeBoolean  = "boolean"
+	TypeDateTime = "dateTime"
+)
+
+// Column is the SQL column a filterable attribute maps to, with its type.
+// Strings are compared case-insensitively, only they support co, sw and ew.
+type Column struct {
+	Name string
+	Type string
+}
+
+var supportedOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+// ParseFilter parses the subset of the RFC 7644 filter grammar supported by
+// the API: comparisons joined with "and". Grouping and "or" are rejected.
+func ParseFilter(raw string) (Filter, error) {
+	tokens, err := tokenize(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := Filter{}
+	for i := 0; i < len(tokens); {
+		if len(filter) > 0 {
+			if !strings.EqualFold(tokens[i].text, "and") || tokens[i].quoted {
+				return nil, invalidFilter(fmt.Sprintf("unsupported logical operator %q", tokens[i].text))
+			}
+			i++
+		}
+
+		if i+1 >= len(tokens) {
+			return nil, invalidFilter("incomplete expression")
+		}
+
+		attribute := tokens[i].text
+		operator := strings.ToLower(tokens[i+1].text)
+		if !supportedOperators[operator] {
+			return nil, invalidFilter(fmt.Sprintf("unsupported operator %q", tokens[i+1].text))
+		}
+
+		if operator == "pr" {
+			filter = append(filter, Comparison{Attribute: attribute, Operator: operator})
+			i += 2
+			continue
+		}
+
+		if i+2 >= len(tokens) {
+			return nil, invalidFilter(fmt.Sprintf("missing value for %q", attribute))
+		}
+
+		filter = append(filter, Comparison{
+			Attribute: attribute,
+			Operator:  operator,
+			Value:     tokens[i+2].value(),
+		})
+		i += 3
+	}
+
+	return filter, nil
+}
+
+// SQL translates the filter into a WHERE fragment. columns maps SCIM
+// attribute names (case-insensitive) to SQL columns; placeholders start at
+// $firstArg. Attributes missing from columns, and values that do not match
+// the type of their column, are rejected.
+func (f Filter) SQL(columns map[string]Column, firstArg int) (string, []interface{}, error) {
+	clauses := []string{}
+	args := []interface{}{}
+
+	for _, cmp := range f {
+		col, ok := lookupColumn(columns, cmp.Attribute)
+		if !ok {
+			return "", nil, invalidFilter(fmt.Sprintf("filtering on %q is not supported", cmp.Attribute))
+		}
+		column := col.Name
+
+		if cmp.Operator == "pr" {
+			clauses = append(clauses, fmt.Sprintf("%s IS NOT NULL", column))
+			continue
+		}
+
+		placeholder := fmt.Sprintf("$%d", firstArg+len(args))
+
+		if cmp.Value == nil {
+			switch cmp.Operator {
+			case "eq":
+				clauses = append(clauses, fmt.Sprintf("%s IS NULL", column))
+			case "ne":
+				clauses = append(clauses, fmt.Sprintf("%s IS NOT NULL", column))
+			default:
+				return "", nil, invalidFilter(fmt.Sprintf("operator %q cannot compare with null", cmp.Operator))
+			}
+			continue
+		}
+
+		if col.Type != TypeString && (cmp.Operator == "co" || cmp.Operator == "sw" || cmp.Operator == "ew") {
+			return "", nil, invalidFilter(fmt.Sprintf("operator %q is only supported on string attributes", cmp.Operator))
+		}
+
+		value, err := col.convert(cmp.Attribute, cmp.Value)
+		if err != nil {
+			return "", nil, err
+		}
+
+		switch cmp.Operator {
+		case "eq":
+			if col.Type == TypeString {
+				clauses = append(clauses, fmt.Sprintf("LOWER(%s) = LOWER(%s)", column, placeholder))
+			} else {
+				clauses = append(clauses, fmt.Sprintf("%s = %s", column, placeholder))
+			}
+		case "ne":
+			clauses = append(clauses, fmt.Sprintf("%s IS DISTINCT FROM %s", column, placeholder))
+		case "co", "sw", "ew":
+			s := escapeLike(value.(string))
+			switch cmp.Operator {
+			case "co":
+				value = "%" + s + "%"
+			case "sw":
+				value = s + "%"
+			case "ew":
+				value = "%" + s
+			}
+			clauses = append(clauses, fmt.Sprintf("%s ILIKE %s", column, placeholder))
+		case "gt":
+			clauses = append(clauses, fmt.Sprintf("%s > %s", column, placeholder))
+		case "ge":
+			clauses = append(clauses, fmt.Sprintf("%s >= %s", column, placeholder))
+		case "lt":
+			clauses = append(clauses, fmt.Sprintf("%s < %s", column, placeholder))
+		case "le":
+			clauses = append(clauses, fmt.Sprintf("%s <= %s", column, placeholder))
+		}
+
+		args = append(args, value)
+	}
+
+	return strings.Join(clauses, " AND "), args, nil
+}
+
+func lookupColumn(columns map[string]Column, attribute string) (Column, bool) {
+	for name, column := range columns {
+		if strings.EqualFold(name, attribute) {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+// convert returns a non-null filter value as the type of the column.
+// Integers may be given as strings, since SCIM ids are strings, and times
+// must be RFC 3339 strings.
+func (c Column) convert(attribute string, value interface{}) (interface{}, error) {
+	mismatch := invalidFilter(fmt.Sprintf("value of %q must be a %s", attribute, c.Type))
+
+	switch c.Type {
+	case TypeInteger:
+		switch v := value.(type) {
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	case TypeBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case TypeDateTime:
+		if s, ok := value.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t, nil
+			}
+		}
+	default:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	}
+
+	return nil, mismatch
+}
+
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
+
+func invalidFilter(detail string) *Error {
+	return NewError(http.StatusBadRequest, "invalidFilter", detail)
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// value converts a token to its JSON-typed value
+func (t token) value() interface{} {
+	if t.quoted {
+		return t.text
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+		return n
+	}
+	return t.text
+}
+
+func tokenize(raw string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(raw) {
+		switch c := raw[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			return nil, invalidFilter("grouping and complex attribute filters are not supported")
+		case c == '"':
+			var b strings.Builder
+			i++
+			closed := false
+			for i < len(raw) {
+				if raw[i] == '\\' && i+1 < len(raw) {
+					b.WriteByte(raw[i+1])
+					i += 2
+					continue
+				}
+				if raw[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				b.WriteByte(raw[i])
+				i++
+			}
+			if !closed {
+				return nil, invalidFilter("unterminated string")
+			}
+			tokens = append(tokens, token{text: b.String(), quoted: true})
+		default:
+			start := i
+			for i < len(raw) && raw[i] != ' ' && raw[i] != '\t' && raw[i] != '"' {
+				i++
+			}
+			tokens = append(tokens, token{text: raw[start:i]})
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, invalidFilter("empty filter")
+	}
+	return tokens, nil
+}
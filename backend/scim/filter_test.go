@@ -0,0 +1,102 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter(`userName eq "bjensen@example.com" and active eq true and externalId pr`)
+	if err != nil {
+		t.Fatalf("Failed to parse filter: %v", err)
+	}
+
+	expected := Filter{
+		{Attribute: "userName", Operator: "eq", Value: "bjensen@example.com"},
+		{Attribute: "active", Operator: "eq", Value: true},
+		{Attribute: "externalId", Operator: "pr"},
+	}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Fatalf("Unexpected filter: %#v", filter)
+	}
+}
+
+func TestParseFilterRejectsUnsupportedSyntax(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		`userName eq`,
+		`userName xx "a"`,
+		`userName eq "a" or userName eq "b"`,
+		`emails[type eq "work"]`,
+		`userName eq "unterminated`,
+	} {
+		if _, err := ParseFilter(raw); err == nil {
+			t.Errorf("Expected an error for filter %q", raw)
+		}
+	}
+}
+
+func TestFilterSQL(t *testing.T) {
+	filter, err := ParseFilter(`userName sw "bjen_" and active eq false`)
+	if err != nil {
+		t.Fatalf("Failed to parse filter: %v", err)
+	}
+
+	columns := map[string]Column{
+		"username": {Name: "email", Type: TypeString},
+		"active":   {Name: "active", Type: TypeBoolean},
+	}
+	where, args, err := filter.SQL(columns, 3)
+	if err != nil {
+		t.Fatalf("Failed to build SQL: %v", err)
+	}
+
+	if where != "email ILIKE $3 AND active = $4" {
+		t.Errorf("Unexpected where clause: %s", where)
+	}
+	if !reflect.DeepEqual(args, []interface{}{`bjen\_%`, false}) {
+		t.Errorf("Unexpected args: %#v", args)
+	}
+
+	if _, _, err := filter.SQL(map[string]Column{"active": {Name: "active", Type: TypeBoolean}}, 1); err == nil {
+		t.Error("Expected an error for an unmapped attribute")
+	}
+}
+
+func TestFilterSQLConvertsTypedColumns(t *testing.T) {
+	columns := map[string]Column{
+		"id":           {Name: "id", Type: TypeInteger},
+		"meta.created": {Name: "created_at", Type: TypeDateTime},
+	}
+
+	filter, err := ParseFilter(`id eq "42" and meta.created gt "2026-01-01T00:00:00Z"`)
+	if err != nil {
+		t.Fatalf("Failed to parse filter: %v", err)
+	}
+
+	where, args, err := filter.SQL(columns, 1)
+	if err != nil {
+		t.Fatalf("Failed to build SQL: %v", err)
+	}
+	if where != "id = $1 AND created_at > $2" {
+		t.Errorf("Unexpected where clause: %s", where)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(42), time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)}) {
+		t.Errorf("Unexpected args: %#v", args)
+	}
+
+	for _, raw := range []string{`id eq "abc"`, `id co "4"`, `meta.created sw "2026"`, `meta.created eq "yesterday"`, `id gt null`} {
+		filter, err := ParseFilter(raw)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", raw, err)
+		}
+
+		_, _, err = filter.SQL(columns, 1)
+		var scimErr *Error
+		if !errors.As(err, &scimErr) || scimErr.ScimType != "invalidFilter" {
+			t.Errorf("Expected an invalidFilter error for %s, got %v", raw, err)
+		}
+	}
+}
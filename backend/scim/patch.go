@@ -0,0 +1,281 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var memberPathPattern = regexp.MustCompile(`^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+
+// ApplyPatch applies the operations of a PatchOp request to a user
+func (u *User) ApplyPatch(operations []PatchOperation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return invalidValue(fmt.Sprintf("unsupported patch operation %q", operation.Op))
+		}
+
+		// Without a path the value is a partial resource to merge
+		if operation.Path == "" {
+			if op == "remove" {
+				return NewError(http.StatusBadRequest, "noTarget", "remove requires a path")
+			}
+			values, ok := operation.Value.(map[string]interface{})
+			if !ok {
+				return invalidValue("patch value must be an object when no path is given")
+			}
+			for path, value := range values {
+				if err := u.setAttribute(path, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if op == "remove" {
+			if err := u.setAttribute(operation.Path, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := u.setAttribute(operation.Path, operation.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u *User) setAttribute(path string, value interface{}) error {
+	switch strings.ToLower(path) {
+	case "active":
+		active, err := boolValue(value)
+		if err != nil {
+			return err
+		}
+		u.Active = &active
+	case "username":
+		s, err := stringValue(value)
+		if err != nil {
+			return err
+		}
+		if s == "" {
+			return NewError(http.StatusBadRequest, "mutability", "userName cannot be removed")
+		}
+		u.UserName = s
+	case "externalid":
+		s, err := stringValue(value)
+		if err != nil {
+			return err
+		}
+		u.ExternalID = s
+	case "displayname":
+		s, err := stringValue(value)
+		if err != nil {
+			return err
+		}
+		u.DisplayName = s
+	case "name":
+		if value == nil {
+			u.Name = nil
+			return nil
+		}
+		name := Name{}
+		if err := remarshal(value, &name); err != nil {
+			return invalidValue("name must be an object")
+		}
+		u.Name = &name
+	case "name.formatted", "name.givenname", "name.familyname":
+		s, err := stringValue(value)
+		if err != nil {
+			return err
+		}
+		if u.Name == nil {
+			u.Name = &Name{}
+		}
+		switch strings.ToLower(path) {
+		case "name.formatted":
+			u.Name.Formatted = s
+		case "name.givenname":
+			u.Name.GivenName = s
+			u.Name.Formatted = ""
+		case "name.familyname":
+			u.Name.FamilyName = s
+			u.Name.Formatted = ""
+		}
+	case "emails":
+		emails := []Email{}
+		if value != nil {
+			if err := remarshal(value, &emails); err != nil {
+				return invalidValue("emails must be a list")
+			}
+		}
+		u.Emails = emails
+	default:
+		// Attributes we do not store (phone numbers, addresses, extensions...)
+		// are accepted and ignored, as most identity providers send them.
+	}
+
+	return nil
+}
+
+// ApplyPatch applies the operations of a PatchOp request to a group
+func (g *Group) ApplyPatch(operations []PatchOperation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		path := strings.TrimSpace(operation.Path)
+
+		switch {
+		case path == "":
+			if op == "remove" {
+				return NewError(http.StatusBadRequest, "noTarget", "remove requires a path")
+			}
+			values, ok := operation.Value.(map[string]interface{})
+			if !ok {
+				return invalidValue("patch value must be an object when no path is given")
+			}
+			for key, value := range values {
+				if err := g.patchAttribute(op, key, value); err != nil {
+					return err
+				}
+			}
+		case memberPathPattern.MatchString(path):
+			if op != "remove" {
+				return invalidValue("filtered member paths only support remove")
+			}
+			id := memberPathPattern.FindStringSubmatch(path)[1]
+			g.removeMembers([]Member{{Value: id}})
+		default:
+			if err := g.patchAttribute(op, path, operation.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *Group) patchAttribute(op, path string, value interface{}) error {
+	switch strings.ToLower(path) {
+	case "displayname":
+		if op == "remove" {
+			return NewError(http.StatusBadRequest, "mutability", "displayName cannot be removed")
+		}
+		s, err := stringValue(value)
+		if err != nil {
+			return err
+		}
+		g.DisplayName = s
+	case "externalid":
+		if op == "remove" {
+			g.ExternalID = ""
+			return nil
+		}
+		s, err := stringValue(value)
+		if err != nil {
+			return err
+		}
+		g.ExternalID = s
+	case "members":
+		members := []Member{}
+		if value != nil {
+			if err := remarshal(value, &members); err != nil {
+				return invalidValue("members must be a list")
+			}
+		}
+		switch op {
+		case "add":
+			g.addMembers(members)
+		case "replace":
+			g.Members = members
+		case "remove":
+			if value == nil {
+				g.Members = nil
+			} else {
+				g.removeMembers(members)
+			}
+		default:
+			return invalidValue(fmt.Sprintf("unsupported patch operation %q", op))
+		}
+	default:
+		return NewError(http.StatusBadRequest, "invalidPath", fmt.Sprintf("unsupported path %q", path))
+	}
+
+	return nil
+}
+
+func (g *Group) addMembers(members []Member) {
+	for _, member := range members {
+		exists := false
+		for _, existing := range g.Members {
+			if existing.Value == member.Value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			g.Members = append(g.Members, member)
+		}
+	}
+}
+
+func (g *Group) removeMembers(members []Member) {
+	kept := []Member{}
+	for _, existing := range g.Members {
+		removed := false
+		for _, member := range members {
+			if existing.Value == member.Value {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, existing)
+		}
+	}
+	g.Members = kept
+}
+
+func stringValue(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", invalidValue(fmt.Sprintf("expected a string, got %v", value))
+	}
+	return s, nil
+}
+
+// boolValue also accepts "True"/"False" strings, which some identity
+// providers send for the active attribute
+func boolValue(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, invalidValue(fmt.Sprintf("expected a boolean, got %v", value))
+}
+
+func remarshal(value interface{}, target interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func invalidValue(detail string) *Error {
+	return NewError(http.StatusBadRequest, "invalidValue", detail)
+}
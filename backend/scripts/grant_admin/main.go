@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+)
+
+func main() {
+	if len(os.Args) < 2 || len(os.Args) > 3 || (len(os.Args) == 3 && os.Args[2] != "--revoke") {
+		fmt.Println("Usage: go run ./scripts/grant_admin <email> [--revoke]")
+		os.Exit(1)
+	}
+
+	database, err := db.NewDB()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	userRepo := models.NewUserRepository(database)
+
+	user, err := userRepo.GetByEmail(os.Args[1])
+	if err != nil {
+		log.Fatalf("Failed to find user: %v", err)
+	}
+
+	isAdmin := len(os.Args) == 2
+	if err := userRepo.SetAdmin(user.ID, isAdmin); err != nil {
+		log.Fatalf("Failed to update user: %v", err)
+	}
+
+	if isAdmin {
+		fmt.Printf("User %s is now an admin\n", user.Email)
+	} else {
+		fmt.Printf("User %s is no longer an admin\n", user.Email)
+	}
+}
@@ -9,12 +9,24 @@ DB_NAME=${DB_NAME:-saas_db}
 
 echo "Exécution des migrations SQL..."
 
-# Exécuter le script de migration
-PGPASSWORD="$DB_PASSWORD" psql -h "$DB_HOST" -p "$DB_PORT" -U "$DB_USER" -d "$DB_NAME" -f ./db/migrations/000001_init_schema.up.sql
+# Exécuter les scripts de migration dans l'ordre
+for migration in ./db/migrations/*.up.sql; do
+    echo "-> $migration"
+    PGPASSWORD="$DB_PASSWORD" psql -v ON_ERROR_STOP=1 -h "$DB_HOST" -p "$DB_PORT" -U "$DB_USER" -d "$DB_NAME" -f "$migration"
+    if [ $? -ne 0 ]; then
+        echo "Erreur lors de l'exécution des migrations."
+        exit 1
+    fi
+done
 
-if [ $? -eq 0 ]; then
-    echo "Migrations exécutées avec succès!"
-else
-    echo "Erreur lors de l'exécution des migrations."
-    exit 1
+# Mettre à jour les schémas et bases des organisations isolées
+if [ "$TENANCY_MODE" = "isolated" ]; then
+    echo "Migrations des tenants isolés..."
+    go run ./scripts/tenant migrate
+    if [ $? -ne 0 ]; then
+        echo "Erreur lors de l'exécution des migrations des tenants."
+        exit 1
+    fi
 fi
+
+echo "Migrations exécutées avec succès!"
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+	"github.com/LouisVannobel/SaaS-Template/backend/models"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println("Usage: go run ./scripts/scim_token <tenant>")
+		os.Exit(1)
+	}
+
+	database, err := db.NewDB()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	token, plain, err := models.NewScimTokenRepository(database).Create(os.Args[1])
+	if err != nil {
+		log.Fatalf("Failed to create SCIM token: %v", err)
+	}
+
+	fmt.Printf("SCIM token %d created for tenant %s\n", token.ID, token.Tenant)
+	fmt.Printf("Bearer token (shown only once): %s\n", plain)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/LouisVannobel/SaaS-Template/backend/db"
+)
+
+const usage = `Usage:
+  go run ./scripts/tenant register <organization-id> schema <schema-name>
+  go run ./scripts/tenant register <organization-id> database <database-url>
+  go run ./scripts/tenant migrate
+  go run ./scripts/tenant list`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+
+	// Tenant connections are only resolved in the isolated tenancy mode
+	os.Setenv("TENANCY_MODE", db.TenancyIsolated)
+
+	database, err := db.NewDB()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	switch os.Args[1] {
+	case "register":
+		register(database, os.Args[2:])
+	case "migrate":
+		applied, err := database.MigrateTenants(db.TenantMigrationsDir)
+		for organizationID, n := range applied {
+			fmt.Printf("Organization %d: %d migration(s) applied\n", organizationID, n)
+		}
+		if err != nil {
+			log.Fatalf("Failed to migrate tenants: %v", err)
+		}
+		fmt.Printf("%d tenant(s) up to date\n", len(applied))
+	case "list":
+		tenants, err := database.GetTenants()
+		if err != nil {
+			log.Fatalf("Failed to list tenants: %v", err)
+		}
+		for _, tenant := range tenants {
+			location := tenant.SchemaName
+			if tenant.Mode == db.TenantModeDatabase {
+				location = "(dedicated database)"
+			}
+			fmt.Printf("Organization %d\t%s\t%s\n", tenant.OrganizationID, tenant.Mode, location)
+		}
+	default:
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+}
+
+func register(database *db.DB, args []string) {
+	if len(args) != 3 {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+
+	organizationID, err := strconv.Atoi(args[0])
+	if err != nil {
+		log.Fatalf("Invalid organization ID %q", args[0])
+	}
+
+	tenant := &db.Tenant{OrganizationID: organizationID, Mode: args[1]}
+	if tenant.Mode == db.TenantModeDatabase {
+		tenant.DatabaseURL = args[2]
+	} else {
+		tenant.SchemaName = args[2]
+	}
+
+	if err := database.RegisterTenant(tenant, db.TenantMigrationsDir); err != nil {
+		log.Fatalf("Failed to register tenant: %v", err)
+	}
+
+	fmt.Printf("Organization %d now stores its data in its own %s\n", organizationID, tenant.Mode)
+}
@@ -0,0 +1,111 @@
+// Package taskhistory computes the changes recorded in the history of a
+// task and rebuilds the fields of a task as they were at a previous
+// version. The history is stored by the models package, nothing here
+// touches the database.
+package taskhistory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// ErrUnknownRevision is returned when rebuilding a version the history does
+// not record
+var ErrUnknownRevision = errors.New("revision not found in the task history")
+
+var null = json.RawMessage("null")
+
+// Change is the value of a field before and after a change, as JSON. A
+// missing value is null.
+type Change struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// Changes are the changes of a revision, by field name
+type Changes map[string]Change
+
+// Fields are the tracked values of a task, by field name. Values are
+// compared and recorded as JSON.
+type Fields map[string]interface{}
+
+// Revision is a version of a task and the changes that produced it
+type Revision struct {
+	Version int
+	Changes Changes
+}
+
+// Diff returns the fields whose value differs between two states of a task.
+// A field missing from a state, or a nil state, is null, so the diff of a
+// new task lists its non-null fields.
+func Diff(before, after Fields) (Changes, error) {
+	changes := Changes{}
+
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	for name := range names {
+		old, err := encode(before, name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := encode(after, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(old, value) {
+			changes[name] = Change{Old: old, New: value}
+		}
+	}
+
+	return changes, nil
+}
+
+// encode returns the JSON value of a field, null when it is missing
+func encode(fields Fields, name string) (json.RawMessage, error) {
+	value, ok := fields[name]
+	if !ok {
+		return null, nil
+	}
+	return json.Marshal(value)
+}
+
+// State replays revisions, in version order, up to version and returns the
+// value of every field they set. Fields no revision set are missing, they
+// were null. ErrUnknownRevision is returned when no revision is at version.
+func State(revisions []Revision, version int) (map[string]json.RawMessage, error) {
+	sorted := append([]Revision{}, revisions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	found := false
+	state := map[string]json.RawMessage{}
+	for _, revision := range sorted {
+		if revision.Version > version {
+			break
+		}
+		found = found || revision.Version == version
+
+		for name, change := range revision.Changes {
+			if len(change.New) == 0 {
+				state[name] = null
+				continue
+			}
+			state[name] = change.New
+		}
+	}
+
+	if !found {
+		return nil, ErrUnknownRevision
+	}
+	return state, nil
+}
@@ -0,0 +1,77 @@
+package taskhistory
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffNewTask(t *testing.T) {
+	changes, err := Diff(nil, Fields{"title": "Write tests", "status": "pending", "due_date": (*time.Time)(nil)})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	expected := Changes{
+		"title":  {Old: json.RawMessage("null"), New: json.RawMessage(`"Write tests"`)},
+		"status": {Old: json.RawMessage("null"), New: json.RawMessage(`"pending"`)},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected the non-null fields, got %v", changes)
+	}
+}
+
+func TestDiffListsChangedFieldsOnly(t *testing.T) {
+	due := time.Date(2026, time.June, 1, 10, 0, 0, 0, time.UTC)
+	before := Fields{"title": "Draft", "status": "pending", "due_date": (*time.Time)(nil)}
+	after := Fields{"title": "Draft", "status": "completed", "due_date": &due}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	expected := Changes{
+		"status":   {Old: json.RawMessage(`"pending"`), New: json.RawMessage(`"completed"`)},
+		"due_date": {Old: json.RawMessage("null"), New: json.RawMessage(`"2026-06-01T10:00:00Z"`)},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Unexpected changes %v", changes)
+	}
+
+	if changes, _ := Diff(after, after); len(changes) != 0 {
+		t.Errorf("Expected no change, got %v", changes)
+	}
+}
+
+func TestState(t *testing.T) {
+	revisions := []Revision{
+		{Version: 3, Changes: Changes{"title": {Old: json.RawMessage(`"Draft"`), New: json.RawMessage(`"Final"`)}}},
+		{Version: 1, Changes: Changes{
+			"title":       {New: json.RawMessage(`"Draft"`)},
+			"description": {New: json.RawMessage(`"First"`)},
+		}},
+		{Version: 2, Changes: Changes{"description": {Old: json.RawMessage(`"First"`), New: json.RawMessage("null")}}},
+	}
+
+	state, err := State(revisions, 2)
+	if err != nil {
+		t.Fatalf("State failed: %v", err)
+	}
+	expected := map[string]json.RawMessage{"title": json.RawMessage(`"Draft"`), "description": json.RawMessage("null")}
+	if !reflect.DeepEqual(state, expected) {
+		t.Errorf("Unexpected state at version 2: %v", state)
+	}
+
+	state, _ = State(revisions, 3)
+	if string(state["title"]) != `"Final"` {
+		t.Errorf("Expected the latest title, got %s", state["title"])
+	}
+
+	// Versions changed outside of the history cannot be rebuilt
+	if _, err := State(revisions, 5); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("Expected ErrUnknownRevision, got %v", err)
+	}
+}
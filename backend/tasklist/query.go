@@ -0,0 +1,377 @@
+// Package tasklist parses the query string of the task list into filters,
+// sort keys and an opaque cursor, and translates them into SQL so that
+// filtering and keyset pagination run in the database.
+package tasklist
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of the task list
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// DefaultSort lists the most recent tasks first
+const DefaultSort = "-created_at"
+
+// field is a sort key of the task list
+type field struct {
+	// expr is the SQL expression sorted on
+	expr string
+	// time fields are compared as timestamps, the others as text
+	time bool
+}
+
+// fields are the sort keys accepted in the sort parameter. Tasks without a
+// due date sort after every other one in ascending order, before them in
+// descending order.
+var fields = map[string]field{
+	"created_at": {expr: "tasks.created_at", time: true},
+	"updated_at": {expr: "tasks.updated_at", time: true},
+	"due_date":   {expr: "COALESCE(tasks.due_date, 'infinity'::timestamptz)", time: true},
+	"title":      {expr: "tasks.title"},
+	"status":     {expr: "tasks.status"},
+}
+
+// SortKey is a field of the sort parameter with its direction
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// Cursor is the position after which the next page starts: the sort values
+// and the ID of the last task of the previous page
+type Cursor struct {
+	// Sort is the sort parameter the cursor was issued for
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	ID     int           `json:"id"`
+}
+
+// Error is a query string the task list cannot apply
+type Error struct {
+	Parameter string
+	Message   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Parameter, e.Message)
+}
+
+// Query is a page of the task list. Time bounds are inclusive for After and
+// exclusive for Before.
+type Query struct {
+	Statuses      []string
+	DueAfter      *time.Time
+	DueBefore     *time.Time
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	// HasDueDate keeps only the tasks with (true) or without (false) a due
+	// date when set
+	HasDueDate   *bool
+	Sort         []SortKey
+	Limit        int
+	Cursor       *Cursor
+	IncludeTotal bool
+}
+
+// Parse reads a query from the query string parameters returned by get:
+// status (comma separated), due_after, due_before, created_after,
+// created_before, updated_after, updated_before (RFC 3339 or YYYY-MM-DD),
+// has_due_date, sort (comma separated fields, prefixed with - for
+// descending order), limit, cursor and include_total.
+func Parse(get func(key string) string) (*Query, error) {
+	q := &Query{Limit: DefaultLimit}
+
+	for _, status := range strings.Split(get("status"), ",") {
+		if status = strings.TrimSpace(status); status != "" {
+			q.Statuses = append(q.Statuses, status)
+		}
+	}
+
+	bounds := []struct {
+		key  string
+		dest **time.Time
+	}{
+		{"due_after", &q.DueAfter},
+		{"due_before", &q.DueBefore},
+		{"created_after", &q.CreatedAfter},
+		{"created_before", &q.CreatedBefore},
+		{"updated_after", &q.UpdatedAfter},
+		{"updated_before", &q.UpdatedBefore},
+	}
+	for _, bound := range bounds {
+		value, err := parseTime(bound.key, get(bound.key))
+		if err != nil {
+			return nil, err
+		}
+		*bound.dest = value
+	}
+
+	if raw := get("has_due_date"); raw != "" {
+		hasDueDate, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, &Error{Parameter: "has_due_date", Message: "expected true or false"}
+		}
+		q.HasDueDate = &hasDueDate
+	}
+
+	if raw := get("include_total"); raw != "" {
+		includeTotal, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, &Error{Parameter: "include_total", Message: "expected true or false"}
+		}
+		q.IncludeTotal = includeTotal
+	}
+
+	if raw := get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return nil, &Error{Parameter: "limit", Message: fmt.Sprintf("expected a number between 1 and %d", MaxLimit)}
+		}
+		q.Limit = limit
+	}
+
+	sort, err := parseSort(get("sort"))
+	if err != nil {
+		return nil, err
+	}
+	q.Sort = sort
+
+	if raw := get("cursor"); raw != "" {
+		cursor, err := q.decodeCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		q.Cursor = cursor
+	}
+
+	return q, nil
+}
+
+func parseTime(key, raw string) (*time.Time, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, &Error{Parameter: key, Message: "expected an RFC 3339 timestamp or a YYYY-MM-DD date"}
+}
+
+func parseSort(raw string) ([]SortKey, error) {
+	if strings.TrimSpace(raw) == "" {
+		raw = DefaultSort
+	}
+
+	keys := []SortKey{}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		key := SortKey{Field: strings.TrimPrefix(part, "-"), Descending: strings.HasPrefix(part, "-")}
+		if _, ok := fields[key.Field]; !ok {
+			return nil, &Error{Parameter: "sort", Message: fmt.Sprintf("unknown field %q", key.Field)}
+		}
+		if seen[key.Field] {
+			return nil, &Error{Parameter: "sort", Message: fmt.Sprintf("field %q is repeated", key.Field)}
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// sortString is the normalized sort parameter, recorded in cursors
+func (q *Query) sortString() string {
+	parts := make([]string, len(q.Sort))
+	for i, key := range q.Sort {
+		parts[i] = key.Field
+		if key.Descending {
+			parts[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (q *Query) decodeCursor(raw string) (*Cursor, error) {
+	invalid := &Error{Parameter: "cursor", Message: "malformed cursor"}
+
+	payload, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, invalid
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(payload, cursor); err != nil || len(cursor.Values) != len(q.Sort) {
+		return nil, invalid
+	}
+	if cursor.Sort != q.sortString() {
+		return nil, &Error{Parameter: "cursor", Message: "cursor was issued for another sort"}
+	}
+
+	for i, key := range q.Sort {
+		value := cursor.Values[i]
+		if value == nil {
+			if key.Field != "due_date" {
+				return nil, invalid
+			}
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if fields[key.Field].time {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, invalid
+			}
+			cursor.Values[i] = t
+		}
+	}
+
+	return cursor, nil
+}
+
+// NextCursor encodes the cursor of the page following the task with the
+// given ID, value returning its value for a sort field: a time.Time, a nil
+// *time.Time for a missing due date or a string
+func (q *Query) NextCursor(id int, value func(field string) interface{}) string {
+	cursor := Cursor{Sort: q.sortString(), ID: id, Values: make([]interface{}, len(q.Sort))}
+	for i, key := range q.Sort {
+		switch v := value(key.Field).(type) {
+		case time.Time:
+			cursor.Values[i] = v.Format(time.RFC3339Nano)
+		case *time.Time:
+			if v != nil {
+				cursor.Values[i] = v.Format(time.RFC3339Nano)
+			}
+		default:
+			cursor.Values[i] = v
+		}
+	}
+
+	payload, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// Filters translates the filters into conditions joined with AND, each
+// prefixed with " AND ". Placeholders start at $firstArg.
+func (q *Query) Filters(firstArg int) (string, []interface{}) {
+	var sql strings.Builder
+	args := []interface{}{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", firstArg+len(args)-1)
+	}
+
+	if len(q.Statuses) > 0 {
+		placeholders := make([]string, len(q.Statuses))
+		for i, status := range q.Statuses {
+			placeholders[i] = arg(status)
+		}
+		fmt.Fprintf(&sql, " AND tasks.status IN (%s)", strings.Join(placeholders, ", "))
+	}
+
+	ranges := []struct {
+		column        string
+		after, before *time.Time
+	}{
+		{"tasks.due_date", q.DueAfter, q.DueBefore},
+		{"tasks.created_at", q.CreatedAfter, q.CreatedBefore},
+		{"tasks.updated_at", q.UpdatedAfter, q.UpdatedBefore},
+	}
+	for _, r := range ranges {
+		if r.after != nil {
+			fmt.Fprintf(&sql, " AND %s >= %s", r.column, arg(*r.after))
+		}
+		if r.before != nil {
+			fmt.Fprintf(&sql, " AND %s < %s", r.column, arg(*r.before))
+		}
+	}
+
+	if q.HasDueDate != nil {
+		if *q.HasDueDate {
+			sql.WriteString(" AND tasks.due_date IS NOT NULL")
+		} else {
+			sql.WriteString(" AND tasks.due_date IS NULL")
+		}
+	}
+
+	return sql.String(), args
+}
+
+// After translates the cursor into a condition prefixed with " AND " that
+// keeps the tasks sorted after it, empty without a cursor. Placeholders
+// start at $firstArg.
+func (q *Query) After(firstArg int) (string, []interface{}) {
+	if q.Cursor == nil {
+		return "", nil
+	}
+
+	args := []interface{}{}
+	arg := func(value interface{}, time bool) string {
+		args = append(args, value)
+		placeholder := fmt.Sprintf("$%d", firstArg+len(args)-1)
+		if time {
+			return fmt.Sprintf("COALESCE(%s::timestamptz, 'infinity'::timestamptz)", placeholder)
+		}
+		return placeholder
+	}
+
+	// (a > x) OR (a = x AND b > y) OR (a = x AND b = y AND id > z), with the
+	// comparison reversed for descending keys
+	equal := []string{}
+	alternatives := []string{}
+	for i, key := range q.Sort {
+		f := fields[key.Field]
+		value := arg(q.Cursor.Values[i], f.time)
+		alternatives = append(alternatives, "("+strings.Join(append(equal, f.expr+comparison(key.Descending)+value), " AND ")+")")
+		equal = append(equal, f.expr+" = "+value)
+	}
+	id := fmt.Sprintf("$%d", firstArg+len(args))
+	args = append(args, q.Cursor.ID)
+	alternatives = append(alternatives, "("+strings.Join(append(equal, "tasks.id"+comparison(q.idDescending())+id), " AND ")+")")
+
+	return " AND (" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// OrderBy returns the ORDER BY expressions, the task ID breaking ties
+func (q *Query) OrderBy() string {
+	parts := []string{}
+	for _, key := range q.Sort {
+		parts = append(parts, fields[key.Field].expr+direction(key.Descending))
+	}
+	return strings.Join(append(parts, "tasks.id"+direction(q.idDescending())), ", ")
+}
+
+// idDescending sorts ties in the direction of the last sort key
+func (q *Query) idDescending() bool {
+	return len(q.Sort) > 0 && q.Sort[len(q.Sort)-1].Descending
+}
+
+func comparison(descending bool) string {
+	if descending {
+		return " < "
+	}
+	return " > "
+}
+
+func direction(descending bool) string {
+	if descending {
+		return " DESC"
+	}
+	return " ASC"
+}
@@ -0,0 +1,111 @@
+package tasklist
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func params(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestParseDefaults(t *testing.T) {
+	q, err := Parse(params(nil))
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+
+	if q.Limit != DefaultLimit || q.IncludeTotal || q.Cursor != nil {
+		t.Errorf("Unexpected defaults %+v", q)
+	}
+	if q.OrderBy() != "tasks.created_at DESC, tasks.id DESC" {
+		t.Errorf("Unexpected order %s", q.OrderBy())
+	}
+}
+
+func TestParseRejectsInvalidParameters(t *testing.T) {
+	for _, values := range []map[string]string{
+		{"limit": "0"},
+		{"limit": "1000"},
+		{"sort": "password"},
+		{"sort": "title,-title"},
+		{"due_after": "tomorrow"},
+		{"has_due_date": "maybe"},
+		{"cursor": "not a cursor"},
+	} {
+		if _, err := Parse(params(values)); err == nil {
+			t.Errorf("Expected an error for %v", values)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	q, err := Parse(params(map[string]string{
+		"status":         "pending, done",
+		"due_after":      "2026-03-01",
+		"created_before": "2026-04-01T12:00:00Z",
+		"has_due_date":   "true",
+	}))
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+
+	where, args := q.Filters(5)
+	expected := " AND tasks.status IN ($5, $6) AND tasks.due_date >= $7 AND tasks.created_at < $8 AND tasks.due_date IS NOT NULL"
+	if where != expected {
+		t.Errorf("Unexpected filters %s", where)
+	}
+
+	dueAfter := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	createdBefore := time.Date(2026, time.April, 1, 12, 0, 0, 0, time.UTC)
+	if !reflect.DeepEqual(args, []interface{}{"pending", "done", dueAfter, createdBefore}) {
+		t.Errorf("Unexpected args %#v", args)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	q, err := Parse(params(map[string]string{"sort": "due_date,-title"}))
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+
+	values := map[string]interface{}{"due_date": (*time.Time)(nil), "title": "Write report"}
+	cursor := q.NextCursor(42, func(field string) interface{} { return values[field] })
+
+	next, err := Parse(params(map[string]string{"sort": "due_date,-title", "cursor": cursor}))
+	if err != nil {
+		t.Fatalf("Failed to parse cursor: %v", err)
+	}
+
+	after, args := next.After(3)
+	due := "COALESCE($3::timestamptz, 'infinity'::timestamptz)"
+	dueDate := "COALESCE(tasks.due_date, 'infinity'::timestamptz)"
+	expected := " AND ((" + dueDate + " > " + due + ")" +
+		" OR (" + dueDate + " = " + due + " AND tasks.title < $4)" +
+		" OR (" + dueDate + " = " + due + " AND tasks.title = $4 AND tasks.id < $5))"
+	if after != expected {
+		t.Errorf("Unexpected keyset condition %s", after)
+	}
+	if !reflect.DeepEqual(args, []interface{}{nil, "Write report", 42}) {
+		t.Errorf("Unexpected args %#v", args)
+	}
+
+	if _, err := Parse(params(map[string]string{"sort": "-created_at", "cursor": cursor})); err == nil {
+		t.Error("Expected a cursor issued for another sort to be rejected")
+	}
+}
+
+func TestCursorKeepsTimestampPrecision(t *testing.T) {
+	q, _ := Parse(params(nil))
+	createdAt := time.Date(2026, time.May, 4, 9, 30, 0, 123456000, time.UTC)
+	cursor := q.NextCursor(7, func(string) interface{} { return createdAt })
+
+	next, err := Parse(params(map[string]string{"cursor": cursor}))
+	if err != nil {
+		t.Fatalf("Failed to parse cursor: %v", err)
+	}
+	if value, ok := next.Cursor.Values[0].(time.Time); !ok || !value.Equal(createdAt) || next.Cursor.ID != 7 {
+		t.Errorf("Unexpected cursor %+v", next.Cursor)
+	}
+}
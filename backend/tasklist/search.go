@@ -0,0 +1,165 @@
+package tasklist
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Page sizes of the search results
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// MaxSearchLength bounds the length of search queries, in bytes
+const MaxSearchLength = 256
+
+// SearchConfig is the text search configuration of the tasks search vector.
+// Tasks are written in any language, words are not stemmed.
+const SearchConfig = "simple"
+
+// Delimiters of the matches in headlines, replaced by <mark> elements once
+// the headline is escaped
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// HeadlineOptions are the ts_headline options of snippets, TitleOptions of
+// titles which are highlighted in full
+const (
+	HeadlineOptions = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`
+	TitleOptions    = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", HighlightAll=true`
+)
+
+// Search is a page of the search results
+type Search struct {
+	// TSQuery is the query in to_tsquery syntax
+	TSQuery string
+	Limit   int
+	Offset  int
+}
+
+// ParseSearch reads a search from the query string parameters returned by
+// get: q, limit and offset. Words of q must all match; "quoted words" match
+// a phrase, a word ending with * matches as a prefix, a word or phrase
+// preceded by - must not match and OR between two terms matches either.
+func ParseSearch(get func(key string) string) (*Search, error) {
+	s := &Search{Limit: DefaultSearchLimit}
+
+	raw := get("q")
+	if len(raw) > MaxSearchLength {
+		return nil, &Error{Parameter: "q", Message: fmt.Sprintf("longer than %d characters", MaxSearchLength)}
+	}
+	s.TSQuery = TSQuery(raw)
+	if s.TSQuery == "" {
+		return nil, &Error{Parameter: "q", Message: "expected at least one word"}
+	}
+
+	if raw := get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > MaxSearchLimit {
+			return nil, &Error{Parameter: "limit", Message: fmt.Sprintf("expected a number between 1 and %d", MaxSearchLimit)}
+		}
+		s.Limit = limit
+	}
+
+	if raw := get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return nil, &Error{Parameter: "offset", Message: "expected a positive number"}
+		}
+		s.Offset = offset
+	}
+
+	return s, nil
+}
+
+// TSQuery translates a search into to_tsquery syntax, every word quoted so
+// that operators typed by users are matched as text. It returns an empty
+// string when the search has no word.
+func TSQuery(raw string) string {
+	var query strings.Builder
+	or := false
+
+	for rest := strings.TrimSpace(raw); rest != ""; rest = strings.TrimSpace(rest) {
+		negate := false
+		if strings.HasPrefix(rest, "-") {
+			negate = true
+			rest = rest[1:]
+		}
+
+		var text string
+		quoted := strings.HasPrefix(rest, `"`)
+		if quoted {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				text, rest = rest[1:], ""
+			} else {
+				text, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(rest, " \t\r\n")
+			if end < 0 {
+				end = len(rest)
+			}
+			text, rest = rest[:end], rest[end:]
+		}
+
+		if text == "OR" && !quoted && !negate {
+			or = query.Len() > 0
+			continue
+		}
+
+		term := phrase(text)
+		if term == "" {
+			continue
+		}
+		if negate {
+			term = "!" + term
+		}
+
+		if query.Len() > 0 {
+			if or {
+				query.WriteString(" | ")
+			} else {
+				query.WriteString(" & ")
+			}
+		}
+		query.WriteString(term)
+		or = false
+	}
+
+	return query.String()
+}
+
+// phrase translates words that must follow each other
+func phrase(text string) string {
+	lexemes := []string{}
+	for _, word := range strings.Fields(text) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.TrimRight(word, "*")
+		if word == "" {
+			continue
+		}
+
+		lexeme := "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(word) + "'"
+		if prefix {
+			lexeme += ":*"
+		}
+		lexemes = append(lexemes, lexeme)
+	}
+
+	if len(lexemes) > 1 {
+		return "(" + strings.Join(lexemes, " <-> ") + ")"
+	}
+	return strings.Join(lexemes, "")
+}
+
+// Highlight escapes a headline built with HeadlineOptions or TitleOptions
+// for HTML, its matches wrapped in <mark> elements
+func Highlight(headline string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(headline))
+}
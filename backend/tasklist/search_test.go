@@ -0,0 +1,54 @@
+package tasklist
+
+import "testing"
+
+func TestTSQuery(t *testing.T) {
+	cases := map[string]string{
+		`invoice`:                   `'invoice'`,
+		`invoice client`:            `'invoice' & 'client'`,
+		`"quarterly report" draft*`: `('quarterly' <-> 'report') & 'draft':*`,
+		`invoice -paid`:             `'invoice' & !'paid'`,
+		`urgent OR asap review`:     `'urgent' | 'asap' & 'review'`,
+		`OR invoice OR`:             `'invoice'`,
+		`l'équipe a&b|c!`:           `'l''équipe' & 'a&b|c!'`,
+		`"unterminated phrase`:      `('unterminated' <-> 'phrase')`,
+		`back\slash`:                `'back\\slash'`,
+		`* - ""`:                    ``,
+		`  `:                        ``,
+		`-"do not" "OR" ship`:       `!('do' <-> 'not') & 'OR' & 'ship'`,
+	}
+
+	for raw, expected := range cases {
+		if got := TSQuery(raw); got != expected {
+			t.Errorf("TSQuery(%q) = %q, expected %q", raw, got, expected)
+		}
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	s, err := ParseSearch(params(map[string]string{"q": "report", "limit": "5", "offset": "10"}))
+	if err != nil {
+		t.Fatalf("Failed to parse search: %v", err)
+	}
+	if s.TSQuery != `'report'` || s.Limit != 5 || s.Offset != 10 {
+		t.Errorf("Unexpected search %+v", s)
+	}
+
+	for _, values := range []map[string]string{
+		{},
+		{"q": "-"},
+		{"q": "report", "limit": "500"},
+		{"q": "report", "offset": "-1"},
+	} {
+		if _, err := ParseSearch(params(values)); err == nil {
+			t.Errorf("Expected an error for %v", values)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	headline := "Fix <b>" + highlightStart + "login" + highlightStop + "</b> & logout"
+	if got := Highlight(headline); got != "Fix &lt;b&gt;<mark>login</mark>&lt;/b&gt; &amp; logout" {
+		t.Errorf("Unexpected highlight %q", got)
+	}
+}
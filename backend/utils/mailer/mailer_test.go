@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailerSend(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := &FileMailer{Dir: dir, From: "no-reply@example.com"}
+
+	err := m.Send(&Message{
+		To:      "alice@example.com",
+		Subject: "Hello\r\nBcc: eve@example.com",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read mail directory: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(files))
+	}
+	if !strings.HasSuffix(files[0].Name(), "_alice_example.com.eml") {
+		t.Errorf("Unexpected file name %q", files[0].Name())
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+
+	message := string(content)
+	for _, want := range []string{
+		"From: no-reply@example.com\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: HelloBcc: eve@example.com\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Message does not contain %q:\n%s", want, message)
+		}
+	}
+}
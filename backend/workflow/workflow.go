@@ -0,0 +1,316 @@
+// Package workflow defines the statuses a task can take in an organization,
+// the transitions allowed between them and the hooks run when a task enters
+// or leaves a status. Workflows are stored as JSON by the models package,
+// validation and transitions never touch the database.
+package workflow
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Status categories, which give a meaning to the statuses of any workflow
+const (
+	CategoryTodo       = "todo"
+	CategoryInProgress = "in_progress"
+	CategoryDone       = "done"
+)
+
+// Hook events
+const (
+	EventEnter = "enter"
+	EventLeave = "leave"
+)
+
+// Hook actions
+const (
+	// ActionSetCompletedAt records when the task was completed
+	ActionSetCompletedAt = "set_completed_at"
+	// ActionClearCompletedAt forgets when the task was completed
+	ActionClearCompletedAt = "clear_completed_at"
+)
+
+// Any matches every status in the From of a transition
+const Any = "*"
+
+var statusKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// Status is a status tasks can take
+type Status struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// Transition allows tasks to move from a status, or any with "*", to
+// another one
+type Transition struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Hook runs an action when a task enters or leaves a status, or any status
+// of a category
+type Hook struct {
+	Event    string `json:"event"`
+	Status   string `json:"status,omitempty"`
+	Category string `json:"category,omitempty"`
+	Action   string `json:"action"`
+}
+
+// Workflow is the status workflow of the tasks of an organization. Tasks
+// are created in Initial unless another status is given.
+type Workflow struct {
+	Statuses    []Status     `json:"statuses"`
+	Initial     string       `json:"initial"`
+	Transitions []Transition `json:"transitions"`
+	Hooks       []Hook       `json:"hooks"`
+}
+
+// Default is the workflow of organizations that did not define one: to do,
+// in progress and completed, any transition allowed, recording when tasks
+// are completed
+func Default() *Workflow {
+	return &Workflow{
+		Statuses: []Status{
+			{Key: "pending", Name: "To do", Category: CategoryTodo},
+			{Key: "in-progress", Name: "In progress", Category: CategoryInProgress},
+			{Key: "completed", Name: "Completed", Category: CategoryDone},
+		},
+		Initial: "pending",
+		Transitions: []Transition{
+			{From: Any, To: "pending"},
+			{From: Any, To: "in-progress"},
+			{From: Any, To: "completed"},
+		},
+		Hooks: []Hook{
+			{Event: EventEnter, Category: CategoryDone, Action: ActionSetCompletedAt},
+			{Event: EventLeave, Category: CategoryDone, Action: ActionClearCompletedAt},
+		},
+	}
+}
+
+// Error is a status change the workflow does not allow
+type Error struct {
+	Message string
+	// Allowed lists the statuses that could be used instead
+	Allowed []string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Validate checks the workflow is consistent: statuses with unique keys and
+// known categories, at least one of them done, and transitions and hooks
+// that refer to them
+func (w *Workflow) Validate() error {
+	if len(w.Statuses) == 0 {
+		return fmt.Errorf("workflow must define at least one status")
+	}
+
+	done := false
+	keys := map[string]bool{}
+	for _, status := range w.Statuses {
+		if !statusKeyPattern.MatchString(status.Key) {
+			return fmt.Errorf("invalid status key %q: use up to 50 lowercase letters, digits, - and _", status.Key)
+		}
+		if keys[status.Key] {
+			return fmt.Errorf("status %q is defined twice", status.Key)
+		}
+		keys[status.Key] = true
+
+		if strings.TrimSpace(status.Name) == "" {
+			return fmt.Errorf("status %q must have a name", status.Key)
+		}
+		if !isCategory(status.Category) {
+			return fmt.Errorf("status %q must be in category todo, in_progress or done", status.Key)
+		}
+		done = done || status.Category == CategoryDone
+	}
+	if !done {
+		return fmt.Errorf("workflow must define at least one done status")
+	}
+
+	if !keys[w.Initial] {
+		return fmt.Errorf("initial status %q is not defined", w.Initial)
+	}
+
+	for _, t := range w.Transitions {
+		if t.From != Any && !keys[t.From] {
+			return fmt.Errorf("transition from unknown status %q", t.From)
+		}
+		if !keys[t.To] {
+			return fmt.Errorf("transition to unknown status %q", t.To)
+		}
+	}
+
+	for _, hook := range w.Hooks {
+		if hook.Event != EventEnter && hook.Event != EventLeave {
+			return fmt.Errorf("hook event must be enter or leave")
+		}
+		if (hook.Status == "") == (hook.Category == "") {
+			return fmt.Errorf("hook must apply to either a status or a category")
+		}
+		if hook.Status != "" && !keys[hook.Status] {
+			return fmt.Errorf("hook on unknown status %q", hook.Status)
+		}
+		if hook.Category != "" && !isCategory(hook.Category) {
+			return fmt.Errorf("hook on unknown category %q", hook.Category)
+		}
+		if hook.Action != ActionSetCompletedAt && hook.Action != ActionClearCompletedAt {
+			return fmt.Errorf("hook action must be set_completed_at or clear_completed_at")
+		}
+	}
+
+	return nil
+}
+
+func isCategory(category string) bool {
+	switch category {
+	case CategoryTodo, CategoryInProgress, CategoryDone:
+		return true
+	default:
+		return false
+	}
+}
+
+// Status returns the definition of a status, nil when it is not defined
+func (w *Workflow) Status(key string) *Status {
+	for i := range w.Statuses {
+		if w.Statuses[i].Key == key {
+			return &w.Statuses[i]
+		}
+	}
+	return nil
+}
+
+// keys returns the keys of the statuses, in order
+func (w *Workflow) keys() []string {
+	keys := make([]string, len(w.Statuses))
+	for i, status := range w.Statuses {
+		keys[i] = status.Key
+	}
+	return keys
+}
+
+// Create resolves the status of a new task: Initial when empty, otherwise
+// any defined status
+func (w *Workflow) Create(status string) (string, error) {
+	if status == "" {
+		return w.Initial, nil
+	}
+	if w.Status(status) == nil {
+		return "", &Error{
+			Message: fmt.Sprintf("unknown status %q", status),
+			Allowed: w.keys(),
+		}
+	}
+	return status, nil
+}
+
+// Allowed returns the statuses a task can move to from a status. Tasks in
+// a status the workflow no longer defines can move to any status.
+func (w *Workflow) Allowed(from string) []string {
+	if w.Status(from) == nil {
+		return w.keys()
+	}
+
+	allowed := map[string]bool{}
+	for _, t := range w.Transitions {
+		if (t.From == from || t.From == Any) && t.To != from {
+			allowed[t.To] = true
+		}
+	}
+
+	statuses := []string{}
+	for _, key := range w.keys() {
+		if allowed[key] {
+			statuses = append(statuses, key)
+		}
+	}
+	return statuses
+}
+
+// Transition checks a task may move from a status to another one. Keeping
+// the same status is always allowed.
+func (w *Workflow) Transition(from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	if w.Status(to) == nil {
+		return &Error{
+			Message: fmt.Sprintf("unknown status %q", to),
+			Allowed: w.Allowed(from),
+		}
+	}
+
+	allowed := w.Allowed(from)
+	for _, status := range allowed {
+		if status == to {
+			return nil
+		}
+	}
+
+	message := fmt.Sprintf("cannot move a task from %q to %q", from, to)
+	if len(allowed) == 0 {
+		message += ", no transition leaves this status"
+	} else {
+		message += ", allowed statuses are " + strings.Join(allowed, ", ")
+	}
+	return &Error{Message: message, Allowed: allowed}
+}
+
+// Actions returns the actions of the hooks run by a status change, in the
+// order of the hooks: those leaving from then those entering to. Category
+// hooks only run when the category changes. A new task has an empty from.
+func (w *Workflow) Actions(from, to string) []string {
+	if from == to {
+		return nil
+	}
+
+	previous, next := w.Status(from), w.Status(to)
+	category := func(status *Status) string {
+		if status == nil {
+			return ""
+		}
+		return status.Category
+	}
+
+	actions := []string{}
+	for _, event := range []struct {
+		name   string
+		status *Status
+	}{{EventLeave, previous}, {EventEnter, next}} {
+		if event.status == nil {
+			continue
+		}
+		for _, hook := range w.Hooks {
+			if hook.Event != event.name {
+				continue
+			}
+			if hook.Status == event.status.Key ||
+				(hook.Category == event.status.Category && category(previous) != category(next)) {
+				actions = append(actions, hook.Action)
+			}
+		}
+	}
+	return actions
+}
+
+// CompletedAt runs the hooks of a status change on the completion time of a
+// task and returns the new one
+func (w *Workflow) CompletedAt(from, to string, completedAt *time.Time, now time.Time) *time.Time {
+	for _, action := range w.Actions(from, to) {
+		switch action {
+		case ActionSetCompletedAt:
+			completedAt = &now
+		case ActionClearCompletedAt:
+			completedAt = nil
+		}
+	}
+	return completedAt
+}
@@ -0,0 +1,128 @@
+package workflow
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// review requires tasks to go through review before being done
+func review() *Workflow {
+	return &Workflow{
+		Statuses: []Status{
+			{Key: "todo", Name: "To do", Category: CategoryTodo},
+			{Key: "doing", Name: "Doing", Category: CategoryInProgress},
+			{Key: "review", Name: "In review", Category: CategoryInProgress},
+			{Key: "done", Name: "Done", Category: CategoryDone},
+			{Key: "wontfix", Name: "Won't fix", Category: CategoryDone},
+		},
+		Initial: "todo",
+		Transitions: []Transition{
+			{From: "todo", To: "doing"},
+			{From: "doing", To: "review"},
+			{From: "review", To: "doing"},
+			{From: "review", To: "done"},
+			{From: Any, To: "wontfix"},
+		},
+		Hooks: []Hook{
+			{Event: EventEnter, Category: CategoryDone, Action: ActionSetCompletedAt},
+			{Event: EventLeave, Category: CategoryDone, Action: ActionClearCompletedAt},
+		},
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("Default workflow is invalid: %v", err)
+	}
+	if err := review().Validate(); err != nil {
+		t.Fatalf("Review workflow is invalid: %v", err)
+	}
+}
+
+func TestValidateRejectsInconsistentWorkflows(t *testing.T) {
+	cases := map[string]func(w *Workflow){
+		"no status":         func(w *Workflow) { w.Statuses = nil },
+		"duplicate status":  func(w *Workflow) { w.Statuses[1].Key = "todo" },
+		"invalid key":       func(w *Workflow) { w.Statuses[0].Key = "To Do" },
+		"unknown category":  func(w *Workflow) { w.Statuses[0].Category = "backlog" },
+		"no done status":    func(w *Workflow) { w.Statuses = w.Statuses[:3] },
+		"unknown initial":   func(w *Workflow) { w.Initial = "" },
+		"unknown target":    func(w *Workflow) { w.Transitions[0].To = "blocked" },
+		"unknown source":    func(w *Workflow) { w.Transitions[0].From = "blocked" },
+		"hook without goal": func(w *Workflow) { w.Hooks[0].Category = "" },
+		"unknown action":    func(w *Workflow) { w.Hooks[0].Action = "notify" },
+	}
+
+	for name, change := range cases {
+		w := review()
+		change(w)
+		if err := w.Validate(); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	w := review()
+
+	if status, err := w.Create(""); err != nil || status != "todo" {
+		t.Errorf("Expected the initial status, got %q, %v", status, err)
+	}
+	if status, err := w.Create("review"); err != nil || status != "review" {
+		t.Errorf("Expected the given status, got %q, %v", status, err)
+	}
+
+	_, err := w.Create("archived")
+	var workflowErr *Error
+	if !errors.As(err, &workflowErr) || len(workflowErr.Allowed) != 5 {
+		t.Errorf("Expected an error listing the statuses, got %v", err)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	w := review()
+
+	for _, allowed := range [][2]string{{"todo", "doing"}, {"review", "done"}, {"done", "wontfix"}, {"done", "done"}, {"legacy", "todo"}} {
+		if err := w.Transition(allowed[0], allowed[1]); err != nil {
+			t.Errorf("Expected %s to %s to be allowed: %v", allowed[0], allowed[1], err)
+		}
+	}
+
+	err := w.Transition("todo", "done")
+	var workflowErr *Error
+	if !errors.As(err, &workflowErr) {
+		t.Fatalf("Expected todo to done to be rejected, got %v", err)
+	}
+	if !reflect.DeepEqual(workflowErr.Allowed, []string{"doing", "wontfix"}) {
+		t.Errorf("Unexpected allowed statuses %v", workflowErr.Allowed)
+	}
+	if err.Error() != `cannot move a task from "todo" to "done", allowed statuses are doing, wontfix` {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+
+	if err := w.Transition("todo", ""); err == nil {
+		t.Error("Expected an empty status to be rejected")
+	}
+}
+
+func TestCompletedAt(t *testing.T) {
+	w := review()
+	now := time.Date(2026, time.June, 1, 10, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+
+	if completedAt := w.CompletedAt("review", "done", nil, now); completedAt == nil || !completedAt.Equal(now) {
+		t.Errorf("Expected entering done to set the completion time, got %v", completedAt)
+	}
+	if completedAt := w.CompletedAt("done", "doing", &earlier, now); completedAt != nil {
+		t.Errorf("Expected leaving done to clear the completion time, got %v", completedAt)
+	}
+	// Moving between two done statuses keeps the completion time
+	if completedAt := w.CompletedAt("done", "wontfix", &earlier, now); completedAt != &earlier {
+		t.Errorf("Expected the completion time to be kept, got %v", completedAt)
+	}
+	if completedAt := w.CompletedAt("", "todo", nil, now); completedAt != nil {
+		t.Errorf("Expected no completion time for a new task, got %v", completedAt)
+	}
+}
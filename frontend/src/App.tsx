@@ -10,6 +10,7 @@ import CreateTaskPage from './pages/CreateTaskPage';
 import EditTaskPage from './pages/EditTaskPage';
 import TaskDetailPage from './pages/TaskDetailPage';
 import ProfilePage from './pages/ProfilePage';
+import DevicePage from './pages/DevicePage';
 import NotFoundPage from './pages/NotFoundPage';
 
 // Components
@@ -32,6 +33,7 @@ function App() {
             <Route path="/tasks/:id" element={<TaskDetailPage />} />
             <Route path="/tasks/:id/edit" element={<EditTaskPage />} />
             <Route path="/profile" element={<ProfilePage />} />
+            <Route path="/device" element={<DevicePage />} />
           </Route>
           
           {/* Route 404 */}
@@ -0,0 +1,122 @@
+import { useEffect, useState } from 'react';
+import { useSearchParams } from 'react-router-dom';
+import Layout from '../components/layout/Layout';
+import api from '../services/api';
+
+interface DeviceAuthorization {
+  user_code: string;
+  client_id: string;
+  expires_at: string;
+}
+
+const DevicePage = () => {
+  const [searchParams] = useSearchParams();
+  const [userCode, setUserCode] = useState(searchParams.get('user_code') || '');
+  const [authorization, setAuthorization] = useState<DeviceAuthorization | null>(null);
+  const [loading, setLoading] = useState(false);
+  const [message, setMessage] = useState('');
+  const [error, setError] = useState('');
+
+  const lookup = async (code: string) => {
+    setLoading(true);
+    setError('');
+    setMessage('');
+    setAuthorization(null);
+
+    try {
+      const response = await api.get('/api/device', { params: { user_code: code } });
+      setAuthorization(response.data.device_authorization);
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Code invalide ou expiré');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    const code = searchParams.get('user_code');
+    if (code) {
+      lookup(code);
+    }
+  }, [searchParams]);
+
+  const decide = async (approve: boolean) => {
+    if (!authorization) return;
+
+    setLoading(true);
+    setError('');
+
+    try {
+      await api.post('/api/device/approve', { user_code: authorization.user_code, approve });
+      setMessage(approve
+        ? 'Appareil autorisé, vous pouvez retourner dans votre terminal.'
+        : 'Connexion refusée.');
+      setAuthorization(null);
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Une erreur est survenue');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <Layout>
+      <div className="max-w-md mx-auto py-8">
+        <h1 className="text-3xl font-bold mb-8">Connecter un appareil</h1>
+
+        <div className="card">
+          {message && (
+            <div className="bg-green-100 border border-green-400 text-green-700 px-4 py-3 rounded mb-4">
+              {message}
+            </div>
+          )}
+
+          {error && (
+            <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded mb-4">
+              {error}
+            </div>
+          )}
+
+          {authorization ? (
+            <div>
+              <p className="mb-4">
+                L'application <strong>{authorization.client_id}</strong> demande l'accès à votre compte
+                avec le code <strong>{authorization.user_code}</strong>.
+              </p>
+              <div className="flex justify-end space-x-2">
+                <button className="btn-secondary" onClick={() => decide(false)} disabled={loading}>
+                  Refuser
+                </button>
+                <button className="btn-primary" onClick={() => decide(true)} disabled={loading}>
+                  Autoriser
+                </button>
+              </div>
+            </div>
+          ) : (
+            <form onSubmit={(e) => { e.preventDefault(); lookup(userCode); }}>
+              <div className="mb-6">
+                <label htmlFor="user_code" className="block text-gray-700 mb-2">Code affiché dans le terminal</label>
+                <input
+                  type="text"
+                  id="user_code"
+                  className="form-input uppercase"
+                  placeholder="XXXX-XXXX"
+                  value={userCode}
+                  onChange={(e) => setUserCode(e.target.value)}
+                  disabled={loading}
+                />
+              </div>
+              <div className="flex justify-end">
+                <button type="submit" className="btn-primary" disabled={loading || !userCode}>
+                  {loading ? 'Chargement...' : 'Continuer'}
+                </button>
+              </div>
+            </form>
+          )}
+        </div>
+      </div>
+    </Layout>
+  );
+};
+
+export default DevicePage;
@@ -15,6 +15,11 @@ export interface User {
   id: number;
   email: string;
   name: string;
+  timezone?: string;
+  locale?: string;
+  avatar_url?: string;
+  date_format?: string;
+  preferences?: Record<string, unknown>;
   created_at: string;
   updated_at: string;
 }
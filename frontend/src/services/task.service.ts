@@ -27,9 +27,15 @@ export interface UpdateTaskRequest {
 
 const TaskService = {
   getAllTasks: async (): Promise<Task[]> => {
-    const response = await api.get('/tasks');
-    // Adapter la réponse au format attendu
-    return response.data.tasks || [];
+    // La liste est paginée : suivre les curseurs jusqu'à la dernière page
+    const tasks: Task[] = [];
+    let cursor: string | undefined;
+    do {
+      const response = await api.get('/tasks', { params: { limit: 200, cursor } });
+      tasks.push(...(response.data.tasks || []));
+      cursor = response.data.next_cursor;
+    } while (cursor);
+    return tasks;
   },
 
   getTaskById: async (id: number): Promise<Task> => {